@@ -2,6 +2,7 @@ package basicauth
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
@@ -73,7 +74,10 @@ func ParseAuthHeader(auths []string, typeWanted, realmWanted string) (string, st
 
 			switch strings.ToLower(data[0]) {
 			case "basic":
-				cred := strings.Split(decoded, ":")
+				cred := strings.SplitN(decoded, ":", 2)
+				if len(cred) != 2 {
+					return "", "", errors.New("invalid credentials format")
+				}
 				return cred[0], cred[1], nil
 			case "password":
 				return "", decoded, nil
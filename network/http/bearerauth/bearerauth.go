@@ -0,0 +1,39 @@
+// Package bearerauth contains methods to deal with the Bearer authentication
+// scheme (RFC 6750)
+package bearerauth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SetWWWAuthenticate set an auth error to the response
+func SetWWWAuthenticate(res http.ResponseWriter, realm string) {
+	authStr := "Bearer"
+	if realm != "" {
+		authStr = fmt.Sprintf(`Bearer realm="%s"`, realm)
+	}
+	res.Header().Set("WWW-Authenticate", authStr)
+}
+
+// ParseAuthHeader returns the first bearer token found in a list of
+// Auth header. An empty string is returned if no tokens are found. Example:
+//
+//	Bearer mF_9.B5f-4.1JqM
+func ParseAuthHeader(auths []string) string {
+	for _, auth := range auths {
+		data := strings.Fields(auth)
+		if len(data) != 2 {
+			continue
+		}
+
+		// The scheme is case-insensitive
+		if strings.ToLower(data[0]) != "bearer" {
+			continue
+		}
+		return data[1]
+	}
+
+	return ""
+}
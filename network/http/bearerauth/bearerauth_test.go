@@ -0,0 +1,70 @@
+package bearerauth_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Nivl/go-rest-tools/network/http/bearerauth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAuthHeader(t *testing.T) {
+	cases := []struct {
+		description   string
+		headers       []string
+		expectedToken string
+	}{
+		{
+			description:   "valid bearer",
+			headers:       []string{"Bearer mF_9.B5f-4.1JqM"},
+			expectedToken: "mF_9.B5f-4.1JqM",
+		},
+		{
+			description:   "lowercase scheme",
+			headers:       []string{"bearer mF_9.B5f-4.1JqM"},
+			expectedToken: "mF_9.B5f-4.1JqM",
+		},
+		{
+			description: "valid bearer in a list",
+			headers: []string{
+				"basic dXNlcjpwYXNzd29yZA==",
+				"Bearer mF_9.B5f-4.1JqM",
+			},
+			expectedToken: "mF_9.B5f-4.1JqM",
+		},
+		{
+			description:   "wrong scheme",
+			headers:       []string{"basic dXNlcjpwYXNzd29yZA=="},
+			expectedToken: "",
+		},
+		{
+			description:   "missing token",
+			headers:       []string{"Bearer"},
+			expectedToken: "",
+		},
+		{
+			description:   "too many params",
+			headers:       []string{"Bearer mF_9.B5f-4.1JqM extra"},
+			expectedToken: "",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+			token := bearerauth.ParseAuthHeader(tc.headers)
+			assert.Equal(t, tc.expectedToken, token)
+		})
+	}
+}
+
+func TestSetWWWAuthenticate(t *testing.T) {
+	rec := httptest.NewRecorder()
+	bearerauth.SetWWWAuthenticate(rec, "api")
+	assert.Equal(t, `Bearer realm="api"`, rec.Header().Get("WWW-Authenticate"))
+
+	rec = httptest.NewRecorder()
+	bearerauth.SetWWWAuthenticate(rec, "")
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+}
@@ -0,0 +1,350 @@
+package paginator
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Nivl/go-rest-tools/types/apperror"
+)
+
+const (
+	// ErrMsgInvalidCursor represents the error message corresponding to
+	// a cursor that cannot be decoded or that has been tampered with
+	ErrMsgInvalidCursor = "invalid cursor"
+
+	// DefaultMaxLimit represents the default maximum number of elements
+	// a cursor page can contain
+	DefaultMaxLimit = 100
+)
+
+// ErrInvalidCursor is returned when a cursor cannot be decoded
+var ErrInvalidCursor = errors.New(ErrMsgInvalidCursor)
+
+// ErrNoSecret is returned when a CursorCodec is created without secret.
+// The cursors could otherwise be forged by anyone
+var ErrNoSecret = errors.New("no secret provided")
+
+// SortKey represents a column used to sort a list.
+// The last key of a list should be unique (like an ID) to make sure
+// two rows never have the same position
+type SortKey struct {
+	// Column is the SQL column (or expression) to sort on.
+	// It is added to the SQL queries as is, and must therefore never
+	// come from the user
+	Column string
+
+	// Desc is set to true to sort in descending order
+	Desc bool
+}
+
+// Cursor represents a position in a list
+type Cursor struct {
+	// Values contains the values of the sort keys of the row the cursor
+	// is pointing to
+	Values []interface{} `json:"v"`
+
+	// Backward is set to true if the cursor is used to fetch the rows
+	// before the row it is pointing to
+	Backward bool `json:"b,omitempty"`
+
+	// Sort contains the sort keys the cursor has been created for
+	Sort string `json:"s"`
+}
+
+// CursorCodec encodes and decodes opaque cursors.
+// The cursors are signed to prevent the clients from crafting
+// or modifying them
+type CursorCodec struct {
+	secret []byte
+}
+
+// NewCursorCodec returns a CursorCodec that signs the cursors with
+// the provided secret. ErrNoSecret is returned if the secret is empty
+func NewCursorCodec(secret []byte) (*CursorCodec, error) {
+	if len(secret) == 0 {
+		return nil, ErrNoSecret
+	}
+	return &CursorCodec{secret: secret}, nil
+}
+
+// Encode returns the opaque token of a cursor. ErrNoSecret is returned
+// if the codec has not been created using NewCursorCodec()
+func (c *CursorCodec) Encode(cur *Cursor) (string, error) {
+	if c == nil || len(c.secret) == 0 {
+		return "", ErrNoSecret
+	}
+	payload, err := json.Marshal(cur)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(c.sign(encoded)), nil
+}
+
+// Decode returns the cursor matching an opaque token.
+// ErrInvalidCursor is returned if the token is invalid or if its
+// signature does not match, and ErrNoSecret if the codec has not been
+// created using NewCursorCodec()
+func (c *CursorCodec) Decode(token string) (*Cursor, error) {
+	if c == nil || len(c.secret) == 0 {
+		return nil, ErrNoSecret
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, c.sign(parts[0])) {
+		return nil, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	// We use json.Number to not lose any precision on the numbers
+	cur := &Cursor{}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err := dec.Decode(cur); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return cur, nil
+}
+
+// sign returns the signature of the provided data
+func (c *CursorCodec) sign(data string) []byte {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// CursorHandlerParams represents the params needed to handle a cursor
+// pagination
+type CursorHandlerParams struct {
+	// Cursor represents the opaque cursor of the page to fetch.
+	// An empty cursor returns the first page
+	Cursor string `from:"query" json:"cursor" params:"trim"`
+
+	// Limit represents the maximum number of element we want per page
+	Limit int `from:"query" json:"limit" default:"100"`
+}
+
+// IsValid checks if a cursor paginator is Valid
+func (params *CursorHandlerParams) IsValid() (isValid bool, fieldName string, err error) {
+	if params.Limit <= 0 {
+		return false, "limit", errors.New(ErrMsgNumberBelow1)
+	}
+	if params.Limit > DefaultMaxLimit {
+		return false, "limit", fmt.Errorf("cannot be > %d", DefaultMaxLimit)
+	}
+	return true, "", nil
+}
+
+// CursorPaginator returns a CursorPaginator from a CursorHandlerParams.
+// A bad request is returned if the cursor is invalid or if it has not
+// been created for the same sort keys, and a server error if the codec
+// has not been created using NewCursorCodec()
+func (params CursorHandlerParams) CursorPaginator(codec *CursorCodec, keys ...SortKey) (*CursorPaginator, error) {
+	p := NewCursorPaginator(codec, params.Limit, keys...)
+	if params.Cursor == "" {
+		return p, nil
+	}
+
+	cur, err := codec.Decode(params.Cursor)
+	if err == ErrNoSecret {
+		return nil, apperror.Wrap(err, apperror.Internal, "", "could not decode the cursor")
+	}
+	if err != nil || cur.Sort != p.sort() || len(cur.Values) != len(keys) {
+		return nil, apperror.NewBadRequest("cursor", "%s", ErrMsgInvalidCursor)
+	}
+	p.cursor = cur
+	return p, nil
+}
+
+// CursorPaginator represents a keyset pagination
+type CursorPaginator struct {
+	codec  *CursorCodec
+	keys   []SortKey
+	cursor *Cursor
+	limit  int
+}
+
+// NewCursorPaginator creates a new CursorPaginator that returns the first
+// page of a list sorted using the provided keys
+func NewCursorPaginator(codec *CursorCodec, limit int, keys ...SortKey) *CursorPaginator {
+	return &CursorPaginator{
+		codec: codec,
+		keys:  keys,
+		limit: limit,
+	}
+}
+
+// Cursor returns the cursor of the current page. Nil is returned for the
+// first page
+func (p *CursorPaginator) Cursor() *Cursor {
+	return p.cursor
+}
+
+// Limit returns the maximum number of element a page contains
+func (p *CursorPaginator) Limit() int {
+	return p.limit
+}
+
+// QueryLimit returns a valid SQL limit value.
+// One extra row is fetched to know if there's another page
+func (p *CursorPaginator) QueryLimit() int {
+	return p.limit + 1
+}
+
+// Where returns the SQL condition that filters the rows of the current page,
+// and the values to use with it. The placeholders starts at
+// $(argOffset+1). An empty condition is returned for the first page.
+//
+// Example with created_at DESC, id DESC:
+// (created_at < $1 OR (created_at = $1 AND id < $2))
+func (p *CursorPaginator) Where(argOffset int) (string, []interface{}) {
+	if p.cursor == nil {
+		return "", nil
+	}
+
+	conditions := make([]string, len(p.keys))
+	for i, key := range p.keys {
+		parts := make([]string, 0, i+1)
+		for j := 0; j < i; j++ {
+			parts = append(parts, fmt.Sprintf("%s = $%d", p.keys[j].Column, argOffset+j+1))
+		}
+		parts = append(parts, fmt.Sprintf("%s %s $%d", key.Column, p.operator(key), argOffset+i+1))
+
+		conditions[i] = strings.Join(parts, " AND ")
+		if len(parts) > 1 {
+			conditions[i] = "(" + conditions[i] + ")"
+		}
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")", p.cursor.Values
+}
+
+// OrderBy returns the SQL ORDER BY clause (without the ORDER BY keywords)
+// to use to fetch the rows of the current page
+func (p *CursorPaginator) OrderBy() string {
+	orders := make([]string, len(p.keys))
+	for i, key := range p.keys {
+		desc := key.Desc
+		if p.isBackward() {
+			desc = !desc
+		}
+		order := "ASC"
+		if desc {
+			order = "DESC"
+		}
+		orders[i] = key.Column + " " + order
+	}
+	return strings.Join(orders, ", ")
+}
+
+// CursorPage contains the cursors to navigate around a page
+type CursorPage struct {
+	// Next contains the cursor of the next page. Empty if there are no
+	// next page
+	Next string `json:"next,omitempty"`
+
+	// Prev contains the cursor of the previous page. Empty if there are no
+	// previous page
+	Prev string `json:"prev,omitempty"`
+}
+
+// Page trims the extra row fetched using QueryLimit(), puts the rows
+// back in the right order, and returns the cursors of the next and
+// previous pages.
+// items is a pointer to the slice of rows returned by the SQL query, and
+// values returns the values of the sort keys of the row at the index i
+// of the trimmed slice
+func (p *CursorPaginator) Page(items interface{}, values func(i int) []interface{}) (*CursorPage, error) {
+	ptr := reflect.ValueOf(items)
+	if ptr.Kind() != reflect.Ptr || ptr.Elem().Kind() != reflect.Slice {
+		return nil, apperror.NewServerError("items must be a pointer to a slice, got %T", items)
+	}
+	slice := ptr.Elem()
+
+	hasMore := slice.Len() > p.limit
+	if hasMore {
+		slice.Set(slice.Slice(0, p.limit))
+	}
+	// when going backward the rows are sorted in the reverse order
+	if p.isBackward() {
+		swap := reflect.Swapper(slice.Interface())
+		for i, j := 0, slice.Len()-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	page := &CursorPage{}
+	if slice.Len() == 0 {
+		return page, nil
+	}
+
+	hasNext := hasMore
+	hasPrev := p.cursor != nil
+	if p.isBackward() {
+		hasNext = true
+		hasPrev = hasMore
+	}
+
+	var err error
+	if hasNext {
+		page.Next, err = p.encode(values(slice.Len()-1), false)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if hasPrev {
+		page.Prev, err = p.encode(values(0), true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// encode returns a cursor pointing to the row having the provided values
+func (p *CursorPaginator) encode(values []interface{}, backward bool) (string, error) {
+	return p.codec.Encode(&Cursor{
+		Values:   values,
+		Backward: backward,
+		Sort:     p.sort(),
+	})
+}
+
+// operator returns the SQL comparison operator to use for the given key
+func (p *CursorPaginator) operator(key SortKey) string {
+	if key.Desc != p.isBackward() {
+		return "<"
+	}
+	return ">"
+}
+
+// isBackward returns true if the current page is before the cursor
+func (p *CursorPaginator) isBackward() bool {
+	return p.cursor != nil && p.cursor.Backward
+}
+
+// sort returns a string representation of the sort keys
+func (p *CursorPaginator) sort() string {
+	keys := make([]string, len(p.keys))
+	for i, key := range p.keys {
+		keys[i] = key.Column
+		if key.Desc {
+			keys[i] += " DESC"
+		}
+	}
+	return strings.Join(keys, ",")
+}
@@ -0,0 +1,224 @@
+package paginator_test
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/Nivl/go-params"
+	"github.com/Nivl/go-rest-tools/paginator"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var feedKeys = []paginator.SortKey{
+	{Column: "created_at", Desc: true},
+	{Column: "id"},
+}
+
+type feedItem struct {
+	ID        string
+	CreatedAt int
+}
+
+func feedValues(items []feedItem) func(int) []interface{} {
+	return func(i int) []interface{} {
+		return []interface{}{items[i].CreatedAt, items[i].ID}
+	}
+}
+
+// newCursorCodec returns a CursorCodec using the provided secret
+func newCursorCodec(t *testing.T, secret string) *paginator.CursorCodec {
+	codec, err := paginator.NewCursorCodec([]byte(secret))
+	require.NoError(t, err, "NewCursorCodec() should have succeed")
+	return codec
+}
+
+func TestNewCursorCodecNoSecret(t *testing.T) {
+	t.Parallel()
+
+	_, err := paginator.NewCursorCodec(nil)
+	assert.Equal(t, paginator.ErrNoSecret, err)
+	_, err = paginator.NewCursorCodec([]byte{})
+	assert.Equal(t, paginator.ErrNoSecret, err)
+
+	_, err = (&paginator.CursorCodec{}).Encode(&paginator.Cursor{Sort: "id"})
+	assert.Equal(t, paginator.ErrNoSecret, err, "a zero codec should not sign cursors")
+
+	var nilCodec *paginator.CursorCodec
+	_, err = nilCodec.Encode(&paginator.Cursor{Sort: "id"})
+	assert.Equal(t, paginator.ErrNoSecret, err, "a nil codec should not sign cursors")
+	_, err = nilCodec.Decode("cursor.signature")
+	assert.Equal(t, paginator.ErrNoSecret, err, "a nil codec should not decode cursors")
+
+	params := paginator.CursorHandlerParams{Cursor: "cursor.signature", Limit: 10}
+	_, err = params.CursorPaginator(nil, feedKeys...)
+	assert.True(t, apperror.IsInternalServerError(err), "expected an Internal error")
+}
+
+func TestCursorCodec(t *testing.T) {
+	t.Parallel()
+
+	codec := newCursorCodec(t, "secret")
+	token, err := codec.Encode(&paginator.Cursor{Values: []interface{}{12, "a"}, Sort: "id"})
+	require.NoError(t, err)
+
+	cur, err := codec.Decode(token)
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{json.Number("12"), "a"}, cur.Values)
+	assert.Equal(t, "id", cur.Sort)
+	assert.False(t, cur.Backward)
+
+	_, err = newCursorCodec(t, "other").Decode(token)
+	assert.Equal(t, paginator.ErrInvalidCursor, err, "a cursor signed with another secret should fail")
+
+	parts := strings.Split(token, ".")
+	forged, err := json.Marshal(&paginator.Cursor{Values: []interface{}{0, "z"}, Sort: "id"})
+	require.NoError(t, err)
+	_, err = codec.Decode(strings.Replace(token, parts[0], string(forged), 1))
+	assert.Equal(t, paginator.ErrInvalidCursor, err, "a modified cursor should fail")
+
+	_, err = codec.Decode("nope")
+	assert.Equal(t, paginator.ErrInvalidCursor, err)
+}
+
+func TestCursorWhereAndOrder(t *testing.T) {
+	codec := newCursorCodec(t, "secret")
+	forward, err := codec.Encode(&paginator.Cursor{Values: []interface{}{10, "b"}, Sort: "created_at DESC,id"})
+	require.NoError(t, err)
+	backward, err := codec.Encode(&paginator.Cursor{Values: []interface{}{10, "b"}, Sort: "created_at DESC,id", Backward: true})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		description   string
+		cursor        string
+		expectedWhere string
+		expectedOrder string
+	}{
+		{"first page", "", "", "created_at DESC, id ASC"},
+		{
+			"forward",
+			forward,
+			"(created_at < $3 OR (created_at = $3 AND id > $4))",
+			"created_at DESC, id ASC",
+		},
+		{
+			"backward",
+			backward,
+			"(created_at > $3 OR (created_at = $3 AND id < $4))",
+			"created_at ASC, id DESC",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			params := paginator.CursorHandlerParams{Cursor: tc.cursor, Limit: 10}
+			p, err := params.CursorPaginator(codec, feedKeys...)
+			require.NoError(t, err)
+
+			where, args := p.Where(2)
+			assert.Equal(t, tc.expectedWhere, where)
+			if tc.cursor != "" {
+				assert.Len(t, args, 2)
+			}
+			assert.Equal(t, tc.expectedOrder, p.OrderBy())
+			assert.Equal(t, 11, p.QueryLimit())
+		})
+	}
+}
+
+func TestCursorPaginatorInvalidCursor(t *testing.T) {
+	t.Parallel()
+
+	codec := newCursorCodec(t, "secret")
+	otherSort, err := codec.Encode(&paginator.Cursor{Values: []interface{}{"b"}, Sort: "id"})
+	require.NoError(t, err)
+
+	for _, cursor := range []string{"nope", otherSort} {
+		params := paginator.CursorHandlerParams{Cursor: cursor, Limit: 10}
+		_, err := params.CursorPaginator(codec, feedKeys...)
+		require.Error(t, err)
+		assert.True(t, apperror.IsBadRequest(err))
+		assert.Equal(t, "cursor", apperror.Convert(err).Field())
+	}
+}
+
+func TestCursorPage(t *testing.T) {
+	t.Parallel()
+
+	codec := newCursorCodec(t, "secret")
+	all := []feedItem{{"a", 5}, {"b", 4}, {"c", 3}, {"d", 2}, {"e", 1}}
+
+	// first page: the query returned limit+1 rows
+	first := paginator.NewCursorPaginator(codec, 2, feedKeys...)
+	items := append([]feedItem{}, all[:3]...)
+	page, err := first.Page(&items, feedValues(items))
+	require.NoError(t, err)
+	assert.Equal(t, all[:2], items, "the extra row should have been removed")
+	assert.Empty(t, page.Prev, "the first page has no previous page")
+	require.NotEmpty(t, page.Next)
+
+	// second page
+	p, err := paginator.CursorHandlerParams{Cursor: page.Next, Limit: 2}.CursorPaginator(codec, feedKeys...)
+	require.NoError(t, err)
+	_, args := p.Where(0)
+	assert.Equal(t, []interface{}{json.Number("4"), "b"}, args)
+	items = append([]feedItem{}, all[2:5]...)
+	page, err = p.Page(&items, feedValues(items))
+	require.NoError(t, err)
+	assert.Equal(t, all[2:4], items)
+	require.NotEmpty(t, page.Prev)
+	require.NotEmpty(t, page.Next)
+
+	// back to the first page: the rows are returned in the reverse order
+	p, err = paginator.CursorHandlerParams{Cursor: page.Prev, Limit: 2}.CursorPaginator(codec, feedKeys...)
+	require.NoError(t, err)
+	items = []feedItem{all[1], all[0]}
+	page, err = p.Page(&items, feedValues(items))
+	require.NoError(t, err)
+	assert.Equal(t, all[:2], items, "the rows should be put back in order")
+	assert.Empty(t, page.Prev, "no more rows before the first one")
+	assert.NotEmpty(t, page.Next)
+
+	_, err = p.Page(items, feedValues(items))
+	assert.Error(t, err, "a non pointer should fail")
+}
+
+func TestCursorHandlerParams(t *testing.T) {
+	type strct struct {
+		paginator.CursorHandlerParams
+	}
+
+	testCases := []struct {
+		description   string
+		params        url.Values
+		expectedField string
+		expectedLimit int
+	}{
+		{"Default values", url.Values{}, "", 100},
+		{"Limit 20", url.Values{"limit": []string{"20"}}, "", 20},
+		{"limit set to 0 should fail", url.Values{"limit": []string{"0"}}, "limit", 0},
+		{"limit above 100 should fail", url.Values{"limit": []string{"101"}}, "limit", 0},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+			s := &strct{}
+			err := params.New(s).Parse(map[string]url.Values{"query": tc.params}, nil)
+			if tc.expectedField != "" {
+				require.Error(t, err)
+				assert.Equal(t, tc.expectedField, apperror.Convert(apperror.NewFromError(err)).Field())
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, tc.expectedLimit, s.Limit)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ package mockrequest
 
 import (
 	context "context"
+	io "io"
 	reflect "reflect"
 
 	go_logger "github.com/Nivl/go-logger"
@@ -38,6 +39,42 @@ func (m *MockRequest) EXPECT() *MockRequestMockRecorder {
 	return m.recorder
 }
 
+// APIKey mocks base method
+func (m *MockRequest) APIKey() *auth.APIKey {
+	ret := m.ctrl.Call(m, "APIKey")
+	ret0, _ := ret[0].(*auth.APIKey)
+	return ret0
+}
+
+// APIKey indicates an expected call of APIKey
+func (mr *MockRequestMockRecorder) APIKey() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "APIKey", reflect.TypeOf((*MockRequest)(nil).APIKey))
+}
+
+// Body mocks base method
+func (m *MockRequest) Body() io.ReadCloser {
+	ret := m.ctrl.Call(m, "Body")
+	ret0, _ := ret[0].(io.ReadCloser)
+	return ret0
+}
+
+// Body indicates an expected call of Body
+func (mr *MockRequestMockRecorder) Body() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Body", reflect.TypeOf((*MockRequest)(nil).Body))
+}
+
+// ClientIP mocks base method
+func (m *MockRequest) ClientIP() string {
+	ret := m.ctrl.Call(m, "ClientIP")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// ClientIP indicates an expected call of ClientIP
+func (mr *MockRequestMockRecorder) ClientIP() *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClientIP", reflect.TypeOf((*MockRequest)(nil).ClientIP))
+}
+
 // Context mocks base method
 func (m *MockRequest) Context() context.Context {
 	ret := m.ctrl.Call(m, "Context")
@@ -122,6 +159,16 @@ func (mr *MockRequestMockRecorder) Session() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Session", reflect.TypeOf((*MockRequest)(nil).Session))
 }
 
+// SetAPIKey mocks base method
+func (m *MockRequest) SetAPIKey(arg0 *auth.APIKey) {
+	m.ctrl.Call(m, "SetAPIKey", arg0)
+}
+
+// SetAPIKey indicates an expected call of SetAPIKey
+func (mr *MockRequestMockRecorder) SetAPIKey(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetAPIKey", reflect.TypeOf((*MockRequest)(nil).SetAPIKey), arg0)
+}
+
 // SetSession mocks base method
 func (m *MockRequest) SetSession(arg0 *auth.Session) {
 	m.ctrl.Call(m, "SetSession", arg0)
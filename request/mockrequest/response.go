@@ -5,6 +5,7 @@
 package mockrequest
 
 import (
+	paginator "github.com/Nivl/go-rest-tools/paginator"
 	gomock "github.com/golang/mock/gomock"
 	http "net/http"
 	reflect "reflect"
@@ -78,3 +79,25 @@ func (m *MockResponse) Ok(arg0 interface{}) error {
 func (mr *MockResponseMockRecorder) Ok(arg0 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ok", reflect.TypeOf((*MockResponse)(nil).Ok), arg0)
 }
+
+// Paginated mocks base method
+func (m *MockResponse) Paginated(arg0 interface{}, arg1 *paginator.Paginator, arg2 *int) error {
+	ret := m.ctrl.Call(m, "Paginated", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Paginated indicates an expected call of Paginated
+func (mr *MockResponseMockRecorder) Paginated(arg0, arg1, arg2 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Paginated", reflect.TypeOf((*MockResponse)(nil).Paginated), arg0, arg1, arg2)
+}
+
+// Redirect mocks base method
+func (m *MockResponse) Redirect(arg0 string) {
+	m.ctrl.Call(m, "Redirect", arg0)
+}
+
+// Redirect indicates an expected call of Redirect
+func (mr *MockResponseMockRecorder) Redirect(arg0 interface{}) *gomock.Call {
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Redirect", reflect.TypeOf((*MockResponse)(nil).Redirect), arg0)
+}
@@ -24,3 +24,13 @@ func (mr *MockResponseMockRecorder) OkSuccess(typ interface{}, runnable interfac
 	}
 	return createdCall
 }
+
+// PaginatedSuccess is a helper that expects a valid Paginated response
+func (mr *MockResponseMockRecorder) PaginatedSuccess(typ interface{}, runnable interface{}) *gomock.Call {
+	paginatedCall := mr.Paginated(matcher.Interface(typ), gomock.Any(), gomock.Any())
+	paginatedCall.Return(nil)
+	if runnable != nil {
+		paginatedCall.Do(runnable)
+	}
+	return paginatedCall
+}
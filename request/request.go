@@ -2,6 +2,7 @@ package request
 
 import (
 	"context"
+	"io"
 
 	logger "github.com/Nivl/go-logger"
 	reporter "github.com/Nivl/go-reporter"
@@ -44,6 +45,21 @@ type Request interface {
 	// SetSession sets the session object that was used to make the request
 	SetSession(*auth.Session)
 
+	// APIKey returns the API key used to make the request. When set, the
+	// user is the owner of the key, and the session is nil
+	APIKey() *auth.APIKey
+
+	// SetAPIKey sets the API key that was used to make the request
+	SetAPIKey(*auth.APIKey)
+
 	// Context returns the context of the request
 	Context() context.Context
+
+	// ClientIP returns the IP address of the client that made the request
+	ClientIP() string
+
+	// Body returns the raw body of the request. The body is only available
+	// for the streaming endpoints, since it's otherwise consumed to parse
+	// the params
+	Body() io.ReadCloser
 }
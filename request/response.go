@@ -1,6 +1,10 @@
 package request
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/Nivl/go-rest-tools/paginator"
+)
 
 // Response represents the response of a request
 //go:generate mockgen -destination mockrequest/response.go -package mockrequest github.com/Nivl/go-rest-tools/request Response
@@ -11,9 +15,16 @@ type Response interface {
 	// NoContent sends a response with no content
 	NoContent()
 
+	// Redirect sends a response redirecting the client to the provided URL
+	Redirect(url string)
+
 	// Created sends a response with a newly created entity attached
 	Created(obj interface{}) error
 
 	// Created sends response with a JSON object attached
 	Ok(obj interface{}) error
+
+	// Paginated sends a response with a page of a list attached.
+	// total is the total number of elements of the list, and can be nil
+	Paginated(obj interface{}, p *paginator.Paginator, total *int) error
 }
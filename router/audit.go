@@ -0,0 +1,81 @@
+package router
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/router/audit"
+)
+
+// statusRecorder is a http.ResponseWriter that keeps the status code
+// sent to the client
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader sends the status code to the client
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// Write writes data to the body of the response
+func (w *statusRecorder) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+// Flush sends the buffered data to the client, if the underlying
+// writer supports it
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+		f.Flush()
+	}
+}
+
+// Hijack lets the caller take over the connection, if the underlying
+// writer supports it
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying writer. It is used by
+// http.ResponseController to reach the features of the writer
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// statusCode returns the status code sent to the client
+func (w *statusRecorder) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// audit records the request using the auditor. The errors are only
+// reported since the response has already been sent
+func (req *HTTPRequest) audit(a *audit.Auditor, endpoint string, w *statusRecorder, startedAt time.Time) {
+	if err := a.Record(req, endpoint, w.statusCode(), startedAt); err != nil {
+		if req.Reporter() != nil {
+			req.Reporter().ReportError(err)
+		}
+		if req.Logger() != nil {
+			req.Logger().Errorf(`could not audit the request: "%s", %s`, err.Error(), req)
+		}
+	}
+}
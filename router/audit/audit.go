@@ -0,0 +1,219 @@
+// Package audit contains the tools used to keep a record of the actions
+// made by the clients: who did what, when, and with which outcome
+package audit
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/request"
+	"github.com/Nivl/go-types/datetime"
+	uuid "github.com/satori/go.uuid"
+)
+
+// RedactedValue is the value recorded in place of a redacted param
+const RedactedValue = "[REDACTED]"
+
+// DefaultRedactedFields contains the params that are redacted by default
+var DefaultRedactedFields = []string{
+	"password",
+	"current_password",
+	"new_password",
+	"token",
+	"refresh_token",
+	"access_token",
+	"api_key",
+	"secret",
+	"client_secret",
+	"code",
+	"recovery_code",
+}
+
+// DefaultRedactedSuffixes contains the suffixes of the params that are
+// redacted by default (ex. id_token, webhook_secret)
+var DefaultRedactedSuffixes = []string{
+	"_token",
+	"_secret",
+	"_password",
+}
+
+// Entry represents an action made by a client
+type Entry struct {
+	ID        string `db:"id" json:"id"`
+	RequestID string `db:"request_id" json:"request_id"`
+
+	// Endpoint contains the signature of the endpoint (ex. POST /users/{id})
+	Endpoint string `db:"endpoint" json:"endpoint"`
+
+	// UserID is empty if the client was not authenticated
+	UserID string `db:"user_id" json:"user_id,omitempty"`
+
+	// SessionHash contains the hash of the ID of the session used by the
+	// client. The ID itself is not recorded since it's a credential
+	SessionHash string `db:"session_hash" json:"session_hash,omitempty"`
+
+	APIKeyID string `db:"api_key_id" json:"api_key_id,omitempty"`
+	ClientIP string `db:"client_ip" json:"client_ip"`
+
+	// Params contains the params of the request, once redacted. It's
+	// empty if the request failed before the params were parsed
+	Params Params `db:"params" json:"params,omitempty"`
+
+	// StatusCode contains the HTTP status code sent to the client
+	StatusCode int `db:"status_code" json:"status_code"`
+
+	StartedAt  *datetime.DateTime `db:"started_at" json:"started_at"`
+	FinishedAt *datetime.DateTime `db:"finished_at" json:"finished_at"`
+}
+
+// Params represents the params of a request
+type Params map[string]interface{}
+
+// Value returns the params as JSON, to be stored in the database
+func (p Params) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+	return json.Marshal(p)
+}
+
+// Scan parses the params stored in the database
+func (p *Params) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*p = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	}
+	return errors.New("unsupported type for audit params")
+}
+
+// Sink represents a storage where the entries are written
+type Sink interface {
+	// Write persists an entry
+	Write(e *Entry) error
+}
+
+// Auditor creates the entries of the requests and writes them to a Sink
+type Auditor struct {
+	// Sink is where the entries are written
+	Sink Sink
+
+	// RedactedFields contains the names of the params whose value should
+	// not be recorded. The comparison is case insensitive, and applies
+	// to the nested fields
+	RedactedFields []string
+
+	// RedactedSuffixes contains the suffixes of the names of the params
+	// whose value should not be recorded. The comparison is case
+	// insensitive, and applies to the nested fields
+	RedactedSuffixes []string
+}
+
+// New returns an Auditor writing to the provided sink and redacting
+// DefaultRedactedFields and DefaultRedactedSuffixes
+func New(sink Sink) *Auditor {
+	return &Auditor{
+		Sink:             sink,
+		RedactedFields:   append([]string{}, DefaultRedactedFields...),
+		RedactedSuffixes: append([]string{}, DefaultRedactedSuffixes...),
+	}
+}
+
+// Record writes the entry of a request that has been handled.
+// endpoint is the signature of the endpoint, and status the HTTP status
+// code sent to the client
+func (a *Auditor) Record(req request.Request, endpoint string, status int, startedAt time.Time) error {
+	e := &Entry{
+		ID:         uuid.NewV4().String(),
+		RequestID:  req.ID(),
+		Endpoint:   endpoint,
+		ClientIP:   req.ClientIP(),
+		StatusCode: status,
+		StartedAt:  &datetime.DateTime{Time: startedAt.UTC()},
+		FinishedAt: datetime.Now(),
+	}
+	if u := req.User(); u != nil {
+		e.UserID = u.ID
+	}
+	if s := req.Session(); s != nil && s.ID != "" {
+		sum := sha256.Sum256([]byte(s.ID))
+		e.SessionHash = hex.EncodeToString(sum[:])
+	}
+	if k := req.APIKey(); k != nil {
+		e.APIKeyID = k.ID
+	}
+
+	params, err := a.Redact(req.Params())
+	if err != nil {
+		return err
+	}
+	e.Params = params
+	return a.Sink.Write(e)
+}
+
+// Redact returns the provided params as a map, with the value of the
+// redacted fields replaced by RedactedValue.
+// The params are expected to be a struct or a map that can be encoded
+// to JSON, the names of the fields are the JSON ones
+func (a *Auditor) Redact(params interface{}) (Params, error) {
+	if params == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	out := Params{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+
+	redact(out, a.isRedacted)
+	return out, nil
+}
+
+// isRedacted returns whether the value of a param should not be recorded
+func (a *Auditor) isRedacted(name string) bool {
+	name = strings.ToLower(name)
+	for _, f := range a.RedactedFields {
+		if name == strings.ToLower(f) {
+			return true
+		}
+	}
+	for _, suffix := range a.RedactedSuffixes {
+		if strings.HasSuffix(name, strings.ToLower(suffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact replaces the value of the redacted fields of a decoded JSON value
+func redact(value interface{}, isRedacted func(string) bool) {
+	switch v := value.(type) {
+	case Params:
+		redact(map[string]interface{}(v), isRedacted)
+	case map[string]interface{}:
+		for key, child := range v {
+			if isRedacted(key) {
+				v[key] = RedactedValue
+				continue
+			}
+			redact(child, isRedacted)
+		}
+	case []interface{}:
+		for _, child := range v {
+			redact(child, isRedacted)
+		}
+	}
+}
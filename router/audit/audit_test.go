@@ -0,0 +1,177 @@
+package audit_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/request/mockrequest"
+	"github.com/Nivl/go-rest-tools/router/audit"
+	"github.com/Nivl/go-rest-tools/security/auth"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memorySink is a Sink that keeps the entries in memory
+type memorySink struct {
+	entries []*audit.Entry
+}
+
+func (s *memorySink) Write(e *audit.Entry) error {
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+type nestedParams struct {
+	Password string `json:"password"`
+}
+
+type testParams struct {
+	Email    string          `json:"email"`
+	Password string          `json:"password"`
+	Code     string          `json:"CODE"`
+	Nested   *nestedParams   `json:"nested"`
+	List     []*nestedParams `json:"list"`
+}
+
+func TestRedact(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		description string
+		fields      []string
+		suffixes    []string
+		params      interface{}
+		expected    audit.Params
+	}{
+		{
+			"nil params",
+			audit.DefaultRedactedFields,
+			audit.DefaultRedactedSuffixes,
+			nil,
+			nil,
+		},
+		{
+			"default fields",
+			audit.DefaultRedactedFields,
+			audit.DefaultRedactedSuffixes,
+			&testParams{
+				Email:    "user@domain.tld",
+				Password: "password",
+				Code:     "123456",
+				Nested:   &nestedParams{Password: "password"},
+				List:     []*nestedParams{{Password: "password"}},
+			},
+			audit.Params{
+				"email":    "user@domain.tld",
+				"password": audit.RedactedValue,
+				"CODE":     audit.RedactedValue,
+				"nested":   map[string]interface{}{"password": audit.RedactedValue},
+				"list":     []interface{}{map[string]interface{}{"password": audit.RedactedValue}},
+			},
+		},
+		{
+			"default credentials",
+			audit.DefaultRedactedFields,
+			audit.DefaultRedactedSuffixes,
+			map[string]string{
+				"refresh_token":  "token",
+				"access_token":   "token",
+				"id_token":       "token",
+				"api_key":        "key",
+				"client_secret":  "secret",
+				"Webhook_Secret": "secret",
+				"recovery_code":  "code",
+				"old_password":   "password",
+				"name":           "name",
+			},
+			audit.Params{
+				"refresh_token":  audit.RedactedValue,
+				"access_token":   audit.RedactedValue,
+				"id_token":       audit.RedactedValue,
+				"api_key":        audit.RedactedValue,
+				"client_secret":  audit.RedactedValue,
+				"Webhook_Secret": audit.RedactedValue,
+				"recovery_code":  audit.RedactedValue,
+				"old_password":   audit.RedactedValue,
+				"name":           "name",
+			},
+		},
+		{
+			"custom fields",
+			[]string{"Email"},
+			nil,
+			map[string]string{"email": "user@domain.tld", "password": "password"},
+			audit.Params{
+				"email":    audit.RedactedValue,
+				"password": "password",
+			},
+		},
+		{
+			"custom suffixes",
+			nil,
+			[]string{"_EMAIL"},
+			map[string]string{"user_email": "user@domain.tld", "password": "password"},
+			audit.Params{
+				"user_email": audit.RedactedValue,
+				"password":   "password",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			a := audit.New(&memorySink{})
+			a.RedactedFields = tc.fields
+			a.RedactedSuffixes = tc.suffixes
+			params, err := a.Redact(tc.params)
+			require.NoError(t, err, "Redact() should have succeed")
+			assert.Equal(t, tc.expected, params)
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	t.Parallel()
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	user := &auth.User{ID: "user-id"}
+	session := &auth.Session{ID: "session-id", UserID: user.ID}
+	req := mockrequest.NewMockRequest(mockCtrl)
+	req.EXPECT().ID().Return("request-id")
+	req.EXPECT().ClientIP().Return("10.0.0.1")
+	req.EXPECT().User().Return(user)
+	req.EXPECT().Session().Return(session)
+	req.EXPECT().APIKey().Return(nil)
+	req.EXPECT().Params().Return(&testParams{Email: "user@domain.tld", Password: "password"})
+
+	sink := &memorySink{}
+	startedAt := time.Now().Add(-time.Second)
+	err := audit.New(sink).Record(req, "POST /sessions", 201, startedAt)
+	require.NoError(t, err, "Record() should have succeed")
+
+	require.Len(t, sink.entries, 1)
+	e := sink.entries[0]
+	assert.NotEmpty(t, e.ID)
+	assert.Equal(t, "request-id", e.RequestID)
+	assert.Equal(t, "POST /sessions", e.Endpoint)
+	assert.Equal(t, "user-id", e.UserID)
+	assert.Empty(t, e.APIKeyID)
+	assert.Equal(t, "10.0.0.1", e.ClientIP)
+	assert.Equal(t, 201, e.StatusCode)
+	assert.Equal(t, "user@domain.tld", e.Params["email"])
+	assert.Equal(t, audit.RedactedValue, e.Params["password"])
+	assert.True(t, e.StartedAt.Time.Equal(startedAt))
+	assert.False(t, e.FinishedAt.Before(e.StartedAt.Time))
+
+	// The session ID should never be recorded as is
+	sum := sha256.Sum256([]byte("session-id"))
+	assert.Equal(t, hex.EncodeToString(sum[:]), e.SessionHash)
+}
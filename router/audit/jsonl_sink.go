@@ -0,0 +1,61 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+var _ Sink = (*JSONLSink)(nil)
+
+// JSONLSink is a Sink that writes the entries as JSON lines
+// (one JSON object per line)
+type JSONLSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewJSONLSink returns a new JSONLSink writing to w
+func NewJSONLSink(w io.Writer) *JSONLSink {
+	return &JSONLSink{
+		w: w,
+	}
+}
+
+// NewJSONLFileSink returns a new JSONLSink appending the entries to
+// the provided file. The file is created if needed, and should be
+// closed using Close()
+func NewJSONLFileSink(path string) (*JSONLSink, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONLSink(f), nil
+}
+
+// Write writes an entry on a new line
+func (s *JSONLSink) Write(e *Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	// The line is written at once so the entries of concurrent requests
+	// don't get mixed
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(line)
+	return err
+}
+
+// Close closes the underlying writer if it can be closed
+func (s *JSONLSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package audit_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Nivl/go-rest-tools/router/audit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONLSinkWrite(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	sink := audit.NewJSONLSink(&buf)
+	require.NoError(t, sink.Write(&audit.Entry{ID: "1", StatusCode: 200}))
+	require.NoError(t, sink.Write(&audit.Entry{ID: "2", StatusCode: 404, Params: audit.Params{"id": "abc"}}))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+
+	e := &audit.Entry{}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), e))
+	assert.Equal(t, "2", e.ID)
+	assert.Equal(t, 404, e.StatusCode)
+	assert.Equal(t, "abc", e.Params["id"])
+}
+
+func TestJSONLFileSink(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	// The entries should be appended to the existing ones
+	for _, id := range []string{"1", "2"} {
+		sink, err := audit.NewJSONLFileSink(path)
+		require.NoError(t, err, "NewJSONLFileSink() should have succeed")
+		require.NoError(t, sink.Write(&audit.Entry{ID: id}))
+		require.NoError(t, sink.Close())
+	}
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+}
@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	db "github.com/Nivl/go-sqldb"
+)
+
+var _ Sink = (*SQLSink)(nil)
+
+// SQLSink is a Sink that writes the entries in a Postgres database.
+// The entries are stored in a table named audit_logs:
+//
+//	CREATE TABLE audit_logs (
+//	  id UUID PRIMARY KEY,
+//	  request_id VARCHAR NOT NULL,
+//	  endpoint VARCHAR NOT NULL,
+//	  user_id VARCHAR NOT NULL,
+//	  session_hash VARCHAR NOT NULL,
+//	  api_key_id VARCHAR NOT NULL,
+//	  client_ip VARCHAR NOT NULL,
+//	  params JSONB,
+//	  status_code INTEGER NOT NULL,
+//	  started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  finished_at TIMESTAMP WITH TIME ZONE NOT NULL
+//	);
+type SQLSink struct {
+	con db.Connection
+}
+
+// NewSQLSink returns a new SQLSink using the provided connection
+func NewSQLSink(con db.Connection) *SQLSink {
+	return &SQLSink{
+		con: con,
+	}
+}
+
+// Write persists an entry in the database
+func (s *SQLSink) Write(e *Entry) error {
+	stmt := `INSERT INTO audit_logs
+		(id, request_id, endpoint, user_id, session_hash, api_key_id, client_ip, params, status_code, started_at, finished_at)
+		VALUES (:id, :request_id, :endpoint, :user_id, :session_hash, :api_key_id, :client_ip, :params, :status_code, :started_at, :finished_at)`
+	_, err := s.con.NamedExec(stmt, e)
+	return apperror.NewFromSQL(err)
+}
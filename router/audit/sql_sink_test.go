@@ -0,0 +1,41 @@
+package audit_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Nivl/go-rest-tools/router/audit"
+	"github.com/Nivl/go-sqldb/implementations/mocksqldb"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLSinkWrite(t *testing.T) {
+	t.Parallel()
+
+	t.Run("valid", func(t *testing.T) {
+		t.Parallel()
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockConnection(mockCtrl)
+		mockDB.QEXPECT().InsertSuccess(&audit.Entry{})
+
+		err := audit.NewSQLSink(mockDB).Write(&audit.Entry{ID: "1"})
+		assert.NoError(t, err, "Write() should have succeed")
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		t.Parallel()
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockConnection(mockCtrl)
+		mockDB.QEXPECT().InsertError(&audit.Entry{}, errors.New("server unreachable"))
+
+		err := audit.NewSQLSink(mockDB).Write(&audit.Entry{ID: "1"})
+		assert.Error(t, err, "Write() should have failed")
+	})
+}
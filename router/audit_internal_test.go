@@ -0,0 +1,26 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatusRecorderFeatures(t *testing.T) {
+	t.Parallel()
+
+	rec := httptest.NewRecorder()
+	w := &statusRecorder{ResponseWriter: rec}
+
+	w.Flush()
+	assert.True(t, rec.Flushed, "the flush should have been forwarded")
+	assert.Equal(t, http.StatusOK, w.statusCode())
+
+	// httptest.ResponseRecorder cannot be hijacked
+	_, _, err := w.Hijack()
+	assert.Equal(t, http.ErrNotSupported, err)
+
+	assert.Equal(t, rec, w.Unwrap())
+}
@@ -0,0 +1,114 @@
+package router_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Nivl/go-rest-tools/request"
+	"github.com/Nivl/go-rest-tools/router"
+	"github.com/Nivl/go-rest-tools/router/audit"
+	"github.com/Nivl/go-rest-tools/router/guard"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memorySink is an audit.Sink that keeps the entries in memory
+type memorySink struct {
+	entries []*audit.Entry
+}
+
+func (s *memorySink) Write(e *audit.Entry) error {
+	s.entries = append(s.entries, e)
+	return nil
+}
+
+type auditParams struct {
+	Email    string `from:"form" json:"email" params:"required"`
+	Password string `from:"form" json:"password"`
+}
+
+func TestAudit(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		description    string
+		audit          bool
+		guard          *guard.Guard
+		body           string
+		expectedStatus int
+	}{
+		{
+			"audited endpoint",
+			true,
+			&guard.Guard{ParamStruct: &auditParams{}},
+			"email=user@domain.tld&password=password",
+			http.StatusNoContent,
+		},
+		{
+			"invalid params",
+			true,
+			&guard.Guard{ParamStruct: &auditParams{}},
+			"password=password",
+			http.StatusBadRequest,
+		},
+		{
+			"guard failure",
+			true,
+			&guard.Guard{Auth: guard.LoggedUserAccess},
+			"",
+			http.StatusUnauthorized,
+		},
+		{
+			"endpoint not audited",
+			false,
+			nil,
+			"",
+			http.StatusNoContent,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			e := &router.Endpoint{
+				Verb:  "POST",
+				Path:  "/sessions",
+				Audit: tc.audit,
+				Guard: tc.guard,
+				Handler: func(req request.Request) error {
+					req.Response().NoContent()
+					return nil
+				},
+			}
+			sink := &memorySink{}
+			r := mux.NewRouter()
+			router.Endpoints{e}.Activate(r, &testDeps{}, router.WithAuditor(audit.New(sink)))
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/sessions?token=secret", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			r.ServeHTTP(rec, req)
+			require.Equal(t, tc.expectedStatus, rec.Code)
+
+			if !tc.audit {
+				assert.Empty(t, sink.entries)
+				return
+			}
+			require.Len(t, sink.entries, 1)
+			entry := sink.entries[0]
+			assert.Equal(t, tc.expectedStatus, entry.StatusCode)
+			// the query string should not leak in the endpoint
+			assert.Equal(t, "POST /sessions", entry.Endpoint)
+			assert.NotEmpty(t, entry.RequestID)
+			if tc.expectedStatus == http.StatusNoContent {
+				assert.Equal(t, "user@domain.tld", entry.Params["email"])
+				assert.Equal(t, audit.RedactedValue, entry.Params["password"])
+			}
+		})
+	}
+}
@@ -0,0 +1,214 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Nivl/go-rest-tools/network/http/basicauth"
+	"github.com/Nivl/go-rest-tools/network/http/bearerauth"
+	"github.com/Nivl/go-rest-tools/security/auth"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+)
+
+// Identity represents the client that made a request
+type Identity struct {
+	// User is the user that made the request
+	User *auth.User
+
+	// Session is the session used to make the request
+	Session *auth.Session
+
+	// APIKey is the API key used to make the request. A request is made
+	// either with a session or with an API key
+	APIKey *auth.APIKey
+}
+
+// Authenticator represents a strategy used to find out who made a request
+type Authenticator interface {
+	// Authenticate returns the identity of the client that made the request.
+	// A nil identity (with no error) means that the request is anonymous.
+	// An error is returned if credentials are provided but are invalid.
+	Authenticate(req *http.Request, deps Dependencies) (*Identity, error)
+}
+
+// Authenticators is a list of Authenticator that are tried one after
+// the other. The first authenticator returning an identity or an error wins
+type Authenticators []Authenticator
+
+// Authenticate returns the identity found by the first Authenticator of the
+// list that recognizes the request
+func (auths Authenticators) Authenticate(req *http.Request, deps Dependencies) (*Identity, error) {
+	for _, a := range auths {
+		identity, err := a.Authenticate(req, deps)
+		if err != nil || identity != nil {
+			return identity, err
+		}
+	}
+	return nil, nil
+}
+
+// SessionAuthenticator is an Authenticator that uses the basic auth scheme
+// to retrieve a session. The username is the ID of the user, and the
+// password is the ID of the session. Example:
+//
+//	Authorization: basic base64(userID:sessionID)
+type SessionAuthenticator struct{}
+
+// Authenticate returns the identity attached to the session provided in
+// the Authorization header
+func (a SessionAuthenticator) Authenticate(req *http.Request, deps Dependencies) (*Identity, error) {
+	headers, found := req.Header["Authorization"]
+	if !found {
+		return nil, nil
+	}
+
+	userID, sessionID, err := basicauth.ParseAuthHeader(headers, "basic", "")
+	if err != nil {
+		return nil, apperror.NewBadRequest("Authorization", "invalid format")
+	}
+	if userID == "" || sessionID == "" {
+		return nil, nil
+	}
+
+	session, err := auth.GetSessionByID(deps.DB(), sessionID)
+	if err != nil {
+		if apperror.IsNotFound(err) {
+			err = apperror.NewNotFoundField("Authorization", "session not found")
+		}
+		return nil, err
+	}
+	if session.UserID != userID || session.IsExpired() {
+		return nil, apperror.NewNotFoundField("Authorization", "session not found")
+	}
+	return identityFromSession(session, deps)
+}
+
+// APIKeyHeader is the header that can be used to send an API key
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyAuthenticator is an Authenticator that uses an API key sent in
+// the X-API-Key header, or using the ApiKey auth scheme. Example:
+//
+//	X-API-Key: key
+//	Authorization: ApiKey key
+type APIKeyAuthenticator struct{}
+
+// Authenticate returns the identity attached to the provided API key
+func (a APIKeyAuthenticator) Authenticate(req *http.Request, deps Dependencies) (*Identity, error) {
+	key := req.Header.Get(APIKeyHeader)
+	if key == "" {
+		for _, header := range req.Header["Authorization"] {
+			data := strings.Fields(header)
+			// The scheme is case-insensitive
+			if len(data) == 2 && strings.ToLower(data[0]) == "apikey" {
+				key = data[1]
+				break
+			}
+		}
+	}
+	if key == "" {
+		return nil, nil
+	}
+
+	apiKey, err := auth.AuthenticateAPIKey(deps.DB(), key)
+	if err != nil {
+		return nil, err
+	}
+	user, err := auth.GetUserByID(deps.DB(), apiKey.UserID)
+	if err != nil {
+		if apperror.IsNotFound(err) {
+			err = apperror.NewUnauthorizedR(auth.ErrMsgInvalidAPIKey)
+		}
+		return nil, err
+	}
+	if err := user.LoadPermissions(deps.DB()); err != nil {
+		return nil, err
+	}
+	return &Identity{User: user, APIKey: apiKey}, nil
+}
+
+// TokenResolver represents a function used to retrieve an identity
+// from a bearer token
+type TokenResolver func(token string, deps Dependencies) (*Identity, error)
+
+// BearerAuthenticator is an Authenticator that uses the bearer auth
+// scheme. Example:
+//
+//	Authorization: Bearer token
+type BearerAuthenticator struct {
+	// Resolve is used to retrieve an identity from a token.
+	// Default to SessionTokenResolver
+	Resolve TokenResolver
+}
+
+// Authenticate returns the identity matching the token provided in the
+// Authorization header
+func (a BearerAuthenticator) Authenticate(req *http.Request, deps Dependencies) (*Identity, error) {
+	headers, found := req.Header["Authorization"]
+	if !found {
+		return nil, nil
+	}
+
+	token := bearerauth.ParseAuthHeader(headers)
+	if token == "" {
+		return nil, nil
+	}
+
+	resolve := a.Resolve
+	if resolve == nil {
+		resolve = SessionTokenResolver
+	}
+	return resolve(token, deps)
+}
+
+// SessionTokenResolver is a TokenResolver that uses the token as a
+// session ID
+func SessionTokenResolver(token string, deps Dependencies) (*Identity, error) {
+	session, err := auth.GetSessionByID(deps.DB(), token)
+	if err != nil {
+		if apperror.IsNotFound(err) {
+			err = apperror.NewNotFoundField("Authorization", "session not found")
+		}
+		return nil, err
+	}
+	if session.IsExpired() {
+		return nil, apperror.NewNotFoundField("Authorization", "session not found")
+	}
+	return identityFromSession(session, deps)
+}
+
+// AccessTokenResolver returns a TokenResolver that validates the access
+// tokens issued by the provided TokenIssuer.
+// The identity is built from the claims of the token, so no database
+// queries are made. This also means that a revoked session will stay usable
+// until its access token expires
+func AccessTokenResolver(issuer *auth.TokenIssuer) TokenResolver {
+	return func(token string, deps Dependencies) (*Identity, error) {
+		claims, err := issuer.ParseAccessToken(token)
+		if err != nil {
+			return nil, err
+		}
+		return &Identity{User: claims.User(), Session: claims.Session()}, nil
+	}
+}
+
+// identityFromSession returns the identity attached to a valid session
+func identityFromSession(session *auth.Session, deps Dependencies) (*Identity, error) {
+	// we get the user and make sure it (still) exists
+	user, err := auth.GetUserByID(deps.DB(), session.UserID)
+	if err != nil {
+		if apperror.IsNotFound(err) {
+			err = apperror.NewNotFoundField("Authorization", "session not found")
+		}
+		return nil, err
+	}
+	if err := user.LoadPermissions(deps.DB()); err != nil {
+		return nil, err
+	}
+
+	// The session is being used, so we slide its idle timeout
+	if err := session.Touch(deps.DB()); err != nil {
+		return nil, err
+	}
+	return &Identity{User: user, Session: session}, nil
+}
@@ -0,0 +1,151 @@
+package router_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Nivl/go-rest-tools/request"
+	"github.com/Nivl/go-rest-tools/router"
+	"github.com/Nivl/go-rest-tools/router/guard"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bodyParams struct {
+	Name string `from:"form" json:"name"`
+	Dir  string `from:"query" json:"dir"`
+}
+
+// newBodyRouter returns a router containing a single endpoint that
+// writes back the name sent in the body
+func newBodyRouter(e *router.Endpoint, opts ...router.Option) *mux.Router {
+	e.Verb = "POST"
+	e.Path = "/items"
+	if e.Guard == nil {
+		e.Guard = &guard.Guard{ParamStruct: &bodyParams{}}
+	}
+	if e.Handler == nil {
+		e.Handler = func(req request.Request) error {
+			params := req.Params().(*bodyParams)
+			req.Response().Ok(params.Name)
+			return nil
+		}
+	}
+
+	r := mux.NewRouter()
+	router.Endpoints{e}.Activate(r, &testDeps{}, opts...)
+	return r
+}
+
+// unsizedReader hides the length of the body so the request is sent
+// without a Content-Length
+type unsizedReader struct {
+	r *strings.Reader
+}
+
+func (r *unsizedReader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+func TestMaxBodySize(t *testing.T) {
+	t.Parallel()
+
+	body := `{"name":"` + strings.Repeat("a", 100) + `"}`
+
+	testCases := []struct {
+		description  string
+		endpointSize int64
+		unsized      bool
+		opts         []router.Option
+		expectedCode int
+	}{
+		{"under the limit", 0, false, nil, http.StatusOK},
+		{"content-length over the global limit", 0, false, []router.Option{router.WithMaxBodySize(10)}, http.StatusRequestEntityTooLarge},
+		{"streamed body over the global limit", 0, true, []router.Option{router.WithMaxBodySize(10)}, http.StatusRequestEntityTooLarge},
+		{"endpoint limit lower than the global one", 10, false, nil, http.StatusRequestEntityTooLarge},
+		{"endpoint limit higher than the global one", 1000, false, []router.Option{router.WithMaxBodySize(10)}, http.StatusOK},
+		{"endpoint without limit", -1, true, []router.Option{router.WithMaxBodySize(10)}, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			r := newBodyRouter(&router.Endpoint{MaxBodySize: tc.endpointSize}, tc.opts...)
+
+			req := httptest.NewRequest("POST", "/items", strings.NewReader(body))
+			if tc.unsized {
+				req = httptest.NewRequest("POST", "/items", &unsizedReader{strings.NewReader(body)})
+				req.ContentLength = -1
+			}
+			req.Header.Set("Content-Type", "application/json")
+			rec := httptest.NewRecorder()
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedCode, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestMultipartBody(t *testing.T) {
+	t.Parallel()
+
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	require.NoError(t, w.WriteField("name", "my name"))
+	file, err := w.CreateFormFile("file", "file.txt")
+	require.NoError(t, err)
+	_, err = file.Write(bytes.Repeat([]byte("a"), 1024))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	// a small amount of memory forces the file to be stored on disk
+	r := newBodyRouter(&router.Endpoint{MultipartMemory: 10})
+
+	req := httptest.NewRequest("POST", "/items", body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	assert.Equal(t, `"my name"`, strings.TrimSpace(rec.Body.String()))
+}
+
+func TestStreamingBody(t *testing.T) {
+	t.Parallel()
+
+	var received []byte
+	var params *bodyParams
+	e := &router.Endpoint{
+		Streaming: true,
+		Handler: func(req request.Request) error {
+			var err error
+			received, err = ioutil.ReadAll(req.Body())
+			if err != nil {
+				return err
+			}
+			params = req.Params().(*bodyParams)
+			req.Response().NoContent()
+			return nil
+		},
+	}
+	r := newBodyRouter(e)
+
+	req := httptest.NewRequest("POST", "/items?dir=uploads", strings.NewReader(`{"name":"not parsed"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+	assert.Equal(t, `{"name":"not parsed"}`, string(received))
+	require.NotNil(t, params)
+	assert.Equal(t, "uploads", params.Dir)
+	assert.Empty(t, params.Name)
+}
@@ -0,0 +1,126 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// CBOR major types
+const (
+	cborUint   = 0 << 5
+	cborNegInt = 1 << 5
+	cborBytes  = 2 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+	cborTag    = 6 << 5
+	cborSimple = 7 << 5
+)
+
+// CBOR is an Encoder that writes data using the CBOR format (RFC 7049).
+// The data are written using their JSON representation
+type CBOR struct{}
+
+// MediaType returns the media type of the encoded data
+func (CBOR) MediaType() string {
+	return "application/cbor"
+}
+
+// ContentType returns the value of the Content-Type header
+func (CBOR) ContentType() string {
+	return "application/cbor"
+}
+
+// Encode writes the CBOR encoding of v to w
+func (CBOR) Encode(w io.Writer, v interface{}) error {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+
+	buf := []byte{}
+	buf, err = appendCBOR(buf, generic)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// appendCBOR appends the CBOR encoding of v to buf
+func appendCBOR(buf []byte, v interface{}) ([]byte, error) {
+	switch value := v.(type) {
+	case nil:
+		return append(buf, cborSimple|22), nil
+	case bool:
+		if value {
+			return append(buf, cborSimple|21), nil
+		}
+		return append(buf, cborSimple|20), nil
+	case json.Number:
+		if i, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+			if i < 0 {
+				return appendCBORHeader(buf, cborNegInt, uint64(-(i + 1))), nil
+			}
+			return appendCBORHeader(buf, cborUint, uint64(i)), nil
+		}
+		if u, err := strconv.ParseUint(string(value), 10, 64); err == nil {
+			return appendCBORHeader(buf, cborUint, u), nil
+		}
+		f, err := value.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendUint(append(buf, cborSimple|27), math.Float64bits(f), 8), nil
+	case string:
+		buf = appendCBORHeader(buf, cborText, uint64(len(value)))
+		return append(buf, value...), nil
+	case []interface{}:
+		buf = appendCBORHeader(buf, cborArray, uint64(len(value)))
+		var err error
+		for _, item := range value {
+			if buf, err = appendCBOR(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]interface{}:
+		buf = appendCBORHeader(buf, cborMap, uint64(len(value)))
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var err error
+		for _, k := range keys {
+			if buf, err = appendCBOR(buf, k); err != nil {
+				return nil, err
+			}
+			if buf, err = appendCBOR(buf, value[k]); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	return nil, fmt.Errorf("codec: unsupported type %T", v)
+}
+
+// appendCBORHeader appends the header of a data item of the given
+// major type, with n as argument
+func appendCBORHeader(buf []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(buf, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(buf, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return appendUint(append(buf, major|25), n, 2)
+	case n <= math.MaxUint32:
+		return appendUint(append(buf, major|26), n, 4)
+	}
+	return appendUint(append(buf, major|27), n, 8)
+}
@@ -0,0 +1,157 @@
+package codec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+)
+
+// Decode reads the CBOR map contained in r and returns its fields.
+// The numbers are returned as json.Number. Indefinite-length items
+// are not supported
+func (CBOR) Decode(r io.Reader) (map[string]interface{}, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	d := &binaryDecoder{data: data}
+	v, err := d.cbor(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, ErrInvalidPayload
+	}
+	return asObject(v)
+}
+
+// cbor decodes the next CBOR value
+func (d *binaryDecoder) cbor(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, ErrInvalidPayload
+	}
+
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	major := b[0] & 0xe0
+	info := b[0] & 0x1f
+
+	// floats and simple values use the additional info differently
+	if major == cborSimple {
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		case 25:
+			u, err := d.uint(2)
+			if err != nil {
+				return nil, err
+			}
+			return floatNumber(halfToFloat(uint16(u)))
+		case 26:
+			u, err := d.uint(4)
+			if err != nil {
+				return nil, err
+			}
+			return floatNumber(float64(math.Float32frombits(uint32(u))))
+		case 27:
+			u, err := d.uint(8)
+			if err != nil {
+				return nil, err
+			}
+			return floatNumber(math.Float64frombits(u))
+		}
+		return nil, fmt.Errorf("codec: unsupported CBOR simple value %d", info)
+	}
+
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info <= 27:
+		if n, err = d.uint(1 << (info - 24)); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("codec: unsupported CBOR additional info %d", info)
+	}
+
+	switch major {
+	case cborUint:
+		return json.Number(strconv.FormatUint(n, 10)), nil
+	case cborNegInt:
+		if n > math.MaxInt64 {
+			return nil, ErrInvalidPayload
+		}
+		return intNumber(-1 - int64(n)), nil
+	case cborBytes, cborText:
+		return d.str(n)
+	case cborArray:
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, ErrInvalidPayload
+		}
+		array := make([]interface{}, 0, n)
+		for i := uint64(0); i < n; i++ {
+			v, err := d.cbor(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, v)
+		}
+		return array, nil
+	case cborMap:
+		if n > uint64(len(d.data)-d.pos) {
+			return nil, ErrInvalidPayload
+		}
+		obj := make(map[string]interface{}, n)
+		for i := uint64(0); i < n; i++ {
+			k, err := d.cbor(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.cbor(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			obj[fmt.Sprint(k)] = v
+		}
+		return obj, nil
+	case cborTag:
+		// the tags are ignored and we only keep the tagged value
+		return d.cbor(depth + 1)
+	}
+	return nil, ErrInvalidPayload
+}
+
+// halfToFloat converts a IEEE 754 half-precision float to a float64
+func halfToFloat(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			return sign * math.Inf(1)
+		}
+		return math.NaN()
+	}
+	return sign * math.Ldexp(mant+1024, exp-25)
+}
@@ -0,0 +1,159 @@
+// Package codec contains the encoders used to write the responses in
+// the format asked by the clients
+package codec
+
+import (
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// Encoder represents a type that can write data using a specific format
+type Encoder interface {
+	// MediaType returns the media type of the encoded data.
+	// Ex. application/json
+	MediaType() string
+
+	// ContentType returns the value of the Content-Type header to use
+	// when sending encoded data. Ex. application/json; charset=utf-8
+	ContentType() string
+
+	// Encode writes the encoding of v to w
+	Encode(w io.Writer, v interface{}) error
+}
+
+// Registry contains a list of encoders and selects the right one
+// for a request
+type Registry struct {
+	encoders []Encoder
+}
+
+// NewRegistry returns a registry containing the provided encoders.
+// The first encoder is used by default, when a client accepts any format
+func NewRegistry(encoders ...Encoder) *Registry {
+	return &Registry{encoders: encoders}
+}
+
+// DefaultRegistry returns a registry that only contains the JSON encoder
+func DefaultRegistry() *Registry {
+	return NewRegistry(JSON{})
+}
+
+// Default returns the default encoder of the registry
+func (r *Registry) Default() Encoder {
+	if len(r.encoders) == 0 {
+		return JSON{}
+	}
+	return r.encoders[0]
+}
+
+// Negotiate returns the encoder that best matches the provided Accept
+// header. The default encoder is returned if the header is empty.
+// false is returned if no encoders can be used
+func (r *Registry) Negotiate(accept string) (Encoder, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return r.Default(), true
+	}
+
+	ranges := parseAccept(accept)
+	var best Encoder
+	var bestRange acceptRange
+	for _, enc := range r.encoders {
+		mediaRange, found := rangeOf(ranges, enc.MediaType())
+		if !found || mediaRange.q <= 0 {
+			continue
+		}
+		if best == nil || mediaRange.isPreferredTo(bestRange) {
+			best = enc
+			bestRange = mediaRange
+		}
+	}
+	return best, best != nil
+}
+
+// acceptRange represents a media range of an Accept header
+type acceptRange struct {
+	mediaType string
+	q         float64
+	// specificity is used to sort the ranges having the same q:
+	// 0 for */*, 1 for type/*, 2 for type/subtype
+	specificity int
+	position    int
+}
+
+// matches checks if the range accepts the provided media type
+func (r acceptRange) matches(mediaType string) bool {
+	switch r.specificity {
+	case 0:
+		return true
+	case 1:
+		return strings.HasPrefix(mediaType, strings.TrimSuffix(r.mediaType, "*"))
+	}
+	return r.mediaType == mediaType
+}
+
+// isPreferredTo checks if the range has been given a higher preference
+// than other by the client
+func (r acceptRange) isPreferredTo(other acceptRange) bool {
+	if r.q != other.q {
+		return r.q > other.q
+	}
+	if r.specificity != other.specificity {
+		return r.specificity > other.specificity
+	}
+	return r.position < other.position
+}
+
+// rangeOf returns the most specific range matching the provided media
+// type, which is the one defining its q (RFC 7231, section 5.3.2).
+// This allows a range with q=0 to exclude a media type matched by a
+// wildcard, ex. "*/*, application/json;q=0"
+func rangeOf(ranges []acceptRange, mediaType string) (acceptRange, bool) {
+	var match acceptRange
+	found := false
+	for _, r := range ranges {
+		if !r.matches(mediaType) {
+			continue
+		}
+		if !found || r.specificity > match.specificity {
+			match = r
+			found = true
+		}
+	}
+	return match, found
+}
+
+// parseAccept parses an Accept header and returns its ranges, in the
+// order of the header. The ranges having q=0 are kept since they
+// exclude the media types they match
+func parseAccept(accept string) []acceptRange {
+	ranges := []acceptRange{}
+	for i, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		r := acceptRange{
+			mediaType:   mediaType,
+			q:           1,
+			specificity: 2,
+			position:    i,
+		}
+		if q, found := params["q"]; found {
+			if r.q, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+
+		switch {
+		case mediaType == "*/*":
+			r.specificity = 0
+		case strings.HasSuffix(mediaType, "/*"):
+			r.specificity = 1
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges
+}
@@ -0,0 +1,131 @@
+package codec_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Nivl/go-rest-tools/router/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	registry := codec.NewRegistry(codec.JSON{}, codec.MsgPack{}, codec.CBOR{}, codec.XML{})
+
+	testCases := []struct {
+		description string
+		accept      string
+		expected    string
+		acceptable  bool
+	}{
+		{"no header", "", "application/json", true},
+		{"any", "*/*", "application/json", true},
+		{"exact match", "application/cbor", "application/cbor", true},
+		{"first preferred", "application/msgpack, application/xml", "application/msgpack", true},
+		{"highest q wins", "application/xml;q=0.5, application/cbor;q=0.9", "application/cbor", true},
+		{"specific before wildcard", "*/*, application/xml", "application/xml", true},
+		{"type wildcard", "text/html, application/*;q=0.8", "application/json", true},
+		{"q=0 is excluded", "application/json;q=0, application/msgpack;q=0.1", "application/msgpack", true},
+		{"q=0 excludes from a wildcard", "*/*, application/json;q=0", "application/msgpack", true},
+		{"q=0 excludes from a type wildcard", "application/*, application/json;q=0, application/msgpack;q=0", "application/cbor", true},
+		{"specific q wins over a wildcard", "*/*;q=0.5, application/json;q=0.1", "application/msgpack", true},
+		{"everything excluded", "*/*;q=0", "", false},
+		{"unsupported", "text/html", "", false},
+		{"invalid ranges are ignored", "nope;;, application/xml", "application/xml", true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			enc, acceptable := registry.Negotiate(tc.accept)
+			require.Equal(t, tc.acceptable, acceptable)
+			if tc.acceptable {
+				assert.Equal(t, tc.expected, enc.MediaType())
+			}
+		})
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	t.Parallel()
+
+	_, acceptable := codec.DefaultRegistry().Negotiate("application/xml")
+	assert.False(t, acceptable, "only JSON should be enabled by default")
+
+	enc, acceptable := codec.DefaultRegistry().Negotiate("application/json")
+	assert.True(t, acceptable)
+	assert.Equal(t, codec.JSON{}, enc)
+}
+
+type item struct {
+	A int           `json:"a"`
+	B []interface{} `json:"b"`
+	C string        `json:"c"`
+}
+
+func TestEncoders(t *testing.T) {
+	value := &item{A: 1, B: []interface{}{true, nil}, C: "x"}
+
+	testCases := []struct {
+		description string
+		encoder     codec.Encoder
+		value       interface{}
+		expected    []byte
+	}{
+		{
+			"msgpack struct",
+			codec.MsgPack{},
+			value,
+			[]byte{0x83, 0xa1, 'a', 0x01, 0xa1, 'b', 0x92, 0xc3, 0xc0, 0xa1, 'c', 0xa1, 'x'},
+		},
+		{
+			"msgpack numbers",
+			codec.MsgPack{},
+			[]interface{}{-1, 300, -200, 1.5},
+			[]byte{0x94, 0xff, 0xcd, 0x01, 0x2c, 0xd1, 0xff, 0x38, 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			"cbor struct",
+			codec.CBOR{},
+			value,
+			[]byte{0xa3, 0x61, 'a', 0x01, 0x61, 'b', 0x82, 0xf5, 0xf6, 0x61, 'c', 0x61, 'x'},
+		},
+		{
+			"cbor numbers",
+			codec.CBOR{},
+			[]interface{}{-1, 300, -200, 1.5},
+			[]byte{0x84, 0x20, 0x19, 0x01, 0x2c, 0x38, 0xc7, 0xfb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0},
+		},
+		{
+			"xml",
+			codec.XML{},
+			value,
+			[]byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<response><a>1</a><b><item>true</item><item></item></b><c>x</c></response>"),
+		},
+		{
+			"xml invalid names",
+			codec.XML{},
+			map[string]interface{}{"1st": 1, "a b": "<x>", "xmlns": "x", "ok-name": true},
+			[]byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<response><item key=\"1st\">1</item><item key=\"a b\">&lt;x&gt;</item><ok-name>true</ok-name><item key=\"xmlns\">x</item></response>"),
+		},
+		{
+			"json",
+			codec.JSON{},
+			value,
+			[]byte(`{"a":1,"b":[true,null],"c":"x"}` + "\n"),
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			require.NoError(t, tc.encoder.Encode(&buf, tc.value))
+			assert.Equal(t, tc.expected, buf.Bytes())
+		})
+	}
+}
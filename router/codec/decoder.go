@@ -0,0 +1,85 @@
+package codec
+
+import (
+	"errors"
+	"io"
+)
+
+// maxDepth is the maximum number of nested arrays and maps a body
+// can contain
+const maxDepth = 100
+
+var (
+	// ErrInvalidPayload is returned when a body cannot be decoded
+	ErrInvalidPayload = errors.New("invalid payload")
+
+	// ErrNotAnObject is returned when the top level value of a body
+	// is not an object
+	ErrNotAnObject = errors.New("payload is not an object")
+)
+
+// Decoder represents a type that can read a request body sent using a
+// specific format
+type Decoder interface {
+	// MediaType returns the media type of the data the decoder can read.
+	// Ex. application/json
+	MediaType() string
+
+	// Decode reads the object contained in r and returns its fields.
+	// An empty body returns an empty map
+	Decode(r io.Reader) (map[string]interface{}, error)
+}
+
+// DecoderRegistry contains a list of decoders indexed by media type
+type DecoderRegistry struct {
+	decoders map[string]Decoder
+}
+
+// NewDecoderRegistry returns a registry containing the provided decoders
+func NewDecoderRegistry(decoders ...Decoder) *DecoderRegistry {
+	r := &DecoderRegistry{
+		decoders: make(map[string]Decoder, len(decoders)),
+	}
+	for _, dec := range decoders {
+		r.decoders[dec.MediaType()] = dec
+	}
+	return r
+}
+
+// DefaultDecoderRegistry returns a registry that contains all the
+// decoders of the package
+func DefaultDecoderRegistry() *DecoderRegistry {
+	return NewDecoderRegistry(JSON{}, MergePatchJSON{}, MsgPack{}, CBOR{}, XML{})
+}
+
+// Lookup returns the decoder of the provided media type
+func (r *DecoderRegistry) Lookup(mediaType string) (Decoder, bool) {
+	dec, found := r.decoders[mediaType]
+	return dec, found
+}
+
+// MergePatchJSON is a Decoder that reads JSON merge patch documents
+// (RFC 7396)
+type MergePatchJSON struct{}
+
+// MediaType returns the media type of the data the decoder can read
+func (MergePatchJSON) MediaType() string {
+	return "application/merge-patch+json"
+}
+
+// Decode reads the patch contained in r and returns its fields
+func (MergePatchJSON) Decode(r io.Reader) (map[string]interface{}, error) {
+	return JSON{}.Decode(r)
+}
+
+// asObject returns v as an object
+func asObject(v interface{}) (map[string]interface{}, error) {
+	if v == nil {
+		return map[string]interface{}{}, nil
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, ErrNotAnObject
+	}
+	return obj, nil
+}
@@ -0,0 +1,137 @@
+package codec_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/Nivl/go-rest-tools/router/codec"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type payload struct {
+	Name  string        `json:"name"`
+	Age   int           `json:"age"`
+	Score float64       `json:"score"`
+	Tags  []string      `json:"tags"`
+	Extra interface{}   `json:"extra"`
+	Nums  []interface{} `json:"nums"`
+}
+
+func TestDecodersRoundTrip(t *testing.T) {
+	value := &payload{
+		Name:  "John",
+		Age:   42,
+		Score: 1.5,
+		Tags:  []string{"a", "b"},
+		Nums:  []interface{}{-1, -200, 70000, 5000000000},
+	}
+	expected := map[string]interface{}{
+		"name":  "John",
+		"age":   json.Number("42"),
+		"score": json.Number("1.5"),
+		"tags":  []interface{}{"a", "b"},
+		"extra": nil,
+		"nums":  []interface{}{json.Number("-1"), json.Number("-200"), json.Number("70000"), json.Number("5000000000")},
+	}
+
+	testCases := []struct {
+		description string
+		codec       interface {
+			codec.Encoder
+			codec.Decoder
+		}
+	}{
+		{"msgpack", codec.MsgPack{}},
+		{"cbor", codec.CBOR{}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+			require.NoError(t, tc.codec.Encode(&buf, value))
+			vars, err := tc.codec.Decode(&buf)
+			require.NoError(t, err)
+			assert.Equal(t, expected, vars)
+		})
+	}
+}
+
+func TestXMLDecoder(t *testing.T) {
+	t.Parallel()
+
+	body := `<request><name>John</name><tags><item>a</item><item>b</item></tags><id>1</id><id>2</id><address><city>Paris</city></address></request>`
+	vars, err := codec.XML{}.Decode(strings.NewReader(body))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"name":    "John",
+		"tags":    []interface{}{"a", "b"},
+		"id":      []interface{}{"1", "2"},
+		"address": map[string]interface{}{"city": "Paris"},
+	}, vars)
+
+	body = `<request><item key="1st">a</item><item key="a b">b</item></request>`
+	vars, err = codec.XML{}.Decode(strings.NewReader(body))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"1st": "a", "a b": "b"}, vars, "the keyed items should be decoded as fields")
+}
+
+func TestDecodersEmptyBody(t *testing.T) {
+	decoders := []codec.Decoder{codec.JSON{}, codec.MergePatchJSON{}, codec.MsgPack{}, codec.CBOR{}, codec.XML{}}
+	for _, dec := range decoders {
+		dec := dec
+		t.Run(dec.MediaType(), func(t *testing.T) {
+			t.Parallel()
+
+			vars, err := dec.Decode(strings.NewReader(""))
+			require.NoError(t, err)
+			assert.Empty(t, vars)
+		})
+	}
+}
+
+func TestDecodersInvalidPayload(t *testing.T) {
+	testCases := []struct {
+		description string
+		decoder     codec.Decoder
+		body        []byte
+	}{
+		{"msgpack truncated string", codec.MsgPack{}, []byte{0x81, 0xa1, 'a', 0xa5, 'x'}},
+		{"msgpack huge array", codec.MsgPack{}, []byte{0xdd, 0xff, 0xff, 0xff, 0xff}},
+		{"msgpack not a map", codec.MsgPack{}, []byte{0x01}},
+		{"msgpack trailing data", codec.MsgPack{}, []byte{0x80, 0x01}},
+		{"cbor truncated", codec.CBOR{}, []byte{0xa1, 0x61, 'a'}},
+		{"cbor indefinite length", codec.CBOR{}, []byte{0xbf, 0xff}},
+		{"cbor not a map", codec.CBOR{}, []byte{0x82, 0x01, 0x02}},
+		{"xml", codec.XML{}, []byte("<a><b></a>")},
+		{"json array", codec.JSON{}, []byte("[1]")},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := tc.decoder.Decode(bytes.NewReader(tc.body))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestDecoderRegistry(t *testing.T) {
+	t.Parallel()
+
+	registry := codec.DefaultDecoderRegistry()
+	for _, mediaType := range []string{"application/json", "application/merge-patch+json", "application/msgpack", "application/cbor", "application/xml"} {
+		_, found := registry.Lookup(mediaType)
+		assert.True(t, found, "%s should be supported", mediaType)
+	}
+
+	_, found := registry.Lookup("text/plain")
+	assert.False(t, found)
+}
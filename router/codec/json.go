@@ -0,0 +1,56 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// JSON is an Encoder that writes data using the JSON format
+type JSON struct{}
+
+// MediaType returns the media type of the encoded data
+func (JSON) MediaType() string {
+	return "application/json"
+}
+
+// ContentType returns the value of the Content-Type header
+func (JSON) ContentType() string {
+	return "application/json; charset=utf-8"
+}
+
+// Encode writes the JSON encoding of v to w
+func (JSON) Encode(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+// Decode reads the JSON object contained in r and returns its fields.
+// The numbers are returned as json.Number
+func (JSON) Decode(r io.Reader) (map[string]interface{}, error) {
+	vars := map[string]interface{}{}
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&vars); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return vars, nil
+}
+
+// toGeneric converts v to its JSON representation using only the basic
+// types (nil, bool, json.Number, string, []interface{} and
+// map[string]interface{}), so it can be encoded in any format while
+// keeping the JSON field names
+func toGeneric(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var generic interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
@@ -0,0 +1,145 @@
+package codec
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// MsgPack is an Encoder that writes data using the MessagePack format.
+// The data are written using their JSON representation
+type MsgPack struct{}
+
+// MediaType returns the media type of the encoded data
+func (MsgPack) MediaType() string {
+	return "application/msgpack"
+}
+
+// ContentType returns the value of the Content-Type header
+func (MsgPack) ContentType() string {
+	return "application/msgpack"
+}
+
+// Encode writes the MessagePack encoding of v to w
+func (MsgPack) Encode(w io.Writer, v interface{}) error {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+
+	buf := []byte{}
+	buf, err = appendMsgPack(buf, generic)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// appendMsgPack appends the MessagePack encoding of v to buf
+func appendMsgPack(buf []byte, v interface{}) ([]byte, error) {
+	switch value := v.(type) {
+	case nil:
+		return append(buf, 0xc0), nil
+	case bool:
+		if value {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case json.Number:
+		if i, err := strconv.ParseInt(string(value), 10, 64); err == nil {
+			return appendMsgPackInt(buf, i), nil
+		}
+		if u, err := strconv.ParseUint(string(value), 10, 64); err == nil {
+			return appendUint(append(buf, 0xcf), u, 8), nil
+		}
+		f, err := value.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return appendUint(append(buf, 0xcb), math.Float64bits(f), 8), nil
+	case string:
+		buf = appendMsgPackHeader(buf, len(value), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		return append(buf, value...), nil
+	case []interface{}:
+		buf = appendMsgPackHeader(buf, len(value), 0x90, 15, 0, 0xdc, 0xdd)
+		var err error
+		for _, item := range value {
+			if buf, err = appendMsgPack(buf, item); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]interface{}:
+		buf = appendMsgPackHeader(buf, len(value), 0x80, 15, 0, 0xde, 0xdf)
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var err error
+		for _, k := range keys {
+			if buf, err = appendMsgPack(buf, k); err != nil {
+				return nil, err
+			}
+			if buf, err = appendMsgPack(buf, value[k]); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	return nil, fmt.Errorf("codec: unsupported type %T", v)
+}
+
+// appendMsgPackInt appends the smallest MessagePack encoding of i to buf
+func appendMsgPackInt(buf []byte, i int64) []byte {
+	switch {
+	case i >= 0 && i <= math.MaxInt8:
+		return append(buf, byte(i))
+	case i < 0 && i >= -32:
+		return append(buf, byte(i))
+	case i >= 0 && i <= math.MaxUint8:
+		return append(buf, 0xcc, byte(i))
+	case i >= 0 && i <= math.MaxUint16:
+		return appendUint(append(buf, 0xcd), uint64(i), 2)
+	case i >= 0 && i <= math.MaxUint32:
+		return appendUint(append(buf, 0xce), uint64(i), 4)
+	case i >= 0:
+		return appendUint(append(buf, 0xcf), uint64(i), 8)
+	case i >= math.MinInt8:
+		return append(buf, 0xd0, byte(i))
+	case i >= math.MinInt16:
+		return appendUint(append(buf, 0xd1), uint64(i), 2)
+	case i >= math.MinInt32:
+		return appendUint(append(buf, 0xd2), uint64(i), 4)
+	}
+	return appendUint(append(buf, 0xd3), uint64(i), 8)
+}
+
+// appendMsgPackHeader appends the header of a string, an array or a map
+// containing n elements. fix is the prefix of the fix format, and
+// fixMax the max number of elements it can contains. A zero 8-bit
+// prefix means the format does not have an 8-bit version
+func appendMsgPackHeader(buf []byte, n int, fix byte, fixMax int, prefix8, prefix16, prefix32 byte) []byte {
+	switch {
+	case n <= fixMax:
+		return append(buf, fix|byte(n))
+	case prefix8 != 0 && n <= math.MaxUint8:
+		return append(buf, prefix8, byte(n))
+	case n <= math.MaxUint16:
+		return appendUint(append(buf, prefix16), uint64(n), 2)
+	}
+	return appendUint(append(buf, prefix32), uint64(n), 4)
+}
+
+// appendUint appends the size last bytes of v to buf, using the
+// big endian order
+func appendUint(buf []byte, v uint64, size int) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return append(buf, b[8-size:]...)
+}
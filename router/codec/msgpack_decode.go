@@ -0,0 +1,202 @@
+package codec
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+)
+
+// Decode reads the MessagePack map contained in r and returns its fields.
+// The numbers are returned as json.Number
+func (MsgPack) Decode(r io.Reader) (map[string]interface{}, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return map[string]interface{}{}, nil
+	}
+
+	d := &binaryDecoder{data: data}
+	v, err := d.msgpack(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(d.data) {
+		return nil, ErrInvalidPayload
+	}
+	return asObject(v)
+}
+
+// binaryDecoder contains the state of the decoding of a binary payload
+type binaryDecoder struct {
+	data []byte
+	pos  int
+}
+
+// next returns the n next bytes of the payload
+func (d *binaryDecoder) next(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, ErrInvalidPayload
+	}
+	b := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return b, nil
+}
+
+// uint reads a big endian unsigned integer of size bytes
+func (d *binaryDecoder) uint(size int) (uint64, error) {
+	b, err := d.next(uint64(size))
+	if err != nil {
+		return 0, err
+	}
+	padded := make([]byte, 8)
+	copy(padded[8-size:], b)
+	return binary.BigEndian.Uint64(padded), nil
+}
+
+// msgpack decodes the next MessagePack value
+func (d *binaryDecoder) msgpack(depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, ErrInvalidPayload
+	}
+
+	b, err := d.next(1)
+	if err != nil {
+		return nil, err
+	}
+	prefix := b[0]
+
+	switch {
+	case prefix <= 0x7f:
+		return intNumber(int64(prefix)), nil
+	case prefix >= 0xe0:
+		return intNumber(int64(int8(prefix))), nil
+	case prefix&0xe0 == 0xa0:
+		return d.str(uint64(prefix & 0x1f))
+	case prefix&0xf0 == 0x90:
+		return d.msgpackArray(uint64(prefix&0x0f), depth)
+	case prefix&0xf0 == 0x80:
+		return d.msgpackMap(uint64(prefix&0x0f), depth)
+	}
+
+	switch prefix {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		u, err := d.uint(1 << (prefix - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return json.Number(strconv.FormatUint(u, 10)), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (prefix - 0xd0)
+		u, err := d.uint(size)
+		if err != nil {
+			return nil, err
+		}
+		// sign extension
+		shift := uint(64 - size*8)
+		return intNumber(int64(u<<shift) >> shift), nil
+	case 0xca:
+		u, err := d.uint(4)
+		if err != nil {
+			return nil, err
+		}
+		return floatNumber(float64(math.Float32frombits(uint32(u))))
+	case 0xcb:
+		u, err := d.uint(8)
+		if err != nil {
+			return nil, err
+		}
+		return floatNumber(math.Float64frombits(u))
+	case 0xd9, 0xda, 0xdb, 0xc4, 0xc5, 0xc6:
+		// strings and binaries
+		sizes := map[byte]int{0xd9: 1, 0xda: 2, 0xdb: 4, 0xc4: 1, 0xc5: 2, 0xc6: 4}
+		n, err := d.uint(sizes[prefix])
+		if err != nil {
+			return nil, err
+		}
+		return d.str(n)
+	case 0xdc, 0xdd:
+		n, err := d.uint(2 << (prefix - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return d.msgpackArray(n, depth)
+	case 0xde, 0xdf:
+		n, err := d.uint(2 << (prefix - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return d.msgpackMap(n, depth)
+	}
+	return nil, fmt.Errorf("codec: unsupported MessagePack type 0x%x", prefix)
+}
+
+// str reads a string of n bytes
+func (d *binaryDecoder) str(n uint64) (interface{}, error) {
+	b, err := d.next(n)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// msgpackArray reads an array of n elements
+func (d *binaryDecoder) msgpackArray(n uint64, depth int) (interface{}, error) {
+	// each element takes at least one byte
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, ErrInvalidPayload
+	}
+	array := make([]interface{}, 0, n)
+	for i := uint64(0); i < n; i++ {
+		v, err := d.msgpack(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		array = append(array, v)
+	}
+	return array, nil
+}
+
+// msgpackMap reads a map of n elements
+func (d *binaryDecoder) msgpackMap(n uint64, depth int) (interface{}, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, ErrInvalidPayload
+	}
+	obj := make(map[string]interface{}, n)
+	for i := uint64(0); i < n; i++ {
+		k, err := d.msgpack(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.msgpack(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		obj[fmt.Sprint(k)] = v
+	}
+	return obj, nil
+}
+
+// intNumber returns i as a json.Number
+func intNumber(i int64) json.Number {
+	return json.Number(strconv.FormatInt(i, 10))
+}
+
+// floatNumber returns f as a json.Number
+func floatNumber(f float64) (json.Number, error) {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", ErrInvalidPayload
+	}
+	return json.Number(strconv.FormatFloat(f, 'f', -1, 64)), nil
+}
@@ -0,0 +1,115 @@
+package codec
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// XML is an Encoder that writes data using the XML format.
+// The data are written using their JSON representation, inside
+// a <response> element. The items of the lists are written
+// in <item> elements, as well as the fields whose name is not a valid
+// XML name, which are written as <item key="name">
+type XML struct{}
+
+// MediaType returns the media type of the encoded data
+func (XML) MediaType() string {
+	return "application/xml"
+}
+
+// ContentType returns the value of the Content-Type header
+func (XML) ContentType() string {
+	return "application/xml; charset=utf-8"
+}
+
+// Encode writes the XML encoding of v to w
+func (XML) Encode(w io.Writer, v interface{}) error {
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	if err := encodeXMLElement(enc, xml.StartElement{Name: xml.Name{Local: "response"}}, generic); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+// encodeXMLElement writes v in the element start
+func encodeXMLElement(enc *xml.Encoder, start xml.StartElement, v interface{}) error {
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch value := v.(type) {
+	case nil:
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := encodeXMLElement(enc, xmlField(k), value[k]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if err := encodeXMLElement(enc, xml.StartElement{Name: xml.Name{Local: "item"}}, item); err != nil {
+				return err
+			}
+		}
+	case string:
+		if err := enc.EncodeToken(xml.CharData(value)); err != nil {
+			return err
+		}
+	case json.Number, bool:
+		if err := enc.EncodeToken(xml.CharData(fmt.Sprint(value))); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("codec: unsupported type %T", v)
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// xmlField returns the element of the field named key. The keys that are
+// not valid XML names are written as <item key="key">
+func xmlField(key string) xml.StartElement {
+	if isXMLName(key) {
+		return xml.StartElement{Name: xml.Name{Local: key}}
+	}
+	return xml.StartElement{
+		Name: xml.Name{Local: "item"},
+		Attr: []xml.Attr{{Name: xml.Name{Local: "key"}, Value: key}},
+	}
+}
+
+// isXMLName returns whether name can be used as the name of an element.
+// The names containing a colon, or starting with "xml" are rejected since
+// they have a special meaning
+func isXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_' || unicode.IsLetter(r):
+		case i > 0 && (r == '-' || r == '.' || unicode.IsDigit(r)):
+		default:
+			return false
+		}
+	}
+	return true
+}
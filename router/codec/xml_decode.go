@@ -0,0 +1,86 @@
+package codec
+
+import (
+	"encoding/xml"
+	"io"
+)
+
+// xmlNode represents an element of an XML document
+type xmlNode struct {
+	XMLName  xml.Name
+	Key      string    `xml:"key,attr"`
+	Content  string    `xml:",chardata"`
+	Children []xmlNode `xml:",any"`
+}
+
+// name returns the name of the field contained in the node. The fields
+// whose name is not a valid XML name are sent as <item key="name">
+func (n *xmlNode) name() string {
+	if n.XMLName.Local == "item" && n.Key != "" {
+		return n.Key
+	}
+	return n.XMLName.Local
+}
+
+// Decode reads the XML document contained in r and returns the fields
+// of its root element.
+// Elements containing children are returned as objects, or as lists
+// if all their children are <item> elements without key. The repeated
+// elements are returned as lists
+func (XML) Decode(r io.Reader) (map[string]interface{}, error) {
+	root := xmlNode{}
+	if err := xml.NewDecoder(r).Decode(&root); err != nil {
+		if err == io.EOF {
+			return map[string]interface{}{}, nil
+		}
+		return nil, err
+	}
+	return asObject(root.value(0))
+}
+
+// value returns the content of the node
+func (n *xmlNode) value(depth int) interface{} {
+	if len(n.Children) == 0 {
+		if depth == 0 {
+			return map[string]interface{}{}
+		}
+		return n.Content
+	}
+	if depth >= maxDepth {
+		return nil
+	}
+
+	isList := true
+	for _, child := range n.Children {
+		if child.name() != "item" {
+			isList = false
+			break
+		}
+	}
+
+	if isList {
+		list := make([]interface{}, len(n.Children))
+		for i := range n.Children {
+			list[i] = n.Children[i].value(depth + 1)
+		}
+		return list
+	}
+
+	counts := map[string]int{}
+	for _, child := range n.Children {
+		counts[child.name()]++
+	}
+
+	obj := map[string]interface{}{}
+	for i := range n.Children {
+		name := n.Children[i].name()
+		v := n.Children[i].value(depth + 1)
+		if counts[name] == 1 {
+			obj[name] = v
+			continue
+		}
+		list, _ := obj[name].([]interface{})
+		obj[name] = append(list, v)
+	}
+	return obj
+}
@@ -0,0 +1,49 @@
+package router
+
+import (
+	"net/http"
+	"strings"
+)
+
+// needsPreflight checks if a preflight endpoint needs to be added for
+// the provided endpoints sharing the same path.
+// No endpoint is added if the path already has an OPTIONS endpoint, or
+// if none of the endpoints have a CORS policy
+func needsPreflight(endpoints []*Endpoint, cfg *options) bool {
+	hasPolicy := false
+	for _, e := range endpoints {
+		if strings.EqualFold(e.Verb, http.MethodOptions) {
+			return false
+		}
+		if e.corsPolicy(cfg) != nil {
+			hasPolicy = true
+		}
+	}
+	return hasPolicy
+}
+
+// newPreflightHandler returns an http.Handler that responds to the
+// preflight requests of the provided endpoints sharing the same path.
+// The policy of the endpoint matching the requested method is used
+func newPreflightHandler(endpoints []*Endpoint, cfg *options) http.Handler {
+	methods := make([]string, len(endpoints))
+	for i, e := range endpoints {
+		methods[i] = strings.ToUpper(e.Verb)
+	}
+	allow := strings.Join(append(methods, http.MethodOptions), ", ")
+
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Allow", allow)
+
+		requestedMethod := req.Header.Get("Access-Control-Request-Method")
+		for _, e := range endpoints {
+			if strings.EqualFold(e.Verb, requestedMethod) {
+				if policy := e.corsPolicy(cfg); policy != nil {
+					policy.SetPreflightHeaders(w.Header(), req, methods)
+				}
+				break
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
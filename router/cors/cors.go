@@ -0,0 +1,221 @@
+// Package cors contains the Cross-Origin Resource Sharing policies used to
+// allow the browsers to call the endpoints from other origins
+package cors
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultAllowedHeaders contains the headers a client can send when
+	// Policy.AllowedHeaders is not set
+	DefaultAllowedHeaders = []string{"Accept", "Accept-Language", "Authorization", "Content-Type"}
+
+	// DefaultExposedHeaders contains the headers a client can read when
+	// Policy.ExposedHeaders is not set
+	DefaultExposedHeaders = []string{
+		"X-Request-Id",
+		"Link",
+		"X-Total-Count",
+		"RateLimit-Limit",
+		"RateLimit-Remaining",
+		"RateLimit-Reset",
+		"Retry-After",
+	}
+)
+
+// Policy represents the rules that define which cross-origin requests
+// are allowed.
+// An empty policy doesn't allow any origin
+type Policy struct {
+	// AllowedOrigins contains the origins allowed to make requests.
+	// "*" allows all the origins, and "*" can also be used as a wildcard
+	// in an origin (ex. "https://*.example.com")
+	AllowedOrigins []string
+
+	// AllowedOriginPatterns contains regular expressions matching the
+	// origins allowed to make requests
+	AllowedOriginPatterns []*regexp.Regexp
+
+	// AllowedMethods contains the methods allowed for the cross-origin
+	// requests. Defaults to all the methods of the endpoints sharing the
+	// same path
+	AllowedMethods []string
+
+	// AllowedHeaders contains the headers a client is allowed to send.
+	// "*" allows all the headers. Defaults to DefaultAllowedHeaders
+	AllowedHeaders []string
+
+	// ExposedHeaders contains the headers a client is allowed to read.
+	// Defaults to DefaultExposedHeaders
+	ExposedHeaders []string
+
+	// AllowCredentials is set to true to allow the requests to contain
+	// cookies or authorization headers.
+	// It is ignored for the origins only allowed by "*", since allowing
+	// any website to make authenticated requests is never wanted
+	AllowCredentials bool
+
+	// MaxAge contains how long the result of a preflight request can be
+	// cached. 0 lets the browser use its default value
+	MaxAge time.Duration
+
+	once      sync.Once
+	wildcards []*regexp.Regexp
+	allowAll  bool
+}
+
+// compile parses the allowed origins
+func (p *Policy) compile() {
+	p.once.Do(func() {
+		for _, origin := range p.AllowedOrigins {
+			if origin == "*" {
+				p.allowAll = true
+				continue
+			}
+			// The wildcards can only match the characters of a hostname
+			// or of a port
+			pattern := strings.Replace(regexp.QuoteMeta(strings.ToLower(origin)), `\*`, `[a-z0-9.-]+`, -1)
+			p.wildcards = append(p.wildcards, regexp.MustCompile("^"+pattern+"$"))
+		}
+	})
+}
+
+// IsOriginAllowed checks if the given origin is allowed to make requests
+func (p *Policy) IsOriginAllowed(origin string) bool {
+	if origin == "" {
+		return false
+	}
+	p.compile()
+	return p.allowAll || p.isOriginListed(origin)
+}
+
+// isOriginListed checks if the given origin is explicitly allowed, by
+// a wildcard or a pattern. "*" is not taken into account
+func (p *Policy) isOriginListed(origin string) bool {
+	lowerOrigin := strings.ToLower(origin)
+	for _, re := range p.wildcards {
+		if re.MatchString(lowerOrigin) {
+			return true
+		}
+	}
+	for _, re := range p.AllowedOriginPatterns {
+		if re.MatchString(origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetHeaders sets the CORS headers of the response of an actual
+// request. Nothing is set if the origin of the request is not allowed
+func (p *Policy) SetHeaders(h http.Header, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	h.Add("Vary", "Origin")
+	if !p.IsOriginAllowed(origin) {
+		return
+	}
+
+	p.setOrigin(h, origin)
+	exposed := p.ExposedHeaders
+	if exposed == nil {
+		exposed = DefaultExposedHeaders
+	}
+	if len(exposed) > 0 {
+		h.Set("Access-Control-Expose-Headers", strings.Join(exposed, ", "))
+	}
+}
+
+// SetPreflightHeaders sets the CORS headers of the response of a
+// preflight request. methods contains the methods available on the
+// requested path.
+// Nothing is set if the request is not allowed
+func (p *Policy) SetPreflightHeaders(h http.Header, r *http.Request, methods []string) {
+	origin := r.Header.Get("Origin")
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+	if !p.IsOriginAllowed(origin) {
+		return
+	}
+
+	allowedMethods := p.AllowedMethods
+	if allowedMethods == nil {
+		allowedMethods = methods
+	}
+	if !contains(allowedMethods, r.Header.Get("Access-Control-Request-Method")) {
+		return
+	}
+
+	requestedHeaders := parseList(r.Header.Get("Access-Control-Request-Headers"))
+	if !p.areHeadersAllowed(requestedHeaders) {
+		return
+	}
+
+	p.setOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", strings.Join(allowedMethods, ", "))
+	if len(requestedHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(requestedHeaders, ", "))
+	}
+	if p.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+	}
+}
+
+// setOrigin sets the headers shared by the actual and preflight requests
+func (p *Policy) setOrigin(h http.Header, origin string) {
+	// The wildcard cannot be used with the credentials, so the origins
+	// that are only allowed by "*" never get the credentials
+	if p.allowAll && !p.isOriginListed(origin) {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	if p.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// areHeadersAllowed checks if all the given headers can be sent by
+// the clients
+func (p *Policy) areHeadersAllowed(headers []string) bool {
+	allowed := p.AllowedHeaders
+	if allowed == nil {
+		allowed = DefaultAllowedHeaders
+	}
+	if contains(allowed, "*") {
+		return true
+	}
+	for _, header := range headers {
+		if !contains(allowed, header) {
+			return false
+		}
+	}
+	return true
+}
+
+// contains checks if the list contains the given value, ignoring the case
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseList parses a comma separated list of values
+func parseList(list string) []string {
+	values := []string{}
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,149 @@
+package cors_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/router/cors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsOriginAllowed(t *testing.T) {
+	t.Parallel()
+
+	p := &cors.Policy{
+		AllowedOrigins:        []string{"https://app.example.com", "https://*.example.org", "http://localhost:*"},
+		AllowedOriginPatterns: []*regexp.Regexp{regexp.MustCompile(`^https://pr-\d+\.preview\.dev$`)},
+	}
+
+	testCases := []struct {
+		origin   string
+		expected bool
+	}{
+		{"https://app.example.com", true},
+		{"HTTPS://APP.EXAMPLE.COM", true},
+		{"http://app.example.com", false},
+		{"https://app.example.com.evil.com", false},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://evil.com/.example.org", false},
+		{"http://localhost:3000", true},
+		{"https://pr-42.preview.dev", true},
+		{"https://pr-a.preview.dev", false},
+		{"", false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, p.IsOriginAllowed(tc.origin), tc.origin)
+	}
+
+	assert.True(t, (&cors.Policy{AllowedOrigins: []string{"*"}}).IsOriginAllowed("https://any.com"))
+	assert.False(t, (&cors.Policy{}).IsOriginAllowed("https://any.com"))
+}
+
+func TestSetHeaders(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		description     string
+		policy          *cors.Policy
+		origin          string
+		expectedOrigin  string
+		expectedExposed string
+		credentials     bool
+	}{
+		{
+			"all origins",
+			&cors.Policy{AllowedOrigins: []string{"*"}, ExposedHeaders: []string{"X-Request-Id"}},
+			"https://app.example.com", "*", "X-Request-Id", false,
+		},
+		{
+			"all origins with credentials",
+			&cors.Policy{AllowedOrigins: []string{"*"}, AllowCredentials: true, ExposedHeaders: []string{}},
+			"https://app.example.com", "*", "", false,
+		},
+		{
+			"listed origin with credentials",
+			&cors.Policy{AllowedOrigins: []string{"https://app.example.com"}, AllowCredentials: true, ExposedHeaders: []string{}},
+			"https://app.example.com", "https://app.example.com", "", true,
+		},
+		{
+			"listed origin and all origins with credentials",
+			&cors.Policy{AllowedOrigins: []string{"*", "https://*.example.com"}, AllowCredentials: true, ExposedHeaders: []string{}},
+			"https://evil.com", "*", "", false,
+		},
+		{
+			"forbidden origin",
+			&cors.Policy{AllowedOrigins: []string{"https://app.example.com"}},
+			"https://evil.com", "", "", false,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest("GET", "/items", nil)
+			req.Header.Set("Origin", tc.origin)
+			h := http.Header{}
+			tc.policy.SetHeaders(h, req)
+
+			assert.Equal(t, tc.expectedOrigin, h.Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tc.expectedExposed, h.Get("Access-Control-Expose-Headers"))
+			assert.Equal(t, tc.credentials, h.Get("Access-Control-Allow-Credentials") == "true")
+			assert.Equal(t, []string{"Origin"}, h["Vary"])
+		})
+	}
+}
+
+func TestSetPreflightHeaders(t *testing.T) {
+	t.Parallel()
+
+	p := &cors.Policy{
+		AllowedOrigins: []string{"https://app.example.com"},
+		MaxAge:         10 * time.Minute,
+	}
+
+	testCases := []struct {
+		description string
+		method      string
+		headers     string
+		allowed     bool
+	}{
+		{"allowed", "POST", "content-type, authorization", true},
+		{"no headers", "GET", "", true},
+		{"method not available", "DELETE", "", false},
+		{"header not allowed", "POST", "X-Custom", false},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest("OPTIONS", "/items", nil)
+			req.Header.Set("Origin", "https://app.example.com")
+			req.Header.Set("Access-Control-Request-Method", tc.method)
+			if tc.headers != "" {
+				req.Header.Set("Access-Control-Request-Headers", tc.headers)
+			}
+			h := http.Header{}
+			p.SetPreflightHeaders(h, req, []string{"GET", "POST"})
+
+			if !tc.allowed {
+				assert.Empty(t, h.Get("Access-Control-Allow-Origin"))
+				return
+			}
+			assert.Equal(t, "https://app.example.com", h.Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, "GET, POST", h.Get("Access-Control-Allow-Methods"))
+			assert.Equal(t, "600", h.Get("Access-Control-Max-Age"))
+			if tc.headers != "" {
+				assert.Equal(t, "content-type, authorization", h.Get("Access-Control-Allow-Headers"))
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package router_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Nivl/go-rest-tools/request"
+	"github.com/Nivl/go-rest-tools/router"
+	"github.com/Nivl/go-rest-tools/router/cors"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func noContentHandler(req request.Request) error {
+	req.Response().NoContent()
+	return nil
+}
+
+func TestCORS(t *testing.T) {
+	t.Parallel()
+
+	policy := &cors.Policy{AllowedOrigins: []string{"https://app.example.com"}}
+	endpoints := router.Endpoints{
+		{Verb: "GET", Path: "/items", Handler: noContentHandler},
+		{Verb: "POST", Path: "/items", Handler: noContentHandler},
+		// CORS is disabled for this endpoint
+		{Verb: "DELETE", Path: "/items", Handler: noContentHandler, CORS: &cors.Policy{}},
+	}
+	r := mux.NewRouter()
+	endpoints.Activate(r, &testDeps{}, router.WithCORS(policy))
+
+	t.Run("actual request", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/items", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		r.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Contains(t, rec.Header().Get("Access-Control-Expose-Headers"), "X-Request-Id")
+	})
+
+	t.Run("preflight request", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("OPTIONS", "/items", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		r.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Equal(t, "GET, POST, DELETE, OPTIONS", rec.Header().Get("Allow"))
+		assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "GET, POST, DELETE", rec.Header().Get("Access-Control-Allow-Methods"))
+	})
+
+	t.Run("preflight request on a disabled endpoint", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("OPTIONS", "/items", nil)
+		req.Header.Set("Origin", "https://app.example.com")
+		req.Header.Set("Access-Control-Request-Method", "DELETE")
+		r.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNoContent, rec.Code)
+		assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
+
+func TestCORSExplicitOptionsEndpoint(t *testing.T) {
+	t.Parallel()
+
+	endpoints := router.Endpoints{
+		{Verb: "GET", Path: "/items", Handler: noContentHandler},
+		{
+			Verb: "OPTIONS",
+			Path: "/items",
+			Handler: func(req request.Request) error {
+				req.Response().Header().Set("X-Custom", "true")
+				req.Response().NoContent()
+				return nil
+			},
+		},
+	}
+	r := mux.NewRouter()
+	endpoints.Activate(r, &testDeps{}, router.WithCORS(&cors.Policy{AllowedOrigins: []string{"*"}}))
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("OPTIONS", "/items", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	r.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.Equal(t, "true", rec.Header().Get("X-Custom"), "the declared OPTIONS endpoint should have been used")
+}
+
+func TestWithoutCORS(t *testing.T) {
+	t.Parallel()
+
+	r := mux.NewRouter()
+	router.Endpoints{{Verb: "GET", Path: "/items", Handler: noContentHandler}}.Activate(r, &testDeps{})
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("OPTIONS", "/items", nil)
+	r.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code, "no OPTIONS endpoint should have been added")
+}
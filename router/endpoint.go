@@ -1,8 +1,12 @@
 package router
 
 import (
+	"net/http"
+
 	"github.com/Nivl/go-rest-tools/request"
+	"github.com/Nivl/go-rest-tools/router/cors"
 	"github.com/Nivl/go-rest-tools/router/guard"
+	"github.com/Nivl/go-rest-tools/router/ratelimit"
 )
 
 // RouteHandler is the function signature we nee
@@ -20,4 +24,110 @@ type Endpoint struct {
 
 	// Guard is the security system of an endpoint
 	Guard *guard.Guard
+
+	// Middlewares contains the middlewares to execute before the handler.
+	// They are executed after the global middlewares
+	Middlewares []Middleware
+
+	// MaxBodySize contains the maximum size of the body in bytes.
+	// 0 uses the global value (see WithMaxBodySize), and a negative value
+	// removes the limit
+	MaxBodySize int64
+
+	// MultipartMemory contains the maximum number of bytes of a multipart
+	// body that are stored in memory. The rest is stored on disk.
+	// 0 uses the global value (see WithMultipartMemory)
+	MultipartMemory int64
+
+	// Streaming is set to true to not parse the body of the request.
+	// The handler is expected to read it using request.Body().
+	// The params are still parsed from the URL and the query string
+	Streaming bool
+
+	// CORS contains the CORS policy of the endpoint. nil uses the global
+	// policy (see WithCORS), and an empty policy disables CORS
+	CORS *cors.Policy
+
+	// Audit is set to true to record the requests made to the endpoint
+	// using the auditor of the router (see WithAuditor). The requests
+	// are recorded whatever their outcome
+	Audit bool
+
+	// Summary contains a short description of the endpoint.
+	// It's only used to document the endpoint
+	Summary string
+
+	// Tags contains the tags used to group the endpoints in the
+	// documentation
+	Tags []string
+
+	// Response describes the response sent back by the endpoint when
+	// the request succeeds. It's used to document the endpoint, and to
+	// check the responses when WithResponseValidation is set
+	Response *ResponseSpec
+}
+
+// ResponseSpec describes the successful response of an endpoint
+type ResponseSpec struct {
+	// Status contains the HTTP status code of the response.
+	// Default to 200, or 204 if Body is nil
+	Status int
+
+	// Description contains the description of the response
+	Description string
+
+	// Body contains an instance of the object sent back to the client
+	// (ex. &User{} or []*User{}). nil means that the response has
+	// no body
+	Body interface{}
+}
+
+// StatusCode returns the status code of the response. Default to 200,
+// or 204 if the response has no body
+func (spec *ResponseSpec) StatusCode() int {
+	switch {
+	case spec.Status != 0:
+		return spec.Status
+	case spec.Body == nil:
+		return http.StatusNoContent
+	}
+	return http.StatusOK
+}
+
+// maxBodySize returns the maximum size of the body of the endpoint.
+// A negative value means there's no limit
+func (e *Endpoint) maxBodySize(cfg *options) int64 {
+	if e.MaxBodySize != 0 {
+		return e.MaxBodySize
+	}
+	return cfg.maxBodySize
+}
+
+// multipartMemory returns the maximum number of bytes of a multipart
+// body that can be stored in memory
+func (e *Endpoint) multipartMemory(cfg *options) int64 {
+	if e.MultipartMemory > 0 {
+		return e.MultipartMemory
+	}
+	return cfg.multipartMemory
+}
+
+// rateLimits returns the global rate limits followed by the ones of the
+// guard of the endpoint
+func (e *Endpoint) rateLimits(cfg *options) []*ratelimit.Rule {
+	rules := []*ratelimit.Rule{}
+	rules = append(rules, cfg.rateLimits...)
+	if e.Guard != nil {
+		rules = append(rules, e.Guard.RateLimits...)
+	}
+	return rules
+}
+
+// corsPolicy returns the CORS policy of the endpoint, or nil if the
+// endpoint has none
+func (e *Endpoint) corsPolicy(cfg *options) *cors.Policy {
+	if e.CORS != nil {
+		return e.CORS
+	}
+	return cfg.cors
 }
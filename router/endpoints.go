@@ -4,10 +4,10 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	reporter "github.com/Nivl/go-reporter"
-	"github.com/Nivl/go-rest-tools/network/http/basicauth"
-	"github.com/Nivl/go-rest-tools/security/auth"
+	"github.com/Nivl/go-rest-tools/router/ratelimit"
 	"github.com/Nivl/go-rest-tools/types/apperror"
 	"github.com/gorilla/mux"
 	uuid "github.com/satori/go.uuid"
@@ -17,33 +17,99 @@ import (
 type Endpoints []*Endpoint
 
 // Activate adds the endpoints to the router
-func (endpoints Endpoints) Activate(router *mux.Router, deps Dependencies) {
+func (endpoints Endpoints) Activate(router *mux.Router, deps Dependencies, opts ...Option) {
+	cfg := newOptions(opts)
+	paths := []string{}
+	endpointsByPath := map[string][]*Endpoint{}
 	for _, endpoint := range endpoints {
 		router.
 			Methods(endpoint.Verb).
 			Path(endpoint.Path).
-			Handler(Handler(endpoint, deps))
+			Handler(newHandler(endpoint, deps, cfg))
+
+		if _, found := endpointsByPath[endpoint.Path]; !found {
+			paths = append(paths, endpoint.Path)
+		}
+		endpointsByPath[endpoint.Path] = append(endpointsByPath[endpoint.Path], endpoint)
+	}
+
+	// We add the endpoints used by the browsers to check the CORS policies
+	for _, path := range paths {
+		if needsPreflight(endpointsByPath[path], cfg) {
+			router.
+				Methods(http.MethodOptions).
+				Path(path).
+				Handler(newPreflightHandler(endpointsByPath[path], cfg))
+		}
 	}
 }
 
 // Handler makes it possible to use a RouteHandler where a http.Handler is required
-func Handler(e *Endpoint, deps Dependencies) http.Handler {
+func Handler(e *Endpoint, deps Dependencies, opts ...Option) http.Handler {
+	return newHandler(e, deps, newOptions(opts))
+}
+
+// newHandler returns an http.Handler that executes the whole pipeline
+// of an endpoint using the provided configuration
+func newHandler(e *Endpoint, deps Dependencies, cfg *options) http.Handler {
+	// The global middlewares are executed before the ones of the endpoint
+	middlewares := make([]Middleware, 0, len(cfg.middlewares)+len(e.Middlewares))
+	middlewares = append(middlewares, cfg.middlewares...)
+	middlewares = append(middlewares, e.Middlewares...)
+	routeHandler := chain(e.Handler, middlewares...)
+
 	HTTPHandler := func(resWriter http.ResponseWriter, req *http.Request) {
+		startedAt := time.Now()
+		var recorder *statusRecorder
+		if e.Audit && cfg.auditor != nil {
+			recorder = &statusRecorder{ResponseWriter: resWriter}
+			resWriter = recorder
+		}
+
 		// the following errors will be checked later on. we first init
 		// the request, then we will use that request to return (and log) the error
 		logger, loggerErr := deps.NewLogger()
 		rep, reporterErr := deps.NewReporter()
+		res := &HTTPResponse{
+			writer:             resWriter,
+			http:               req,
+			encoder:            cfg.encoders.Default(),
+			errorFormat:        cfg.errorFormat,
+			paginationEnvelope: cfg.paginationEnvelope,
+		}
+		if cfg.validateResponses && e.Response != nil {
+			res.validator = &responseValidator{
+				endpoint: e.Verb + " " + e.Path,
+				spec:     e.Response,
+				reporter: rep,
+			}
+		}
 		request := &HTTPRequest{
-			id:       uuid.NewV4().String()[:8],
-			http:     req,
-			res:      NewResponse(resWriter),
-			logger:   logger,
-			reporter: rep,
+			id:           uuid.NewV4().String()[:8],
+			http:         req,
+			res:          res,
+			decoders:     cfg.decoders,
+			streaming:    e.Streaming,
+			maxBodySize:  e.maxBodySize(cfg),
+			multipartMem: e.multipartMemory(cfg),
+			ipHeader:     cfg.clientIPHeader,
+			logger:       logger,
+			reporter:     rep,
+		}
+		// The request is audited once everything else has been done,
+		// including the recovery of a panic
+		if recorder != nil {
+			defer request.audit(cfg.auditor, e.Verb+" "+e.Path, recorder, startedAt)
 		}
 		defer request.handlePanic()
+		defer request.removeTempFiles()
 
 		// We set some response data
 		request.res.Header().Set("X-Request-Id", request.id)
+		request.res.Header().Add("Vary", "Accept")
+		if policy := e.corsPolicy(cfg); policy != nil {
+			policy.SetHeaders(request.res.Header(), req)
+		}
 
 		// if a dep failed to be created, we return an error
 		if loggerErr != nil {
@@ -59,38 +125,40 @@ func Handler(e *Endpoint, deps Dependencies) http.Handler {
 		request.Reporter().AddTag("Req ID", request.id)
 		request.Reporter().AddTag("Endpoint", e.Path)
 
-		// We fetch the user session if a token is provided
-		headers, found := req.Header["Authorization"]
-		if found {
-			request.Reporter().AddTag("Req Auths", strings.Join(headers, ", "))
+		// We find the format the response should be sent with
+		encoder, acceptable := cfg.encoders.Negotiate(req.Header.Get("Accept"))
+		if !acceptable {
+			request.res.Error(apperror.NewNotAcceptable(), request)
+			return
+		}
+		res.encoder = encoder
 
-			userID, sessionID, err := basicauth.ParseAuthHeader(headers, "basic", "")
-			if err != nil {
-				request.res.Error(apperror.NewBadRequest("Authorization", "invalid format"), request)
+		// We make sure the body is not too large
+		if maxBodySize := e.maxBodySize(cfg); maxBodySize > 0 {
+			if req.ContentLength > maxBodySize {
+				request.res.Error(apperror.NewPayloadTooLarge(maxBodySize), request)
+				return
 			}
-			session := &auth.Session{ID: sessionID, UserID: userID}
-
-			if session.ID != "" && session.UserID != "" {
-				exists, err := session.Exists(deps.DB())
-				if err != nil {
-					request.res.Error(err, request)
-					return
-				}
-				if !exists {
-					request.res.Error(apperror.NewNotFoundField("Authorization", "session not found"), request)
-					return
-				}
-				request.session = session
-				// we get the user and make sure it (still) exists
-				request.user, err = auth.GetUserByID(deps.DB(), session.UserID)
-				if err != nil {
-					if apperror.IsNotFound(err) {
-						err = apperror.NewNotFoundField("Authorization", "session not found")
-					}
-					request.res.Error(err, request)
-					return
-				}
+			if req.Body != nil {
+				req.Body = http.MaxBytesReader(resWriter, req.Body, maxBodySize)
 			}
+		}
+
+		// We fetch the identity of the client
+		headers, found := req.Header["Authorization"]
+		if found {
+			request.Reporter().AddTag("Req Auths", authSchemes(headers))
+		}
+
+		identity, err := cfg.authenticator.Authenticate(req, deps)
+		if err != nil {
+			request.res.Error(err, request)
+			return
+		}
+		if identity != nil && identity.User != nil {
+			request.user = identity.User
+			request.session = identity.Session
+			request.apiKey = identity.APIKey
 
 			request.Reporter().SetUser(&reporter.User{
 				ID:       request.user.ID,
@@ -99,8 +167,22 @@ func Handler(e *Endpoint, deps Dependencies) http.Handler {
 			})
 		}
 
+		// Make sure the client didn't exceed its quota
+		limit, err := ratelimit.Check(e.rateLimits(cfg), e.Verb+" "+e.Path, request)
+		if err != nil {
+			request.res.Error(err, request)
+			return
+		}
+		if limit != nil {
+			request.res.setRateLimitHeaders(limit)
+			if !limit.Allowed {
+				request.res.Error(apperror.NewTooManyRequests(), request)
+				return
+			}
+		}
+
 		// Make sure the user has access to the handler
-		if allowed, err := e.Guard.HasAccess(request.user); !allowed {
+		if allowed, err := e.Guard.HasAccess(request.user, request.session, request.apiKey); !allowed {
 			request.res.Error(err, request)
 			return
 		}
@@ -122,8 +204,14 @@ func Handler(e *Endpoint, deps Dependencies) http.Handler {
 			request.Reporter().AddTag("Endpoint Params", fmt.Sprintf("%#v", request.params))
 		}
 
-		// Execute the actual route handler
-		err := e.Handler(request)
+		// Make sure the user has access to the requested resource
+		if allowed, err := e.Guard.HasParamsAccess(request.user, request.session, request.params); !allowed {
+			request.res.Error(err, request)
+			return
+		}
+
+		// Execute the middlewares and the actual route handler
+		err = routeHandler(request)
 		if err != nil {
 			request.res.Error(err, request)
 		}
@@ -131,3 +219,17 @@ func Handler(e *Endpoint, deps Dependencies) http.Handler {
 
 	return http.HandlerFunc(HTTPHandler)
 }
+
+// authSchemes returns the schemes used by the provided Authorization
+// headers. The credentials are not returned since they are secrets
+func authSchemes(headers []string) string {
+	schemes := make([]string, 0, len(headers))
+	for _, h := range headers {
+		scheme := "none"
+		if fields := strings.Fields(h); len(fields) > 0 {
+			scheme = fields[0]
+		}
+		schemes = append(schemes, scheme)
+	}
+	return strings.Join(schemes, ", ")
+}
@@ -0,0 +1,138 @@
+package router_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	logger "github.com/Nivl/go-logger"
+	reporter "github.com/Nivl/go-reporter"
+	"github.com/Nivl/go-rest-tools/request"
+	"github.com/Nivl/go-rest-tools/router"
+	db "github.com/Nivl/go-sqldb"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// noopReporter is a reporter that does nothing
+type noopReporter struct{}
+
+func (r *noopReporter) SetUser(u *reporter.User)       {}
+func (r *noopReporter) AddTag(key, value string)       {}
+func (r *noopReporter) AddTags(tags map[string]string) {}
+func (r *noopReporter) ReportError(err error)          {}
+func (r *noopReporter) ReportErrorAndWait(err error)   {}
+
+// tagsReporter is a reporter that keeps the tags
+type tagsReporter struct {
+	noopReporter
+	tags map[string]string
+}
+
+func (r *tagsReporter) AddTag(key, value string) {
+	r.tags[key] = value
+}
+
+// testDeps is an implementation of router.Dependencies that does not
+// need any external services
+type testDeps struct {
+	db       db.Connection
+	reporter reporter.Reporter
+}
+
+func (d *testDeps) NewLogger() (logger.Logger, error) { return nil, nil }
+func (d *testDeps) DB() db.Connection                 { return d.db }
+func (d *testDeps) NewReporter() (reporter.Reporter, error) {
+	if d.reporter != nil {
+		return d.reporter, nil
+	}
+	return &noopReporter{}, nil
+}
+
+// tracer returns a middleware that appends its name to the provided list
+func tracer(name string, calls *[]string) router.Middleware {
+	return func(next router.RouteHandler) router.RouteHandler {
+		return func(req request.Request) error {
+			*calls = append(*calls, name)
+			return next(req)
+		}
+	}
+}
+
+func TestMiddlewaresOrder(t *testing.T) {
+	calls := []string{}
+
+	e := &router.Endpoint{
+		Verb: "GET",
+		Path: "/items",
+		Handler: func(req request.Request) error {
+			calls = append(calls, "handler")
+			req.Response().NoContent()
+			return nil
+		},
+		Middlewares: []router.Middleware{
+			tracer("endpoint 1", &calls),
+			tracer("endpoint 2", &calls),
+		},
+	}
+
+	r := mux.NewRouter()
+	router.Endpoints{e}.Activate(r, &testDeps{},
+		router.WithMiddlewares(tracer("global 1", &calls), tracer("global 2", &calls)))
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/items", nil))
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	expected := []string{"global 1", "global 2", "endpoint 1", "endpoint 2", "handler"}
+	assert.Equal(t, expected, calls, "the middlewares were not called in the right order")
+}
+
+func TestMiddlewareShortCircuit(t *testing.T) {
+	handlerCalled := false
+
+	e := &router.Endpoint{
+		Verb: "GET",
+		Path: "/items",
+		Handler: func(req request.Request) error {
+			handlerCalled = true
+			return nil
+		},
+		Middlewares: []router.Middleware{
+			func(next router.RouteHandler) router.RouteHandler {
+				return func(req request.Request) error {
+					req.Response().NoContent()
+					return nil
+				}
+			},
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	router.Handler(e, &testDeps{}).ServeHTTP(rec, httptest.NewRequest("GET", "/items", nil))
+
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	assert.False(t, handlerCalled, "the handler should not have been called")
+}
+
+func TestAuthorizationTagRedacted(t *testing.T) {
+	e := &router.Endpoint{
+		Verb: "GET",
+		Path: "/items",
+		Handler: func(req request.Request) error {
+			req.Response().NoContent()
+			return nil
+		},
+	}
+
+	rep := &tagsReporter{tags: map[string]string{}}
+	r := mux.NewRouter()
+	router.Endpoints{e}.Activate(r, &testDeps{reporter: rep})
+
+	req := httptest.NewRequest("GET", "/items", nil)
+	req.Header.Add("Authorization", "Bearer secret-token")
+	req.Header.Add("Authorization", "Basic c2VjcmV0")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "Bearer, Basic", rep.tags["Req Auths"])
+}
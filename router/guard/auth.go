@@ -5,24 +5,125 @@ import (
 	"github.com/Nivl/go-rest-tools/types/apperror"
 )
 
-// RouteAuth represents a middleware used to allow/block the access to an endpoint
-type RouteAuth func(*auth.User) apperror.Error
+// RouteAuth represents a middleware used to allow/block the access to an
+// endpoint. s is the session used to authenticate the user, if any
+type RouteAuth func(u *auth.User, s *auth.Session) apperror.Error
 
-// LoggedUserAccess is a auth middleware that filters out anonymous users
-func LoggedUserAccess(u *auth.User) apperror.Error {
+// LoggedUserAccess is a auth middleware that filters out anonymous users,
+// and the users that still have to provide a second factor
+func LoggedUserAccess(u *auth.User, s *auth.Session) apperror.Error {
+	if err := MFAPendingAccess(u, s); err != nil {
+		return err
+	}
+	if s.IsMFAPending() {
+		return apperror.NewUnauthorizedR(auth.ErrMsgMFARequired)
+	}
+	return nil
+}
+
+// MFAPendingAccess is a auth middleware that filters out anonymous users,
+// but grants access to the users that still have to provide a second
+// factor. It should only be used by the endpoints needed to provide the
+// second factor, all the other endpoints should use LoggedUserAccess
+func MFAPendingAccess(u *auth.User, s *auth.Session) apperror.Error {
 	if u == nil || u.ID == "" {
 		return apperror.NewUnauthorized()
 	}
 	return nil
 }
 
-// AdminAccess is a auth middleware that filters out non admin users
-func AdminAccess(u *auth.User) apperror.Error {
-	if err := LoggedUserAccess(u); err != nil {
-		return apperror.NewUnauthorized()
+// MFAAccess is a auth middleware that filters out the users that didn't
+// provide a second factor, including the users that don't use MFA.
+// Example to require the admins to use MFA:
+//
+//	guard.AllOf(guard.AdminAccess, guard.MFAAccess)
+func MFAAccess(u *auth.User, s *auth.Session) apperror.Error {
+	if err := LoggedUserAccess(u, s); err != nil {
+		return err
+	}
+	if s == nil || s.MFAStatus != auth.MFAVerified {
+		return apperror.NewForbiddenR(auth.ErrMsgMFARequired)
+	}
+	return nil
+}
+
+// AdminAccess is a auth middleware that filters out non admin users, and
+// the admins that still have to provide a second factor
+func AdminAccess(u *auth.User, s *auth.Session) apperror.Error {
+	if err := LoggedUserAccess(u, s); err != nil {
+		return err
 	}
 	if !u.IsAdmin {
 		return apperror.NewForbidden()
 	}
 	return nil
 }
+
+// RequirePermission returns an auth middleware that filters out the users
+// that haven't been granted all the provided permissions, and the users
+// that still have to provide a second factor
+func RequirePermission(permissions ...string) RouteAuth {
+	return func(u *auth.User, s *auth.Session) apperror.Error {
+		if err := LoggedUserAccess(u, s); err != nil {
+			return err
+		}
+		for _, p := range permissions {
+			if !u.HasPermission(p) {
+				return apperror.NewForbidden()
+			}
+		}
+		return nil
+	}
+}
+
+// RequireRole returns an auth middleware that filters out the users that
+// don't have the provided role, and the users that still have to provide
+// a second factor
+func RequireRole(role string) RouteAuth {
+	return func(u *auth.User, s *auth.Session) apperror.Error {
+		if err := LoggedUserAccess(u, s); err != nil {
+			return err
+		}
+		if !u.HasRole(role) {
+			return apperror.NewForbidden()
+		}
+		return nil
+	}
+}
+
+// AllOf returns an auth middleware that only grants access if all the
+// provided auth middlewares grant access. The first error is returned
+func AllOf(auths ...RouteAuth) RouteAuth {
+	return func(u *auth.User, s *auth.Session) apperror.Error {
+		for _, a := range auths {
+			if err := a(u, s); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// AnyOf returns an auth middleware that grants access if at least one
+// of the provided auth middlewares grants access.
+// If the access is denied, a Forbidden error is preferred over an
+// Unauthorized one since it means that the user is logged in
+func AnyOf(auths ...RouteAuth) RouteAuth {
+	return func(u *auth.User, s *auth.Session) apperror.Error {
+		var deniedErr apperror.Error
+		for _, a := range auths {
+			err := a(u, s)
+			if err == nil {
+				return nil
+			}
+			if deniedErr == nil || err.StatusCode() == apperror.PermissionDenied {
+				deniedErr = err
+			}
+		}
+		if deniedErr == nil {
+			// An empty list grants nothing
+			return apperror.NewForbidden()
+		}
+		return deniedErr
+	}
+}
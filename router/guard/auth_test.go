@@ -15,22 +15,92 @@ func TestLoggedUserAccess(t *testing.T) {
 	testCases := []struct {
 		description   string
 		user          *auth.User
+		session       *auth.Session
 		expectedError *int
 	}{
 		{
 			"Anonymous user",
 			nil,
+			nil,
 			ptrs.NewInt(int(apperror.Unauthenticated)),
 		},
 		{
 			"Invalid user object",
 			&auth.User{},
+			nil,
 			ptrs.NewInt(int(apperror.Unauthenticated)),
 		},
 		{
 			"Logged In user",
 			&auth.User{ID: "xxx"},
 			nil,
+			nil,
+		},
+		{
+			"User waiting for MFA",
+			&auth.User{ID: "xxx"},
+			&auth.Session{MFAStatus: auth.MFAPending},
+			ptrs.NewInt(int(apperror.Unauthenticated)),
+		},
+		{
+			"User without MFA",
+			&auth.User{ID: "xxx"},
+			&auth.Session{},
+			nil,
+		},
+		{
+			"User with MFA",
+			&auth.User{ID: "xxx"},
+			&auth.Session{MFAStatus: auth.MFAVerified},
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			err := guard.LoggedUserAccess(tc.user, tc.session)
+			if tc.expectedError == nil {
+				assert.Nil(t, err, "access should have not been denied: %s", err)
+			} else {
+				assert.Equal(t, *tc.expectedError, int(err.StatusCode()), "the auth failed with the wrong error code")
+			}
+		})
+	}
+}
+
+func TestMFAPendingAccess(t *testing.T) {
+	testCases := []struct {
+		description   string
+		user          *auth.User
+		session       *auth.Session
+		expectedError *int
+	}{
+		{
+			"Anonymous user",
+			nil,
+			nil,
+			ptrs.NewInt(int(apperror.Unauthenticated)),
+		},
+		{
+			"Invalid user object",
+			&auth.User{},
+			&auth.Session{MFAStatus: auth.MFAPending},
+			ptrs.NewInt(int(apperror.Unauthenticated)),
+		},
+		{
+			"User waiting for MFA",
+			&auth.User{ID: "xxx"},
+			&auth.Session{MFAStatus: auth.MFAPending},
+			nil,
+		},
+		{
+			"User with MFA",
+			&auth.User{ID: "xxx"},
+			&auth.Session{MFAStatus: auth.MFAVerified},
+			nil,
 		},
 	}
 
@@ -39,7 +109,55 @@ func TestLoggedUserAccess(t *testing.T) {
 		t.Run(tc.description, func(t *testing.T) {
 			t.Parallel()
 
-			err := guard.LoggedUserAccess(tc.user)
+			err := guard.MFAPendingAccess(tc.user, tc.session)
+			if tc.expectedError == nil {
+				assert.Nil(t, err, "access should have not been denied: %s", err)
+			} else {
+				assert.Equal(t, *tc.expectedError, int(err.StatusCode()), "the auth failed with the wrong error code")
+			}
+		})
+	}
+}
+
+func TestMFAAccess(t *testing.T) {
+	testCases := []struct {
+		description   string
+		user          *auth.User
+		session       *auth.Session
+		expectedError *int
+	}{
+		{
+			"Anonymous user",
+			nil,
+			nil,
+			ptrs.NewInt(int(apperror.Unauthenticated)),
+		},
+		{
+			"User waiting for MFA",
+			&auth.User{ID: "xxx"},
+			&auth.Session{MFAStatus: auth.MFAPending},
+			ptrs.NewInt(int(apperror.Unauthenticated)),
+		},
+		{
+			"User without MFA",
+			&auth.User{ID: "xxx"},
+			nil,
+			ptrs.NewInt(int(apperror.PermissionDenied)),
+		},
+		{
+			"User with MFA",
+			&auth.User{ID: "xxx"},
+			&auth.Session{MFAStatus: auth.MFAVerified},
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			err := guard.MFAAccess(tc.user, tc.session)
 			if tc.expectedError == nil {
 				assert.Nil(t, err, "access should have not been denied: %s", err)
 			} else {
@@ -53,22 +171,266 @@ func TestAdminAccess(t *testing.T) {
 	testCases := []struct {
 		description   string
 		user          *auth.User
+		session       *auth.Session
 		expectedError *int
 	}{
 		{
 			"Anonymous user",
 			nil,
+			nil,
 			ptrs.NewInt(int(apperror.Unauthenticated)),
 		},
 		{
 			"Logged In user",
 			&auth.User{ID: "xxx"},
+			nil,
+			ptrs.NewInt(int(apperror.PermissionDenied)),
+		},
+		{
+			"Admin",
+			&auth.User{ID: "xxx", IsAdmin: true},
+			nil,
+			nil,
+		},
+		{
+			"Admin waiting for MFA",
+			&auth.User{ID: "xxx", IsAdmin: true},
+			&auth.Session{MFAStatus: auth.MFAPending},
+			ptrs.NewInt(int(apperror.Unauthenticated)),
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			err := guard.AdminAccess(tc.user, tc.session)
+			if tc.expectedError == nil {
+				assert.Nil(t, err, "access should have not been denied: %s", err)
+			} else {
+				assert.Equal(t, *tc.expectedError, int(err.StatusCode()), "the auth failed with the wrong error code")
+			}
+		})
+	}
+}
+
+func TestRequirePermission(t *testing.T) {
+	testCases := []struct {
+		description   string
+		user          *auth.User
+		session       *auth.Session
+		expectedError *int
+	}{
+		{
+			"Anonymous user",
+			nil,
+			nil,
+			ptrs.NewInt(int(apperror.Unauthenticated)),
+		},
+		{
+			"User without permissions",
+			&auth.User{ID: "xxx"},
+			nil,
 			ptrs.NewInt(int(apperror.PermissionDenied)),
 		},
+		{
+			"User with one permission",
+			&auth.User{ID: "xxx", Permissions: []string{"articles:write"}},
+			nil,
+			ptrs.NewInt(int(apperror.PermissionDenied)),
+		},
+		{
+			"User with all permissions",
+			&auth.User{ID: "xxx", Permissions: []string{"articles:write", "articles:publish"}},
+			nil,
+			nil,
+		},
+		{
+			"User with a wildcard",
+			&auth.User{ID: "xxx", Permissions: []string{"articles:*"}},
+			nil,
+			nil,
+		},
 		{
 			"Admin",
 			&auth.User{ID: "xxx", IsAdmin: true},
 			nil,
+			nil,
+		},
+		{
+			"User waiting for MFA",
+			&auth.User{ID: "xxx", Permissions: []string{"articles:*"}},
+			&auth.Session{MFAStatus: auth.MFAPending},
+			ptrs.NewInt(int(apperror.Unauthenticated)),
+		},
+		{
+			"Admin waiting for MFA",
+			&auth.User{ID: "xxx", IsAdmin: true},
+			&auth.Session{MFAStatus: auth.MFAPending},
+			ptrs.NewInt(int(apperror.Unauthenticated)),
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			err := guard.RequirePermission("articles:write", "articles:publish")(tc.user, tc.session)
+			if tc.expectedError == nil {
+				assert.Nil(t, err, "access should have not been denied: %s", err)
+			} else {
+				assert.Equal(t, *tc.expectedError, int(err.StatusCode()), "the auth failed with the wrong error code")
+			}
+		})
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	a := guard.RequireRole("editor")
+
+	err := a(nil, nil)
+	assert.Equal(t, apperror.Unauthenticated, err.StatusCode())
+
+	err = a(&auth.User{ID: "xxx", Roles: []string{"reader"}}, nil)
+	assert.Equal(t, apperror.PermissionDenied, err.StatusCode())
+
+	assert.Nil(t, a(&auth.User{ID: "xxx", Roles: []string{"editor"}}, nil))
+
+	err = a(&auth.User{ID: "xxx", Roles: []string{"editor"}}, &auth.Session{MFAStatus: auth.MFAPending})
+	assert.Equal(t, apperror.Unauthenticated, err.StatusCode())
+}
+
+func TestCombinators(t *testing.T) {
+	editor := guard.RequireRole("editor")
+	writer := guard.RequirePermission("articles:write")
+
+	testCases := []struct {
+		description   string
+		auth          guard.RouteAuth
+		user          *auth.User
+		session       *auth.Session
+		expectedError *int
+	}{
+		{
+			"AnyOf with anonymous user",
+			guard.AnyOf(editor, writer),
+			nil,
+			nil,
+			ptrs.NewInt(int(apperror.Unauthenticated)),
+		},
+		{
+			"AnyOf with no matches",
+			guard.AnyOf(editor, writer),
+			&auth.User{ID: "xxx"},
+			nil,
+			ptrs.NewInt(int(apperror.PermissionDenied)),
+		},
+		{
+			"AnyOf with one match",
+			guard.AnyOf(editor, writer),
+			&auth.User{ID: "xxx", Permissions: []string{"articles:write"}},
+			nil,
+			nil,
+		},
+		{
+			"AnyOf prefers forbidden over unauthorized",
+			guard.AnyOf(
+				func(*auth.User, *auth.Session) apperror.Error { return apperror.NewUnauthorized() },
+				func(*auth.User, *auth.Session) apperror.Error { return apperror.NewForbidden() },
+			),
+			&auth.User{ID: "xxx"},
+			nil,
+			ptrs.NewInt(int(apperror.PermissionDenied)),
+		},
+		{
+			"AnyOf with no auths",
+			guard.AnyOf(),
+			&auth.User{ID: "xxx"},
+			nil,
+			ptrs.NewInt(int(apperror.PermissionDenied)),
+		},
+		{
+			"AllOf with one match",
+			guard.AllOf(editor, writer),
+			&auth.User{ID: "xxx", Permissions: []string{"articles:write"}},
+			nil,
+			ptrs.NewInt(int(apperror.PermissionDenied)),
+		},
+		{
+			"AllOf with all matches",
+			guard.AllOf(editor, writer),
+			&auth.User{ID: "xxx", Roles: []string{"editor"}, Permissions: []string{"articles:write"}},
+			nil,
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.auth(tc.user, tc.session)
+			if tc.expectedError == nil {
+				assert.Nil(t, err, "access should have not been denied: %s", err)
+			} else {
+				assert.Equal(t, *tc.expectedError, int(err.StatusCode()), "the auth failed with the wrong error code")
+			}
+		})
+	}
+}
+
+func TestOwnerAccess(t *testing.T) {
+	type params struct {
+		UserID string
+	}
+	a := guard.OwnerAccess(func(p interface{}) string {
+		return p.(*params).UserID
+	}, "users:write")
+
+	testCases := []struct {
+		description   string
+		user          *auth.User
+		session       *auth.Session
+		expectedError *int
+	}{
+		{
+			"Anonymous user",
+			nil,
+			nil,
+			ptrs.NewInt(int(apperror.Unauthenticated)),
+		},
+		{
+			"Other user",
+			&auth.User{ID: "yyy"},
+			nil,
+			ptrs.NewInt(int(apperror.PermissionDenied)),
+		},
+		{
+			"Owner",
+			&auth.User{ID: "xxx"},
+			nil,
+			nil,
+		},
+		{
+			"User with bypass permission",
+			&auth.User{ID: "yyy", Permissions: []string{"users:write"}},
+			nil,
+			nil,
+		},
+		{
+			"Admin",
+			&auth.User{ID: "yyy", IsAdmin: true},
+			nil,
+			nil,
+		},
+		{
+			"Owner waiting for MFA",
+			&auth.User{ID: "xxx"},
+			&auth.Session{MFAStatus: auth.MFAPending},
+			ptrs.NewInt(int(apperror.Unauthenticated)),
 		},
 	}
 
@@ -77,7 +439,7 @@ func TestAdminAccess(t *testing.T) {
 		t.Run(tc.description, func(t *testing.T) {
 			t.Parallel()
 
-			err := guard.AdminAccess(tc.user)
+			err := a(tc.user, tc.session, &params{UserID: "xxx"})
 			if tc.expectedError == nil {
 				assert.Nil(t, err, "access should have not been denied: %s", err)
 			} else {
@@ -0,0 +1,385 @@
+package guard
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	params "github.com/Nivl/go-params"
+	"github.com/Nivl/go-params/perror"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+)
+
+const (
+	// NullSource is the name of the source containing the fields of
+	// the body that have been explicitly set to null
+	NullSource = "null"
+
+	// ErrMsgNotAnObject represents the error message corresponding to
+	// a value that should be an object
+	ErrMsgNotAnObject = "not an object"
+
+	// ErrMsgNotAList represents the error message corresponding to
+	// a value that should be a list
+	ErrMsgNotAList = "not a list"
+
+	// ErrMsgInvalidNumber represents the error message corresponding to
+	// a value that should be a number
+	ErrMsgInvalidNumber = "invalid number"
+
+	// ErrMsgNotAString represents the error message corresponding to
+	// a value that should be a string
+	ErrMsgNotAString = "not a string"
+
+	// ErrMsgInvalidJSON represents the error message corresponding to
+	// a value that is not valid JSON
+	ErrMsgInvalidJSON = "invalid JSON"
+)
+
+// NullFieldsSetter is implemented by the param structs that need to
+// differentiate a field explicitly set to null from a missing field.
+// A field set to null is otherwise treated as missing
+type NullFieldsSetter interface {
+	// SetNullFields is called with the names of the fields of the body
+	// that have been set to null
+	SetNullFields(fields []string)
+}
+
+var scannerType = reflect.TypeOf((*params.Scanner)(nil)).Elem()
+
+// isScanner checks if a type can be parsed from a string by go-params
+func isScanner(t reflect.Type) bool {
+	return t.Implements(scannerType) || reflect.PtrTo(t).Implements(scannerType)
+}
+
+// isComplex checks if a type cannot be parsed from a string, and needs
+// to be decoded from JSON. This is the case for the structs,
+// the maps, and the lists of structs, maps or lists
+func isComplex(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return !isScanner(t)
+	case reflect.Map:
+		return true
+	case reflect.Slice:
+		elem := t.Elem()
+		if elem.Kind() == reflect.Ptr {
+			elem = elem.Elem()
+		}
+		return (elem.Kind() == reflect.Struct && !isScanner(elem)) ||
+			elem.Kind() == reflect.Map ||
+			elem.Kind() == reflect.Slice
+	}
+	return false
+}
+
+// fieldName returns the name of a field in the payload, or an empty
+// string if the field should be ignored
+func fieldName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	switch name {
+	case "-":
+		return ""
+	case "":
+		return field.Name
+	}
+	return name
+}
+
+// decodeComplexFields decodes and validates all the complex fields of
+// the provided struct, using the raw JSON found in the sources
+func decodeComplexFields(v reflect.Value, sources map[string]url.Values) []*apperror.FieldError {
+	fieldErrors := []*apperror.FieldError{}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			fieldErrors = append(fieldErrors, decodeComplexFields(v.Field(i), sources)...)
+			continue
+		}
+
+		from := strings.ToLower(field.Tag.Get("from"))
+		name := fieldName(field)
+		if !isComplex(field.Type) || from == "file" || name == "" {
+			continue
+		}
+
+		raws := sources[from][name]
+		if len(raws) == 0 {
+			// go-params already took care of the required fields
+			continue
+		}
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		isList := fieldType.Kind() == reflect.Slice
+		if !isList && len(raws) > 1 {
+			fieldErrors = append(fieldErrors, apperror.NewFieldError(name, apperror.FieldCodeInvalid, ErrMsgNotAnObject))
+			continue
+		}
+
+		// the items of the lists are sent one by one
+		items := make([]interface{}, len(raws))
+		var err error
+		for j, raw := range raws {
+			if items[j], err = decodeJSON(raw); err != nil {
+				path := name
+				if isList {
+					path = fmt.Sprintf("%s[%d]", name, j)
+				}
+				fieldErrors = append(fieldErrors, apperror.NewFieldError(path, apperror.FieldCodeInvalid, ErrMsgInvalidJSON))
+				break
+			}
+		}
+		if err != nil {
+			continue
+		}
+
+		var raw interface{} = items[0]
+		if isList {
+			raw = items
+		}
+		fieldErrors = append(fieldErrors, decodeComplex(name, raw, v.Field(i))...)
+	}
+	return fieldErrors
+}
+
+// decodeJSON decodes a raw JSON value
+func decodeJSON(raw string) (interface{}, error) {
+	var v interface{}
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// decodeComplex sets the value of target using the decoded JSON raw.
+// path contains the path to target in the payload. ex. items[2].price
+func decodeComplex(path string, raw interface{}, target reflect.Value) []*apperror.FieldError {
+	if raw == nil {
+		return nil
+	}
+
+	t := target.Type()
+	if t.Kind() == reflect.Ptr {
+		if target.IsNil() {
+			target.Set(reflect.New(t.Elem()))
+		}
+		return decodeComplex(path, raw, target.Elem())
+	}
+
+	switch {
+	case t.Kind() == reflect.Struct && !isScanner(t):
+		obj, ok := raw.(map[string]interface{})
+		if !ok {
+			return []*apperror.FieldError{apperror.NewFieldError(path, apperror.FieldCodeInvalid, ErrMsgNotAnObject)}
+		}
+		return decodeStruct(path, obj, target)
+	case t.Kind() == reflect.Slice && isComplex(t):
+		list, ok := raw.([]interface{})
+		if !ok {
+			return []*apperror.FieldError{apperror.NewFieldError(path, apperror.FieldCodeInvalid, ErrMsgNotAList)}
+		}
+		fieldErrors := []*apperror.FieldError{}
+		slice := reflect.MakeSlice(t, len(list), len(list))
+		for i, item := range list {
+			fieldErrors = append(fieldErrors, decodeComplex(fmt.Sprintf("%s[%d]", path, i), item, slice.Index(i))...)
+		}
+		target.Set(slice)
+		return fieldErrors
+	}
+
+	// the maps and all the other types are decoded by the json package
+	data, err := json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(data, target.Addr().Interface())
+	}
+	if err != nil {
+		// The error contains the type of the nested value that failed
+		if e, ok := err.(*json.UnmarshalTypeError); ok {
+			t = e.Type
+		}
+		return []*apperror.FieldError{apperror.NewFieldError(path, apperror.FieldCodeInvalid, typeErrorMessage(t))}
+	}
+	return nil
+}
+
+// typeErrorMessage returns the error message corresponding to a value
+// that cannot be decoded into the type t
+func typeErrorMessage(t reflect.Type) string {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Map, reflect.Struct:
+		return ErrMsgNotAnObject
+	case reflect.Slice, reflect.Array:
+		return ErrMsgNotAList
+	case reflect.String:
+		return ErrMsgNotAString
+	case reflect.Bool:
+		return params.ErrMsgInvalidBoolean
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return params.ErrMsgInvalidInteger
+	case reflect.Float32, reflect.Float64:
+		return ErrMsgInvalidNumber
+	}
+	return ErrMsgInvalidJSON
+}
+
+// decodeStruct sets the fields of target using the provided object.
+// The fields that are not complex are parsed and validated by go-params
+func decodeStruct(path string, obj map[string]interface{}, target reflect.Value) []*apperror.FieldError {
+	fieldErrors := []*apperror.FieldError{}
+
+	t := target.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			fieldErrors = append(fieldErrors, decodeStruct(path, obj, target.Field(i))...)
+			continue
+		}
+
+		name := fieldName(field)
+		if name == "" {
+			continue
+		}
+		fieldPath := path + "." + name
+		raw, found := obj[name]
+
+		if isComplex(field.Type) {
+			if raw == nil {
+				if opts, err := params.NewOptions(&field.Tag); err == nil && opts.Required {
+					fieldErrors = append(fieldErrors, apperror.NewFieldError(fieldPath, apperror.FieldCodeMissing, params.ErrMsgMissingParameter))
+				}
+				continue
+			}
+			fieldErrors = append(fieldErrors, decodeComplex(fieldPath, raw, target.Field(i))...)
+			continue
+		}
+
+		if fieldError := decodeScalar(fieldPath, field, raw, found && raw != nil, target.Field(i)); fieldError != nil {
+			fieldErrors = append(fieldErrors, fieldError)
+		}
+	}
+	return fieldErrors
+}
+
+// decodeScalar parses and validates a field that is not complex
+func decodeScalar(path string, field reflect.StructField, raw interface{}, found bool, target reflect.Value) *apperror.FieldError {
+	name := fieldName(field)
+	values := url.Values{}
+	if found {
+		if list, ok := raw.([]interface{}); ok {
+			values[name] = make([]string, 0, len(list))
+			for _, item := range list {
+				values.Add(name, scalarString(item))
+			}
+		} else {
+			values.Set(name, scalarString(raw))
+		}
+	}
+
+	// go-params doesn't support floats
+	t := field.Type
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64 {
+		return decodeFloat(path, field, values.Get(name), found, target)
+	}
+
+	// We parse a struct only containing the field, using the body as source
+	tmp := reflect.New(reflect.StructOf([]reflect.StructField{{
+		Name: field.Name,
+		Type: field.Type,
+		Tag:  reflect.StructTag(`from:"form" ` + string(field.Tag)),
+	}}))
+	err := params.New(tmp.Interface()).Parse(map[string]url.Values{"form": values}, nil)
+	if err != nil {
+		msg := err.Error()
+		if e, ok := err.(perror.Error); ok {
+			msg = e.Error()
+		}
+		return apperror.NewFieldError(path, "", msg)
+	}
+	target.Set(tmp.Elem().Field(0))
+	return nil
+}
+
+// decodeFloat parses and validates a float field
+func decodeFloat(path string, field reflect.StructField, value string, found bool, target reflect.Value) *apperror.FieldError {
+	opts, err := params.NewOptions(&field.Tag)
+	if err != nil {
+		return apperror.NewFieldError(path, "", err.Error())
+	}
+	if value == "" {
+		value = field.Tag.Get("default")
+	}
+	if err := opts.Validate(value, found, false); err != nil {
+		return apperror.NewFieldError(path, "", err.Error())
+	}
+	if value == "" {
+		return nil
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return apperror.NewFieldError(path, apperror.FieldCodeInvalid, ErrMsgInvalidNumber)
+	}
+	if target.Kind() == reflect.Ptr {
+		target.Set(reflect.New(target.Type().Elem()))
+		target = target.Elem()
+	}
+	target.SetFloat(f)
+	return nil
+}
+
+// scalarString returns the string representation of a decoded JSON value
+func scalarString(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case bool:
+		return strconv.FormatBool(value)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(data)
+}
+
+// nullFields returns the sorted list of the fields set to null
+func nullFields(sources map[string]url.Values) []string {
+	fields := make([]string, 0, len(sources[NullSource]))
+	for name := range sources[NullSource] {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields
+}
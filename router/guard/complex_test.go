@@ -0,0 +1,157 @@
+package guard_test
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/Nivl/go-rest-tools/router/guard"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type orderItem struct {
+	SKU      string   `json:"sku" params:"required"`
+	Quantity int      `json:"quantity" min_int:"1"`
+	Price    float64  `json:"price" params:"required"`
+	Discount *float64 `json:"discount"`
+}
+
+type orderAddress struct {
+	City    string `json:"city" params:"required"`
+	Country string `json:"country" enum:"fr,us"`
+}
+
+type orderParams struct {
+	Reference string            `from:"form" json:"reference"`
+	Amount    int               `from:"form" json:"amount"`
+	Items     []*orderItem      `from:"form" json:"items" params:"required" min_items:"1"`
+	Address   *orderAddress     `from:"form" json:"address"`
+	Metadata  map[string]string `from:"form" json:"metadata"`
+	Note      *string           `from:"form" json:"note"`
+
+	Nulls []string `from:"form" json:"-"`
+}
+
+func (p *orderParams) SetNullFields(fields []string) {
+	p.Nulls = fields
+}
+
+func TestParseParamsNested(t *testing.T) {
+	t.Parallel()
+
+	sources := map[string]url.Values{
+		"form": url.Values{
+			"reference": []string{"12345678901234567890"},
+			"amount":    []string{"1000000"},
+			"items": []string{
+				`{"sku":"a","quantity":2,"price":10.5}`,
+				`{"sku":"b","quantity":1,"price":3,"discount":0.5}`,
+			},
+			"address":  []string{`{"city":"Paris","country":"fr"}`},
+			"metadata": []string{`{"source":"app"}`},
+		},
+		guard.NullSource: url.Values{"note": []string{""}},
+	}
+
+	g := &guard.Guard{ParamStruct: &orderParams{}}
+	data, err := g.ParseParams(sources, nil)
+	require.NoError(t, err)
+
+	p := data.(*orderParams)
+	assert.Equal(t, "12345678901234567890", p.Reference)
+	assert.Equal(t, 1000000, p.Amount)
+	require.Len(t, p.Items, 2)
+	assert.Equal(t, &orderItem{SKU: "a", Quantity: 2, Price: 10.5}, p.Items[0])
+	require.NotNil(t, p.Items[1].Discount)
+	assert.Equal(t, 0.5, *p.Items[1].Discount)
+	assert.Equal(t, &orderAddress{City: "Paris", Country: "fr"}, p.Address)
+	assert.Equal(t, map[string]string{"source": "app"}, p.Metadata)
+	assert.Nil(t, p.Note)
+	assert.Equal(t, []string{"note"}, p.Nulls)
+}
+
+func TestParseParamsNestedErrors(t *testing.T) {
+	testCases := []struct {
+		description string
+		form        url.Values
+		expected    []*apperror.FieldError
+	}{
+		{
+			"invalid nested fields",
+			url.Values{
+				"items": []string{
+					`{"sku":"a","price":1}`,
+					`{"sku":"b","price":1}`,
+					`{"quantity":0,"price":"nope"}`,
+				},
+				"address": []string{`{"country":"de"}`},
+			},
+			[]*apperror.FieldError{
+				{Field: "items[2].sku", Code: apperror.FieldCodeMissing, Message: "parameter missing"},
+				{Field: "items[2].quantity", Code: apperror.FieldCodeTooLow, Message: "value too small"},
+				{Field: "items[2].price", Code: apperror.FieldCodeInvalid, Message: guard.ErrMsgInvalidNumber},
+				{Field: "address.city", Code: apperror.FieldCodeMissing, Message: "parameter missing"},
+				{Field: "address.country", Code: apperror.FieldCodeNotInEnum, Message: "not a valid value"},
+			},
+		},
+		{
+			"wrong types",
+			url.Values{
+				"items":   []string{`"a"`},
+				"address": []string{`[1]`},
+			},
+			[]*apperror.FieldError{
+				{Field: "items[0]", Code: apperror.FieldCodeInvalid, Message: guard.ErrMsgNotAnObject},
+				{Field: "address", Code: apperror.FieldCodeInvalid, Message: guard.ErrMsgNotAnObject},
+			},
+		},
+		{
+			"malformed JSON and wrong nested types",
+			url.Values{
+				"items":    []string{`{"sku":`},
+				"metadata": []string{`{"source":1}`},
+			},
+			[]*apperror.FieldError{
+				{Field: "items[0]", Code: apperror.FieldCodeInvalid, Message: guard.ErrMsgInvalidJSON},
+				{Field: "metadata", Code: apperror.FieldCodeInvalid, Message: guard.ErrMsgNotAString},
+			},
+		},
+		{
+			"map sent as a list",
+			url.Values{
+				"items":    []string{`{"sku":"a","price":1}`},
+				"metadata": []string{`["app"]`},
+			},
+			[]*apperror.FieldError{
+				{Field: "metadata", Code: apperror.FieldCodeInvalid, Message: guard.ErrMsgNotAnObject},
+			},
+		},
+		{
+			"missing required list along with a nested error",
+			url.Values{
+				"amount":  []string{"nope"},
+				"address": []string{`{"city":"Paris","country":"us"}`},
+			},
+			[]*apperror.FieldError{
+				{Field: "amount", Code: apperror.FieldCodeInvalidInt, Message: "invalid integer"},
+				{Field: "items", Code: apperror.FieldCodeMissing, Message: "parameter missing"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			g := &guard.Guard{ParamStruct: &orderParams{}}
+			_, err := g.ParseParams(map[string]url.Values{"form": tc.form}, nil)
+			require.Error(t, err)
+
+			e := apperror.Convert(err)
+			assert.True(t, apperror.IsBadRequest(e))
+			assert.Equal(t, tc.expected, e.FieldErrors())
+		})
+	}
+}
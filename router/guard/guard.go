@@ -6,6 +6,8 @@ import (
 
 	"github.com/Nivl/go-params"
 	"github.com/Nivl/go-params/formfile"
+	"github.com/Nivl/go-params/perror"
+	"github.com/Nivl/go-rest-tools/router/ratelimit"
 	"github.com/Nivl/go-rest-tools/security/auth"
 	"github.com/Nivl/go-rest-tools/types/apperror"
 )
@@ -18,10 +20,26 @@ type Guard struct {
 
 	// Auth is used to add a auth middleware
 	Auth RouteAuth
+
+	// ParamsAuth is used to add an auth middleware that needs the params
+	// of the request. It is executed after the params have been parsed
+	ParamsAuth ParamsAuth
+
+	// Scopes contains the scopes an API key needs to be granted to access
+	// the endpoint. The endpoints that don't declare any scope cannot be
+	// accessed using an API key. The users authenticated with a session
+	// are not restricted by the scopes
+	Scopes []string
+
+	// RateLimits contains the rate limits applied to the endpoint, in
+	// addition to the global ones. They are checked once the client
+	// has been authenticated
+	RateLimits []*ratelimit.Rule
 }
 
 // ParseParams parses and returns the list of params needed
-// Returns an error if a required param is missing, or if a type is wrong
+// Returns an error if a required param is missing, or if a type is wrong.
+// When several params are invalid, the returned error contains all of them
 func (g *Guard) ParseParams(sources map[string]url.Values, fileHolder formfile.FileHolder) (interface{}, error) {
 	// It's ok not to have a guard provided, as well as not having params
 	if g == nil || g.ParamStruct == nil {
@@ -29,21 +47,149 @@ func (g *Guard) ParseParams(sources map[string]url.Values, fileHolder formfile.F
 	}
 
 	// We give p the same type as g.ParamStruct
-	p := reflect.New(reflect.TypeOf(g.ParamStruct).Elem()).Interface()
-	err := params.New(p).Parse(sources, fileHolder)
+	typ := reflect.TypeOf(g.ParamStruct).Elem()
+	p := reflect.New(typ)
+	err := params.New(p.Interface()).Parse(sources, fileHolder)
 	if err != nil {
-		return nil, apperror.NewFromError(err)
+		if _, isParamError := err.(perror.Error); !isParamError {
+			return nil, apperror.NewFromError(err)
+		}
+	}
+
+	// go-params doesn't support nested objects, so we take care of them
+	complexErrors := decodeComplexFields(p.Elem(), sources)
+	if err == nil && len(complexErrors) == 0 {
+		// The custom validation has been run by go-params before
+		// the complex fields were set
+		if validator, ok := p.Interface().(params.CustomValidation); ok && hasComplexFields(typ) {
+			if isValid, field, err := validator.IsValid(); !isValid {
+				return nil, apperror.NewFromError(perror.New(field, err.Error()))
+			}
+		}
+		if setter, ok := p.Interface().(NullFieldsSetter); ok {
+			setter.SetNullFields(nullFields(sources))
+		}
+		return p.Interface(), nil
+	}
+
+	// go-params stops at the first error, so we parse the fields
+	// one by one to report all the invalid params at once
+	fieldErrors := []*apperror.FieldError{}
+	if err != nil {
+		fieldErrors = collectFieldErrors(typ, sources, fileHolder)
+		if len(fieldErrors) == 0 {
+			fieldErrors = apperror.Convert(apperror.NewFromError(err)).FieldErrors()
+		}
+	}
+	for _, complexError := range complexErrors {
+		if !hasFieldError(fieldErrors, complexError.Field) {
+			fieldErrors = append(fieldErrors, complexError)
+		}
 	}
-	return p, nil
+	return nil, apperror.NewValidationError(fieldErrors...)
 }
 
-// HasAccess check if a given user has access to the
-func (g *Guard) HasAccess(u *auth.User) (bool, apperror.Error) {
+// hasFieldError checks if the list contains an error for the given field
+func hasFieldError(fieldErrors []*apperror.FieldError, field string) bool {
+	for _, fieldError := range fieldErrors {
+		if fieldError.Field == field {
+			return true
+		}
+	}
+	return false
+}
+
+// hasComplexFields checks if the provided struct type contains at least
+// one complex field
+func hasComplexFields(typ reflect.Type) bool {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if hasComplexFields(field.Type) {
+				return true
+			}
+			continue
+		}
+		if field.PkgPath == "" && isComplex(field.Type) {
+			return true
+		}
+	}
+	return false
+}
+
+// collectFieldErrors parses all the fields of the given struct type
+// separately and returns all the errors
+func collectFieldErrors(typ reflect.Type, sources map[string]url.Values, fileHolder formfile.FileHolder) []*apperror.FieldError {
+	fieldErrors := []*apperror.FieldError{}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		// unexported fields are ignored by go-params
+		if field.PkgPath != "" {
+			continue
+		}
+
+		var target reflect.Value
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			target = reflect.New(field.Type)
+		} else {
+			target = reflect.New(reflect.StructOf([]reflect.StructField{{
+				Name: field.Name,
+				Type: field.Type,
+				Tag:  field.Tag,
+			}}))
+		}
+
+		err := params.New(target.Interface()).Parse(sources, fileHolder)
+		if e, ok := err.(perror.Error); ok {
+			fieldErrors = append(fieldErrors, apperror.NewFieldError(e.Field(), "", e.Error()))
+		}
+	}
+	return fieldErrors
+}
+
+// HasAccess check if a given user has access to the endpoint.
+// s is the session used to authenticate the user, and k the API key used
+// by the client, if any.
+// The clients using an API key are denied access unless the endpoint
+// declares scopes that the key has been granted
+func (g *Guard) HasAccess(u *auth.User, s *auth.Session, k *auth.APIKey) (bool, apperror.Error) {
+	if k != nil {
+		if err := g.checkScopes(k); err != nil {
+			return false, err
+		}
+	}
+
 	// It's ok not to have a guard provided, as well as not having an auth check
 	if g == nil || g.Auth == nil {
 		return true, nil
 	}
 
-	err := g.Auth(u)
+	err := g.Auth(u, s)
+	return err == nil, err
+}
+
+// checkScopes checks that the provided key has been granted all the
+// scopes of the endpoint
+func (g *Guard) checkScopes(k *auth.APIKey) apperror.Error {
+	if g == nil || len(g.Scopes) == 0 {
+		return apperror.NewForbiddenR(auth.ErrMsgMissingScope)
+	}
+	for _, s := range g.Scopes {
+		if !k.HasScope(s) {
+			return apperror.NewForbiddenR(auth.ErrMsgMissingScope)
+		}
+	}
+	return nil
+}
+
+// HasParamsAccess check if a given user has access to the endpoint using
+// the provided params. s is the session used to authenticate the user
+func (g *Guard) HasParamsAccess(u *auth.User, s *auth.Session, params interface{}) (bool, apperror.Error) {
+	// It's ok not to have a guard provided, as well as not having an auth check
+	if g == nil || g.ParamsAuth == nil {
+		return true, nil
+	}
+
+	err := g.ParamsAuth(u, s, params)
 	return err == nil, err
 }
@@ -6,7 +6,9 @@ import (
 
 	"github.com/Nivl/go-rest-tools/router/guard"
 	"github.com/Nivl/go-rest-tools/security/auth"
+	"github.com/Nivl/go-rest-tools/types/apperror"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type BasicParamStruct struct {
@@ -116,6 +118,75 @@ func TestParseParams(t *testing.T) {
 	}
 }
 
+type EmbeddingParamStruct struct {
+	BasicParamStruct
+
+	Limit int `from:"query" json:"limit" params:"required"`
+}
+
+func TestParseParamsAllErrors(t *testing.T) {
+	testCases := []struct {
+		description string
+		paramStruct interface{}
+		sources     map[string]url.Values
+		expected    []*apperror.FieldError
+	}{
+		{
+			"one invalid field",
+			&BasicParamStruct{},
+			map[string]url.Values{
+				"url":  url.Values{"uuid": []string{"5847a692"}},
+				"form": url.Values{"required": []string{"required data"}},
+			},
+			[]*apperror.FieldError{
+				{Field: "uuid", Code: apperror.FieldCodeInvalidUUID, Message: "not a valid uuid"},
+			},
+		},
+		{
+			"all invalid fields",
+			&BasicParamStruct{},
+			map[string]url.Values{
+				"url":  url.Values{"uuid": []string{"5847a692"}},
+				"form": url.Values{"pointer": []string{"nope"}},
+			},
+			[]*apperror.FieldError{
+				{Field: "uuid", Code: apperror.FieldCodeInvalidUUID, Message: "not a valid uuid"},
+				{Field: "required", Code: apperror.FieldCodeMissing, Message: "parameter missing"},
+				{Field: "pointer", Code: apperror.FieldCodeInvalidInt, Message: "invalid integer"},
+			},
+		},
+		{
+			"embedded struct",
+			&EmbeddingParamStruct{},
+			map[string]url.Values{
+				"url":   url.Values{"uuid": []string{"5847a692"}},
+				"query": url.Values{},
+			},
+			[]*apperror.FieldError{
+				{Field: "uuid", Code: apperror.FieldCodeInvalidUUID, Message: "not a valid uuid"},
+				{Field: "limit", Code: apperror.FieldCodeMissing, Message: "parameter missing"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			g := &guard.Guard{ParamStruct: tc.paramStruct}
+			_, err := g.ParseParams(tc.sources, nil)
+			require.NotNil(t, err, "the parsing was expected to fail")
+
+			e, ok := err.(apperror.Error)
+			require.True(t, ok, "expected an apperror.Error")
+			assert.True(t, apperror.IsBadRequest(e), "expected a bad request")
+			assert.Equal(t, tc.expected[0].Field, e.Field(), "the first field should be the main one")
+			assert.Equal(t, tc.expected, e.FieldErrors())
+		})
+	}
+}
+
 func TestNoParseParams(t *testing.T) {
 	testCases := []struct {
 		description string
@@ -148,22 +219,135 @@ func TestAuth(t *testing.T) {
 		description string
 		guard       *guard.Guard
 		user        *auth.User
+		session     *auth.Session
+		apiKey      *auth.APIKey
 		shouldFail  bool
 	}{
-		{"no guards should work", nil, nil, !shouldFail},
-		{"no Auth should work", &guard.Guard{}, nil, !shouldFail},
+		{"no guards should work", nil, nil, nil, nil, !shouldFail},
+		{"no Auth should work", &guard.Guard{}, nil, nil, nil, !shouldFail},
 		{
 			"valid auth",
 			&guard.Guard{Auth: guard.LoggedUserAccess},
 			&auth.User{ID: "xxx"},
+			nil,
+			nil,
 			!shouldFail,
 		},
 		{
 			"invalid auth",
 			&guard.Guard{Auth: guard.LoggedUserAccess},
 			nil,
+			nil,
+			nil,
+			shouldFail,
+		},
+		{
+			"session waiting for MFA",
+			&guard.Guard{Auth: guard.LoggedUserAccess},
+			&auth.User{ID: "xxx"},
+			&auth.Session{MFAStatus: auth.MFAPending},
+			nil,
+			shouldFail,
+		},
+		{
+			"session waiting for MFA on an MFA endpoint",
+			&guard.Guard{Auth: guard.MFAPendingAccess},
+			&auth.User{ID: "xxx"},
+			&auth.Session{MFAStatus: auth.MFAPending},
+			nil,
+			!shouldFail,
+		},
+		{
+			"api key without guard",
+			nil,
+			&auth.User{ID: "xxx"},
+			nil,
+			&auth.APIKey{Scopes: []string{"*"}},
 			shouldFail,
 		},
+		{
+			"api key on an endpoint without scopes",
+			&guard.Guard{Auth: guard.AdminAccess},
+			&auth.User{ID: "xxx", IsAdmin: true},
+			nil,
+			&auth.APIKey{Scopes: []string{"articles:read"}},
+			shouldFail,
+		},
+		{
+			"api key missing a scope",
+			&guard.Guard{Auth: guard.LoggedUserAccess, Scopes: []string{"articles:read", "articles:write"}},
+			&auth.User{ID: "xxx"},
+			nil,
+			&auth.APIKey{Scopes: []string{"articles:read"}},
+			shouldFail,
+		},
+		{
+			"api key with no scopes",
+			&guard.Guard{Auth: guard.LoggedUserAccess, Scopes: []string{"articles:read"}},
+			&auth.User{ID: "xxx"},
+			nil,
+			&auth.APIKey{},
+			shouldFail,
+		},
+		{
+			"api key with all the scopes",
+			&guard.Guard{Auth: guard.LoggedUserAccess, Scopes: []string{"articles:read", "articles:write"}},
+			&auth.User{ID: "xxx"},
+			nil,
+			&auth.APIKey{Scopes: []string{"articles:*"}},
+			!shouldFail,
+		},
+		{
+			"scopes don't restrict the sessions",
+			&guard.Guard{Auth: guard.LoggedUserAccess, Scopes: []string{"articles:read"}},
+			&auth.User{ID: "xxx"},
+			nil,
+			nil,
+			!shouldFail,
+		},
+		{
+			"scopes don't replace the auth",
+			&guard.Guard{Auth: guard.AdminAccess, Scopes: []string{"articles:read"}},
+			&auth.User{ID: "xxx"},
+			nil,
+			&auth.APIKey{Scopes: []string{"articles:read"}},
+			shouldFail,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			success, err := tc.guard.HasAccess(tc.user, tc.session, tc.apiKey)
+			if tc.shouldFail {
+				assert.False(t, success, "the access should have been denied")
+				assert.NotNil(t, err, "an error should have been returned")
+			} else {
+				assert.True(t, success, "the access should have been granted")
+				assert.Nil(t, err, "no error should have been returned")
+			}
+		})
+	}
+}
+
+func TestParamsAuth(t *testing.T) {
+	ownerOnly := guard.OwnerAccess(func(p interface{}) string {
+		return p.(*BasicParamStruct).UUID
+	})
+	params := &BasicParamStruct{UUID: "xxx"}
+
+	testCases := []struct {
+		description string
+		guard       *guard.Guard
+		user        *auth.User
+		shouldFail  bool
+	}{
+		{"no guards should work", nil, nil, false},
+		{"no ParamsAuth should work", &guard.Guard{}, nil, false},
+		{"owner", &guard.Guard{ParamsAuth: ownerOnly}, &auth.User{ID: "xxx"}, false},
+		{"not the owner", &guard.Guard{ParamsAuth: ownerOnly}, &auth.User{ID: "yyy"}, true},
 	}
 
 	for _, tc := range testCases {
@@ -171,7 +355,7 @@ func TestAuth(t *testing.T) {
 		t.Run(tc.description, func(t *testing.T) {
 			t.Parallel()
 
-			success, err := tc.guard.HasAccess(tc.user)
+			success, err := tc.guard.HasParamsAccess(tc.user, nil, params)
 			if tc.shouldFail {
 				assert.False(t, success, "the access should have been denied")
 				assert.NotNil(t, err, "an error should have been returned")
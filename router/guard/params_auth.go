@@ -0,0 +1,38 @@
+package guard
+
+import (
+	"github.com/Nivl/go-rest-tools/security/auth"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+)
+
+// ParamsAuth represents a middleware used to allow/block the access to an
+// endpoint using the parsed params of the request.
+// It is executed after the params have been parsed, which makes it
+// possible to check if the user owns the requested resource
+type ParamsAuth func(u *auth.User, s *auth.Session, params interface{}) apperror.Error
+
+// OwnerAccess returns a ParamsAuth that only grants access to the owner of
+// the requested resource. ownerID is used to retrieve the ID of the owner
+// from the params.
+// The users having one of the bypass permissions (and the admins) are
+// granted access regardless of the ownership.
+// The users that still have to provide a second factor are filtered out
+func OwnerAccess(ownerID func(params interface{}) string, bypass ...string) ParamsAuth {
+	return func(u *auth.User, s *auth.Session, params interface{}) apperror.Error {
+		if err := LoggedUserAccess(u, s); err != nil {
+			return err
+		}
+		if u.ID == ownerID(params) {
+			return nil
+		}
+		for _, p := range bypass {
+			if u.HasPermission(p) {
+				return nil
+			}
+		}
+		if u.IsAdmin {
+			return nil
+		}
+		return apperror.NewForbidden()
+	}
+}
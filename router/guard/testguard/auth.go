@@ -12,7 +12,9 @@ import (
 type AccessTestCase struct {
 	Description string
 	User        *auth.User
-	ErrCode     int // <= 0 for no error
+	Session     *auth.Session // nil when not using a session
+	APIKey      *auth.APIKey  // nil when not using an API key
+	ErrCode     int           // <= 0 for no error
 }
 
 // AccessTest checks if the auth are correctly set
@@ -22,7 +24,7 @@ func AccessTest(t *testing.T, g *guard.Guard, testCases []AccessTestCase) {
 		t.Run(tc.Description, func(t *testing.T) {
 			t.Parallel()
 
-			_, err := g.HasAccess(tc.User)
+			_, err := g.HasAccess(tc.User, tc.Session, tc.APIKey)
 			if tc.ErrCode > 0 {
 				assert.Error(t, err)
 				assert.Equal(t, tc.ErrCode, err.StatusCode())
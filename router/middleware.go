@@ -0,0 +1,21 @@
+package router
+
+// Middleware represents a function that wraps a RouteHandler to add behavior
+// before and/or after its execution.
+//
+// Middlewares are executed after all the built-in steps of the pipeline
+// (request creation, authentication, access check, and params parsing), so
+// request.User(), request.Session() and request.Params() are already
+// available. The global middlewares (provided to Activate) are executed
+// first, in the order they have been provided, followed by the middlewares
+// of the endpoint, and finally the RouteHandler itself
+type Middleware func(RouteHandler) RouteHandler
+
+// chain wraps a RouteHandler with the provided middlewares. The first
+// middleware of the list will be the first one executed
+func chain(h RouteHandler, middlewares ...Middleware) RouteHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
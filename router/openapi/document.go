@@ -0,0 +1,130 @@
+// Package openapi generates the OpenAPI 3 documentation of a list of
+// endpoints
+package openapi
+
+// Version contains the version of the OpenAPI specification used by
+// the generated documents
+const Version = "3.0.3"
+
+// Document represents an OpenAPI document
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Servers    []*Server                        `json:"servers,omitempty"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components *Components                      `json:"components,omitempty"`
+}
+
+// Info contains the metadata of the API
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// Server represents a server hosting the API
+type Server struct {
+	URL string `json:"url"`
+}
+
+// Operation represents an endpoint
+type Operation struct {
+	OperationID string                `json:"operationId,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []SecurityRequirement `json:"security,omitempty"`
+}
+
+// Parameter represents a param sent in the path or the query string
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+// RequestBody represents the body of a request
+type RequestBody struct {
+	Required bool                  `json:"required,omitempty"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+// MediaType represents the content of a body for a specific media type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Response represents a response of an endpoint. Ref is used to
+// reference a response declared in the components
+type Response struct {
+	Ref         string                `json:"$ref,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// Schema represents the type of a value
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Maximum              *int               `json:"maximum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// Components contains the objects referenced by the rest of the document
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	Responses       map[string]*Response       `json:"responses,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme represents a way to authenticate the requests
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Description  string `json:"description,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+}
+
+// SecurityRequirement contains the security schemes needed to access an
+// endpoint, with the scopes required for each of them
+type SecurityRequirement map[string][]string
+
+var (
+	// SessionScheme is the security scheme used by router.SessionAuthenticator
+	SessionScheme = &SecurityScheme{
+		Type:        "http",
+		Scheme:      "basic",
+		Description: "The username is the ID of the user, and the password is the ID of the session",
+	}
+
+	// BearerScheme is the security scheme used by router.BearerAuthenticator
+	BearerScheme = &SecurityScheme{
+		Type:   "http",
+		Scheme: "bearer",
+	}
+
+	// APIKeyScheme is the security scheme used by router.APIKeyAuthenticator
+	APIKeyScheme = &SecurityScheme{
+		Type: "apiKey",
+		Name: "X-API-Key",
+		In:   "header",
+	}
+)
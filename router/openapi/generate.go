@@ -0,0 +1,485 @@
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	params "github.com/Nivl/go-params"
+	"github.com/Nivl/go-params/formfile"
+	"github.com/Nivl/go-rest-tools/router"
+	"github.com/Nivl/go-rest-tools/router/guard"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	"github.com/Nivl/go-types/ptrs"
+)
+
+// slugPattern matches the values accepted by the slug validator of
+// go-params
+const slugPattern = `^[a-z0-9]+(?:-[a-z0-9]+)*$`
+
+var (
+	scannerType  = reflect.TypeOf((*params.Scanner)(nil)).Elem()
+	formFileType = reflect.TypeOf(&formfile.FormFile{})
+)
+
+// Option represents a function used to configure the generated document
+type Option func(*generator)
+
+// generator contains the configuration and the state of a generation
+type generator struct {
+	doc             *Document
+	schemas         *schemaRegistry
+	responses       map[string]*Response
+	securitySchemes map[string]*SecurityScheme
+	errorFormat     router.ErrorFormat
+	operationIDs    map[string]bool
+}
+
+// WithServer adds the URL of a server hosting the API
+func WithServer(url string) Option {
+	return func(g *generator) {
+		g.doc.Servers = append(g.doc.Servers, &Server{URL: url})
+	}
+}
+
+// WithSecurityScheme adds a way to authenticate the requests. The
+// endpoints having a guard.Guard.Auth accept any of the schemes.
+// Default to SessionScheme, named "session"
+func WithSecurityScheme(name string, s *SecurityScheme) Option {
+	return func(g *generator) {
+		if g.securitySchemes == nil {
+			g.securitySchemes = map[string]*SecurityScheme{}
+		}
+		g.securitySchemes[name] = s
+	}
+}
+
+// WithErrorFormat sets the format of the errors. It needs to match the
+// format given to router.WithErrorFormat.
+// Default to router.ErrorFormatDefault
+func WithErrorFormat(f router.ErrorFormat) Option {
+	return func(g *generator) {
+		g.errorFormat = f
+	}
+}
+
+// Generate returns the OpenAPI document describing the provided endpoints
+func Generate(endpoints router.Endpoints, info Info, opts ...Option) *Document {
+	g := &generator{
+		doc: &Document{
+			OpenAPI: Version,
+			Info:    info,
+			Paths:   map[string]map[string]*Operation{},
+		},
+		schemas:      newSchemaRegistry(),
+		responses:    map[string]*Response{},
+		operationIDs: map[string]bool{},
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if g.securitySchemes == nil {
+		g.securitySchemes = map[string]*SecurityScheme{"session": SessionScheme}
+	}
+
+	for _, e := range endpoints {
+		path, pathParams := parsePath(e.Path)
+		if g.doc.Paths[path] == nil {
+			g.doc.Paths[path] = map[string]*Operation{}
+		}
+		g.doc.Paths[path][strings.ToLower(e.Verb)] = g.operation(e, path, pathParams)
+	}
+
+	g.doc.Components = &Components{
+		Schemas:         g.schemas.schemas,
+		Responses:       g.responses,
+		SecuritySchemes: g.securitySchemes,
+	}
+	return g.doc
+}
+
+// operation returns the documentation of an endpoint
+func (g *generator) operation(e *router.Endpoint, path string, pathParams []string) *Operation {
+	op := &Operation{
+		OperationID: g.operationID(e.Verb, path),
+		Summary:     e.Summary,
+		Tags:        e.Tags,
+		Responses:   map[string]*Response{},
+	}
+
+	hasBody := false
+	if e.Guard != nil && e.Guard.ParamStruct != nil {
+		t := reflect.TypeOf(e.Guard.ParamStruct)
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		body := &Schema{Type: "object", Properties: map[string]*Schema{}}
+		hasFile := g.addParams(op, body, t)
+		if len(body.Properties) > 0 {
+			hasBody = true
+			op.RequestBody = requestBody(body, hasFile)
+		}
+	}
+
+	// The path params that are not part of the param struct still need
+	// to be documented
+	for _, name := range pathParams {
+		if !hasParam(op, name) {
+			op.Parameters = append(op.Parameters, &Parameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+	}
+
+	op.Responses[successStatus(e.Response)] = g.successResponse(e.Response)
+	for _, code := range errorCodes(e, len(pathParams) > 0, hasBody) {
+		status := strconv.Itoa(apperror.HTTPStatusCode(code))
+		op.Responses[status] = g.errorResponse(code)
+	}
+
+	if e.Guard != nil && e.Guard.Auth != nil {
+		op.Security = g.securityRequirements()
+	}
+	return op
+}
+
+// addParams adds the params of the provided struct to the operation.
+// The params of the body are added to the body schema.
+// Returns true if the body contains a file
+func (g *generator) addParams(op *Operation, body *Schema, t reflect.Type) (hasFile bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if g.addParams(op, body, field.Type) {
+				hasFile = true
+			}
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		opts, err := params.NewOptions(&field.Tag)
+		if err != nil || opts.Ignore {
+			continue
+		}
+		name := opts.Name
+		if name == "" {
+			name = field.Name
+		}
+
+		switch strings.ToLower(field.Tag.Get("from")) {
+		case "url":
+			op.Parameters = append(op.Parameters, &Parameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   g.paramSchema(field, opts),
+			})
+		case "query":
+			op.Parameters = append(op.Parameters, &Parameter{
+				Name:     name,
+				In:       "query",
+				Required: opts.Required,
+				Schema:   g.paramSchema(field, opts),
+			})
+		case "cookie":
+			op.Parameters = append(op.Parameters, &Parameter{
+				Name:     name,
+				In:       "cookie",
+				Required: opts.Required,
+				Schema:   g.paramSchema(field, opts),
+			})
+		case "form":
+			body.Properties[name] = g.paramSchema(field, opts)
+			if opts.Required {
+				body.Required = append(body.Required, name)
+			}
+		case "file":
+			hasFile = true
+			body.Properties[name] = &Schema{Type: "string", Format: "binary"}
+			if opts.Required {
+				body.Required = append(body.Required, name)
+			}
+		}
+	}
+	return hasFile
+}
+
+// paramSchema returns the schema of a param using the options of its tags
+func (g *generator) paramSchema(field reflect.StructField, opts *params.Options) *Schema {
+	t := field.Type
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var s *Schema
+	switch {
+	case t == formFileType.Elem():
+		s = &Schema{Type: "string", Format: "binary"}
+	case t.Kind() == reflect.Struct && implements(t, scannerType) && t != dateTimeType:
+		s = &Schema{Type: "string"}
+	default:
+		s = g.schemas.schemaOf(t)
+	}
+
+	// The validations apply to the items of the lists
+	value := s
+	if s.Type == "array" && s.Items != nil && s.Items.Ref == "" {
+		value = s.Items
+		s.MinItems = opts.MinItems
+		s.MaxItems = opts.MaxItems
+		if opts.NoEmpty && s.MinItems == nil {
+			s.MinItems = ptrs.NewInt(1)
+		}
+		if opts.NoEmptyItems {
+			value.MinLength = ptrs.NewInt(1)
+		}
+	}
+
+	if value.Ref == "" && value.Type != "array" && value.Type != "object" {
+		value.Enum = opts.AuthorizedValues
+		if opts.MaxLen > 0 {
+			value.MaxLength = ptrs.NewInt(opts.MaxLen)
+		}
+		if opts.MinInt != nil {
+			value.Minimum = opts.MinInt
+		}
+		if opts.MaxInt != nil {
+			value.Maximum = opts.MaxInt
+		}
+		if opts.NoEmpty && value == s {
+			value.MinLength = ptrs.NewInt(1)
+		}
+		switch {
+		case opts.ValidateUUID:
+			value.Format = "uuid"
+		case opts.ValidateEmail:
+			value.Format = "email"
+		case opts.ValidateURL:
+			value.Format = "uri"
+		case opts.ValidateSlug:
+			value.Pattern = slugPattern
+		}
+	}
+
+	if def := field.Tag.Get("default"); def != "" {
+		s.Default = defaultValue(s, def)
+	}
+	return s
+}
+
+// defaultValue converts the default value of a param to the type of
+// its schema
+func defaultValue(s *Schema, value string) interface{} {
+	switch s.Type {
+	case "array":
+		values := []interface{}{}
+		for _, v := range strings.Split(value, ",") {
+			values = append(values, defaultValue(s.Items, v))
+		}
+		return values
+	case "integer":
+		if v, err := strconv.Atoi(value); err == nil {
+			return v
+		}
+	case "boolean":
+		if v, err := strconv.ParseBool(value); err == nil {
+			return v
+		}
+	}
+	return value
+}
+
+// requestBody returns the documentation of a request body
+func requestBody(body *Schema, hasFile bool) *RequestBody {
+	content := map[string]*MediaType{}
+	if hasFile {
+		content[router.ContentTypeMultipartForm] = &MediaType{Schema: body}
+	} else {
+		content[router.ContentTypeJSON] = &MediaType{Schema: body}
+		content[router.ContentTypeForm] = &MediaType{Schema: body}
+	}
+	return &RequestBody{
+		Required: len(body.Required) > 0,
+		Content:  content,
+	}
+}
+
+// successStatus returns the HTTP status code sent when the request succeeds
+func successStatus(spec *router.ResponseSpec) string {
+	if spec == nil {
+		return strconv.Itoa(http.StatusOK)
+	}
+	return strconv.Itoa(spec.StatusCode())
+}
+
+// successResponse returns the documentation of the response sent when
+// the request succeeds
+func (g *generator) successResponse(spec *router.ResponseSpec) *Response {
+	status, _ := strconv.Atoi(successStatus(spec))
+	res := &Response{Description: http.StatusText(status)}
+	if spec == nil {
+		return res
+	}
+	if spec.Description != "" {
+		res.Description = spec.Description
+	}
+	if spec.Body != nil {
+		res.Content = map[string]*MediaType{
+			router.ContentTypeJSON: {Schema: g.schemas.schemaOf(reflect.TypeOf(spec.Body))},
+		}
+	}
+	return res
+}
+
+// errorCodes returns the errors that can be returned by an endpoint
+func errorCodes(e *router.Endpoint, hasPathParams, hasBody bool) []apperror.Code {
+	codes := []apperror.Code{}
+	g := e.Guard
+	if g != nil && g.ParamStruct != nil {
+		codes = append(codes, apperror.InvalidArgument)
+	}
+	if g != nil && g.Auth != nil {
+		codes = append(codes, apperror.Unauthenticated)
+	}
+	if g != nil && (g.ParamsAuth != nil || (g.Auth != nil && !isLoggedUserAccess(g.Auth))) {
+		codes = append(codes, apperror.PermissionDenied)
+	}
+	if hasPathParams {
+		codes = append(codes, apperror.NotFound)
+	}
+	codes = append(codes, apperror.NotAcceptable)
+	if hasBody {
+		codes = append(codes, apperror.PayloadTooLarge, apperror.UnsupportedMediaType)
+	}
+	if g != nil && len(g.RateLimits) > 0 {
+		codes = append(codes, apperror.ResourceExhausted)
+	}
+	return append(codes, apperror.Internal)
+}
+
+// isLoggedUserAccess checks if the auth middleware is
+// guard.LoggedUserAccess or guard.MFAPendingAccess, which cannot
+// return a Forbidden error
+func isLoggedUserAccess(a guard.RouteAuth) bool {
+	ptr := reflect.ValueOf(a).Pointer()
+	return ptr == reflect.ValueOf(guard.LoggedUserAccess).Pointer() ||
+		ptr == reflect.ValueOf(guard.MFAPendingAccess).Pointer()
+}
+
+// errorResponse returns a reference to the response sent for the given
+// error code. The response is added to the components if needed
+func (g *generator) errorResponse(code apperror.Code) *Response {
+	status := apperror.HTTPStatusCode(code)
+	name := strings.Replace(http.StatusText(status), " ", "", -1)
+	if _, found := g.responses[name]; !found {
+		var errorType reflect.Type
+		mediaType := router.ContentTypeJSON
+		if g.errorFormat == router.ErrorFormatProblem {
+			errorType = reflect.TypeOf(router.ProblemDetails{})
+			mediaType = "application/problem+json"
+		} else {
+			errorType = reflect.TypeOf(router.ResponseError{})
+		}
+
+		g.responses[name] = &Response{
+			Description: apperror.StatusText(code),
+			Content: map[string]*MediaType{
+				mediaType: {Schema: g.schemas.schemaOf(errorType)},
+			},
+		}
+	}
+	return &Response{Ref: "#/components/responses/" + name}
+}
+
+// securityRequirements returns the security schemes accepted by the
+// endpoints requiring authentication. Any of the schemes can be used
+func (g *generator) securityRequirements() []SecurityRequirement {
+	names := make([]string, 0, len(g.securitySchemes))
+	for name := range g.securitySchemes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	reqs := make([]SecurityRequirement, len(names))
+	for i, name := range names {
+		reqs[i] = SecurityRequirement{name: []string{}}
+	}
+	return reqs
+}
+
+// operationID returns a unique identifier for an operation, based on
+// its verb and path. Ex. "GET /users/{id}" gives "getUsersId"
+func (g *generator) operationID(verb, path string) string {
+	id := strings.ToLower(verb)
+	for _, word := range strings.FieldsFunc(path, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		id += strings.ToUpper(word[:1]) + word[1:]
+	}
+
+	uniqueID := id
+	for i := 2; g.operationIDs[uniqueID]; i++ {
+		uniqueID = id + strconv.Itoa(i)
+	}
+	g.operationIDs[uniqueID] = true
+	return uniqueID
+}
+
+// parsePath converts a gorilla/mux path to an OpenAPI path by removing
+// the patterns of the variables, and returns the name of the variables.
+// Ex. "/users/{id:[0-9]+}" gives "/users/{id}"
+func parsePath(muxPath string) (path string, vars []string) {
+	var b strings.Builder
+	depth := 0
+	var name strings.Builder
+	inName := false
+	for _, r := range muxPath {
+		switch {
+		case r == '{':
+			depth++
+			if depth == 1 {
+				inName = true
+				name.Reset()
+				b.WriteRune(r)
+				continue
+			}
+		case r == '}':
+			depth--
+			if depth == 0 {
+				inName = false
+				vars = append(vars, name.String())
+				b.WriteString(name.String())
+				b.WriteRune(r)
+				continue
+			}
+		case r == ':' && depth == 1:
+			inName = false
+			continue
+		}
+
+		if depth == 0 {
+			b.WriteRune(r)
+		} else if inName {
+			name.WriteRune(r)
+		}
+	}
+	return b.String(), vars
+}
+
+// hasParam checks if the operation contains a param with the given name
+func hasParam(op *Operation, name string) bool {
+	for _, p := range op.Parameters {
+		if p.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,205 @@
+package openapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Nivl/go-params/formfile"
+	"github.com/Nivl/go-rest-tools/request"
+	"github.com/Nivl/go-rest-tools/router"
+	"github.com/Nivl/go-rest-tools/router/guard"
+	"github.com/Nivl/go-rest-tools/router/openapi"
+	"github.com/Nivl/go-types/datetime"
+	"github.com/Nivl/go-types/ptrs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type listParams struct {
+	Page  int      `from:"query" json:"page" default:"1" min_int:"1"`
+	Order string   `from:"query" json:"order" enum:"asc,desc"`
+	Tags  []string `from:"query" json:"tags" max_items:"5" maxlen:"10"`
+}
+
+type updateParams struct {
+	ID     string             `from:"url" json:"id" params:"uuid"`
+	Email  string             `from:"form" json:"email" params:"required,email"`
+	Name   *string            `from:"form" json:"name" maxlen:"255" params:"noempty"`
+	Avatar *formfile.FormFile `from:"file" json:"avatar" params:"image"`
+}
+
+type user struct {
+	ID        string             `json:"id"`
+	Name      string             `json:"name"`
+	Email     string             `json:"email,omitempty"`
+	CreatedAt *datetime.DateTime `json:"created_at"`
+	Password  string             `json:"-"`
+	Friends   []*user            `json:"friends,omitempty"`
+}
+
+func handler(req request.Request) error {
+	return nil
+}
+
+func newEndpoints() router.Endpoints {
+	return router.Endpoints{
+		{
+			Verb:     "GET",
+			Path:     "/users",
+			Summary:  "List the users",
+			Tags:     []string{"users"},
+			Guard:    &guard.Guard{ParamStruct: &listParams{}},
+			Handler:  handler,
+			Response: &router.ResponseSpec{Body: []*user{}},
+		},
+		{
+			Verb:     "PATCH",
+			Path:     "/users/{id:[0-9a-f-]+}",
+			Guard:    &guard.Guard{ParamStruct: &updateParams{}, Auth: guard.AdminAccess},
+			Handler:  handler,
+			Response: &router.ResponseSpec{Body: &user{}, Description: "The updated user"},
+		},
+		{
+			Verb:     "DELETE",
+			Path:     "/sessions/{id}",
+			Guard:    &guard.Guard{Auth: guard.LoggedUserAccess},
+			Handler:  handler,
+			Response: &router.ResponseSpec{},
+		},
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+
+	doc := openapi.Generate(newEndpoints(), openapi.Info{Title: "API", Version: "1.0"},
+		openapi.WithSecurityScheme("bearer", openapi.BearerScheme))
+	assert.Equal(t, openapi.Version, doc.OpenAPI)
+	assert.Equal(t, "API", doc.Info.Title)
+
+	t.Run("query params", func(t *testing.T) {
+		t.Parallel()
+
+		op := doc.Paths["/users"]["get"]
+		require.NotNil(t, op)
+		assert.Equal(t, "getUsers", op.OperationID)
+		assert.Equal(t, "List the users", op.Summary)
+		assert.Empty(t, op.Security, "the endpoint doesn't require authentication")
+		assert.Nil(t, op.RequestBody)
+
+		require.Len(t, op.Parameters, 3)
+		assert.Equal(t, &openapi.Parameter{
+			Name:   "page",
+			In:     "query",
+			Schema: &openapi.Schema{Type: "integer", Format: "int32", Default: 1, Minimum: ptrs.NewInt(1)},
+		}, op.Parameters[0])
+		assert.Equal(t, []string{"asc", "desc"}, op.Parameters[1].Schema.Enum)
+		assert.Equal(t, &openapi.Schema{
+			Type:     "array",
+			MaxItems: ptrs.NewInt(5),
+			Items:    &openapi.Schema{Type: "string", MaxLength: ptrs.NewInt(10)},
+		}, op.Parameters[2].Schema)
+
+		success := op.Responses["200"]
+		require.NotNil(t, success)
+		assert.Equal(t, &openapi.Schema{
+			Type:  "array",
+			Items: &openapi.Schema{Ref: "#/components/schemas/user"},
+		}, success.Content["application/json"].Schema)
+
+		for _, status := range []string{"400", "406", "500"} {
+			assert.Contains(t, op.Responses, status)
+		}
+		for _, status := range []string{"401", "403", "404", "413"} {
+			assert.NotContains(t, op.Responses, status)
+		}
+	})
+
+	t.Run("body params", func(t *testing.T) {
+		t.Parallel()
+
+		op := doc.Paths["/users/{id}"]["patch"]
+		require.NotNil(t, op)
+		assert.Equal(t, []openapi.SecurityRequirement{{"bearer": {}}}, op.Security)
+
+		require.Len(t, op.Parameters, 1)
+		assert.Equal(t, &openapi.Parameter{
+			Name:     "id",
+			In:       "path",
+			Required: true,
+			Schema:   &openapi.Schema{Type: "string", Format: "uuid"},
+		}, op.Parameters[0])
+
+		require.NotNil(t, op.RequestBody)
+		body := op.RequestBody.Content["multipart/form-data"]
+		require.NotNil(t, body, "a file is expected")
+		assert.Equal(t, []string{"email"}, body.Schema.Required)
+		assert.Equal(t, &openapi.Schema{Type: "string", Format: "email"}, body.Schema.Properties["email"])
+		assert.Equal(t, &openapi.Schema{Type: "string", MaxLength: ptrs.NewInt(255), MinLength: ptrs.NewInt(1)}, body.Schema.Properties["name"])
+		assert.Equal(t, &openapi.Schema{Type: "string", Format: "binary"}, body.Schema.Properties["avatar"])
+
+		assert.Equal(t, "The updated user", op.Responses["200"].Description)
+		for _, status := range []string{"400", "401", "403", "404", "413", "415"} {
+			assert.Equal(t, "#/components/responses/", op.Responses[status].Ref[:len("#/components/responses/")], status)
+		}
+	})
+
+	t.Run("no content", func(t *testing.T) {
+		t.Parallel()
+
+		op := doc.Paths["/sessions/{id}"]["delete"]
+		require.NotNil(t, op)
+		assert.Contains(t, op.Responses, "204")
+		assert.Contains(t, op.Responses, "401")
+		assert.NotContains(t, op.Responses, "403", "LoggedUserAccess cannot deny the access")
+		require.Len(t, op.Parameters, 1, "the path param should have been added")
+		assert.Equal(t, "id", op.Parameters[0].Name)
+	})
+
+	t.Run("components", func(t *testing.T) {
+		t.Parallel()
+
+		u := doc.Components.Schemas["user"]
+		require.NotNil(t, u)
+		assert.Equal(t, []string{"id", "name", "created_at"}, u.Required)
+		assert.NotContains(t, u.Properties, "Password")
+		assert.Equal(t, &openapi.Schema{Type: "string", Format: "date-time", Nullable: true}, u.Properties["created_at"])
+		assert.Equal(t, "#/components/schemas/user", u.Properties["friends"].Items.Ref)
+
+		assert.Contains(t, doc.Components.Schemas, "ResponseError")
+		assert.Contains(t, doc.Components.Responses, "Unauthorized")
+		assert.Equal(t, openapi.BearerScheme, doc.Components.SecuritySchemes["bearer"])
+	})
+}
+
+func TestGenerateProblemFormat(t *testing.T) {
+	t.Parallel()
+
+	doc := openapi.Generate(newEndpoints(), openapi.Info{Title: "API", Version: "1.0"},
+		openapi.WithErrorFormat(router.ErrorFormatProblem))
+
+	res := doc.Components.Responses["InternalServerError"]
+	require.NotNil(t, res)
+	assert.Contains(t, res.Content, "application/problem+json")
+	assert.Contains(t, doc.Components.Schemas, "ProblemDetails")
+	assert.Equal(t, openapi.SessionScheme, doc.Components.SecuritySchemes["session"])
+}
+
+func TestHandler(t *testing.T) {
+	t.Parallel()
+
+	doc := openapi.Generate(newEndpoints(), openapi.Info{Title: "API", Version: "1.0"})
+
+	rec := httptest.NewRecorder()
+	openapi.Handler(doc).ServeHTTP(rec, httptest.NewRequest("GET", "/openapi.json", nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+
+	var body map[string]interface{}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	assert.Equal(t, openapi.Version, body["openapi"])
+	assert.Contains(t, body["paths"], "/users/{id}")
+}
@@ -0,0 +1,20 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handler returns an http.Handler that serves the document in JSON.
+// The document is encoded once, so it should not be modified afterward
+func Handler(doc *Document) http.Handler {
+	data, err := json.Marshal(doc)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(data)
+	})
+}
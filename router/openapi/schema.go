@@ -0,0 +1,173 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/Nivl/go-types/datetime"
+	"github.com/Nivl/go-types/ptrs"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	dateTimeType      = reflect.TypeOf(datetime.DateTime{})
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// schemaRegistry generates the schemas of the Go types. The named structs
+// are stored in the components and referenced
+type schemaRegistry struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+// newSchemaRegistry returns an empty schemaRegistry
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{
+		schemas: map[string]*Schema{},
+		names:   map[reflect.Type]string{},
+	}
+}
+
+// implements checks if a type, or a pointer to this type, implements
+// the provided interface
+func implements(t, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PtrTo(t).Implements(iface)
+}
+
+// schemaOf returns the schema of the provided type, as it would be
+// encoded in JSON
+func (r *schemaRegistry) schemaOf(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType, dateTimeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	if implements(t, jsonMarshalerType) {
+		// We have no way to know what the type looks like
+		return &Schema{}
+	}
+	if implements(t, textMarshalerType) {
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Minimum: ptrs.NewInt(0)}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: r.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: r.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + r.register(t)}
+	}
+	// interfaces, funcs, etc.
+	return &Schema{}
+}
+
+// register adds a named struct to the components and returns its name
+func (r *schemaRegistry) register(t reflect.Type) string {
+	if name, found := r.names[t]; found {
+		return name
+	}
+
+	// Two types of different packages can have the same name
+	name := t.Name()
+	if _, found := r.schemas[name]; found {
+		pkg := t.PkgPath()
+		name = pkg[strings.LastIndex(pkg, "/")+1:] + "." + name
+	}
+
+	// The name is reserved before generating the schema to support
+	// the recursive types
+	r.names[t] = name
+	r.schemas[name] = &Schema{}
+	*r.schemas[name] = *r.structSchema(t)
+	return name
+}
+
+// structSchema returns the schema of a struct
+func (r *schemaRegistry) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	r.addProperties(s, t)
+	return s
+}
+
+// addProperties adds the fields of the struct to the schema
+func (r *schemaRegistry) addProperties(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tags := strings.Split(field.Tag.Get("json"), ",")
+		name := tags[0]
+		if name == "-" {
+			continue
+		}
+
+		// The fields of the embedded structs are promoted
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			r.addProperties(s, fieldType)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		prop := r.schemaOf(field.Type)
+		if field.Type.Kind() == reflect.Ptr {
+			prop = nullable(prop)
+		}
+		s.Properties[name] = prop
+
+		omitEmpty := false
+		for _, opt := range tags[1:] {
+			if opt == "omitempty" {
+				omitEmpty = true
+			}
+		}
+		if !omitEmpty {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// nullable returns a nullable version of the schema. References cannot
+// have siblings, so they are returned untouched
+func nullable(s *Schema) *Schema {
+	if s.Ref != "" {
+		return s
+	}
+	s.Nullable = true
+	return s
+}
@@ -0,0 +1,183 @@
+package router
+
+import (
+	"github.com/Nivl/go-rest-tools/router/audit"
+	"github.com/Nivl/go-rest-tools/router/codec"
+	"github.com/Nivl/go-rest-tools/router/cors"
+	"github.com/Nivl/go-rest-tools/router/ratelimit"
+)
+
+const (
+	// DefaultMaxBodySize is the maximum size of a request body in bytes,
+	// if not set otherwise
+	DefaultMaxBodySize = 10 << 20
+
+	// DefaultMultipartMemory is the maximum number of bytes of a
+	// multipart body that are stored in memory, if not set otherwise
+	DefaultMultipartMemory = 32 << 20
+)
+
+// Option represents a function used to configure how the endpoints
+// are handled
+type Option func(*options)
+
+// options contains the configuration shared by a set of endpoints
+type options struct {
+	middlewares   []Middleware
+	authenticator Authenticator
+	errorFormat   ErrorFormat
+	encoders      *codec.Registry
+	decoders      *codec.DecoderRegistry
+
+	maxBodySize     int64
+	multipartMemory int64
+
+	rateLimits     []*ratelimit.Rule
+	clientIPHeader string
+	cors           *cors.Policy
+
+	paginationEnvelope bool
+	validateResponses  bool
+
+	auditor *audit.Auditor
+}
+
+// newOptions returns the configuration matching the provided options
+func newOptions(opts []Option) *options {
+	cfg := &options{
+		authenticator: SessionAuthenticator{},
+		encoders:      codec.DefaultRegistry(),
+		decoders:      codec.DefaultDecoderRegistry(),
+
+		maxBodySize:     DefaultMaxBodySize,
+		multipartMemory: DefaultMultipartMemory,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithMiddlewares adds middlewares that will be executed for all
+// the endpoints
+func WithMiddlewares(middlewares ...Middleware) Option {
+	return func(cfg *options) {
+		cfg.middlewares = append(cfg.middlewares, middlewares...)
+	}
+}
+
+// WithAuthenticator sets the strategy used to authenticate the requests.
+// Default to SessionAuthenticator
+func WithAuthenticator(a Authenticator) Option {
+	return func(cfg *options) {
+		cfg.authenticator = a
+	}
+}
+
+// WithErrorFormat sets the format used to send the errors to the clients.
+// Default to ErrorFormatDefault
+func WithErrorFormat(f ErrorFormat) Option {
+	return func(cfg *options) {
+		cfg.errorFormat = f
+	}
+}
+
+// WithPaginationEnvelope wraps the paginated lists into a JSON object
+// containing the data and the pagination information.
+// See PaginationEnvelope
+func WithPaginationEnvelope() Option {
+	return func(cfg *options) {
+		cfg.paginationEnvelope = true
+	}
+}
+
+// WithEncoders sets the formats the responses can be sent with. The format
+// is selected using the Accept header of the requests, and the first
+// encoder is used by default.
+// Default to JSON only
+func WithEncoders(encoders ...codec.Encoder) Option {
+	return func(cfg *options) {
+		cfg.encoders = codec.NewRegistry(encoders...)
+	}
+}
+
+// WithDecoders sets the formats the request bodies can be sent with.
+// The format is selected using the Content-Type header of the requests.
+// Default to all the decoders of the codec package
+func WithDecoders(decoders ...codec.Decoder) Option {
+	return func(cfg *options) {
+		cfg.decoders = codec.NewDecoderRegistry(decoders...)
+	}
+}
+
+// WithMaxBodySize sets the maximum size of the request bodies in bytes.
+// A negative value removes the limit. Endpoint.MaxBodySize can be used to
+// override this value for a specific endpoint.
+// Default to DefaultMaxBodySize
+func WithMaxBodySize(size int64) Option {
+	return func(cfg *options) {
+		cfg.maxBodySize = size
+	}
+}
+
+// WithMultipartMemory sets the maximum number of bytes of a multipart body
+// that are stored in memory. The rest of the data is stored in temporary
+// files. Endpoint.MultipartMemory can be used to override this value for
+// a specific endpoint.
+// Default to DefaultMultipartMemory
+func WithMultipartMemory(size int64) Option {
+	return func(cfg *options) {
+		cfg.multipartMemory = size
+	}
+}
+
+// WithRateLimits adds rate limits that will be applied to all the
+// endpoints. Unless the rules are named, each endpoint is limited
+// separately. guard.Guard.RateLimits can be used to add limits to a
+// specific endpoint
+func WithRateLimits(rules ...*ratelimit.Rule) Option {
+	return func(cfg *options) {
+		cfg.rateLimits = append(cfg.rateLimits, rules...)
+	}
+}
+
+// WithClientIPHeader sets the header containing the IP of the clients
+// (ex. X-Forwarded-For or X-Real-Ip). The last address of the header is
+// used, since it's the one added by the proxy.
+// This option should only be used behind a trusted proxy, since the
+// header can otherwise be forged by the clients.
+// Default to using the address of the connection
+func WithClientIPHeader(header string) Option {
+	return func(cfg *options) {
+		cfg.clientIPHeader = header
+	}
+}
+
+// WithCORS sets the CORS policy of the endpoints. An OPTIONS endpoint is
+// automatically added to each path to handle the preflight requests.
+// Endpoint.CORS can be used to override the policy for a specific endpoint
+func WithCORS(p *cors.Policy) Option {
+	return func(cfg *options) {
+		cfg.cors = p
+	}
+}
+
+// WithResponseValidation checks that the responses sent by the endpoints
+// match their Endpoint.Response declaration (status code, type, and
+// fields). The differences are reported as a ResponseMismatchError using
+// the reporter of the request.
+// The validation is slow, and should only be enabled in development and
+// in the tests
+func WithResponseValidation() Option {
+	return func(cfg *options) {
+		cfg.validateResponses = true
+	}
+}
+
+// WithAuditor sets the auditor used to record the requests made to the
+// endpoints that have Endpoint.Audit set to true
+func WithAuditor(a *audit.Auditor) Option {
+	return func(cfg *options) {
+		cfg.auditor = a
+	}
+}
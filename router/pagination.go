@@ -0,0 +1,139 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/Nivl/go-rest-tools/paginator"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+)
+
+// PaginationEnvelope represents the data sent to the client when a
+// paginated list is wrapped in an envelope
+type PaginationEnvelope struct {
+	Data interface{}     `json:"data"`
+	Meta *PaginationMeta `json:"meta"`
+}
+
+// PaginationMeta contains the information about the current page
+// of a paginated list
+type PaginationMeta struct {
+	Page       int              `json:"page"`
+	PerPage    int              `json:"per_page"`
+	Total      *int             `json:"total,omitempty"`
+	TotalPages *int             `json:"total_pages,omitempty"`
+	Links      *PaginationLinks `json:"links,omitempty"`
+}
+
+// PaginationLinks contains the URLs of the pages around the current page.
+// An empty link means the page does not exist
+type PaginationLinks struct {
+	First string `json:"first,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+	Next  string `json:"next,omitempty"`
+	Last  string `json:"last,omitempty"`
+}
+
+// Paginated sends a http.StatusOK response with a page of a list attached.
+// total contains the total number of elements of the list, and can be nil
+// if unknown. In this case, the next page is assumed to exist if the
+// current page is full, and no last page is provided.
+// The pagination data are sent using the Link (RFC 5988) and the
+// X-Total-Count headers, and using an envelope if enabled.
+// An Internal error is returned if p is nil
+func (res *HTTPResponse) Paginated(obj interface{}, p *paginator.Paginator, total *int) error {
+	if p == nil {
+		return apperror.NewServerError("no paginator provided")
+	}
+
+	meta := &PaginationMeta{
+		Page:    p.CurrentPage(),
+		PerPage: p.PerPage(),
+		Total:   total,
+	}
+
+	if total != nil {
+		totalPages := 1
+		if *total > 0 && p.PerPage() > 0 {
+			totalPages = (*total + p.PerPage() - 1) / p.PerPage()
+		}
+		meta.TotalPages = &totalPages
+		res.writer.Header().Set("X-Total-Count", strconv.Itoa(*total))
+	}
+
+	if res.http != nil {
+		meta.Links = res.paginationLinks(meta, countItems(obj))
+		if header := meta.Links.header(); header != "" {
+			res.writer.Header().Set("Link", header)
+		}
+	}
+
+	res.validator.validate(http.StatusOK, obj)
+	if res.paginationEnvelope {
+		return res.render(http.StatusOK, &PaginationEnvelope{
+			Data: obj,
+			Meta: meta,
+		})
+	}
+	return res.render(http.StatusOK, obj)
+}
+
+// paginationLinks returns the links of the pages around the current page
+func (res *HTTPResponse) paginationLinks(meta *PaginationMeta, count int) *PaginationLinks {
+	links := &PaginationLinks{
+		First: res.pageURL(1, meta.PerPage),
+	}
+	if meta.Page > 1 {
+		links.Prev = res.pageURL(meta.Page-1, meta.PerPage)
+	}
+
+	if meta.TotalPages != nil {
+		links.Last = res.pageURL(*meta.TotalPages, meta.PerPage)
+		if meta.Page < *meta.TotalPages {
+			links.Next = res.pageURL(meta.Page+1, meta.PerPage)
+		}
+	} else if count >= meta.PerPage {
+		links.Next = res.pageURL(meta.Page+1, meta.PerPage)
+	}
+	return links
+}
+
+// pageURL returns the URL of the current request, targeting another page
+func (res *HTTPResponse) pageURL(page, perPage int) string {
+	query := res.http.URL.Query()
+	query.Set("page", strconv.Itoa(page))
+	query.Set("per_page", strconv.Itoa(perPage))
+
+	u := *res.http.URL
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
+
+// header returns the value of the Link header matching the links
+func (links *PaginationLinks) header() string {
+	values := []string{}
+	for _, link := range []struct{ rel, url string }{
+		{"first", links.First},
+		{"prev", links.Prev},
+		{"next", links.Next},
+		{"last", links.Last},
+	} {
+		if link.url != "" {
+			values = append(values, fmt.Sprintf(`<%s>; rel="%s"`, link.url, link.rel))
+		}
+	}
+	return strings.Join(values, ", ")
+}
+
+// countItems returns the number of elements of a slice, or 0 if obj
+// is not a slice
+func countItems(obj interface{}) int {
+	v := reflect.Indirect(reflect.ValueOf(obj))
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return 0
+	}
+	return v.Len()
+}
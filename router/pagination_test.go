@@ -0,0 +1,135 @@
+package router_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Nivl/go-rest-tools/paginator"
+	"github.com/Nivl/go-rest-tools/request"
+	"github.com/Nivl/go-rest-tools/router"
+	"github.com/Nivl/go-rest-tools/router/guard"
+	"github.com/Nivl/go-types/ptrs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaginated(t *testing.T) {
+	testCases := []struct {
+		description   string
+		url           string
+		items         []string
+		total         *int
+		expectedLink  string
+		expectedTotal string
+	}{
+		{
+			"first page with total",
+			"/items?per_page=2&q=go",
+			[]string{"a", "b"},
+			ptrs.NewInt(5),
+			`</items?page=1&per_page=2&q=go>; rel="first", </items?page=2&per_page=2&q=go>; rel="next", </items?page=3&per_page=2&q=go>; rel="last"`,
+			"5",
+		},
+		{
+			"last page with total",
+			"/items?page=3&per_page=2",
+			[]string{"e"},
+			ptrs.NewInt(5),
+			`</items?page=1&per_page=2>; rel="first", </items?page=2&per_page=2>; rel="prev", </items?page=3&per_page=2>; rel="last"`,
+			"5",
+		},
+		{
+			"full page without total",
+			"/items?page=2&per_page=2",
+			[]string{"c", "d"},
+			nil,
+			`</items?page=1&per_page=2>; rel="first", </items?page=1&per_page=2>; rel="prev", </items?page=3&per_page=2>; rel="next"`,
+			"",
+		},
+		{
+			"partial page without total",
+			"/items?page=1&per_page=2",
+			[]string{"a"},
+			nil,
+			`</items?page=1&per_page=2>; rel="first"`,
+			"",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			e := &router.Endpoint{
+				Verb:  "GET",
+				Path:  "/items",
+				Guard: &guard.Guard{ParamStruct: &paginator.HandlerParams{}},
+				Handler: func(req request.Request) error {
+					p := req.Params().(*paginator.HandlerParams).Paginator()
+					return req.Response().Paginated(tc.items, p, tc.total)
+				},
+			}
+
+			rec := httptest.NewRecorder()
+			router.Handler(e, &testDeps{}).ServeHTTP(rec, httptest.NewRequest("GET", tc.url, nil))
+
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, tc.expectedLink, rec.Header().Get("Link"))
+			assert.Equal(t, tc.expectedTotal, rec.Header().Get("X-Total-Count"))
+
+			var body []string
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+			assert.Equal(t, tc.items, body)
+		})
+	}
+}
+
+func TestPaginatedEnvelope(t *testing.T) {
+	t.Parallel()
+
+	e := &router.Endpoint{
+		Verb: "GET",
+		Path: "/items",
+		Handler: func(req request.Request) error {
+			return req.Response().Paginated([]string{"c", "d"}, paginator.New(2, 2), ptrs.NewInt(5))
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	router.Handler(e, &testDeps{}, router.WithPaginationEnvelope()).ServeHTTP(rec, httptest.NewRequest("GET", "/items", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var body struct {
+		Data []string               `json:"data"`
+		Meta *router.PaginationMeta `json:"meta"`
+	}
+	require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+	assert.Equal(t, []string{"c", "d"}, body.Data)
+	require.NotNil(t, body.Meta)
+	assert.Equal(t, 2, body.Meta.Page)
+	assert.Equal(t, 2, body.Meta.PerPage)
+	assert.Equal(t, 5, *body.Meta.Total)
+	assert.Equal(t, 3, *body.Meta.TotalPages)
+	require.NotNil(t, body.Meta.Links)
+	assert.Equal(t, "/items?page=3&per_page=2", body.Meta.Links.Next)
+	assert.Equal(t, "/items?page=1&per_page=2", body.Meta.Links.Prev)
+}
+
+func TestPaginatedNoPaginator(t *testing.T) {
+	t.Parallel()
+
+	e := &router.Endpoint{
+		Verb: "GET",
+		Path: "/items",
+		Handler: func(req request.Request) error {
+			return req.Response().Paginated([]string{"a"}, nil, nil)
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	router.Handler(e, &testDeps{}).ServeHTTP(rec, httptest.NewRequest("GET", "/items", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
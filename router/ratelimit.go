@@ -0,0 +1,28 @@
+package router
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/router/ratelimit"
+)
+
+// setRateLimitHeaders sets the RateLimit-* headers of the response, as
+// well as the Retry-After header if the request has been denied.
+// All the durations are sent in seconds
+func (res *HTTPResponse) setRateLimitHeaders(r *ratelimit.Result) {
+	header := res.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(r.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(r.Remaining))
+	header.Set("RateLimit-Reset", seconds(r.Reset))
+	if !r.Allowed {
+		header.Set("Retry-After", seconds(r.RetryAfter))
+	}
+}
+
+// seconds returns the provided duration as a number of seconds,
+// rounded up
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
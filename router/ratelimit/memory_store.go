@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is the minimum amount of time between two removals of
+// the expired states of a MemoryStore
+const sweepInterval = time.Minute
+
+// memoryEntry represents a state stored in memory
+type memoryEntry struct {
+	state     State
+	expiresAt time.Time
+}
+
+// MemoryStore is a Store that keeps the states in memory.
+// The states are not shared between several instances of the API,
+// which makes it mostly useful for single-instance deployments and tests
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// NewMemoryStore returns a new empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		entries: map[string]*memoryEntry{},
+		now:     time.Now,
+	}
+}
+
+// Update atomically updates the state of the given key
+func (s *MemoryStore) Update(key string, ttl time.Duration, fn func(s *State)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	entry, found := s.entries[key]
+	if !found || !now.Before(entry.expiresAt) {
+		entry = &memoryEntry{}
+		s.entries[key] = entry
+	}
+	fn(&entry.state)
+	entry.expiresAt = now.Add(ttl)
+	return nil
+}
+
+// sweep removes the expired states. It needs to be called with the
+// lock held
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < sweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, entry := range s.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(s.entries, key)
+		}
+	}
+}
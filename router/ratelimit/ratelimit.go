@@ -0,0 +1,133 @@
+// Package ratelimit contains the algorithms and the stores used to limit
+// the number of requests a client can make to an endpoint
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/Nivl/go-rest-tools/request"
+)
+
+// State represents the data stored for a client. Its meaning depends on
+// the algorithm using it
+type State struct {
+	// Value contains the number of tokens left for the token bucket,
+	// and the number of hits of the current window for the sliding window
+	Value float64
+
+	// Previous contains the number of hits of the previous window for
+	// the sliding window. It's not used by the token bucket
+	Previous float64
+
+	// Time contains the date of the last update for the token bucket,
+	// and the start of the current window for the sliding window.
+	// A zero time means that the client has no state yet
+	Time time.Time
+}
+
+// Store represents a storage used to persist the states of the clients
+type Store interface {
+	// Update atomically updates the state of the given key. fn receives
+	// the current state (a zero state if the key doesn't exist or has
+	// expired) and modifies it in place.
+	// The state expires after ttl
+	Update(key string, ttl time.Duration, fn func(s *State)) error
+}
+
+// Result represents the outcome of a rate limit check
+type Result struct {
+	// Allowed is set to true if the request can be processed
+	Allowed bool
+
+	// Limit contains the maximum number of requests allowed
+	Limit int
+
+	// Remaining contains the number of requests left
+	Remaining int
+
+	// Reset contains the time left until the quota is fully restored
+	Reset time.Duration
+
+	// RetryAfter contains the time left until a new request can be made.
+	// It's always 0 for allowed requests
+	RetryAfter time.Duration
+}
+
+// Limiter represents an algorithm used to limit the number of requests
+type Limiter interface {
+	// Allow consumes a request for the given key
+	Allow(key string) (*Result, error)
+}
+
+// KeyFunc represents a function that returns the identifier of the
+// client that made a request
+type KeyFunc func(req request.Request) string
+
+// ByIP is a KeyFunc that identifies the clients by their IP
+func ByIP(req request.Request) string {
+	return "ip:" + req.ClientIP()
+}
+
+// ByUserOrIP is a KeyFunc that identifies the clients using an API key
+// by their key, the logged users by their ID, and the anonymous clients
+// by their IP
+func ByUserOrIP(req request.Request) string {
+	if k := req.APIKey(); k != nil && k.ID != "" {
+		return "key:" + k.ID
+	}
+	if u := req.User(); u != nil && u.ID != "" {
+		return "user:" + u.ID
+	}
+	return ByIP(req)
+}
+
+// Rule represents a rate limit applied to an endpoint
+type Rule struct {
+	// Name is used to share the same limit between several endpoints.
+	// When empty, each endpoint has its own limit
+	Name string
+
+	// Limiter is the algorithm used to limit the requests
+	Limiter Limiter
+
+	// Key is used to identify the clients. Defaults to ByUserOrIP
+	Key KeyFunc
+}
+
+// Allow consumes a request for the client that made req.
+// scope identifies the endpoint, and is ignored when the rule has a name
+func (r *Rule) Allow(scope string, req request.Request) (*Result, error) {
+	key := r.Key
+	if key == nil {
+		key = ByUserOrIP
+	}
+	if r.Name != "" {
+		scope = r.Name
+	}
+	return r.Limiter.Allow(scope + "|" + key(req))
+}
+
+// Check applies all the rules to the request and returns the result of
+// the first rule that denied the request. If the request is allowed,
+// the most restrictive result is returned.
+// The rules are applied in order, and each rule consumes a request as it
+// allows it. A denied request is therefore still counted by the rules
+// that come before the one denying it, so the most restrictive rules
+// should come first.
+// nil is returned if there are no rules
+func Check(rules []*Rule, scope string, req request.Request) (*Result, error) {
+	var res *Result
+	for _, rule := range rules {
+		r, err := rule.Allow(scope, req)
+		if err != nil {
+			return nil, err
+		}
+		if !r.Allowed {
+			return r, nil
+		}
+		if res == nil || r.Remaining < res.Remaining {
+			res = r
+		}
+	}
+	return res, nil
+}
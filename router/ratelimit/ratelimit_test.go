@@ -0,0 +1,232 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/request/mockrequest"
+	"github.com/Nivl/go-rest-tools/security/auth"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clock is a fake time source that can be moved forward
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newClock() *clock {
+	return &clock{t: time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func TestTokenBucket(t *testing.T) {
+	t.Parallel()
+
+	c := newClock()
+	store := NewMemoryStore()
+	store.now = c.now
+	l := NewTokenBucket(store, 3, 3*time.Second)
+	l.now = c.now
+
+	// the full bucket allows a burst
+	for i := 2; i >= 0; i-- {
+		res, err := l.Allow("key")
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, 3, res.Limit)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res, err := l.Allow("key")
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, time.Second, res.RetryAfter)
+	assert.Equal(t, 3*time.Second, res.Reset)
+
+	// other keys are not affected
+	res, err = l.Allow("other key")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+
+	// one token is added every second
+	c.advance(time.Second)
+	res, err = l.Allow("key")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+
+	// the bucket never contains more than its capacity
+	c.advance(time.Hour)
+	res, err = l.Allow("key")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 2, res.Remaining)
+	assert.Equal(t, time.Second, res.Reset)
+}
+
+func TestNewTokenBucketInvalid(t *testing.T) {
+	t.Parallel()
+
+	assert.Panics(t, func() { NewTokenBucket(NewMemoryStore(), 0, time.Minute) }, "an empty bucket should be rejected")
+	assert.Panics(t, func() { NewTokenBucket(NewMemoryStore(), -1, time.Minute) }, "a negative capacity should be rejected")
+	assert.Panics(t, func() { NewTokenBucket(NewMemoryStore(), 1, 0) }, "a bucket never refilled should be rejected")
+}
+
+func TestNewSlidingWindowInvalid(t *testing.T) {
+	t.Parallel()
+
+	assert.Panics(t, func() { NewSlidingWindow(NewMemoryStore(), 0, time.Minute) }, "a zero limit should be rejected")
+	assert.Panics(t, func() { NewSlidingWindow(NewMemoryStore(), -1, time.Minute) }, "a negative limit should be rejected")
+	assert.Panics(t, func() { NewSlidingWindow(NewMemoryStore(), 1, 0) }, "a zero window should be rejected")
+}
+
+func TestSlidingWindow(t *testing.T) {
+	t.Parallel()
+
+	c := newClock()
+	store := NewMemoryStore()
+	store.now = c.now
+	l := NewSlidingWindow(store, 4, time.Minute)
+	l.now = c.now
+
+	for i := 3; i >= 0; i-- {
+		res, err := l.Allow("key")
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+	}
+
+	res, err := l.Allow("key")
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	// the 4 hits of the current window need to weight less than 3
+	assert.Equal(t, time.Minute+15*time.Second, res.RetryAfter)
+	assert.Equal(t, 2*time.Minute, res.Reset)
+
+	// Halfway through the next window, the previous hits count for 2
+	c.advance(time.Minute + 30*time.Second)
+	for i := 1; i >= 0; i-- {
+		res, err = l.Allow("key")
+		require.NoError(t, err)
+		assert.True(t, res.Allowed)
+		assert.Equal(t, i, res.Remaining)
+	}
+	res, err = l.Allow("key")
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+	// the previous window needs to weight less than 1
+	assert.Equal(t, 15*time.Second, res.RetryAfter)
+
+	// Once a full window has passed, everything has been forgotten
+	c.advance(2 * time.Minute)
+	res, err = l.Allow("key")
+	require.NoError(t, err)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 3, res.Remaining)
+}
+
+func TestMemoryStoreExpiration(t *testing.T) {
+	t.Parallel()
+
+	c := newClock()
+	store := NewMemoryStore()
+	store.now = c.now
+
+	err := store.Update("key", time.Second, func(s *State) {
+		s.Value = 42
+	})
+	require.NoError(t, err)
+
+	c.advance(2 * sweepInterval)
+	err = store.Update("other key", time.Second, func(s *State) {})
+	require.NoError(t, err)
+	assert.Len(t, store.entries, 1, "the expired state should have been removed")
+
+	err = store.Update("key", time.Second, func(s *State) {
+		assert.Equal(t, State{}, *s, "the state should have expired")
+	})
+	require.NoError(t, err)
+}
+
+// fixedLimiter is a limiter that returns the same result for all the keys
+type fixedLimiter struct {
+	res  *Result
+	keys []string
+}
+
+func (l *fixedLimiter) Allow(key string) (*Result, error) {
+	l.keys = append(l.keys, key)
+	return l.res, nil
+}
+
+func TestRuleKey(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		description string
+		rule        *Rule
+		user        *auth.User
+		apiKey      *auth.APIKey
+		expectedKey string
+	}{
+		{"anonymous", &Rule{}, nil, nil, "POST /sessions|ip:10.0.0.1"},
+		{"logged user", &Rule{}, &auth.User{ID: "user-id"}, nil, "POST /sessions|user:user-id"},
+		{"api key", &Rule{}, &auth.User{ID: "user-id"}, &auth.APIKey{ID: "key-id"}, "POST /sessions|key:key-id"},
+		{"by ip", &Rule{Key: ByIP}, &auth.User{ID: "user-id"}, nil, "POST /sessions|ip:10.0.0.1"},
+		{"named rule", &Rule{Name: "auth"}, nil, nil, "auth|ip:10.0.0.1"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			req := mockrequest.NewMockRequest(mockCtrl)
+			req.EXPECT().User().Return(tc.user).AnyTimes()
+			req.EXPECT().APIKey().Return(tc.apiKey).AnyTimes()
+			req.EXPECT().ClientIP().Return("10.0.0.1").AnyTimes()
+
+			limiter := &fixedLimiter{res: &Result{Allowed: true}}
+			tc.rule.Limiter = limiter
+			_, err := tc.rule.Allow("POST /sessions", req)
+			require.NoError(t, err)
+			assert.Equal(t, []string{tc.expectedKey}, limiter.keys)
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	req := mockrequest.NewMockRequest(mockCtrl)
+	req.EXPECT().User().Return(nil).AnyTimes()
+	req.EXPECT().APIKey().Return(nil).AnyTimes()
+	req.EXPECT().ClientIP().Return("10.0.0.1").AnyTimes()
+
+	loose := &Rule{Limiter: &fixedLimiter{res: &Result{Allowed: true, Remaining: 10}}}
+	strict := &Rule{Limiter: &fixedLimiter{res: &Result{Allowed: true, Remaining: 1}}}
+	denied := &Rule{Limiter: &fixedLimiter{res: &Result{Allowed: false}}}
+
+	res, err := Check(nil, "scope", req)
+	require.NoError(t, err)
+	assert.Nil(t, res)
+
+	res, err = Check([]*Rule{loose, strict}, "scope", req)
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.Remaining, "the most restrictive result should be returned")
+
+	res, err = Check([]*Rule{loose, denied, strict}, "scope", req)
+	require.NoError(t, err)
+	assert.False(t, res.Allowed)
+}
@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// SlidingWindow is a Limiter that allows a fixed number of requests over
+// a rolling window of time.
+// The number of requests is estimated using the number of hits of the
+// current and the previous fixed windows, which only requires to store
+// two counters per client
+type SlidingWindow struct {
+	store  Store
+	limit  int
+	window time.Duration
+	now    func() time.Time
+}
+
+// NewSlidingWindow returns a sliding window that allows limit requests
+// per window.
+// Ex. NewSlidingWindow(store, 100, time.Hour) allows 100 requests per hour.
+// NewSlidingWindow panics if limit or window are not positive, since
+// no requests would ever be allowed
+func NewSlidingWindow(store Store, limit int, window time.Duration) *SlidingWindow {
+	if limit <= 0 {
+		panic(fmt.Sprintf("ratelimit: non-positive limit for NewSlidingWindow: %d", limit))
+	}
+	if window <= 0 {
+		panic(fmt.Sprintf("ratelimit: non-positive window for NewSlidingWindow: %s", window))
+	}
+	return &SlidingWindow{
+		store:  store,
+		limit:  limit,
+		window: window,
+		now:    time.Now,
+	}
+}
+
+// Allow consumes a request for the given key
+func (l *SlidingWindow) Allow(key string) (*Result, error) {
+	now := l.now()
+	limit := float64(l.limit)
+	windowStart := now.Truncate(l.window)
+	windowEnd := windowStart.Add(l.window)
+
+	res := &Result{Limit: l.limit}
+	err := l.store.Update(key, 2*l.window, func(s *State) {
+		// We move to the current window
+		if !s.Time.Equal(windowStart) {
+			if s.Time.Equal(windowStart.Add(-l.window)) {
+				s.Previous = s.Value
+			} else {
+				s.Previous = 0
+			}
+			s.Value = 0
+			s.Time = windowStart
+		}
+
+		// The previous window is weighted by how much of it still
+		// overlaps with the rolling window
+		elapsed := float64(now.Sub(windowStart)) / float64(l.window)
+		count := s.Previous*(1-elapsed) + s.Value
+
+		if count+1 <= limit {
+			s.Value++
+			res.Allowed = true
+			res.Remaining = int(math.Floor(limit - count - 1))
+		} else {
+			res.RetryAfter = l.retryAfter(s, now, windowStart)
+		}
+
+		switch {
+		case s.Value > 0:
+			res.Reset = windowEnd.Add(l.window).Sub(now)
+		case s.Previous > 0:
+			res.Reset = windowEnd.Sub(now)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// retryAfter returns the time left until the weighted number of hits
+// leaves room for a new request
+func (l *SlidingWindow) retryAfter(s *State, now, windowStart time.Time) time.Duration {
+	limit := float64(l.limit)
+	window := float64(l.window)
+
+	// There's room in the current window, we just need the previous
+	// window to weight less
+	if s.Value+1 <= limit {
+		elapsed := 1 - (limit-1-s.Value)/s.Previous
+		return windowStart.Add(time.Duration(math.Ceil(elapsed * window))).Sub(now)
+	}
+
+	// We need to wait for the next window, in which the current window
+	// will be the previous one
+	elapsed := 1 - (limit-1)/s.Value
+	return windowStart.Add(l.window).Add(time.Duration(math.Ceil(elapsed * window))).Sub(now)
+}
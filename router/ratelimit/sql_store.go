@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"time"
+
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	db "github.com/Nivl/go-sqldb"
+)
+
+// SQLStore is a Store that keeps the states in a Postgres database,
+// which allows the states to be shared between several instances of
+// the API.
+// The states are stored in a table named rate_limits:
+//
+//	CREATE TABLE rate_limits (
+//	  key VARCHAR PRIMARY KEY,
+//	  value DOUBLE PRECISION NOT NULL,
+//	  previous DOUBLE PRECISION NOT NULL,
+//	  time TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  expires_at TIMESTAMP WITH TIME ZONE NOT NULL
+//	);
+type SQLStore struct {
+	con db.Connection
+	now func() time.Time
+}
+
+// sqlState represents a row of the rate_limits table
+type sqlState struct {
+	Value     float64   `db:"value"`
+	Previous  float64   `db:"previous"`
+	Time      time.Time `db:"time"`
+	ExpiresAt time.Time `db:"expires_at"`
+}
+
+// NewSQLStore returns a Store using the provided connection.
+// The connection is usually the one returned by the DB() method of the
+// router dependencies
+func NewSQLStore(con db.Connection) *SQLStore {
+	return &SQLStore{
+		con: con,
+		now: time.Now,
+	}
+}
+
+// Update atomically updates the state of the given key.
+// The row of the key is locked for the duration of the update
+func (s *SQLStore) Update(key string, ttl time.Duration, fn func(s *State)) (err error) {
+	now := s.now()
+
+	tx, err := s.con.Beginx()
+	if err != nil {
+		return apperror.NewFromSQL(err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// We make sure the row exists so it can be locked. A new row is
+	// created already expired
+	stmt := `INSERT INTO rate_limits (key, value, previous, time, expires_at)
+					VALUES ($1, 0, 0, $2, $2)
+					ON CONFLICT (key) DO NOTHING`
+	if _, err = tx.Exec(stmt, key, now); err != nil {
+		return apperror.NewFromSQL(err)
+	}
+
+	row := &sqlState{}
+	stmt = `SELECT value, previous, time, expires_at
+					FROM rate_limits
+					WHERE key = $1
+					FOR UPDATE`
+	if err = tx.Get(row, stmt, key); err != nil {
+		return apperror.NewFromSQL(err)
+	}
+
+	state := &State{}
+	if now.Before(row.ExpiresAt) {
+		state = &State{
+			Value:    row.Value,
+			Previous: row.Previous,
+			Time:     row.Time,
+		}
+	}
+	fn(state)
+
+	stmt = `UPDATE rate_limits
+					SET value = $2, previous = $3, time = $4, expires_at = $5
+					WHERE key = $1`
+	if _, err = tx.Exec(stmt, key, state.Value, state.Previous, state.Time, now.Add(ttl)); err != nil {
+		return apperror.NewFromSQL(err)
+	}
+	if err = tx.Commit(); err != nil {
+		return apperror.NewFromSQL(err)
+	}
+	return nil
+}
+
+// DeleteExpired removes the expired states from the database
+func (s *SQLStore) DeleteExpired() error {
+	stmt := "DELETE FROM rate_limits WHERE expires_at <= $1"
+	_, err := s.con.Exec(stmt, s.now())
+	return apperror.NewFromSQL(err)
+}
@@ -0,0 +1,85 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Nivl/go-sqldb/implementations/mocksqldb"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLStoreUpdate(t *testing.T) {
+	t.Parallel()
+
+	c := newClock()
+	lastUpdate := c.now().Add(-time.Second)
+
+	testCases := []struct {
+		description   string
+		row           *sqlState
+		expectedState State
+	}{
+		{
+			"existing state",
+			&sqlState{Value: 2, Previous: 1, Time: lastUpdate, ExpiresAt: c.now().Add(time.Minute)},
+			State{Value: 2, Previous: 1, Time: lastUpdate},
+		},
+		{
+			"expired state",
+			&sqlState{Value: 2, Previous: 1, Time: lastUpdate, ExpiresAt: c.now()},
+			State{},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			mockDB := mocksqldb.NewMockConnection(mockCtrl)
+			tx, _ := mockDB.EXPECT().TransactionSuccess(mockCtrl)
+			tx.QEXPECT().Exec(gomock.Any(), "key", c.now()).Return(int64(1), nil)
+			tx.QEXPECT().Get(gomock.Any(), gomock.Any(), "key").
+				Do(func(row *sqlState, stmt string, args ...interface{}) {
+					*row = *tc.row
+				}).
+				Return(nil)
+			tx.QEXPECT().Exec(gomock.Any(), "key", float64(3), float64(1), c.now(), c.now().Add(time.Minute)).Return(int64(1), nil)
+			tx.EXPECT().CommitSuccess()
+
+			store := NewSQLStore(mockDB)
+			store.now = c.now
+			err := store.Update("key", time.Minute, func(s *State) {
+				assert.Equal(t, tc.expectedState, *s)
+				s.Value = 3
+				s.Previous = 1
+				s.Time = c.now()
+			})
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestSQLStoreUpdateFailure(t *testing.T) {
+	t.Parallel()
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDB := mocksqldb.NewMockConnection(mockCtrl)
+	tx, _ := mockDB.EXPECT().TransactionSuccess(mockCtrl)
+	tx.QEXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any()).Return(int64(0), errors.New("server unreachable"))
+	tx.EXPECT().RollbackSuccess()
+
+	store := NewSQLStore(mockDB)
+	err := store.Update("key", time.Minute, func(s *State) {
+		t.Fatal("the state should not have been updated")
+	})
+	require.Error(t, err)
+}
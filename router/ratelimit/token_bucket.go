@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// TokenBucket is a Limiter that allows bursts of requests. Each request
+// consumes a token from a bucket that is continuously refilled
+type TokenBucket struct {
+	store    Store
+	capacity int
+	period   time.Duration
+	now      func() time.Time
+}
+
+// NewTokenBucket returns a token bucket containing up to capacity tokens,
+// and that takes period to be fully refilled.
+// Ex. NewTokenBucket(store, 10, time.Minute) allows bursts of 10 requests,
+// and one new request every 6 seconds.
+// NewTokenBucket panics if capacity or period are not positive, since
+// the bucket would never contain any token
+func NewTokenBucket(store Store, capacity int, period time.Duration) *TokenBucket {
+	if capacity <= 0 {
+		panic(fmt.Sprintf("ratelimit: non-positive capacity for NewTokenBucket: %d", capacity))
+	}
+	if period <= 0 {
+		panic(fmt.Sprintf("ratelimit: non-positive period for NewTokenBucket: %s", period))
+	}
+	return &TokenBucket{
+		store:    store,
+		capacity: capacity,
+		period:   period,
+		now:      time.Now,
+	}
+}
+
+// Allow consumes a token for the given key
+func (l *TokenBucket) Allow(key string) (*Result, error) {
+	now := l.now()
+	capacity := float64(l.capacity)
+	// tokenDuration is the time needed to get a new token
+	tokenDuration := float64(l.period) / capacity
+
+	res := &Result{Limit: l.capacity}
+	err := l.store.Update(key, l.period, func(s *State) {
+		tokens := capacity
+		if !s.Time.IsZero() {
+			elapsed := now.Sub(s.Time)
+			if elapsed < 0 {
+				elapsed = 0
+			}
+			tokens = math.Min(capacity, s.Value+float64(elapsed)/tokenDuration)
+		}
+
+		if tokens >= 1 {
+			tokens--
+			res.Allowed = true
+		} else {
+			res.RetryAfter = time.Duration(math.Ceil((1 - tokens) * tokenDuration))
+		}
+		res.Remaining = int(math.Floor(tokens))
+		res.Reset = time.Duration(math.Ceil((capacity - tokens) * tokenDuration))
+
+		s.Value = tokens
+		s.Time = now
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
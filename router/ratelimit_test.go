@@ -0,0 +1,114 @@
+package router_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/request"
+	"github.com/Nivl/go-rest-tools/router"
+	"github.com/Nivl/go-rest-tools/router/guard"
+	"github.com/Nivl/go-rest-tools/router/ratelimit"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRateLimitRouter(g *guard.Guard, opts ...router.Option) *mux.Router {
+	e := &router.Endpoint{
+		Verb:  "POST",
+		Path:  "/sessions",
+		Guard: g,
+		Handler: func(req request.Request) error {
+			req.Response().NoContent()
+			return nil
+		},
+	}
+
+	r := mux.NewRouter()
+	router.Endpoints{e}.Activate(r, &testDeps{}, opts...)
+	return r
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+
+	rule := &ratelimit.Rule{
+		Limiter: ratelimit.NewTokenBucket(ratelimit.NewMemoryStore(), 2, time.Minute),
+	}
+
+	testCases := []struct {
+		description string
+		guard       *guard.Guard
+		opts        []router.Option
+	}{
+		{"endpoint limit", &guard.Guard{RateLimits: []*ratelimit.Rule{rule}}, nil},
+		{"global limit", nil, []router.Option{router.WithRateLimits(rule)}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			// we use a different IP per test since the store is shared
+			ip := "10.0.0.1"
+			if tc.guard == nil {
+				ip = "10.0.0.2"
+			}
+			r := newRateLimitRouter(tc.guard, tc.opts...)
+
+			for _, remaining := range []string{"1", "0"} {
+				rec := httptest.NewRecorder()
+				req := httptest.NewRequest("POST", "/sessions", nil)
+				req.RemoteAddr = ip + ":1234"
+				r.ServeHTTP(rec, req)
+
+				assert.Equal(t, http.StatusNoContent, rec.Code)
+				assert.Equal(t, "2", rec.Header().Get("RateLimit-Limit"))
+				assert.Equal(t, remaining, rec.Header().Get("RateLimit-Remaining"))
+				assert.Empty(t, rec.Header().Get("Retry-After"))
+			}
+
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/sessions", nil)
+			req.RemoteAddr = ip + ":1234"
+			r.ServeHTTP(rec, req)
+
+			assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+			assert.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+			assert.Equal(t, "60", rec.Header().Get("RateLimit-Reset"))
+			assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+		})
+	}
+}
+
+func TestRateLimitClientIPHeader(t *testing.T) {
+	t.Parallel()
+
+	g := &guard.Guard{
+		RateLimits: []*ratelimit.Rule{{
+			Limiter: ratelimit.NewTokenBucket(ratelimit.NewMemoryStore(), 1, time.Minute),
+			Key:     ratelimit.ByIP,
+		}},
+	}
+	r := newRateLimitRouter(g, router.WithClientIPHeader("X-Forwarded-For"))
+
+	testCases := []struct {
+		forwardedFor string
+		expectedCode int
+	}{
+		{"1.1.1.1, 10.0.0.1", http.StatusNoContent},
+		// the first address can be forged by the client
+		{"2.2.2.2, 10.0.0.1", http.StatusTooManyRequests},
+		{"10.0.0.2", http.StatusNoContent},
+	}
+
+	for _, tc := range testCases {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/sessions", nil)
+		req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+		r.ServeHTTP(rec, req)
+		assert.Equal(t, tc.expectedCode, rec.Code, tc.forwardedFor)
+	}
+}
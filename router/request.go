@@ -3,15 +3,20 @@ package router
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 
 	logger "github.com/Nivl/go-logger"
 	reporter "github.com/Nivl/go-reporter"
 	"github.com/Nivl/go-rest-tools/request"
+	"github.com/Nivl/go-rest-tools/router/codec"
+	"github.com/Nivl/go-rest-tools/router/guard"
 	"github.com/Nivl/go-rest-tools/security/auth"
 	"github.com/Nivl/go-rest-tools/types/apperror"
 	"github.com/gorilla/mux"
@@ -29,6 +34,10 @@ const (
 // ErrMsgInvalidJSONPayload is the message representing a invalid json payload
 var ErrMsgInvalidJSONPayload = "invalid JSON payload"
 
+// ErrMsgInvalidPayload is the message representing a payload that cannot
+// be decoded
+var ErrMsgInvalidPayload = "invalid payload"
+
 var _ request.Request = (*HTTPRequest)(nil)
 
 // HTTPRequest represent a client request
@@ -37,8 +46,14 @@ type HTTPRequest struct {
 	res          *HTTPResponse
 	http         *http.Request
 	params       interface{}
+	decoders     *codec.DecoderRegistry
+	streaming    bool
+	maxBodySize  int64
+	multipartMem int64
+	ipHeader     string
 	user         *auth.User
 	session      *auth.Session
+	apiKey       *auth.APIKey
 	_contentType string
 	logger       logger.Logger
 	reporter     reporter.Reporter
@@ -49,6 +64,32 @@ func (req *HTTPRequest) Context() context.Context {
 	return req.http.Context()
 }
 
+// ClientIP returns the IP address of the client that made the request
+func (req *HTTPRequest) ClientIP() string {
+	if req.ipHeader != "" {
+		// The last address is the one added by our proxy
+		if values := req.http.Header[http.CanonicalHeaderKey(req.ipHeader)]; len(values) > 0 {
+			addrs := strings.Split(values[len(values)-1], ",")
+			if ip := strings.TrimSpace(addrs[len(addrs)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(req.http.RemoteAddr)
+	if err != nil {
+		return req.http.RemoteAddr
+	}
+	return host
+}
+
+// Body returns the raw body of the request. The body is only available
+// for the streaming endpoints, since it's otherwise consumed to parse
+// the params
+func (req *HTTPRequest) Body() io.ReadCloser {
+	return req.http.Body
+}
+
 // User returns the user that made the request
 func (req *HTTPRequest) User() *auth.User {
 	return req.user
@@ -69,6 +110,17 @@ func (req *HTTPRequest) SetSession(s *auth.Session) {
 	req.session = s
 }
 
+// APIKey returns the API key used to make the request. nil means that
+// the request has been made using a session, or anonymously
+func (req *HTTPRequest) APIKey() *auth.APIKey {
+	return req.apiKey
+}
+
+// SetAPIKey sets the API key that was used to make the request
+func (req *HTTPRequest) SetAPIKey(k *auth.APIKey) {
+	req.apiKey = k
+}
+
 // ID returns the ID of the request
 func (req *HTTPRequest) ID() string {
 	return req.id
@@ -128,63 +180,165 @@ func (req *HTTPRequest) muxVariables() url.Values {
 	return output
 }
 
+// cookies returns the cookies sent with the request
+func (req *HTTPRequest) cookies() url.Values {
+	output := url.Values{}
+	for _, c := range req.http.Cookies() {
+		output.Add(c.Name, c.Value)
+	}
+	return output
+}
+
 // contentType returns the content type of the current request
 func (req *HTTPRequest) contentType() string {
 	contentType := req.http.Header.Get("Content-Type")
 	return strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
 }
 
-// parseJSONBody parses and returns the body of the request
-func (req *HTTPRequest) parseJSONBody() (url.Values, error) {
-	output := url.Values{}
-
-	vars := map[string]interface{}{}
-	if err := json.NewDecoder(req.http.Body).Decode(&vars); err != nil && err != io.EOF {
-		return nil, apperror.NewBadRequest("", ErrMsgInvalidJSONPayload)
+// parseBody parses and returns the body of the request using the
+// provided decoder. The fields set to null are returned in a separate
+// list.
+// The objects and the lists are sent as raw JSON, and the items of
+// the lists are added one by one.
+func (req *HTTPRequest) parseBody(dec codec.Decoder) (form url.Values, nulls url.Values, err error) {
+	form = url.Values{}
+	nulls = url.Values{}
+
+	vars, err := dec.Decode(req.http.Body)
+	if err != nil {
+		if req.isBodyTooLarge(err) {
+			return nil, nil, apperror.NewPayloadTooLarge(req.maxBodySize)
+		}
+		msg := ErrMsgInvalidPayload
+		if mediaType := dec.MediaType(); mediaType == ContentTypeJSON || strings.HasSuffix(mediaType, "+json") {
+			msg = ErrMsgInvalidJSONPayload
+		}
+		return nil, nil, apperror.NewBadRequest("", "%s", msg)
 	}
 
 	for k, v := range vars {
 		switch array := v.(type) {
+		case nil:
+			nulls.Set(k, "")
 		case []interface{}:
-			if len(array) == 0 {
-				output[k] = []string{}
-			}
-
+			form[k] = make([]string, 0, len(array))
 			for _, elem := range array {
-				output.Add(k, fmt.Sprintf("%v", elem))
+				form.Add(k, flattenValue(elem))
 			}
 		default:
-			output.Set(k, fmt.Sprintf("%v", v))
+			form.Set(k, flattenValue(v))
+		}
+	}
+
+	return form, nulls, nil
+}
+
+// flattenValue returns the string representation of a value of a body.
+// The objects and the lists are returned as JSON
+func flattenValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case json.Number:
+		return value.String()
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Sprintf("%v", value)
+		}
+		return string(data)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+// errMsgBodyTooLarge is the message of the error returned by
+// http.MaxBytesReader. The message is checked because the
+// http.MaxBytesError type only exists since Go 1.19
+const errMsgBodyTooLarge = "http: request body too large"
+
+// isBodyTooLarge checks if an error has been caused by a body larger
+// than the limit
+func (req *HTTPRequest) isBodyTooLarge(err error) bool {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if err.Error() == errMsgBodyTooLarge {
+			return true
 		}
 	}
+	return false
+}
 
-	return output, nil
+// hasBody checks if the request has a body
+func (req *HTTPRequest) hasBody() bool {
+	return req.http.Body != nil && req.http.Body != http.NoBody && req.http.ContentLength != 0
 }
 
 // httpParamsBySource returns a map of all http params ordered by their source (url, query, form, ...)
 func (req *HTTPRequest) httpParamsBySource() (map[string]url.Values, error) {
 	params := map[string]url.Values{
-		"url":   req.muxVariables(),
-		"query": req.http.URL.Query(),
-		"form":  url.Values{},
+		"url":    req.muxVariables(),
+		"query":  req.http.URL.Query(),
+		"cookie": req.cookies(),
+		"form":   url.Values{},
+	}
+
+	// The body of the streaming endpoints is read by the handlers
+	if req.streaming {
+		return params, nil
 	}
 
-	if req.contentType() == ContentTypeJSON {
-		form, err := req.parseJSONBody()
+	contentType := req.contentType()
+	if contentType == ContentTypeForm || contentType == ContentTypeMultipartForm {
+		var err error
+		if contentType == ContentTypeMultipartForm {
+			// The files that don't fit in memory are stored on disk
+			multipartMem := req.multipartMem
+			if multipartMem <= 0 {
+				multipartMem = DefaultMultipartMemory
+			}
+			err = req.http.ParseMultipartForm(multipartMem)
+		} else {
+			err = req.http.ParseForm()
+		}
 		if err != nil {
-			return nil, err
+			if req.isBodyTooLarge(err) {
+				return nil, apperror.NewPayloadTooLarge(req.maxBodySize)
+			}
+			return nil, apperror.NewBadRequest("", "%s", ErrMsgInvalidPayload)
 		}
-		params["form"] = form
-	} else if req.contentType() == ContentTypeForm || req.contentType() == ContentTypeMultipartForm {
-		if err := req.http.ParseForm(); err != nil {
+		params["form"] = req.http.PostForm
+		return params, nil
+	}
+
+	decoders := req.decoders
+	if decoders == nil {
+		decoders = codec.DefaultDecoderRegistry()
+	}
+	if dec, found := decoders.Lookup(contentType); found {
+		form, nulls, err := req.parseBody(dec)
+		if err != nil {
 			return nil, err
 		}
-		params["form"] = req.http.PostForm
+		params["form"] = form
+		params[guard.NullSource] = nulls
+	} else if contentType != "" && req.hasBody() {
+		return nil, apperror.NewUnsupportedMediaType(contentType)
 	}
 
 	return params, nil
 }
 
+// removeTempFiles removes the temporary files created when parsing
+// a multipart body
+func (req *HTTPRequest) removeTempFiles() {
+	if req.http.MultipartForm != nil {
+		req.http.MultipartForm.RemoveAll()
+	}
+}
+
 // handlePanic will recover a panic an log what happen
 func (req *HTTPRequest) handlePanic() {
 	if rec := recover(); rec != nil {
@@ -1,16 +1,21 @@
 package router
 
 import (
+	"bytes"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strings"
 	"testing"
 
+	"github.com/Nivl/go-rest-tools/router/codec"
+	"github.com/Nivl/go-rest-tools/types/apperror"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
-func TestParseJSONBody(t *testing.T) {
+func TestParseBody(t *testing.T) {
 	t.Run("valid data", func(t *testing.T) {
 		body := `{"array":[1,2,3], "string": "value", "empty_array":[]}`
 
@@ -23,8 +28,8 @@ func TestParseJSONBody(t *testing.T) {
 			},
 		}
 
-		vals, err := req.parseJSONBody()
-		require.NoError(t, err, "parseJSONBody() should have succeed")
+		vals, _, err := req.parseBody(codec.JSON{})
+		require.NoError(t, err, "parseBody() should have succeed")
 		assert.Equal(t, []string{"1", "2", "3"}, vals["array"], "invalid values for 'array'")
 		assert.Equal(t, []string{"value"}, vals["string"], "invalid value for 'string'")
 		assert.Equal(t, []string{}, vals["empty_array"], "invalid value for 'empty_array'")
@@ -42,8 +47,8 @@ func TestParseJSONBody(t *testing.T) {
 			},
 		}
 
-		_, err := req.parseJSONBody()
-		require.Error(t, err, "parseJSONBody() should have failed")
+		_, _, err := req.parseBody(codec.JSON{})
+		require.Error(t, err, "parseBody() should have failed")
 		require.Equal(t, ErrMsgInvalidJSONPayload, err.Error(), "unexpected error returned")
 	})
 }
@@ -88,3 +93,76 @@ func TestContentType(t *testing.T) {
 		assert.Empty(t, ct, "invalid content type")
 	})
 }
+
+func TestHTTPParamsBySource(t *testing.T) {
+	msgpackBody := []byte{0x81, 0xa4, 'n', 'a', 'm', 'e', 0xa4, 'J', 'o', 'h', 'n'}
+
+	testCases := []struct {
+		description  string
+		contentType  string
+		body         []byte
+		expectedCode apperror.Code
+		expectedForm url.Values
+	}{
+		{"json", ContentTypeJSON, []byte(`{"name":"John"}`), apperror.NoError, url.Values{"name": []string{"John"}}},
+		{"merge patch", "application/merge-patch+json", []byte(`{"name":"John"}`), apperror.NoError, url.Values{"name": []string{"John"}}},
+		{"msgpack", "application/msgpack", msgpackBody, apperror.NoError, url.Values{"name": []string{"John"}}},
+		{"form", ContentTypeForm, []byte("name=John"), apperror.NoError, url.Values{"name": []string{"John"}}},
+		{"unknown type", "text/plain", []byte(`{"name":"John"}`), apperror.UnsupportedMediaType, nil},
+		{"unknown type without body", "text/plain", nil, apperror.NoError, url.Values{}},
+		{"no content type", "", []byte("John"), apperror.NoError, url.Values{}},
+		{"invalid msgpack", "application/msgpack", []byte{0x81}, apperror.InvalidArgument, nil},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			httpReq := httptest.NewRequest("POST", "/items", bytes.NewReader(tc.body))
+			if tc.body == nil {
+				httpReq = httptest.NewRequest("POST", "/items", nil)
+			}
+			if tc.contentType != "" {
+				httpReq.Header.Set("Content-Type", tc.contentType)
+			}
+			req := &HTTPRequest{http: httpReq}
+
+			sources, err := req.httpParamsBySource()
+			if tc.expectedCode != apperror.NoError {
+				require.Error(t, err)
+				assert.Equal(t, tc.expectedCode, apperror.Convert(err).StatusCode())
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expectedForm, sources["form"])
+		})
+	}
+}
+
+func TestHTTPParamsBySourceCookies(t *testing.T) {
+	httpReq := httptest.NewRequest("GET", "/items", nil)
+	httpReq.AddCookie(&http.Cookie{Name: "state", Value: "value"})
+	req := &HTTPRequest{http: httpReq}
+
+	sources, err := req.httpParamsBySource()
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{"state": []string{"value"}}, sources["cookie"])
+}
+
+func TestParseBodyNested(t *testing.T) {
+	t.Parallel()
+
+	body := `{"obj":{"b":1},"null":null,"big":12345678901234567890,"float":1000000.0,"list":[{"x":1},2,"s"]}`
+	req := &HTTPRequest{http: httptest.NewRequest("POST", "/items", strings.NewReader(body))}
+
+	form, nulls, err := req.parseBody(codec.JSON{})
+	require.NoError(t, err)
+	assert.Equal(t, url.Values{
+		"obj":   []string{`{"b":1}`},
+		"big":   []string{"12345678901234567890"},
+		"float": []string{"1000000.0"},
+		"list":  []string{`{"x":1}`, "2", "s"},
+	}, form)
+	assert.Equal(t, url.Values{"null": []string{""}}, nulls)
+}
@@ -1,25 +1,60 @@
 package router
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
 
 	"github.com/Nivl/go-rest-tools/request"
+	"github.com/Nivl/go-rest-tools/router/codec"
 	"github.com/Nivl/go-rest-tools/types/apperror"
 )
 
+// ErrorFormat represents the format used to send the errors to the client
+type ErrorFormat int
+
+const (
+	// ErrorFormatDefault sends the errors using ResponseError
+	ErrorFormatDefault ErrorFormat = iota
+
+	// ErrorFormatProblem sends the errors using ProblemDetails
+	// (RFC 7807, application/problem+json)
+	ErrorFormatProblem
+)
+
 // ResponseError represents the data sent the client when an error occurs
 type ResponseError struct {
 	Error string `json:"error,omitempty"`
 	Field string `json:"field,omitempty"`
+
+	// Errors contains all the fields that failed
+	Errors []*apperror.FieldError `json:"errors,omitempty"`
+}
+
+// ProblemDetails represents the data sent the client when an error
+// occurs, following the RFC 7807
+type ProblemDetails struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+
+	// RequestID contains the ID of the request that failed
+	RequestID string `json:"request_id,omitempty"`
+
+	// Errors contains all the fields that failed
+	Errors []*apperror.FieldError `json:"errors,omitempty"`
 }
 
 var _ request.Response = (*HTTPResponse)(nil)
 
 // HTTPResponse is a basic implementation of the HTTPResponse that uses a ResponseWriter
 type HTTPResponse struct {
-	writer http.ResponseWriter
+	writer             http.ResponseWriter
+	http               *http.Request
+	encoder            codec.Encoder
+	errorFormat        ErrorFormat
+	paginationEnvelope bool
+	validator          *responseValidator
 }
 
 // NewResponse creates a new response
@@ -36,35 +71,63 @@ func (res *HTTPResponse) Header() http.Header {
 
 // NoContent sends a http.StatusNoContent response
 func (res *HTTPResponse) NoContent() {
+	res.validator.validate(http.StatusNoContent, nil)
 	res.writer.WriteHeader(http.StatusNoContent)
 }
 
-// Created sends a http.StatusCreated response with a JSON object attached
+// Redirect sends a http.StatusFound response redirecting the client to
+// the provided URL
+func (res *HTTPResponse) Redirect(url string) {
+	res.validator.validate(http.StatusFound, nil)
+	res.writer.Header().Set("Location", url)
+	res.writer.WriteHeader(http.StatusFound)
+}
+
+// Created sends a http.StatusCreated response with an object attached
 func (res *HTTPResponse) Created(obj interface{}) error {
-	return res.renderJSON(http.StatusCreated, obj)
+	res.validator.validate(http.StatusCreated, obj)
+	return res.render(http.StatusCreated, obj)
 }
 
-// Ok sends a http.StatusOK response with a JSON object attached
+// Ok sends a http.StatusOK response with an object attached
 func (res *HTTPResponse) Ok(obj interface{}) error {
-	return res.renderJSON(http.StatusOK, obj)
+	res.validator.validate(http.StatusOK, obj)
+	return res.render(http.StatusOK, obj)
 }
 
-// renderJSON attaches a json object to the response
-func (res *HTTPResponse) renderJSON(code int, obj interface{}) error {
-	res.setJSON(code)
+// render attaches an object to the response, using the format
+// negotiated with the client (JSON by default)
+func (res *HTTPResponse) render(code int, obj interface{}) error {
+	enc := res.getEncoder()
+	res.setContentType(code, enc.ContentType())
 
 	if obj != nil {
-		return json.NewEncoder(res.writer).Encode(obj)
+		return enc.Encode(res.writer, obj)
 	}
 	return nil
 }
 
+// getEncoder returns the encoder to use to write the response
+func (res *HTTPResponse) getEncoder() codec.Encoder {
+	if res.encoder == nil {
+		return codec.JSON{}
+	}
+	return res.encoder
+}
+
 // Error sends an error to the client
 // If the error is an instance of HTTPError, the returned code will
 // match HTTPError.HTTPStatus(). It returns a 500 if no code has been set.
 func (res *HTTPResponse) Error(e error, req request.Request) {
 	err := apperror.Convert(e)
-	res.errorJSON(err)
+	if retryAfter := err.RetryAfter(); retryAfter > 0 {
+		res.Header().Set("Retry-After", seconds(retryAfter))
+	}
+	if res.errorFormat == ErrorFormatProblem {
+		res.errorProblem(err, req)
+	} else {
+		res.renderError(err)
+	}
 
 	// if the error has a field attached we log it
 	field := ""
@@ -83,29 +146,59 @@ func (res *HTTPResponse) Error(e error, req request.Request) {
 	}
 }
 
-// errorJSON set the request content to the specified error message and HTTP code.
-// The error message should be valid json.
-func (res *HTTPResponse) errorJSON(err apperror.Error) {
+// renderError set the request content to the specified error message and HTTP code.
+func (res *HTTPResponse) renderError(err apperror.Error) {
 	httpStatusCode := apperror.HTTPStatusCode(err.StatusCode())
 	if err.Error() == "" {
 		res.writer.WriteHeader(httpStatusCode)
 		return
 	}
 	resError := &ResponseError{
-		Error: err.Error(),
-		Field: err.Field(),
+		Error:  err.Error(),
+		Field:  err.Field(),
+		Errors: err.FieldErrors(),
 	}
 
 	if apperror.IsInternalServerError(err) {
 		resError.Error = "Something went wrong"
 		resError.Field = ""
+		resError.Errors = nil
+	}
+	res.render(httpStatusCode, resError)
+}
+
+// errorProblem set the request content to the specified error using
+// the RFC 7807 format
+func (res *HTTPResponse) errorProblem(err apperror.Error, req request.Request) {
+	httpStatusCode := apperror.HTTPStatusCode(err.StatusCode())
+	problem := &ProblemDetails{
+		Type:      "about:blank",
+		Title:     http.StatusText(httpStatusCode),
+		Status:    httpStatusCode,
+		Detail:    err.Error(),
+		RequestID: req.ID(),
+		Errors:    err.FieldErrors(),
+	}
+
+	if apperror.IsInternalServerError(err) {
+		problem.Detail = ""
+		problem.Errors = nil
+	}
+
+	// The problem+json media type only exists for JSON
+	enc := res.getEncoder()
+	contentType := enc.ContentType()
+	if enc.MediaType() == (codec.JSON{}).MediaType() {
+		contentType = "application/problem+json; charset=utf-8"
 	}
-	res.renderJSON(httpStatusCode, resError)
+	res.setContentType(httpStatusCode, contentType)
+	enc.Encode(res.writer, problem)
 }
 
-// setJSON set the response to JSON and with the specify HTTP code.
-func (res *HTTPResponse) setJSON(code int) {
-	res.writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+// setContentType set the content type of the response and the specify
+// HTTP code.
+func (res *HTTPResponse) setContentType(code int, contentType string) {
+	res.writer.Header().Set("Content-Type", contentType)
 	res.writer.Header().Set("X-Content-Type-Options", "nosniff")
 	res.writer.WriteHeader(code)
 }
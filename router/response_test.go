@@ -0,0 +1,165 @@
+package router_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/request"
+	"github.com/Nivl/go-rest-tools/router"
+	"github.com/Nivl/go-rest-tools/router/codec"
+	"github.com/Nivl/go-rest-tools/router/guard"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type errorFormatParams struct {
+	Name  string `from:"query" json:"name" params:"required"`
+	Limit int    `from:"query" json:"limit" params:"required"`
+}
+
+func newErrorFormatEndpoint() *router.Endpoint {
+	return &router.Endpoint{
+		Verb: "GET",
+		Path: "/items",
+		Guard: &guard.Guard{
+			ParamStruct: &errorFormatParams{},
+		},
+		Handler: func(req request.Request) error {
+			req.Response().NoContent()
+			return nil
+		},
+	}
+}
+
+func TestErrorFormat(t *testing.T) {
+	expectedErrors := []*apperror.FieldError{
+		{Field: "name", Code: apperror.FieldCodeMissing, Message: "parameter missing"},
+		{Field: "limit", Code: apperror.FieldCodeInvalidInt, Message: "invalid integer"},
+	}
+
+	t.Run("default", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		router.Handler(newErrorFormatEndpoint(), &testDeps{}).ServeHTTP(rec, httptest.NewRequest("GET", "/items?limit=nope", nil))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+
+		var body router.ResponseError
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Equal(t, "name", body.Field)
+		assert.Equal(t, "parameter missing", body.Error)
+		assert.Equal(t, expectedErrors, body.Errors)
+	})
+
+	t.Run("problem", func(t *testing.T) {
+		t.Parallel()
+
+		rec := httptest.NewRecorder()
+		h := router.Handler(newErrorFormatEndpoint(), &testDeps{}, router.WithErrorFormat(router.ErrorFormatProblem))
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/items?limit=nope", nil))
+
+		assert.Equal(t, http.StatusBadRequest, rec.Code)
+		assert.Equal(t, "application/problem+json; charset=utf-8", rec.Header().Get("Content-Type"))
+
+		var body router.ProblemDetails
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Equal(t, "about:blank", body.Type)
+		assert.Equal(t, "Bad Request", body.Title)
+		assert.Equal(t, http.StatusBadRequest, body.Status)
+		assert.Equal(t, "parameter missing", body.Detail)
+		assert.Equal(t, rec.Header().Get("X-Request-Id"), body.RequestID)
+		assert.Equal(t, expectedErrors, body.Errors)
+	})
+
+	t.Run("problem hides server errors", func(t *testing.T) {
+		t.Parallel()
+
+		e := &router.Endpoint{
+			Verb: "GET",
+			Path: "/items",
+			Handler: func(req request.Request) error {
+				return apperror.NewServerError("db password is 42")
+			},
+		}
+
+		rec := httptest.NewRecorder()
+		router.Handler(e, &testDeps{}, router.WithErrorFormat(router.ErrorFormatProblem)).ServeHTTP(rec, httptest.NewRequest("GET", "/items", nil))
+
+		assert.Equal(t, http.StatusInternalServerError, rec.Code)
+		var body router.ProblemDetails
+		require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+		assert.Empty(t, body.Detail)
+		assert.Equal(t, "Internal Server Error", body.Title)
+	})
+}
+
+func TestErrorRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	e := &router.Endpoint{
+		Verb: "POST",
+		Path: "/sessions",
+		Handler: func(req request.Request) error {
+			return apperror.NewLocked("too many failed attempts", 90*time.Second)
+		},
+	}
+
+	rec := httptest.NewRecorder()
+	router.Handler(e, &testDeps{}).ServeHTTP(rec, httptest.NewRequest("POST", "/sessions", nil))
+
+	assert.Equal(t, http.StatusLocked, rec.Code)
+	assert.Equal(t, "90", rec.Header().Get("Retry-After"))
+}
+
+func TestContentNegotiation(t *testing.T) {
+	e := &router.Endpoint{
+		Verb: "GET",
+		Path: "/items",
+		Handler: func(req request.Request) error {
+			return req.Response().Ok(map[string]string{"a": "b"})
+		},
+	}
+
+	testCases := []struct {
+		description         string
+		accept              string
+		opts                []router.Option
+		expectedCode        int
+		expectedContentType string
+	}{
+		{"default to json", "", nil, http.StatusOK, "application/json; charset=utf-8"},
+		{"json is accepted", "application/json", nil, http.StatusOK, "application/json; charset=utf-8"},
+		{"msgpack disabled by default", "application/msgpack", nil, http.StatusNotAcceptable, "application/json; charset=utf-8"},
+		{
+			"msgpack enabled",
+			"application/msgpack",
+			[]router.Option{router.WithEncoders(codec.JSON{}, codec.MsgPack{})},
+			http.StatusOK,
+			"application/msgpack",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest("GET", "/items", nil)
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+			rec := httptest.NewRecorder()
+			router.Handler(e, &testDeps{}, tc.opts...).ServeHTTP(rec, req)
+
+			assert.Equal(t, tc.expectedCode, rec.Code)
+			assert.Equal(t, tc.expectedContentType, rec.Header().Get("Content-Type"))
+			assert.Equal(t, "Accept", rec.Header().Get("Vary"))
+		})
+	}
+}
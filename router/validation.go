@@ -0,0 +1,264 @@
+package router
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	reporter "github.com/Nivl/go-reporter"
+)
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// ResponseMismatchError is reported when the response sent by an endpoint
+// doesn't match its declaration. See WithResponseValidation
+type ResponseMismatchError struct {
+	// Endpoint contains the verb and the path of the endpoint
+	Endpoint string
+
+	// Problems contains all the differences found
+	Problems []string
+}
+
+// Error returns the list of problems as a string
+func (e *ResponseMismatchError) Error() string {
+	return fmt.Sprintf("the response of %s doesn't match its declaration: %s",
+		e.Endpoint, strings.Join(e.Problems, "; "))
+}
+
+// responseValidator checks that the responses sent by an endpoint match
+// its ResponseSpec
+type responseValidator struct {
+	endpoint string
+	spec     *ResponseSpec
+	reporter reporter.Reporter
+}
+
+// validate reports the differences between the provided response and
+// the declaration of the endpoint
+func (v *responseValidator) validate(code int, obj interface{}) {
+	if v == nil || v.spec == nil {
+		return
+	}
+
+	problems := v.spec.problems(code, obj)
+	if len(problems) > 0 && v.reporter != nil {
+		v.reporter.ReportError(&ResponseMismatchError{
+			Endpoint: v.endpoint,
+			Problems: problems,
+		})
+	}
+}
+
+// problems returns all the differences between the provided response
+// and the spec
+func (spec *ResponseSpec) problems(code int, obj interface{}) []string {
+	problems := []string{}
+	if expected := spec.StatusCode(); code != expected {
+		problems = append(problems, fmt.Sprintf("status: expected %d, got %d", expected, code))
+	}
+
+	switch {
+	case spec.Body == nil && obj != nil:
+		problems = append(problems, "body: no body expected")
+	case spec.Body != nil && obj == nil:
+		problems = append(problems, "body: missing")
+	case spec.Body != nil:
+		expected := indirectType(reflect.TypeOf(spec.Body))
+		got := indirectType(reflect.TypeOf(obj))
+		if expected != got {
+			problems = append(problems, fmt.Sprintf("body: expected %s, got %s", expected, got))
+		}
+
+		// We compare the data that are actually sent to the client
+		data, err := toJSON(obj)
+		if err != nil {
+			return append(problems, fmt.Sprintf("body: %s", err.Error()))
+		}
+		problems = append(problems, checkValue(data, reflect.TypeOf(spec.Body), "body")...)
+	}
+	return problems
+}
+
+// toJSON returns the JSON representation of obj using generic types
+func toJSON(obj interface{}) (interface{}, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	var v interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	err = dec.Decode(&v)
+	return v, err
+}
+
+// indirectType returns the type pointed by t
+func indirectType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// jsonField represents a field of a struct, as encoded in JSON
+type jsonField struct {
+	typ       reflect.Type
+	omitEmpty bool
+	asString  bool
+}
+
+// jsonFields returns the fields of a struct, indexed by their JSON name
+func jsonFields(t reflect.Type, fields map[string]*jsonField) map[string]*jsonField {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tags := strings.Split(field.Tag.Get("json"), ",")
+		name := tags[0]
+		if name == "-" && len(tags) == 1 {
+			continue
+		}
+
+		// The fields of the embedded structs are promoted
+		if field.Anonymous && name == "" && indirectType(field.Type).Kind() == reflect.Struct {
+			jsonFields(indirectType(field.Type), fields)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		f := &jsonField{typ: field.Type}
+		for _, opt := range tags[1:] {
+			switch opt {
+			case "omitempty":
+				f.omitEmpty = true
+			case "string":
+				f.asString = true
+			}
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// checkValue returns the differences between a JSON value and the
+// type it's expected to have
+func checkValue(v interface{}, t reflect.Type, path string) []string {
+	t = indirectType(t)
+	// null is accepted everywhere since it's the zero value of the
+	// pointers, slices, and maps
+	if v == nil || t.Kind() == reflect.Interface {
+		return nil
+	}
+	// The types using a custom encoding cannot be checked
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) ||
+		t.Implements(textMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType) {
+		return nil
+	}
+
+	mismatch := func(expected string) []string {
+		return []string{fmt.Sprintf("%s: expected %s, got %T", path, expected, v)}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch("an object")
+		}
+		return checkObject(obj, t, path)
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch("an object")
+		}
+		problems := []string{}
+		for _, key := range sortedKeys(obj) {
+			problems = append(problems, checkValue(obj[key], t.Elem(), path+"."+key)...)
+		}
+		return problems
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if _, ok := v.(string); !ok {
+				return mismatch("a string")
+			}
+			return nil
+		}
+		list, ok := v.([]interface{})
+		if !ok {
+			return mismatch("a list")
+		}
+		problems := []string{}
+		for i, item := range list {
+			problems = append(problems, checkValue(item, t.Elem(), fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return problems
+	case reflect.String:
+		if _, ok := v.(string); !ok {
+			return mismatch("a string")
+		}
+	case reflect.Bool:
+		if _, ok := v.(bool); !ok {
+			return mismatch("a boolean")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if _, ok := v.(json.Number); !ok {
+			return mismatch("a number")
+		}
+	}
+	return nil
+}
+
+// checkObject returns the differences between a JSON object and the
+// struct it's expected to be
+func checkObject(obj map[string]interface{}, t reflect.Type, path string) []string {
+	problems := []string{}
+	fields := jsonFields(t, map[string]*jsonField{})
+	for _, name := range sortedKeys(obj) {
+		if _, found := fields[name]; !found {
+			problems = append(problems, fmt.Sprintf("%s.%s: not declared", path, name))
+		}
+	}
+
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field := fields[name]
+		value, found := obj[name]
+		if !found {
+			if !field.omitEmpty {
+				problems = append(problems, fmt.Sprintf("%s.%s: missing", path, name))
+			}
+			continue
+		}
+		if !field.asString {
+			problems = append(problems, checkValue(value, field.typ, path+"."+name)...)
+		}
+	}
+	return problems
+}
+
+// sortedKeys returns the keys of the object in alphabetical order
+func sortedKeys(obj map[string]interface{}) []string {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
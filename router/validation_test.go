@@ -0,0 +1,175 @@
+package router_test
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	logger "github.com/Nivl/go-logger"
+	reporter "github.com/Nivl/go-reporter"
+	"github.com/Nivl/go-rest-tools/request"
+	"github.com/Nivl/go-rest-tools/router"
+	"github.com/Nivl/go-rest-tools/security/auth"
+	db "github.com/Nivl/go-sqldb"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingReporter is a reporter that keeps the reported errors
+type recordingReporter struct {
+	noopReporter
+
+	mu     sync.Mutex
+	errors []error
+}
+
+func (r *recordingReporter) ReportError(err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, err)
+}
+
+// recordingDeps is an implementation of router.Dependencies that
+// returns a recordingReporter
+type recordingDeps struct {
+	reporter *recordingReporter
+}
+
+func (d *recordingDeps) NewLogger() (logger.Logger, error)       { return nil, nil }
+func (d *recordingDeps) NewReporter() (reporter.Reporter, error) { return d.reporter, nil }
+func (d *recordingDeps) DB() db.Connection                       { return nil }
+
+type publicUser struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Bio  string `json:"bio,omitempty"`
+}
+
+func TestResponseValidation(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		description      string
+		spec             *router.ResponseSpec
+		handler          router.RouteHandler
+		disabled         bool
+		expectedProblems []string
+	}{
+		{
+			"valid response",
+			&router.ResponseSpec{Body: &publicUser{}},
+			func(req request.Request) error {
+				return req.Response().Ok(&publicUser{ID: "id", Name: "name"})
+			},
+			false,
+			nil,
+		},
+		{
+			"valid list",
+			&router.ResponseSpec{Body: []*publicUser{}},
+			func(req request.Request) error {
+				return req.Response().Ok([]*publicUser{{ID: "id"}})
+			},
+			false,
+			nil,
+		},
+		{
+			"missing fields",
+			&router.ResponseSpec{Body: []*publicUser{}},
+			func(req request.Request) error {
+				return req.Response().Ok([]map[string]interface{}{{"id": 42}})
+			},
+			false,
+			[]string{
+				"body: expected []*router_test.publicUser, got []map[string]interface {}",
+				"body[0].id: expected a string, got json.Number",
+				"body[0].name: missing",
+			},
+		},
+		{
+			"wrong status",
+			&router.ResponseSpec{Status: 201, Body: &publicUser{}},
+			func(req request.Request) error {
+				return req.Response().Ok(&publicUser{})
+			},
+			false,
+			[]string{"status: expected 201, got 200"},
+		},
+		{
+			"unexpected body",
+			&router.ResponseSpec{},
+			func(req request.Request) error {
+				return req.Response().Ok(&publicUser{})
+			},
+			false,
+			[]string{"status: expected 204, got 200", "body: no body expected"},
+		},
+		{
+			"disabled",
+			&router.ResponseSpec{},
+			func(req request.Request) error {
+				return req.Response().Ok(&publicUser{})
+			},
+			true,
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			rep := &recordingReporter{}
+			e := &router.Endpoint{
+				Verb:     "GET",
+				Path:     "/users/{id}",
+				Handler:  tc.handler,
+				Response: tc.spec,
+			}
+			opts := []router.Option{router.WithResponseValidation()}
+			if tc.disabled {
+				opts = nil
+			}
+			r := mux.NewRouter()
+			router.Endpoints{e}.Activate(r, &recordingDeps{reporter: rep}, opts...)
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/id", nil))
+
+			if tc.expectedProblems == nil {
+				assert.Empty(t, rep.errors)
+				return
+			}
+			require.Len(t, rep.errors, 1)
+			err, ok := rep.errors[0].(*router.ResponseMismatchError)
+			require.True(t, ok, "unexpected error type %T", rep.errors[0])
+			assert.Equal(t, "GET /users/{id}", err.Endpoint)
+			assert.Equal(t, tc.expectedProblems, err.Problems)
+		})
+	}
+}
+
+func TestResponseValidationLeak(t *testing.T) {
+	t.Parallel()
+
+	rep := &recordingReporter{}
+	e := &router.Endpoint{
+		Verb: "GET",
+		Path: "/users/{id}",
+		Handler: func(req request.Request) error {
+			return req.Response().Ok(&auth.User{ID: "id", Name: "name", Password: "hash"})
+		},
+		Response: &router.ResponseSpec{Body: &publicUser{}},
+	}
+	r := mux.NewRouter()
+	router.Endpoints{e}.Activate(r, &recordingDeps{reporter: rep}, router.WithResponseValidation())
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/id", nil))
+
+	require.Len(t, rep.errors, 1)
+	err, ok := rep.errors[0].(*router.ResponseMismatchError)
+	require.True(t, ok, "unexpected error type %T", rep.errors[0])
+	assert.Contains(t, err.Problems, "body: expected router_test.publicUser, got auth.User")
+	assert.Contains(t, err.Problems, "body.email: not declared", "the email leak should have been reported")
+	// the password never serializes, so it cannot leak
+	assert.NotContains(t, err.Problems, "body.Password: not declared")
+}
@@ -0,0 +1,352 @@
+package auth
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	hasher "github.com/Nivl/go-hasher"
+	"github.com/Nivl/go-hasher/implementations/bcrypt"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	db "github.com/Nivl/go-sqldb"
+	"github.com/Nivl/go-types/datetime"
+)
+
+var (
+	// PasswordResetTTL is the lifetime of a password reset token
+	PasswordResetTTL = time.Hour
+
+	// EmailVerificationTTL is the lifetime of an email verification token
+	EmailVerificationTTL = 7 * 24 * time.Hour
+
+	// MinPasswordLength is the minimum number of characters a password
+	// must contain
+	MinPasswordLength = 8
+)
+
+const (
+	// ErrMsgInvalidCredentials is the message returned when the email or
+	// the password of a user is invalid. The same message is used for
+	// both to not leak the existence of an account
+	ErrMsgInvalidCredentials = "invalid email or password"
+
+	// ErrMsgInvalidPassword is the message returned when the current
+	// password of a user is invalid
+	ErrMsgInvalidPassword = "invalid password"
+
+	// ErrMsgPasswordTooShort is the message returned when a new password
+	// doesn't contain enough characters
+	ErrMsgPasswordTooShort = "must contain at least %d characters"
+
+	// ErrMsgEmailAlreadyVerified is the message returned when verifying
+	// an email that has already been verified
+	ErrMsgEmailAlreadyVerified = "already verified"
+)
+
+// Accounts implements the flows needed to manage the accounts of the
+// users: sign-up, login, password change, password reset,
+// email verification, and multi-factor authentication.
+// The functions that write more than once in the database should be
+// given a transaction
+type Accounts struct {
+	// Hasher is used to hash the passwords
+	Hasher hasher.Hasher
+
+	// Lockout protects the logins against brute-force attacks. nil
+	// disables the protection.
+	// The failed attempts are recorded using the Queryable given to
+	// AuthenticateFrom(), which should therefore not be a transaction
+	// that gets rolled back when the credentials are invalid
+	Lockout *Lockout
+
+	dummyHashMu sync.Mutex
+	dummyHash   string
+}
+
+// NewAccounts returns an Accounts using bcrypt to hash the passwords
+func NewAccounts() *Accounts {
+	return &Accounts{
+		Hasher: bcrypt.Bcrypt{},
+	}
+}
+
+// SignUp sets the password of a user and persists the user.
+// A Conflict error is returned if the email is already used
+func (a *Accounts) SignUp(q db.Queryable, u *User, password string) error {
+	if u == nil {
+		return apperror.NewServerError("user is nil")
+	}
+	if err := a.setPassword(u, password); err != nil {
+		return err
+	}
+	u.Email = strings.TrimSpace(u.Email)
+	u.EmailVerifiedAt = nil
+	return u.Create(q)
+}
+
+// Authenticate checks the credentials of a user and returns a new
+// session. It's the same as AuthenticateFrom() with no IP address
+func (a *Accounts) Authenticate(q db.Queryable, email, password string) (*User, *Session, error) {
+	return a.AuthenticateFrom(q, email, password, "")
+}
+
+// AuthenticateFrom checks the credentials sent by a client and returns
+// a new session. The session of a user using MFA is pending until
+// VerifyMFA() is called. The roles and permissions of the user are not
+// loaded, see User.LoadPermissions().
+// An Unauthorized error is returned if the credentials are invalid,
+// and the response time is the same whether the email exists or not.
+// A Locked error is returned if the account or the IP address of the
+// client has been locked by the Lockout. The attempts are recorded
+// using q, which should therefore not be a transaction that gets rolled
+// back when the credentials are invalid. clientIP is optional
+func (a *Accounts) AuthenticateFrom(q db.Queryable, email, password, clientIP string) (*User, *Session, error) {
+	dummyHash, err := a.getDummyHash()
+	if err != nil {
+		return nil, nil, err
+	}
+	if a.Lockout != nil {
+		if err := a.Lockout.Reserve(q, email, clientIP); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	u, err := GetUserByEmail(q, email)
+	if err != nil {
+		if !apperror.IsNotFound(err) {
+			return nil, nil, err
+		}
+		// We still check a password to not leak the existence of the
+		// account through the response time
+		a.Hasher.IsValid(dummyHash, password)
+		return nil, nil, a.loginFailed(q, email, clientIP)
+	}
+	if !a.Hasher.IsValid(u.Password, password) {
+		return nil, nil, a.loginFailed(q, email, clientIP)
+	}
+
+	if a.Lockout != nil {
+		if err := a.Lockout.RecordSuccess(q, email, clientIP); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	s, err := StartSession(q, u)
+	if err != nil {
+		return nil, nil, err
+	}
+	return u, s, nil
+}
+
+// StartSession creates a new session for a user whose identity has
+// been checked. The session of a user using MFA is pending until
+// VerifyMFA() is called
+func StartSession(q db.Queryable, u *User) (*Session, error) {
+	if u.IsZero() {
+		return nil, apperror.NewServerError("user has not been saved")
+	}
+
+	// The users using MFA get a session that cannot be used until
+	// the second factor is verified, see VerifyMFA()
+	hasMFA, err := HasMFA(q, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	s := &Session{UserID: u.ID}
+	if hasMFA {
+		s.MFAStatus = MFAPending
+	}
+	if err := s.Create(q); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// loginFailed records a failed login attempt and returns the error to
+// send to the client
+func (a *Accounts) loginFailed(q db.Queryable, email, clientIP string) error {
+	if a.Lockout != nil {
+		if err := a.Lockout.RecordFailure(q, email, clientIP); err != nil {
+			return err
+		}
+	}
+	return apperror.NewUnauthorizedR(ErrMsgInvalidCredentials)
+}
+
+// ChangePassword replaces the password of a user after checking their
+// current password. All the sessions of the user but the current one
+// are revoked, as well as the pending password reset tokens.
+// The invalid passwords count toward the lockout of the account, if
+// any, and are recorded using q, which should therefore not be a
+// transaction that gets rolled back when the password is invalid
+func (a *Accounts) ChangePassword(q db.Queryable, u *User, currentSessionID, currentPassword, newPassword string) error {
+	if u.IsZero() {
+		return apperror.NewServerError("user has not been saved")
+	}
+	if a.Lockout != nil {
+		if err := a.Lockout.Reserve(q, u.Email, ""); err != nil {
+			return err
+		}
+	}
+	if !a.Hasher.IsValid(u.Password, currentPassword) {
+		if a.Lockout != nil {
+			if err := a.Lockout.RecordFailure(q, u.Email, ""); err != nil {
+				return err
+			}
+		}
+		return apperror.NewBadRequest("current_password", ErrMsgInvalidPassword)
+	}
+	if a.Lockout != nil {
+		if err := a.Lockout.RecordSuccess(q, u.Email, ""); err != nil {
+			return err
+		}
+	}
+	if err := a.setPassword(u, newPassword); err != nil {
+		return err
+	}
+	if err := u.updatePassword(q); err != nil {
+		return err
+	}
+	if err := RevokeUserTokens(q, u.ID, UserTokenPasswordReset); err != nil {
+		return err
+	}
+	return RevokeOtherUserSessions(q, u.ID, currentSessionID)
+}
+
+// RequestPasswordReset returns a token to send to the provided email
+// address, to be used with ResetPassword(). The previous tokens are
+// revoked.
+// No error and an empty token are returned if the email doesn't
+// belong to any user, the response sent to the client should therefore
+// be the same in both cases.
+// Creating the token and sending the email take time that the unknown
+// emails don't, which leaks the existence of the accounts through the
+// response time. Callers must therefore respond to the client first,
+// and call RequestPasswordReset() and send the email asynchronously
+func (a *Accounts) RequestPasswordReset(q db.Queryable, email string) (token string, u *User, err error) {
+	u, err = GetUserByEmail(q, email)
+	if err != nil {
+		if apperror.IsNotFound(err) {
+			return "", nil, nil
+		}
+		return "", nil, err
+	}
+
+	token, err = newUserToken(q, u, UserTokenPasswordReset, PasswordResetTTL)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, u, nil
+}
+
+// ResetPassword uses a token returned by RequestPasswordReset() to set
+// a new password. All the sessions of the user are revoked.
+// An InvalidArgument error is returned if the token is invalid, expired,
+// or has already been used
+func (a *Accounts) ResetPassword(q db.Queryable, token, newPassword string) (*User, error) {
+	// The password is checked first to not burn the token if the
+	// password is invalid
+	if err := validatePassword(newPassword); err != nil {
+		return nil, err
+	}
+
+	_, u, err := useUserToken(q, UserTokenPasswordReset, token)
+	if err != nil {
+		return nil, err
+	}
+	if err := a.setPassword(u, newPassword); err != nil {
+		return nil, err
+	}
+	if err := u.updatePassword(q); err != nil {
+		return nil, err
+	}
+	return u, RevokeUserSessions(q, u.ID)
+}
+
+// RequestEmailVerification returns a token to send to the email address
+// of the user, to be used with VerifyEmail(). The previous tokens are
+// revoked
+func (a *Accounts) RequestEmailVerification(q db.Queryable, u *User) (string, error) {
+	if u.IsZero() {
+		return "", apperror.NewServerError("user has not been saved")
+	}
+	if u.IsEmailVerified() {
+		return "", apperror.NewConflictR("email", ErrMsgEmailAlreadyVerified)
+	}
+	return newUserToken(q, u, UserTokenEmailVerification, EmailVerificationTTL)
+}
+
+// VerifyEmail uses a token returned by RequestEmailVerification() to
+// flag the email address of a user as verified.
+// An InvalidArgument error is returned if the token is invalid, expired,
+// has already been used, or if the user changed their email address
+// since the token has been created
+func (a *Accounts) VerifyEmail(q db.Queryable, token string) (*User, error) {
+	_, u, err := useUserToken(q, UserTokenEmailVerification, token)
+	if err != nil {
+		return nil, err
+	}
+
+	u.EmailVerifiedAt = datetime.Now()
+	u.UpdatedAt = u.EmailVerifiedAt
+	stmt := `UPDATE users
+					SET email_verified_at=$1, updated_at=$1
+					WHERE id=$2`
+	if _, err := q.Exec(stmt, u.EmailVerifiedAt, u.ID); err != nil {
+		return nil, apperror.NewFromSQL(err)
+	}
+	return u, nil
+}
+
+// setPassword validates and hashes a password and sets it to the user.
+// The user is not saved
+func (a *Accounts) setPassword(u *User, password string) error {
+	if err := validatePassword(password); err != nil {
+		return err
+	}
+	hash, err := a.Hasher.Hash(password)
+	if err != nil {
+		return apperror.Wrap(err, apperror.Internal, "", "could not hash the password")
+	}
+	u.Password = hash
+	return nil
+}
+
+// getDummyHash returns the hash of a random password, used to check
+// passwords in constant time when a user doesn't exist.
+// The hash is only generated once, unless the generation fails
+func (a *Accounts) getDummyHash() (string, error) {
+	a.dummyHashMu.Lock()
+	defer a.dummyHashMu.Unlock()
+
+	if a.dummyHash == "" {
+		secret, err := newSecret(16)
+		if err != nil {
+			return "", err
+		}
+		hash, err := a.Hasher.Hash(secret)
+		if err != nil {
+			return "", apperror.Wrap(err, apperror.Internal, "", "could not hash the password")
+		}
+		a.dummyHash = hash
+	}
+	return a.dummyHash, nil
+}
+
+// validatePassword checks that a password can be used
+func validatePassword(password string) error {
+	if len([]rune(password)) < MinPasswordLength {
+		return apperror.NewBadRequest("password", ErrMsgPasswordTooShort, MinPasswordLength)
+	}
+	return nil
+}
+
+// updatePassword persists the password of the user
+func (u *User) updatePassword(q db.Queryable) error {
+	u.UpdatedAt = datetime.Now()
+	stmt := `UPDATE users
+					SET password=$1, updated_at=$2
+					WHERE id=$3`
+	_, err := q.Exec(stmt, u.Password, u.UpdatedAt, u.ID)
+	return apperror.NewFromSQL(err)
+}
@@ -0,0 +1,404 @@
+package auth_test
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/security/auth"
+	"github.com/Nivl/go-rest-tools/security/auth/testauth"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	"github.com/Nivl/go-sqldb/implementations/mocksqldb"
+	"github.com/Nivl/go-types/datetime"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// plainHasher is a fast hasher that can be used in the tests
+type plainHasher struct{}
+
+func (h plainHasher) Hash(raw string) (string, error) { return "hashed:" + raw, nil }
+func (h plainHasher) IsValid(hash, raw string) bool   { return hash == "hashed:"+raw }
+
+// failingHasher is a hasher that cannot hash any password
+type failingHasher struct{ plainHasher }
+
+func (h failingHasher) Hash(raw string) (string, error) { return "", errors.New("hash failed") }
+
+func newTestAccounts() *auth.Accounts {
+	return &auth.Accounts{Hasher: plainHasher{}}
+}
+
+func TestSignUp(t *testing.T) {
+	t.Run("valid password", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().InsertSuccess(&auth.User{})
+
+		u := &auth.User{Name: "name", Email: " email@domain.tld "}
+		err := newTestAccounts().SignUp(mockDB, u, "password")
+		require.NoError(t, err, "SignUp() should have succeed")
+		assert.NotEmpty(t, u.ID)
+		assert.Equal(t, "email@domain.tld", u.Email)
+		assert.Equal(t, "hashed:password", u.Password)
+	})
+
+	t.Run("short password", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		u := &auth.User{Name: "name", Email: "email@domain.tld"}
+		err := newTestAccounts().SignUp(mocksqldb.NewMockQueryable(mockCtrl), u, "short")
+		require.True(t, apperror.IsBadRequest(err), "expected a BadRequest error")
+		assert.Equal(t, "password", apperror.Convert(err).Field())
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	t.Parallel()
+
+	// testauth creates users with "fake" as password using bcrypt
+	user := testauth.NewUser()
+
+	testCases := []struct {
+		description string
+		password    string
+		userExists  bool
+		hasMFA      bool
+		expectedErr bool
+	}{
+		{"valid credentials", "fake", true, false, false},
+		{"valid credentials with MFA", "fake", true, true, false},
+		{"invalid password", "not fake", true, false, true},
+		{"unknown user", "fake", false, false, true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+			if tc.userExists {
+				mockDB.EXPECT().GetSuccess(&auth.User{}, func(u *auth.User, stmt, email string) {
+					assert.Equal(t, user.Email, email)
+					*u = *user
+				})
+			} else {
+				mockDB.EXPECT().GetNotFound(&auth.User{})
+			}
+			if !tc.expectedErr {
+				if tc.hasMFA {
+					mockDB.EXPECT().GetSuccess(&auth.TOTPDevice{}, nil)
+				} else {
+					mockDB.EXPECT().GetNotFound(&auth.TOTPDevice{})
+				}
+				mockDB.EXPECT().InsertSuccess(&auth.Session{})
+			}
+
+			u, s, err := auth.NewAccounts().Authenticate(mockDB, " "+user.Email, tc.password)
+			if tc.expectedErr {
+				require.True(t, apperror.IsUnauthorized(err), "expected an Unauthorized error")
+				assert.Equal(t, auth.ErrMsgInvalidCredentials, err.Error())
+				return
+			}
+			require.NoError(t, err, "Authenticate() should have succeed")
+			assert.Equal(t, user.ID, u.ID)
+			assert.Equal(t, user.ID, s.UserID)
+			assert.NotEmpty(t, s.ID)
+			if tc.hasMFA {
+				assert.Equal(t, auth.MFAPending, s.MFAStatus, "the session should wait for the second factor")
+				assert.True(t, s.IsMFAPending(), "the session should wait for the second factor")
+			} else {
+				assert.Empty(t, s.MFAStatus)
+			}
+		})
+	}
+}
+
+func TestAuthenticateHashFailure(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	// The error should be returned every time, without calling the
+	// database
+	a := &auth.Accounts{Hasher: failingHasher{}}
+	for i := 0; i < 2; i++ {
+		_, _, err := a.Authenticate(mocksqldb.NewMockQueryable(mockCtrl), "user@domain.tld", "password")
+		assert.True(t, apperror.IsInternalServerError(err), "expected an Internal error")
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	t.Run("valid password", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		u := &auth.User{ID: "user-id", Password: "hashed:current-password"}
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().Exec(gomock.Any(), "hashed:new-password", gomock.Any(), u.ID).Return(int64(1), nil)
+		mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), u.ID, auth.UserTokenPasswordReset).Return(int64(0), nil)
+		mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), u.ID, "session-id").Return(int64(2), nil)
+
+		err := newTestAccounts().ChangePassword(mockDB, u, "session-id", "current-password", "new-password")
+		require.NoError(t, err, "ChangePassword() should have succeed")
+		assert.Equal(t, "hashed:new-password", u.Password)
+	})
+
+	t.Run("invalid current password", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		u := &auth.User{ID: "user-id", Password: "hashed:current-password"}
+		err := newTestAccounts().ChangePassword(mocksqldb.NewMockQueryable(mockCtrl), u, "session-id", "wrong-password", "new-password")
+		require.True(t, apperror.IsBadRequest(err), "expected a BadRequest error")
+		assert.Equal(t, "current_password", apperror.Convert(err).Field())
+		assert.Equal(t, "hashed:current-password", u.Password, "the password should not have changed")
+	})
+}
+
+func TestRequestPasswordResetUnknownEmail(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+	mockDB.EXPECT().GetNotFound(&auth.User{})
+
+	token, u, err := newTestAccounts().RequestPasswordReset(mockDB, "email@domain.tld")
+	require.NoError(t, err, "RequestPasswordReset() should not leak the existence of the account")
+	assert.Empty(t, token)
+	assert.Nil(t, u)
+}
+
+func TestResetPassword(t *testing.T) {
+	user := testauth.NewUser()
+
+	// newResetToken creates a reset token and returns it with its
+	// DB representation
+	newResetToken := func(t *testing.T) (string, *auth.UserToken) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		var saved *auth.UserToken
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetSuccess(&auth.User{}, func(u *auth.User, stmt, email string) {
+			*u = *user
+		})
+		mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), user.ID, auth.UserTokenPasswordReset).Return(int64(1), nil)
+		mockDB.EXPECT().InsertSuccess(&auth.UserToken{}).Do(func(stmt string, ut *auth.UserToken) {
+			saved = &auth.UserToken{}
+			*saved = *ut
+		})
+		token, u, err := newTestAccounts().RequestPasswordReset(mockDB, user.Email)
+		require.NoError(t, err)
+		require.Equal(t, user.ID, u.ID)
+		assert.WithinDuration(t, time.Now().Add(auth.PasswordResetTTL), saved.ExpiresAt.Time, time.Minute)
+		return token, saved
+	}
+
+	t.Run("valid token", func(t *testing.T) {
+		token, saved := newResetToken(t)
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetID(&auth.UserToken{}, saved.ID, func(ut *auth.UserToken, stmt, id string) {
+			*ut = *saved
+		})
+		mockDB.EXPECT().GetID(&auth.User{}, user.ID, func(u *auth.User, stmt, id string) {
+			*u = *user
+		})
+		mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), saved.ID).Return(int64(1), nil)
+		mockDB.EXPECT().Exec(gomock.Any(), "hashed:new-password", gomock.Any(), user.ID).Return(int64(1), nil)
+		mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), user.ID).Return(int64(3), nil)
+
+		u, err := newTestAccounts().ResetPassword(mockDB, token, "new-password")
+		require.NoError(t, err, "ResetPassword() should have succeed")
+		assert.Equal(t, "hashed:new-password", u.Password)
+	})
+
+	t.Run("token used concurrently", func(t *testing.T) {
+		token, saved := newResetToken(t)
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetID(&auth.UserToken{}, saved.ID, func(ut *auth.UserToken, stmt, id string) {
+			*ut = *saved
+		})
+		mockDB.EXPECT().GetID(&auth.User{}, user.ID, func(u *auth.User, stmt, id string) {
+			*u = *user
+		})
+		mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), saved.ID).Return(int64(0), nil)
+
+		_, err := newTestAccounts().ResetPassword(mockDB, token, "new-password")
+		assert.True(t, apperror.IsBadRequest(err), "expected a BadRequest error")
+	})
+
+	t.Run("user not found", func(t *testing.T) {
+		token, saved := newResetToken(t)
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetID(&auth.UserToken{}, saved.ID, func(ut *auth.UserToken, stmt, id string) {
+			*ut = *saved
+		})
+		mockDB.EXPECT().GetIDNotFound(&auth.User{}, user.ID)
+
+		_, err := newTestAccounts().ResetPassword(mockDB, token, "new-password")
+		assert.True(t, apperror.IsBadRequest(err), "expected a BadRequest error")
+	})
+
+	t.Run("malformed token ID", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		// The database should not be queried
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+
+		_, err := newTestAccounts().ResetPassword(mockDB, "not-a-uuid.secret", "new-password")
+		require.True(t, apperror.IsBadRequest(err), "expected a BadRequest error")
+		assert.Contains(t, err.Error(), auth.ErrMsgInvalidToken)
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		token, saved := newResetToken(t)
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetIDError(&auth.UserToken{}, saved.ID, sql.ErrConnDone)
+
+		_, err := newTestAccounts().ResetPassword(mockDB, token, "new-password")
+		assert.Equal(t, sql.ErrConnDone, err)
+	})
+
+	t.Run("short password", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		// the token should not be used
+		_, err := newTestAccounts().ResetPassword(mocksqldb.NewMockQueryable(mockCtrl), "id.secret", "short")
+		require.True(t, apperror.IsBadRequest(err), "expected a BadRequest error")
+		assert.Equal(t, "password", apperror.Convert(err).Field())
+	})
+
+	testCases := []struct {
+		description string
+		update      func(token string, ut *auth.UserToken, u *auth.User) string
+	}{
+		{
+			"wrong secret",
+			func(token string, ut *auth.UserToken, u *auth.User) string {
+				return ut.ID + ".wrong-secret"
+			},
+		},
+		{
+			"expired token",
+			func(token string, ut *auth.UserToken, u *auth.User) string {
+				ut.ExpiresAt = &datetime.DateTime{Time: time.Now().Add(-time.Minute)}
+				return token
+			},
+		},
+		{
+			"used token",
+			func(token string, ut *auth.UserToken, u *auth.User) string {
+				ut.UsedAt = datetime.Now()
+				return token
+			},
+		},
+		{
+			"revoked token",
+			func(token string, ut *auth.UserToken, u *auth.User) string {
+				ut.DeletedAt = datetime.Now()
+				return token
+			},
+		},
+		{
+			"wrong type",
+			func(token string, ut *auth.UserToken, u *auth.User) string {
+				ut.Type = auth.UserTokenEmailVerification
+				return token
+			},
+		},
+		{
+			"email changed",
+			func(token string, ut *auth.UserToken, u *auth.User) string {
+				u.Email = "new+" + u.Email
+				return token
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			token, saved := newResetToken(t)
+			u := *user
+			token = tc.update(token, saved, &u)
+
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+			mockDB.EXPECT().GetID(&auth.UserToken{}, saved.ID, func(ut *auth.UserToken, stmt, id string) {
+				*ut = *saved
+			})
+			mockDB.EXPECT().GetID(&auth.User{}, user.ID, func(dest *auth.User, stmt, id string) {
+				*dest = u
+			}).MaxTimes(1)
+
+			_, err := newTestAccounts().ResetPassword(mockDB, token, "new-password")
+			require.True(t, apperror.IsBadRequest(err), "expected a BadRequest error")
+			assert.Equal(t, "token", apperror.Convert(err).Field())
+		})
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	user := testauth.NewUser()
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	var saved *auth.UserToken
+	mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+	mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), user.ID, auth.UserTokenEmailVerification).Return(int64(0), nil)
+	mockDB.EXPECT().InsertSuccess(&auth.UserToken{}).Do(func(stmt string, ut *auth.UserToken) {
+		saved = &auth.UserToken{}
+		*saved = *ut
+	})
+	token, err := newTestAccounts().RequestEmailVerification(mockDB, user)
+	require.NoError(t, err, "RequestEmailVerification() should have succeed")
+	require.Len(t, strings.Split(token, "."), 2, "invalid token format")
+	assert.Equal(t, user.Email, saved.Email)
+
+	mockDB.EXPECT().GetID(&auth.UserToken{}, saved.ID, func(ut *auth.UserToken, stmt, id string) {
+		*ut = *saved
+	})
+	mockDB.EXPECT().GetID(&auth.User{}, user.ID, func(u *auth.User, stmt, id string) {
+		*u = *user
+	})
+	mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), saved.ID).Return(int64(1), nil)
+	mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), user.ID).Return(int64(1), nil)
+
+	u, err := newTestAccounts().VerifyEmail(mockDB, token)
+	require.NoError(t, err, "VerifyEmail() should have succeed")
+	assert.True(t, u.IsEmailVerified(), "the email should be verified")
+
+	_, err = newTestAccounts().RequestEmailVerification(mockDB, u)
+	assert.True(t, apperror.IsConflict(err), "expected a Conflict error")
+}
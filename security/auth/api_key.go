@@ -0,0 +1,276 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	db "github.com/Nivl/go-sqldb"
+	"github.com/Nivl/go-types/datetime"
+	"github.com/lib/pq"
+	uuid "github.com/satori/go.uuid"
+)
+
+var (
+	// APIKeyTouchInterval is the minimum amount of time between two
+	// updates of the last usage of an API key. It prevents writing in the
+	// database at every request
+	APIKeyTouchInterval = time.Minute
+)
+
+const (
+	// ErrMsgInvalidAPIKey is the message returned when an API key cannot
+	// be used
+	ErrMsgInvalidAPIKey = "invalid api key"
+
+	// ErrMsgMissingScope is the message returned when an API key doesn't
+	// have the scope needed to access a resource
+	ErrMsgMissingScope = "missing scope"
+)
+
+// APIKey is a structure representing a key used by a machine-to-machine
+// client to act on behalf of a user, that can be saved in the database.
+// The key sent by the client contains a public prefix used to identify
+// the key, and a secret. Only the hash of the secret is stored.
+// The scopes restrict what the key can do, on top of the permissions of
+// its owner: a key can only be used on the endpoints that declare scopes
+// the key has been granted (see guard.Guard.Scopes). A key with no
+// scopes cannot be used at all.
+// The keys are stored in a table named user_api_keys:
+//
+//	CREATE TABLE user_api_keys (
+//	  id UUID PRIMARY KEY,
+//	  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  deleted_at TIMESTAMP WITH TIME ZONE,
+//	  user_id UUID NOT NULL,
+//	  name VARCHAR NOT NULL,
+//	  prefix VARCHAR NOT NULL UNIQUE,
+//	  hash VARCHAR NOT NULL,
+//	  scopes VARCHAR[] NOT NULL,
+//	  expires_at TIMESTAMP WITH TIME ZONE,
+//	  last_used_at TIMESTAMP WITH TIME ZONE
+//	);
+type APIKey struct {
+	ID        string             `db:"id" json:"id"`
+	CreatedAt *datetime.DateTime `db:"created_at" json:"created_at"`
+	UpdatedAt *datetime.DateTime `db:"updated_at" json:"updated_at"`
+	DeletedAt *datetime.DateTime `db:"deleted_at" json:"-"`
+
+	UserID     string             `db:"user_id" json:"user_id"`
+	Name       string             `db:"name" json:"name"`
+	Prefix     string             `db:"prefix" json:"prefix"`
+	Hash       string             `db:"hash" json:"-"`
+	Scopes     pq.StringArray     `db:"scopes" json:"scopes"`
+	ExpiresAt  *datetime.DateTime `db:"expires_at" json:"expires_at"`
+	LastUsedAt *datetime.DateTime `db:"last_used_at" json:"last_used_at"`
+}
+
+// GetAPIKeyByID finds and returns an active API key by ID.
+// Revoked keys are not returned
+func GetAPIKeyByID(q db.Queryable, id string) (*APIKey, error) {
+	k := &APIKey{}
+	stmt := "SELECT * from user_api_keys WHERE id=$1 and deleted_at IS NULL LIMIT 1"
+	err := q.Get(k, stmt, id)
+	return k, apperror.NewFromSQL(err)
+}
+
+// GetAPIKeyByPrefix finds and returns an active API key by prefix.
+// Revoked keys are not returned
+func GetAPIKeyByPrefix(q db.Queryable, prefix string) (*APIKey, error) {
+	k := &APIKey{}
+	stmt := "SELECT * from user_api_keys WHERE prefix=$1 and deleted_at IS NULL LIMIT 1"
+	err := q.Get(k, stmt, prefix)
+	return k, apperror.NewFromSQL(err)
+}
+
+// GetUserAPIKeys returns the active API keys of a user
+func GetUserAPIKeys(q db.Queryable, userID string) ([]*APIKey, error) {
+	keys := []*APIKey{}
+	stmt := `SELECT * from user_api_keys
+					WHERE user_id=$1
+						AND deleted_at IS NULL
+					ORDER BY created_at`
+	err := q.Select(&keys, stmt, userID)
+	return keys, apperror.NewFromSQL(err)
+}
+
+// Create persists an API key in the database and returns the key to
+// send to the client. The key cannot be retrieved afterward
+func (k *APIKey) Create(q db.Queryable) (string, error) {
+	if k == nil {
+		return "", apperror.NewServerError("api key is nil")
+	}
+
+	if k.ID != "" {
+		return "", apperror.NewServerError("api keys cannot be updated")
+	}
+
+	if k.UserID == "" {
+		return "", apperror.NewServerError("cannot save an api key with no user id")
+	}
+
+	prefix, err := newAPIKeyPrefix()
+	if err != nil {
+		return "", err
+	}
+	secret, err := newSecret(32)
+	if err != nil {
+		return "", err
+	}
+
+	k.ID = uuid.NewV4().String()
+	k.Prefix = prefix
+	k.Hash = hashSecret(secret)
+	k.UpdatedAt = datetime.Now()
+	if k.CreatedAt == nil {
+		k.CreatedAt = datetime.Now()
+	}
+	if k.Scopes == nil {
+		k.Scopes = pq.StringArray{}
+	}
+
+	stmt := `INSERT INTO user_api_keys
+		(id, created_at, updated_at, deleted_at, user_id, name, prefix, hash, scopes, expires_at, last_used_at)
+		VALUES (:id, :created_at, :updated_at, :deleted_at, :user_id, :name, :prefix, :hash, :scopes, :expires_at, :last_used_at)`
+	if _, err := q.NamedExec(stmt, k); err != nil {
+		return "", apperror.NewFromSQL(err)
+	}
+	return k.Prefix + "." + secret, nil
+}
+
+// AuthenticateAPIKey returns the API key matching the key sent by a
+// client, and marks it as used.
+// An Unauthorized error is returned if the key is invalid, expired,
+// or has been revoked
+func AuthenticateAPIKey(q db.Queryable, key string) (*APIKey, error) {
+	parts := strings.SplitN(key, ".", 2)
+	if len(parts) != 2 {
+		return nil, apperror.NewUnauthorizedR(ErrMsgInvalidAPIKey)
+	}
+
+	k, err := GetAPIKeyByPrefix(q, parts[0])
+	if err != nil {
+		if apperror.IsNotFound(err) {
+			return nil, apperror.NewUnauthorizedR(ErrMsgInvalidAPIKey)
+		}
+		return nil, err
+	}
+	if !secretMatches(k.Hash, parts[1]) || k.IsExpired() {
+		return nil, apperror.NewUnauthorizedR(ErrMsgInvalidAPIKey)
+	}
+
+	if err := k.touch(q); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// IsExpired checks if the key has expired
+func (k *APIKey) IsExpired() bool {
+	return k.ExpiresAt != nil && !k.ExpiresAt.After(time.Now())
+}
+
+// HasScope checks if the key has been granted the given scope.
+// Wildcards are supported the same way they are for the permissions
+// Works on nil object
+func (k *APIKey) HasScope(scope string) bool {
+	if k == nil {
+		return false
+	}
+	for _, s := range k.Scopes {
+		if permissionMatches(s, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// touch updates the last usage of the key. The database is not updated
+// if the key has been used less than APIKeyTouchInterval ago
+func (k *APIKey) touch(q db.Queryable) error {
+	now := datetime.Now()
+	if k.LastUsedAt != nil && k.LastUsedAt.After(now.Add(-APIKeyTouchInterval)) {
+		return nil
+	}
+
+	stmt := `UPDATE user_api_keys
+					SET last_used_at = $1
+					WHERE id = $2`
+	if _, err := q.Exec(stmt, now, k.ID); err != nil {
+		return apperror.NewFromSQL(err)
+	}
+	k.LastUsedAt = now
+	return nil
+}
+
+// Revoke soft-deletes the key, making it unusable
+func (k *APIKey) Revoke(q db.Queryable) error {
+	if k.ID == "" {
+		return apperror.NewServerError("api key has not been saved")
+	}
+
+	now := datetime.Now()
+	stmt := `UPDATE user_api_keys
+					SET deleted_at = $1
+					WHERE id = $2
+						AND deleted_at IS NULL`
+	if _, err := q.Exec(stmt, now, k.ID); err != nil {
+		return apperror.NewFromSQL(err)
+	}
+	k.DeletedAt = now
+	return nil
+}
+
+// Rotate creates a new key with the same owner, name, scopes and
+// lifetime, and returns it with the key to send to the client.
+// The current key stays valid for gracePeriod to give the client some
+// time to switch, 0 revokes it immediately
+func (k *APIKey) Rotate(q db.Queryable, gracePeriod time.Duration) (*APIKey, string, error) {
+	if k.ID == "" {
+		return nil, "", apperror.NewServerError("api key has not been saved")
+	}
+
+	rotated := &APIKey{
+		UserID: k.UserID,
+		Name:   k.Name,
+		Scopes: append(pq.StringArray{}, k.Scopes...),
+	}
+	if k.ExpiresAt != nil && k.CreatedAt != nil {
+		lifetime := k.ExpiresAt.Sub(k.CreatedAt.Time)
+		rotated.ExpiresAt = &datetime.DateTime{Time: time.Now().Add(lifetime).UTC()}
+	}
+	key, err := rotated.Create(q)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if gracePeriod <= 0 {
+		return rotated, key, k.Revoke(q)
+	}
+
+	// We only shorten the lifetime of the key
+	expiresAt := &datetime.DateTime{Time: time.Now().Add(gracePeriod).UTC()}
+	if k.ExpiresAt != nil && k.ExpiresAt.Before(expiresAt.Time) {
+		return rotated, key, nil
+	}
+	stmt := `UPDATE user_api_keys
+					SET expires_at = $1, updated_at = $2
+					WHERE id = $3`
+	if _, err := q.Exec(stmt, expiresAt, datetime.Now(), k.ID); err != nil {
+		return nil, "", apperror.NewFromSQL(err)
+	}
+	k.ExpiresAt = expiresAt
+	return rotated, key, nil
+}
+
+// newAPIKeyPrefix returns a random prefix used to identify a key
+func newAPIKeyPrefix() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strings.ToLower(base32.StdEncoding.EncodeToString(b)), nil
+}
@@ -0,0 +1,171 @@
+package auth_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/security/auth"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	"github.com/Nivl/go-sqldb/implementations/mocksqldb"
+	"github.com/Nivl/go-types/datetime"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newAPIKey creates an API key and returns it with its DB representation
+func newAPIKey(t *testing.T, k *auth.APIKey) (string, *auth.APIKey) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	var saved *auth.APIKey
+	mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+	mockDB.EXPECT().InsertSuccess(&auth.APIKey{}).Do(func(stmt string, k *auth.APIKey) {
+		saved = &auth.APIKey{}
+		*saved = *k
+	})
+	key, err := k.Create(mockDB)
+	require.NoError(t, err, "Create() should have succeed")
+	return key, saved
+}
+
+func TestAPIKeyCreate(t *testing.T) {
+	key, saved := newAPIKey(t, &auth.APIKey{UserID: "user-id", Name: "ci"})
+
+	parts := strings.Split(key, ".")
+	require.Len(t, parts, 2, "invalid key format")
+	assert.Equal(t, saved.Prefix, parts[0], "the key should start with its prefix")
+	assert.NotContains(t, saved.Hash, parts[1], "the secret should not be stored")
+	assert.NotNil(t, saved.Scopes, "the scopes should not be NULL")
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	key, saved := newAPIKey(t, &auth.APIKey{UserID: "user-id"})
+
+	t.Run("valid key", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetID(&auth.APIKey{}, saved.Prefix, func(k *auth.APIKey, stmt, prefix string) {
+			*k = *saved
+		})
+		// The last usage should be updated
+		mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), saved.ID).Return(int64(1), nil)
+
+		k, err := auth.AuthenticateAPIKey(mockDB, key)
+		require.NoError(t, err, "AuthenticateAPIKey() should have succeed")
+		assert.Equal(t, saved.ID, k.ID)
+		assert.NotNil(t, k.LastUsedAt)
+	})
+
+	t.Run("recently used key", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetID(&auth.APIKey{}, saved.Prefix, func(k *auth.APIKey, stmt, prefix string) {
+			*k = *saved
+			k.LastUsedAt = datetime.Now()
+		})
+
+		_, err := auth.AuthenticateAPIKey(mockDB, key)
+		require.NoError(t, err, "AuthenticateAPIKey() should have succeed")
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetIDNotFound(&auth.APIKey{}, saved.Prefix)
+
+		_, err := auth.AuthenticateAPIKey(mockDB, key)
+		assert.True(t, apperror.IsUnauthorized(err), "expected an Unauthorized error")
+	})
+
+	testCases := []struct {
+		description string
+		key         string
+		update      func(k *auth.APIKey)
+	}{
+		{"wrong secret", saved.Prefix + ".wrong-secret", func(k *auth.APIKey) {}},
+		{"expired key", key, func(k *auth.APIKey) {
+			k.ExpiresAt = &datetime.DateTime{Time: time.Now().Add(-time.Minute)}
+		}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+			mockDB.EXPECT().GetID(&auth.APIKey{}, saved.Prefix, func(k *auth.APIKey, stmt, prefix string) {
+				*k = *saved
+				tc.update(k)
+			})
+
+			_, err := auth.AuthenticateAPIKey(mockDB, tc.key)
+			require.True(t, apperror.IsUnauthorized(err), "expected an Unauthorized error")
+			assert.Equal(t, auth.ErrMsgInvalidAPIKey, err.Error())
+		})
+	}
+}
+
+func TestAPIKeyHasScope(t *testing.T) {
+	t.Parallel()
+
+	k := &auth.APIKey{Scopes: []string{"articles:read", "billing:*"}}
+	assert.True(t, k.HasScope("articles:read"))
+	assert.False(t, k.HasScope("articles:write"))
+	assert.True(t, k.HasScope("billing:read"), "wildcards should be supported")
+
+	var nilKey *auth.APIKey
+	assert.False(t, nilKey.HasScope("articles:read"))
+}
+
+func TestAPIKeyRotate(t *testing.T) {
+	_, saved := newAPIKey(t, &auth.APIKey{
+		UserID:    "user-id",
+		Name:      "ci",
+		Scopes:    []string{"articles:read"},
+		ExpiresAt: &datetime.DateTime{Time: time.Now().Add(30 * 24 * time.Hour)},
+	})
+
+	t.Run("with grace period", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		old := *saved
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().InsertSuccess(&auth.APIKey{})
+		mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), gomock.Any(), old.ID).Return(int64(1), nil)
+
+		rotated, key, err := old.Rotate(mockDB, time.Hour)
+		require.NoError(t, err, "Rotate() should have succeed")
+		assert.True(t, strings.HasPrefix(key, rotated.Prefix+"."))
+		assert.NotEqual(t, old.ID, rotated.ID)
+		assert.Equal(t, old.Name, rotated.Name)
+		assert.Equal(t, old.Scopes, rotated.Scopes)
+		assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), rotated.ExpiresAt.Time, time.Minute)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), old.ExpiresAt.Time, time.Minute)
+		assert.Nil(t, old.DeletedAt, "the old key should still be usable")
+	})
+
+	t.Run("without grace period", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		old := *saved
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().InsertSuccess(&auth.APIKey{})
+		mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), old.ID).Return(int64(1), nil)
+
+		_, _, err := old.Rotate(mockDB, 0)
+		require.NoError(t, err, "Rotate() should have succeed")
+		assert.NotNil(t, old.DeletedAt, "the old key should have been revoked")
+	})
+}
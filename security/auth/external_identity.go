@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	db "github.com/Nivl/go-sqldb"
+	"github.com/Nivl/go-types/datetime"
+	uuid "github.com/satori/go.uuid"
+)
+
+// ExternalIdentity is a structure representing the link between a user
+// and an account of an external identity provider (ex. an OpenID Connect
+// provider), that can be saved in the database.
+// An account of a provider is identified by its subject, and can only
+// be linked to one user.
+// The identities are stored in a table named user_external_identities:
+//
+//	CREATE TABLE user_external_identities (
+//	  id UUID PRIMARY KEY,
+//	  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  user_id UUID NOT NULL,
+//	  provider VARCHAR NOT NULL,
+//	  subject VARCHAR NOT NULL,
+//	  email VARCHAR NOT NULL,
+//	  UNIQUE (provider, subject)
+//	);
+type ExternalIdentity struct {
+	ID        string             `db:"id" json:"id"`
+	CreatedAt *datetime.DateTime `db:"created_at" json:"created_at"`
+	UpdatedAt *datetime.DateTime `db:"updated_at" json:"updated_at"`
+
+	UserID   string `db:"user_id" json:"user_id"`
+	Provider string `db:"provider" json:"provider"`
+	Subject  string `db:"subject" json:"subject"`
+
+	// Email contains the email address sent by the provider when the
+	// identity was linked. It's only informative
+	Email string `db:"email" json:"email"`
+}
+
+// GetExternalIdentity finds and returns the identity matching the
+// subject of a provider
+func GetExternalIdentity(q db.Queryable, provider, subject string) (*ExternalIdentity, error) {
+	ei := &ExternalIdentity{}
+	stmt := "SELECT * from user_external_identities WHERE provider=$1 AND subject=$2 LIMIT 1"
+	err := q.Get(ei, stmt, provider, subject)
+	return ei, apperror.NewFromSQL(err)
+}
+
+// GetUserExternalIdentities returns the external identities linked to
+// a user
+func GetUserExternalIdentities(q db.Queryable, userID string) ([]*ExternalIdentity, error) {
+	identities := []*ExternalIdentity{}
+	stmt := `SELECT * from user_external_identities
+					WHERE user_id=$1
+					ORDER BY created_at`
+	err := q.Select(&identities, stmt, userID)
+	return identities, apperror.NewFromSQL(err)
+}
+
+// Create persists an external identity in the database.
+// A Conflict error is returned if the identity is already linked
+func (ei *ExternalIdentity) Create(q db.Queryable) error {
+	if ei == nil {
+		return apperror.NewServerError("external identity is nil")
+	}
+
+	if ei.ID != "" {
+		return apperror.NewServerError("external identities cannot be updated")
+	}
+
+	if ei.UserID == "" || ei.Provider == "" || ei.Subject == "" {
+		return apperror.NewServerError("cannot save an external identity with no user id, provider, or subject")
+	}
+
+	ei.ID = uuid.NewV4().String()
+	ei.UpdatedAt = datetime.Now()
+	if ei.CreatedAt == nil {
+		ei.CreatedAt = datetime.Now()
+	}
+
+	stmt := `INSERT INTO user_external_identities
+		(id, created_at, updated_at, user_id, provider, subject, email)
+		VALUES (:id, :created_at, :updated_at, :user_id, :provider, :subject, :email)`
+	_, err := q.NamedExec(stmt, ei)
+	return apperror.NewFromSQL(err)
+}
+
+// Delete unlinks the identity from its user
+func (ei *ExternalIdentity) Delete(q db.Queryable) error {
+	if ei.ID == "" {
+		return apperror.NewServerError("external identity has not been saved")
+	}
+
+	stmt := "DELETE FROM user_external_identities WHERE id=$1"
+	_, err := q.Exec(stmt, ei.ID)
+	return apperror.NewFromSQL(err)
+}
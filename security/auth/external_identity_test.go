@@ -0,0 +1,34 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/Nivl/go-rest-tools/security/auth"
+	"github.com/Nivl/go-sqldb/implementations/mocksqldb"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExternalIdentityCreate(t *testing.T) {
+	t.Run("valid identity", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().InsertSuccess(&auth.ExternalIdentity{})
+
+		ei := &auth.ExternalIdentity{UserID: "user-id", Provider: "google", Subject: "subject"}
+		require.NoError(t, ei.Create(mockDB), "Create() should have succeed")
+		assert.NotEmpty(t, ei.ID)
+		assert.NotNil(t, ei.CreatedAt)
+	})
+
+	t.Run("missing subject", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		ei := &auth.ExternalIdentity{UserID: "user-id", Provider: "google"}
+		assert.Error(t, ei.Create(mocksqldb.NewMockQueryable(mockCtrl)), "Create() should have failed")
+	})
+}
@@ -0,0 +1,82 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrExpired is returned when a token has expired
+	ErrExpired = errors.New("token expired")
+
+	// ErrNotValidYet is returned when a token cannot be used yet
+	ErrNotValidYet = errors.New("token not valid yet")
+)
+
+// Leeway represents the clock skew tolerated when validating the time
+// based claims
+var Leeway = 30 * time.Second
+
+// Audience represents the "aud" claim, which can either be a string or an
+// array of strings
+type Audience []string
+
+// MarshalJSON returns the audience as a string if it contains only
+// one value, as an array otherwise
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// UnmarshalJSON parses an audience that is either a string or an
+// array of strings
+func (a *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = Audience(list)
+	return nil
+}
+
+// Contains checks if the audience contains the given value
+func (a Audience) Contains(value string) bool {
+	for _, v := range a {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisteredClaims contains the registered claims of RFC 7519.
+// Times are represented as Unix timestamps
+type RegisteredClaims struct {
+	Issuer    string   `json:"iss,omitempty"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  Audience `json:"aud,omitempty"`
+	ExpiresAt int64    `json:"exp,omitempty"`
+	NotBefore int64    `json:"nbf,omitempty"`
+	IssuedAt  int64    `json:"iat,omitempty"`
+	ID        string   `json:"jti,omitempty"`
+}
+
+// Valid checks the time based claims
+func (c *RegisteredClaims) Valid(now time.Time) error {
+	if c.ExpiresAt != 0 && now.Add(-Leeway).Unix() >= c.ExpiresAt {
+		return ErrExpired
+	}
+	if c.NotBefore != 0 && now.Add(Leeway).Unix() < c.NotBefore {
+		return ErrNotValidYet
+	}
+	return nil
+}
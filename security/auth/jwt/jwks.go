@@ -0,0 +1,282 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownKey is returned when no key matches the header of a token
+	ErrUnknownKey = errors.New("unknown key")
+
+	// ErrUnsupportedKey is returned when a JWK uses a key type or a curve
+	// that is not supported
+	ErrUnsupportedKey = errors.New("unsupported key")
+)
+
+// JWK represents a public JSON Web Key (RFC 7517).
+// Only the RSA keys and the Ed25519 keys (RFC 8037) are supported
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+
+	// N and E contain the modulus and the exponent of an RSA key
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+
+	// Curve and X contain the curve and the public key of an OKP key
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKSet represents a set of JSON Web Keys, as returned by the JWKS
+// endpoint of an OpenID Connect provider
+type JWKSet struct {
+	Keys []*JWK `json:"keys"`
+}
+
+// NewJWK returns the public JWK of a Verifier.
+// Only RS256 and EdDSA are supported
+func NewJWK(v Verifier, keyID string) (*JWK, error) {
+	switch key := v.(type) {
+	case *RS256:
+		pub := key.PublicKey
+		if pub == nil && key.PrivateKey != nil {
+			pub = &key.PrivateKey.PublicKey
+		}
+		if pub == nil {
+			return nil, ErrNoKey
+		}
+		return &JWK{
+			KeyType:   "RSA",
+			KeyID:     keyID,
+			Use:       "sig",
+			Algorithm: AlgRS256,
+			N:         encoding.EncodeToString(pub.N.Bytes()),
+			E:         encoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case *EdDSA:
+		pub := key.PublicKey
+		if pub == nil && len(key.PrivateKey) == ed25519.PrivateKeySize {
+			pub = key.PrivateKey.Public().(ed25519.PublicKey)
+		}
+		if len(pub) != ed25519.PublicKeySize {
+			return nil, ErrNoKey
+		}
+		return &JWK{
+			KeyType:   "OKP",
+			KeyID:     keyID,
+			Use:       "sig",
+			Algorithm: AlgEdDSA,
+			Curve:     "Ed25519",
+			X:         encoding.EncodeToString(pub),
+		}, nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// Verifier returns a Verifier using the key
+func (k *JWK) Verifier() (Verifier, error) {
+	switch k.KeyType {
+	case "RSA":
+		if k.Algorithm != "" && k.Algorithm != AlgRS256 {
+			return nil, ErrUnsupportedKey
+		}
+		n, err := encoding.DecodeString(k.N)
+		if err != nil {
+			return nil, ErrMalformed
+		}
+		e, err := encoding.DecodeString(k.E)
+		if err != nil {
+			return nil, ErrMalformed
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if len(n) == 0 || !exponent.IsInt64() || exponent.Int64() < 2 || exponent.Int64() > 1<<31-1 {
+			return nil, ErrMalformed
+		}
+		return &RS256{
+			PublicKey: &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(exponent.Int64()),
+			},
+		}, nil
+	case "OKP":
+		if k.Curve != "Ed25519" || (k.Algorithm != "" && k.Algorithm != AlgEdDSA) {
+			return nil, ErrUnsupportedKey
+		}
+		x, err := encoding.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, ErrMalformed
+		}
+		return &EdDSA{PublicKey: ed25519.PublicKey(x)}, nil
+	}
+	return nil, ErrUnsupportedKey
+}
+
+// DefaultFetchTimeout is the timeout used to fetch the keys of a
+// RemoteKeySet that has no Client
+const DefaultFetchTimeout = 10 * time.Second
+
+// defaultClient is the client used by the RemoteKeySets that have
+// no Client
+var defaultClient = &http.Client{Timeout: DefaultFetchTimeout}
+
+// remoteKey represents a key of a RemoteKeySet
+type remoteKey struct {
+	id       string
+	verifier Verifier
+}
+
+// keyRefresh represents a fetch of the keys of a RemoteKeySet. done is
+// closed once the fetch is over
+type keyRefresh struct {
+	done chan struct{}
+	err  error
+}
+
+// RemoteKeySet is a set of keys fetched from a JWKS endpoint.
+// The keys are cached, and fetched again when a token uses an unknown
+// key, which allows the provider to rotate its keys
+type RemoteKeySet struct {
+	// URL contains the URL of the JWKS endpoint
+	URL string
+
+	// Client is the HTTP client used to fetch the keys. It should have
+	// a timeout since the requests using an unknown key wait for the
+	// fetch. Default to a client timing out after DefaultFetchTimeout
+	Client *http.Client
+
+	// MinRefreshInterval is the minimum amount of time between two
+	// fetches. It prevents a client from making us call the endpoint at
+	// every request by sending unknown key IDs
+	MinRefreshInterval time.Duration
+
+	mu         sync.Mutex
+	keys       []*remoteKey
+	fetchedAt  time.Time
+	refreshing *keyRefresh
+}
+
+// NewRemoteKeySet returns a RemoteKeySet fetching its keys from the
+// provided URL
+func NewRemoteKeySet(url string) *RemoteKeySet {
+	return &RemoteKeySet{
+		URL:                url,
+		MinRefreshInterval: time.Minute,
+	}
+}
+
+// KeyFunc returns the Verifier matching the header of a token. It can
+// be used as a KeyFunc.
+// When the header has no key ID, the first key using the algorithm of
+// the token is returned.
+// The keys are fetched without holding the lock, so the tokens using
+// a known key are not blocked by a slow endpoint. The concurrent
+// requests using an unknown key share the same fetch
+func (s *RemoteKeySet) KeyFunc(h *Header) (Verifier, error) {
+	s.mu.Lock()
+	if v := s.find(h); v != nil {
+		s.mu.Unlock()
+		return v, nil
+	}
+	r := s.refreshing
+	if r == nil {
+		if !s.fetchedAt.IsZero() && time.Since(s.fetchedAt) < s.MinRefreshInterval {
+			s.mu.Unlock()
+			return nil, ErrUnknownKey
+		}
+		// We set fetchedAt before doing the request so a failing
+		// endpoint also gets rate limited
+		s.fetchedAt = time.Now()
+		r = &keyRefresh{done: make(chan struct{})}
+		s.refreshing = r
+		go s.refresh(r)
+	}
+	s.mu.Unlock()
+
+	<-r.done
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if v := s.find(h); v != nil {
+		return v, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+// find returns the cached key matching the header, or nil.
+// s.mu must be held
+func (s *RemoteKeySet) find(h *Header) Verifier {
+	for _, k := range s.keys {
+		if k.verifier.Algorithm() != h.Algorithm {
+			continue
+		}
+		if h.KeyID == "" || h.KeyID == k.id {
+			return k.verifier
+		}
+	}
+	return nil
+}
+
+// refresh fetches the keys from the endpoint, replaces the cached
+// ones, and closes r.done
+func (s *RemoteKeySet) refresh(r *keyRefresh) {
+	keys, err := s.fetch()
+
+	s.mu.Lock()
+	if err == nil {
+		s.keys = keys
+	}
+	r.err = err
+	s.refreshing = nil
+	s.mu.Unlock()
+	close(r.done)
+}
+
+// fetch fetches the keys from the endpoint. The keys that are not
+// supported are ignored
+func (s *RemoteKeySet) fetch() ([]*remoteKey, error) {
+	client := s.Client
+	if client == nil {
+		client = defaultClient
+	}
+
+	res, err := client.Get(s.URL)
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch the keys: %w", err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("could not fetch the keys: unexpected status %d", res.StatusCode)
+	}
+
+	set := &JWKSet{}
+	if err := json.NewDecoder(res.Body).Decode(set); err != nil {
+		return nil, fmt.Errorf("could not decode the keys: %w", err)
+	}
+
+	keys := make([]*remoteKey, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		v, err := k.Verifier()
+		if err != nil {
+			continue
+		}
+		keys = append(keys, &remoteKey{id: k.KeyID, verifier: v})
+	}
+	return keys, nil
+}
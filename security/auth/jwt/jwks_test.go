@@ -0,0 +1,168 @@
+package jwt_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/security/auth/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWKRoundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	_, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		description string
+		key         jwt.Key
+	}{
+		{"RS256", &jwt.RS256{PrivateKey: rsaKey}},
+		{"EdDSA", &jwt.EdDSA{PrivateKey: edPriv}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			jwk, err := jwt.NewJWK(tc.key, "key-1")
+			require.NoError(t, err, "NewJWK() should have succeed")
+
+			// The key should survive a JSON round trip
+			data, err := json.Marshal(jwk)
+			require.NoError(t, err)
+			decoded := &jwt.JWK{}
+			require.NoError(t, json.Unmarshal(data, decoded))
+
+			v, err := decoded.Verifier()
+			require.NoError(t, err, "Verifier() should have succeed")
+			token, err := jwt.Encode(&jwt.RegisteredClaims{Subject: "user-id"}, tc.key, "key-1")
+			require.NoError(t, err)
+			_, err = jwt.Decode(token, jwt.StaticKey(v), &jwt.RegisteredClaims{})
+			assert.NoError(t, err, "the token should be valid")
+		})
+	}
+
+	t.Run("HS256 is not supported", func(t *testing.T) {
+		t.Parallel()
+
+		_, err := jwt.NewJWK(&jwt.HS256{Secret: []byte("secret")}, "")
+		assert.Equal(t, jwt.ErrUnsupportedKey, err)
+	})
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	_, key1, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, key2, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer1 := &jwt.EdDSA{PrivateKey: key1}
+	signer2 := &jwt.EdDSA{PrivateKey: key2}
+
+	// The endpoint starts by only exposing the first key
+	var fetches int32
+	var rotated atomic.Value
+	rotated.Store(false)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		set := &jwt.JWKSet{}
+		jwk, _ := jwt.NewJWK(signer1, "key-1")
+		set.Keys = append(set.Keys, jwk)
+		if rotated.Load().(bool) {
+			jwk, _ := jwt.NewJWK(signer2, "key-2")
+			set.Keys = append(set.Keys, jwk)
+		}
+		json.NewEncoder(w).Encode(set)
+	}))
+	defer server.Close()
+
+	keys := jwt.NewRemoteKeySet(server.URL)
+	keys.MinRefreshInterval = 0
+	decode := func(s jwt.Signer, keyID string) error {
+		token, err := jwt.Encode(&jwt.RegisteredClaims{Subject: "user-id"}, s, keyID)
+		require.NoError(t, err)
+		_, err = jwt.Decode(token, keys.KeyFunc, &jwt.RegisteredClaims{})
+		return err
+	}
+
+	require.NoError(t, decode(signer1, "key-1"), "the first key should be valid")
+	require.NoError(t, decode(signer1, "key-1"), "the first key should be valid")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches), "the keys should have been cached")
+
+	assert.Equal(t, jwt.ErrUnknownKey, decode(signer2, "key-2"), "the second key should not be known yet")
+
+	rotated.Store(true)
+	require.NoError(t, decode(signer2, "key-2"), "the keys should have been fetched again")
+	assert.Equal(t, int32(3), atomic.LoadInt32(&fetches))
+
+	// A key signed with an unknown key but using a known ID should fail
+	assert.Equal(t, jwt.ErrInvalidSignature, decode(signer2, "key-1"))
+
+	t.Run("refresh interval", func(t *testing.T) {
+		keys.MinRefreshInterval = time.Hour
+		before := atomic.LoadInt32(&fetches)
+		assert.Equal(t, jwt.ErrUnknownKey, decode(signer1, "key-3"))
+		assert.Equal(t, before, atomic.LoadInt32(&fetches), "the keys should not have been fetched")
+	})
+}
+
+func TestRemoteKeySetSlowEndpoint(t *testing.T) {
+	_, key1, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, key2, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	signer1 := &jwt.EdDSA{PrivateKey: key1}
+	signer2 := &jwt.EdDSA{PrivateKey: key2}
+
+	// The first fetch returns right away, the next ones wait for release
+	var fetches int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&fetches, 1) > 1 {
+			close(started)
+			<-release
+		}
+		set := &jwt.JWKSet{}
+		jwk, _ := jwt.NewJWK(signer1, "key-1")
+		set.Keys = append(set.Keys, jwk)
+		json.NewEncoder(w).Encode(set)
+	}))
+	defer server.Close()
+
+	keys := jwt.NewRemoteKeySet(server.URL)
+	keys.MinRefreshInterval = 0
+	decode := func(s jwt.Signer, keyID string) error {
+		token, err := jwt.Encode(&jwt.RegisteredClaims{Subject: "user-id"}, s, keyID)
+		require.NoError(t, err)
+		_, err = jwt.Decode(token, keys.KeyFunc, &jwt.RegisteredClaims{})
+		return err
+	}
+	require.NoError(t, decode(signer1, "key-1"), "the first key should be valid")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.Equal(t, jwt.ErrUnknownKey, decode(signer2, "key-2"))
+	}()
+
+	// The known keys should still be usable while the keys are fetched
+	<-started
+	require.NoError(t, decode(signer1, "key-1"), "the first key should not wait for the fetch")
+
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+}
@@ -0,0 +1,131 @@
+// Package jwt contains methods and structs to sign and verify JSON Web
+// Tokens (RFC 7519) using the compact serialization
+package jwt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrMalformed is returned when a token cannot be decoded
+	ErrMalformed = errors.New("malformed token")
+
+	// ErrInvalidSignature is returned when the signature of a token
+	// doesn't match its content
+	ErrInvalidSignature = errors.New("invalid signature")
+
+	// ErrAlgorithmMismatch is returned when a token has not been signed
+	// with the expected algorithm
+	ErrAlgorithmMismatch = errors.New("unexpected signing algorithm")
+)
+
+// Header represents the JOSE header of a token
+type Header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ,omitempty"`
+	KeyID     string `json:"kid,omitempty"`
+}
+
+// KeyFunc is used to retrieve the Verifier that should be used to verify
+// a token. It can be used to select a key using Header.KeyID
+type KeyFunc func(h *Header) (Verifier, error)
+
+// Validator is implemented by the claims that need to be validated once
+// the signature of the token has been verified
+type Validator interface {
+	// Valid returns an error if the claims are not valid at the given time
+	Valid(now time.Time) error
+}
+
+var encoding = base64.RawURLEncoding
+
+// Encode returns a signed token containing the provided claims.
+// keyID is optional
+func Encode(claims interface{}, s Signer, keyID string) (string, error) {
+	header, err := json.Marshal(&Header{
+		Algorithm: s.Algorithm(),
+		Type:      "JWT",
+		KeyID:     keyID,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encoding.EncodeToString(header) + "." + encoding.EncodeToString(payload)
+	sig, err := s.Sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + encoding.EncodeToString(sig), nil
+}
+
+// Decode verifies the signature of a token and stores its claims into the
+// value pointed by claims. If claims implements Validator, the claims
+// are also validated
+func Decode(token string, keyFunc KeyFunc, claims interface{}) (*Header, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	rawHeader, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	header := &Header{}
+	if err := json.Unmarshal(rawHeader, header); err != nil {
+		return nil, ErrMalformed
+	}
+
+	sig, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	v, err := keyFunc(header)
+	if err != nil {
+		return nil, err
+	}
+	// We never trust the algorithm of the token, it has to be the one
+	// of the key
+	if header.Algorithm != v.Algorithm() {
+		return nil, ErrAlgorithmMismatch
+	}
+	if err := v.Verify([]byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, ErrInvalidSignature
+	}
+
+	payload, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+	if err := dec.Decode(claims); err != nil {
+		return nil, ErrMalformed
+	}
+
+	if validator, ok := claims.(Validator); ok {
+		if err := validator.Valid(time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	return header, nil
+}
+
+// StaticKey returns a KeyFunc that always returns the provided Verifier
+func StaticKey(v Verifier) KeyFunc {
+	return func(h *Header) (Verifier, error) {
+		return v, nil
+	}
+}
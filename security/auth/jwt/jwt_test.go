@@ -0,0 +1,98 @@
+package jwt_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/security/auth/jwt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		description string
+		signer      jwt.Signer
+		verifier    jwt.Verifier
+	}{
+		{"HS256", &jwt.HS256{Secret: []byte("secret")}, &jwt.HS256{Secret: []byte("secret")}},
+		{"RS256", &jwt.RS256{PrivateKey: rsaKey}, &jwt.RS256{PublicKey: &rsaKey.PublicKey}},
+		{"EdDSA", &jwt.EdDSA{PrivateKey: edPriv}, &jwt.EdDSA{PublicKey: edPub}},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			claims := &jwt.RegisteredClaims{
+				Subject:   "user-id",
+				Audience:  jwt.Audience{"api"},
+				ExpiresAt: time.Now().Add(time.Hour).Unix(),
+			}
+			token, err := jwt.Encode(claims, tc.signer, "key-1")
+			require.NoError(t, err, "Encode() should have succeed")
+
+			decoded := &jwt.RegisteredClaims{}
+			header, err := jwt.Decode(token, jwt.StaticKey(tc.verifier), decoded)
+			require.NoError(t, err, "Decode() should have succeed")
+			assert.Equal(t, "key-1", header.KeyID)
+			assert.Equal(t, tc.signer.Algorithm(), header.Algorithm)
+			assert.Equal(t, claims, decoded)
+
+			// We change the last char of the payload
+			parts := strings.Split(token, ".")
+			payload := []byte(parts[1])
+			payload[len(payload)-1] ^= 1
+			tampered := parts[0] + "." + string(payload) + "." + parts[2]
+			_, err = jwt.Decode(tampered, jwt.StaticKey(tc.verifier), &jwt.RegisteredClaims{})
+			assert.Error(t, err, "Decode() should have failed on a tampered token")
+		})
+	}
+}
+
+func TestDecodeAlgorithmMismatch(t *testing.T) {
+	token, err := jwt.Encode(&jwt.RegisteredClaims{}, &jwt.HS256{Secret: []byte("secret")}, "")
+	require.NoError(t, err)
+
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	_, err = jwt.Decode(token, jwt.StaticKey(&jwt.EdDSA{PublicKey: edPub}), &jwt.RegisteredClaims{})
+	assert.Equal(t, jwt.ErrAlgorithmMismatch, err)
+}
+
+func TestDecodeExpired(t *testing.T) {
+	key := &jwt.HS256{Secret: []byte("secret")}
+	claims := &jwt.RegisteredClaims{ExpiresAt: time.Now().Add(-time.Hour).Unix()}
+	token, err := jwt.Encode(claims, key, "")
+	require.NoError(t, err)
+
+	_, err = jwt.Decode(token, jwt.StaticKey(key), &jwt.RegisteredClaims{})
+	assert.Equal(t, jwt.ErrExpired, err)
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	key := &jwt.HS256{Secret: []byte("secret")}
+	for _, token := range []string{"", "a.b", "a.b.c", "!!.!!.!!"} {
+		_, err := jwt.Decode(token, jwt.StaticKey(key), &jwt.RegisteredClaims{})
+		assert.Error(t, err, "Decode(%q) should have failed", token)
+	}
+}
+
+func TestAudience(t *testing.T) {
+	a := jwt.Audience{}
+	require.NoError(t, a.UnmarshalJSON([]byte(`"api"`)))
+	assert.Equal(t, jwt.Audience{"api"}, a)
+	require.NoError(t, a.UnmarshalJSON([]byte(`["api","web"]`)))
+	assert.True(t, a.Contains("web"))
+	assert.False(t, a.Contains("mobile"))
+}
@@ -0,0 +1,155 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+)
+
+// Supported signing algorithms
+const (
+	// AlgHS256 represents HMAC using SHA-256
+	AlgHS256 = "HS256"
+	// AlgRS256 represents RSASSA-PKCS1-v1_5 using SHA-256
+	AlgRS256 = "RS256"
+	// AlgEdDSA represents EdDSA using Ed25519
+	AlgEdDSA = "EdDSA"
+)
+
+// ErrNoKey is returned when a key needed to sign or verify a token is missing
+var ErrNoKey = errors.New("no key provided")
+
+// Signer represents a struct used to sign a token
+type Signer interface {
+	// Algorithm returns the value of the "alg" header
+	Algorithm() string
+
+	// Sign returns the signature of the provided data
+	Sign(data []byte) ([]byte, error)
+}
+
+// Verifier represents a struct used to verify the signature of a token
+type Verifier interface {
+	// Algorithm returns the value of the "alg" header
+	Algorithm() string
+
+	// Verify returns an error if the signature doesn't match the data
+	Verify(data, signature []byte) error
+}
+
+// Key represents a key that can both sign and verify tokens
+type Key interface {
+	Signer
+	Verifier
+}
+
+var (
+	_ Key = (*HS256)(nil)
+	_ Key = (*RS256)(nil)
+	_ Key = (*EdDSA)(nil)
+)
+
+// HS256 signs and verifies tokens using HMAC SHA-256
+type HS256 struct {
+	Secret []byte
+}
+
+// Algorithm returns the value of the "alg" header
+func (s *HS256) Algorithm() string {
+	return AlgHS256
+}
+
+// Sign returns the signature of the provided data
+func (s *HS256) Sign(data []byte) ([]byte, error) {
+	if len(s.Secret) == 0 {
+		return nil, ErrNoKey
+	}
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+// Verify returns an error if the signature doesn't match the data
+func (s *HS256) Verify(data, signature []byte) error {
+	expected, err := s.Sign(data)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(expected, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// RS256 signs and verifies tokens using RSA PKCS #1 v1.5 with SHA-256.
+// Only the PublicKey is needed to verify tokens
+type RS256 struct {
+	PrivateKey *rsa.PrivateKey
+	PublicKey  *rsa.PublicKey
+}
+
+// Algorithm returns the value of the "alg" header
+func (s *RS256) Algorithm() string {
+	return AlgRS256
+}
+
+// Sign returns the signature of the provided data
+func (s *RS256) Sign(data []byte) ([]byte, error) {
+	if s.PrivateKey == nil {
+		return nil, ErrNoKey
+	}
+	hash := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, s.PrivateKey, crypto.SHA256, hash[:])
+}
+
+// Verify returns an error if the signature doesn't match the data
+func (s *RS256) Verify(data, signature []byte) error {
+	key := s.PublicKey
+	if key == nil && s.PrivateKey != nil {
+		key = &s.PrivateKey.PublicKey
+	}
+	if key == nil {
+		return ErrNoKey
+	}
+	hash := sha256.Sum256(data)
+	return rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature)
+}
+
+// EdDSA signs and verifies tokens using Ed25519.
+// Only the PublicKey is needed to verify tokens
+type EdDSA struct {
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+}
+
+// Algorithm returns the value of the "alg" header
+func (s *EdDSA) Algorithm() string {
+	return AlgEdDSA
+}
+
+// Sign returns the signature of the provided data
+func (s *EdDSA) Sign(data []byte) ([]byte, error) {
+	if len(s.PrivateKey) != ed25519.PrivateKeySize {
+		return nil, ErrNoKey
+	}
+	return ed25519.Sign(s.PrivateKey, data), nil
+}
+
+// Verify returns an error if the signature doesn't match the data
+func (s *EdDSA) Verify(data, signature []byte) error {
+	key := s.PublicKey
+	if key == nil && len(s.PrivateKey) == ed25519.PrivateKeySize {
+		key = s.PrivateKey.Public().(ed25519.PublicKey)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return ErrNoKey
+	}
+	if !ed25519.Verify(key, data, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
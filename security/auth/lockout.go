@@ -0,0 +1,523 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	reporter "github.com/Nivl/go-reporter"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	db "github.com/Nivl/go-sqldb"
+	"github.com/Nivl/go-types/datetime"
+)
+
+// ErrMsgTooManyAttempts is the message returned when an account or an IP
+// address has been locked after too many failed login attempts
+const ErrMsgTooManyAttempts = "too many failed attempts, try again later"
+
+const (
+	// LockoutEventAccountLocked is reported when an account gets locked
+	LockoutEventAccountLocked = "account_locked"
+
+	// LockoutEventIPLocked is reported when an IP address gets locked
+	LockoutEventIPLocked = "ip_locked"
+
+	// LockoutEventBlockedAttempt is reported when a login attempt is
+	// rejected because the account or the IP address is locked
+	LockoutEventBlockedAttempt = "blocked_attempt"
+)
+
+// LockoutPolicy contains the thresholds used to protect the logins
+// against brute-force attacks
+type LockoutPolicy struct {
+	// Window is the period during which the failed attempts are counted
+	Window time.Duration
+
+	// MaxAccountFailures is the number of failed attempts after which an
+	// account gets locked. 0 disables the lockout of the accounts
+	MaxAccountFailures int
+
+	// MaxIPFailures is the number of failed attempts after which an IP
+	// address gets locked. It should be higher than MaxAccountFailures
+	// since several users can share the same address.
+	// 0 disables the lockout of the IP addresses
+	MaxIPFailures int
+
+	// LockoutDuration is the duration of the first lockout. It doubles
+	// with every new lockout, up to MaxLockoutDuration
+	LockoutDuration    time.Duration
+	MaxLockoutDuration time.Duration
+
+	// DelayAfter is the number of failed attempts after which the client
+	// has to wait between two attempts. 0 disables the delays
+	DelayAfter int
+
+	// BaseDelay is the delay to wait after DelayAfter failed attempts.
+	// It doubles with every new failed attempt, up to MaxDelay
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultLockoutPolicy returns the policy used by NewLockout()
+func DefaultLockoutPolicy() *LockoutPolicy {
+	return &LockoutPolicy{
+		Window:             15 * time.Minute,
+		MaxAccountFailures: 10,
+		MaxIPFailures:      100,
+		LockoutDuration:    15 * time.Minute,
+		MaxLockoutDuration: 24 * time.Hour,
+		DelayAfter:         3,
+		BaseDelay:          time.Second,
+		MaxDelay:           30 * time.Second,
+	}
+}
+
+// LoginAttempts is a structure representing the failed login attempts of
+// an account or of an IP address, that can be saved in the database
+type LoginAttempts struct {
+	// Key identifies the account ("account:email"), the IP address
+	// ("ip:address"), or the second factor of a user ("mfa:user_id")
+	Key string `db:"key" json:"key"`
+
+	// Failures contains the number of attempts since the last lockout.
+	// The attempts are counted before being verified, see Reserve()
+	Failures int `db:"failures" json:"failures"`
+
+	// Lockouts contains the number of times the key got locked
+	Lockouts int `db:"lockouts" json:"lockouts"`
+
+	// LastFailureAt contains the date of the last attempt
+	LastFailureAt *datetime.DateTime `db:"last_failure_at" json:"last_failure_at"`
+	LockedUntil   *datetime.DateTime `db:"locked_until" json:"locked_until"`
+}
+
+// LockoutEvent represents an event that should be monitored, like an
+// account getting locked. It implements error so it can be sent
+// using Reporter.ReportError()
+type LockoutEvent struct {
+	Type     string
+	Key      string
+	Failures int
+
+	// RetryAfter contains the amount of time before the key is unlocked
+	RetryAfter time.Duration
+}
+
+// Error returns a description of the event
+func (e *LockoutEvent) Error() string {
+	return fmt.Sprintf("login lockout: %s (key: %s, failures: %d, retry after: %s)", e.Type, e.Key, e.Failures, e.RetryAfter)
+}
+
+// Lockout tracks the failed login attempts per account and per IP
+// address, and temporarily locks the ones being attacked.
+// The accounts are identified by email, so the emails that don't belong
+// to any user get locked the same way.
+// The attempts are stored in a table named login_attempts:
+//
+//	CREATE TABLE login_attempts (
+//	  key VARCHAR PRIMARY KEY,
+//	  failures INTEGER NOT NULL,
+//	  lockouts INTEGER NOT NULL,
+//	  last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  locked_until TIMESTAMP WITH TIME ZONE
+//	);
+type Lockout struct {
+	// Policy contains the thresholds of the lockout
+	Policy *LockoutPolicy
+
+	// Reporter receives a LockoutEvent every time a key gets locked or
+	// an attempt is blocked, which can be used to alert on spikes.
+	// It's shared by all the requests. nil disables the reports
+	Reporter reporter.Reporter
+
+	now func() time.Time
+}
+
+// NewLockout returns a Lockout using the provided policy, or
+// DefaultLockoutPolicy() if nil
+func NewLockout(policy *LockoutPolicy) *Lockout {
+	if policy == nil {
+		policy = DefaultLockoutPolicy()
+	}
+	return &Lockout{
+		Policy: policy,
+		now:    time.Now,
+	}
+}
+
+// maxReservationRetries is the number of times Reserve re-reads the
+// attempts of a key when a concurrent request reserved an attempt first
+const maxReservationRetries = 3
+
+// Reserve counts a login attempt on the account and the IP address
+// before the password gets verified, and returns a Locked error if the
+// account or the IP address is locked, or if the client has to wait
+// before trying again.
+// The attempt is reserved atomically, so concurrent requests cannot
+// try more passwords than the policy allows. It must be followed by a
+// call to RecordFailure() or RecordSuccess(). A reservation that never
+// gets settled (after a panic or a lost connection for example) is
+// counted as a failure until it leaves the window.
+// ip is optional
+func (l *Lockout) Reserve(q db.Queryable, email, ip string) error {
+	return l.reserve(q, lockoutKeys(email, ip))
+}
+
+// ReserveMFA counts an attempt on the second factor of a user before
+// the code gets verified, and returns a Locked error if the second
+// factor is locked, or if the user has to wait before trying again.
+// It must be followed by a call to RecordMFAFailure() or
+// RecordMFASuccess(), see Reserve()
+func (l *Lockout) ReserveMFA(q db.Queryable, userID string) error {
+	return l.reserve(q, []string{mfaKey(userID)})
+}
+
+// reserve counts an attempt on all the keys, or returns a Locked error
+// if one of the keys is locked.
+// All the keys are checked before the attempt gets counted, so a locked
+// key doesn't increase the counters of the other keys
+func (l *Lockout) reserve(q db.Queryable, keys []string) error {
+	attempts := make([]*LoginAttempts, len(keys))
+	for i, key := range keys {
+		la, err := l.checkKey(q, key, l.getNow())
+		if err != nil {
+			return err
+		}
+		attempts[i] = la
+	}
+
+	for i, key := range keys {
+		if err := l.reserveKey(q, key, attempts[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkKey returns the attempts of a key, or a Locked error if the key
+// is locked. nil is returned if the key doesn't have any attempts
+func (l *Lockout) checkKey(q db.Queryable, key string, now time.Time) (*LoginAttempts, error) {
+	la, err := GetLoginAttempts(q, key)
+	if err != nil {
+		if apperror.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if wait := l.Policy.wait(la, l.Policy.maxFailures(key), now); wait > 0 {
+		return nil, l.blocked(la, wait)
+	}
+	return la, nil
+}
+
+// reserveKey counts an attempt on a key. la contains the attempts
+// returned by checkKey().
+// The counter is only updated if it didn't change since it got read,
+// which makes the check and the increment atomic. The key is checked
+// again if another request updated it in the meantime
+func (l *Lockout) reserveKey(q db.Queryable, key string, la *LoginAttempts) error {
+	var err error
+	for i := 0; i < maxReservationRetries; i++ {
+		now := l.getNow()
+		if i > 0 {
+			if la, err = l.checkKey(q, key, now); err != nil {
+				return err
+			}
+		}
+
+		var reserved bool
+		if la == nil {
+			reserved, err = insertLoginAttempts(q, key, now)
+		} else {
+			reserved, err = l.incrementLoginAttempts(q, la, now)
+		}
+		if err != nil || reserved {
+			return err
+		}
+	}
+
+	// The key keeps being updated by other requests
+	return l.blocked(&LoginAttempts{Key: key}, time.Second)
+}
+
+// blocked reports a blocked attempt and returns the matching error
+func (l *Lockout) blocked(la *LoginAttempts, wait time.Duration) error {
+	l.report(&LockoutEvent{
+		Type:       LockoutEventBlockedAttempt,
+		Key:        la.Key,
+		Failures:   la.Failures,
+		RetryAfter: wait,
+	})
+	return apperror.NewLocked(ErrMsgTooManyAttempts, wait)
+}
+
+// insertLoginAttempts saves the first attempt of a key. false is returned
+// if the key has been inserted by another request in the meantime
+func insertLoginAttempts(q db.Queryable, key string, now time.Time) (bool, error) {
+	stmt := `INSERT INTO login_attempts (key, failures, lockouts, last_failure_at)
+					VALUES ($1, 1, 0, $2)
+					ON CONFLICT (key) DO NOTHING`
+	rows, err := q.Exec(stmt, key, now)
+	return rows > 0, apperror.NewFromSQL(err)
+}
+
+// incrementLoginAttempts counts a new attempt on la. false is returned
+// if the attempts have been updated by another request in the meantime
+func (l *Lockout) incrementLoginAttempts(q db.Queryable, la *LoginAttempts, now time.Time) (bool, error) {
+	failures := 1
+	if la.LastFailureAt != nil && la.LastFailureAt.After(now.Add(-l.Policy.Window)) {
+		failures = la.Failures + 1
+	}
+
+	stmt := `UPDATE login_attempts
+					SET failures = $2, last_failure_at = $3
+					WHERE key = $1
+						AND failures = $4
+						AND last_failure_at = $5`
+	rows, err := q.Exec(stmt, la.Key, failures, now, la.Failures, la.LastFailureAt)
+	return rows > 0, apperror.NewFromSQL(err)
+}
+
+// RecordFailure locks the account or the IP address if they reached
+// their limit. The attempt itself has already been counted by Reserve().
+// ip is optional
+func (l *Lockout) RecordFailure(q db.Queryable, email, ip string) error {
+	return l.recordFailure(q, lockoutKeys(email, ip))
+}
+
+// RecordMFAFailure locks the second factor of a user if they reached
+// the limit of the accounts. The attempt itself has already been
+// counted by ReserveMFA()
+func (l *Lockout) RecordMFAFailure(q db.Queryable, userID string) error {
+	return l.recordFailure(q, []string{mfaKey(userID)})
+}
+
+// recordFailure locks the keys that reached their limit
+func (l *Lockout) recordFailure(q db.Queryable, keys []string) error {
+	now := l.getNow()
+	for _, key := range keys {
+		max := l.Policy.maxFailures(key)
+		if max <= 0 {
+			continue
+		}
+
+		la, err := GetLoginAttempts(q, key)
+		if err != nil {
+			if apperror.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		if la.Failures < max {
+			continue
+		}
+
+		duration := l.Policy.lockoutDuration(la.Lockouts)
+		stmt := `UPDATE login_attempts
+						SET failures = 0, lockouts = lockouts + 1, locked_until = $2
+						WHERE key = $1 AND failures >= $3`
+		rows, err := q.Exec(stmt, key, now.Add(duration), max)
+		if err != nil {
+			return apperror.NewFromSQL(err)
+		}
+		// The key has already been locked by a concurrent request
+		if rows == 0 {
+			continue
+		}
+
+		eventType := LockoutEventAccountLocked
+		if strings.HasPrefix(key, ipKeyPrefix) {
+			eventType = LockoutEventIPLocked
+		}
+		l.report(&LockoutEvent{
+			Type:       eventType,
+			Key:        key,
+			Failures:   la.Failures,
+			RetryAfter: duration,
+		})
+	}
+	return nil
+}
+
+// RecordSuccess resets the failed attempts of an account once its
+// user signed in. The attempts of the IP address are kept, since an
+// attacker could use their own account to reset them, but the
+// attempt reserved by Reserve() is given back.
+// ip is optional
+func (l *Lockout) RecordSuccess(q db.Queryable, email, ip string) error {
+	if err := deleteLoginAttempts(q, accountKey(email)); err != nil {
+		return err
+	}
+	if ip == "" {
+		return nil
+	}
+
+	stmt := `UPDATE login_attempts
+					SET failures = GREATEST(failures - 1, 0)
+					WHERE key = $1`
+	_, err := q.Exec(stmt, ipKey(ip))
+	return apperror.NewFromSQL(err)
+}
+
+// RecordMFASuccess resets the failed attempts of the second factor of
+// a user
+func (l *Lockout) RecordMFASuccess(q db.Queryable, userID string) error {
+	return deleteLoginAttempts(q, mfaKey(userID))
+}
+
+// DeleteExpired removes the attempts that are not relevant anymore.
+// The number of lockouts of a key is forgotten once its attempts are
+// removed
+func (l *Lockout) DeleteExpired(q db.Queryable) error {
+	now := l.getNow()
+	retention := l.Policy.Window
+	if l.Policy.MaxLockoutDuration > retention {
+		retention = l.Policy.MaxLockoutDuration
+	}
+
+	stmt := `DELETE FROM login_attempts
+					WHERE last_failure_at <= $1
+						AND (locked_until IS NULL OR locked_until <= $2)`
+	_, err := q.Exec(stmt, now.Add(-retention), now)
+	return apperror.NewFromSQL(err)
+}
+
+// report sends an event to the reporter, if any
+func (l *Lockout) report(e *LockoutEvent) {
+	if l.Reporter != nil {
+		l.Reporter.ReportError(e)
+	}
+}
+
+// getNow returns the current time
+func (l *Lockout) getNow() time.Time {
+	if l.now == nil {
+		return time.Now()
+	}
+	return l.now()
+}
+
+// wait returns the amount of time a client has to wait before trying
+// again. max is the number of failed attempts allowed on the key
+func (p *LockoutPolicy) wait(la *LoginAttempts, max int, now time.Time) time.Duration {
+	if la.LockedUntil != nil && la.LockedUntil.After(now) {
+		return la.LockedUntil.Sub(now)
+	}
+
+	// The failures that are out of the window don't count anymore
+	if la.LastFailureAt == nil || !la.LastFailureAt.After(now.Add(-p.Window)) {
+		return 0
+	}
+
+	// The last allowed attempt is still being verified and the key is
+	// about to be locked
+	if max > 0 && la.Failures >= max {
+		return time.Second
+	}
+
+	if p.DelayAfter <= 0 || la.Failures < p.DelayAfter {
+		return 0
+	}
+	delay := doubleUpTo(p.BaseDelay, la.Failures-p.DelayAfter, p.MaxDelay)
+	if next := la.LastFailureAt.Add(delay); next.After(now) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// maxFailures returns the number of failed attempts allowed on a key
+func (p *LockoutPolicy) maxFailures(key string) int {
+	if strings.HasPrefix(key, ipKeyPrefix) {
+		return p.MaxIPFailures
+	}
+	return p.MaxAccountFailures
+}
+
+// lockoutDuration returns the duration of a lockout, given the number
+// of times the key has already been locked
+func (p *LockoutPolicy) lockoutDuration(lockouts int) time.Duration {
+	return doubleUpTo(p.LockoutDuration, lockouts, p.MaxLockoutDuration)
+}
+
+// doubleUpTo doubles d n times, without exceeding max.
+// A max of 0 means there's no limit
+func doubleUpTo(d time.Duration, n int, max time.Duration) time.Duration {
+	for i := 0; i < n; i++ {
+		if max > 0 && d >= max {
+			break
+		}
+		d *= 2
+	}
+	if max > 0 && d > max {
+		return max
+	}
+	return d
+}
+
+// GetLoginAttempts finds and returns the attempts matching a key
+func GetLoginAttempts(q db.Queryable, key string) (*LoginAttempts, error) {
+	la := &LoginAttempts{}
+	stmt := "SELECT * from login_attempts WHERE key=$1 LIMIT 1"
+	err := q.Get(la, stmt, key)
+	return la, apperror.NewFromSQL(err)
+}
+
+// GetLockedLoginAttempts returns the accounts and the IP addresses that
+// are currently locked
+func GetLockedLoginAttempts(q db.Queryable) ([]*LoginAttempts, error) {
+	attempts := []*LoginAttempts{}
+	stmt := `SELECT * from login_attempts
+					WHERE locked_until > $1
+					ORDER BY locked_until DESC`
+	err := q.Select(&attempts, stmt, datetime.Now())
+	return attempts, apperror.NewFromSQL(err)
+}
+
+// UnlockAccount removes the lockout and the failed attempts of
+// an account
+func UnlockAccount(q db.Queryable, email string) error {
+	return deleteLoginAttempts(q, accountKey(email))
+}
+
+// UnlockIP removes the lockout and the failed attempts of an IP address
+func UnlockIP(q db.Queryable, ip string) error {
+	return deleteLoginAttempts(q, ipKey(ip))
+}
+
+// deleteLoginAttempts removes the attempts matching a key
+func deleteLoginAttempts(q db.Queryable, key string) error {
+	stmt := "DELETE FROM login_attempts WHERE key=$1"
+	_, err := q.Exec(stmt, key)
+	return apperror.NewFromSQL(err)
+}
+
+const (
+	accountKeyPrefix = "account:"
+	ipKeyPrefix      = "ip:"
+	mfaKeyPrefix     = "mfa:"
+)
+
+// accountKey returns the key used to track the attempts of an account
+func accountKey(email string) string {
+	return accountKeyPrefix + strings.ToLower(strings.TrimSpace(email))
+}
+
+// ipKey returns the key used to track the attempts of an IP address
+func ipKey(ip string) string {
+	return ipKeyPrefix + ip
+}
+
+// mfaKey returns the key used to track the attempts of the second factor
+// of a user
+func mfaKey(userID string) string {
+	return mfaKeyPrefix + userID
+}
+
+// lockoutKeys returns the keys matching an attempt
+func lockoutKeys(email, ip string) []string {
+	keys := []string{accountKey(email)}
+	if ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+	return keys
+}
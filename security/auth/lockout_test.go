@@ -0,0 +1,361 @@
+package auth_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	reporter "github.com/Nivl/go-reporter"
+	"github.com/Nivl/go-rest-tools/security/auth"
+	"github.com/Nivl/go-rest-tools/security/auth/testauth"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	"github.com/Nivl/go-sqldb/implementations/mocksqldb"
+	"github.com/Nivl/go-types/datetime"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// eventsReporter is a reporter that keeps the lockout events
+type eventsReporter struct {
+	events []*auth.LockoutEvent
+}
+
+func (r *eventsReporter) SetUser(u *reporter.User)       {}
+func (r *eventsReporter) AddTag(key, value string)       {}
+func (r *eventsReporter) AddTags(tags map[string]string) {}
+func (r *eventsReporter) ReportErrorAndWait(err error)   {}
+func (r *eventsReporter) ReportError(err error) {
+	if e, ok := err.(*auth.LockoutEvent); ok {
+		r.events = append(r.events, e)
+	}
+}
+
+// expectReservation expects the first attempt of key to be reserved
+func expectReservation(mockDB *mocksqldb.MockQueryable, key string) {
+	mockDB.EXPECT().GetIDNotFound(&auth.LoginAttempts{}, key)
+	mockDB.EXPECT().Exec(gomock.Any(), key, gomock.Any()).Return(int64(1), nil)
+}
+
+// expectFailure expects a failed attempt to be recorded for key.
+// attempts contains the attempts returned by the database
+func expectFailure(mockDB *mocksqldb.MockQueryable, key string, attempts *auth.LoginAttempts) *gomock.Call {
+	return mockDB.EXPECT().GetID(&auth.LoginAttempts{}, key, func(la *auth.LoginAttempts, stmt, key string) {
+		*la = *attempts
+	})
+}
+
+func TestLockoutReserve(t *testing.T) {
+	now := time.Now()
+
+	testCases := []struct {
+		description string
+		attempts    *auth.LoginAttempts
+		minWait     time.Duration
+		maxWait     time.Duration
+	}{
+		{
+			"locked",
+			&auth.LoginAttempts{LockedUntil: &datetime.DateTime{Time: now.Add(10 * time.Minute)}},
+			9 * time.Minute, 10 * time.Minute,
+		},
+		{
+			"lockout expired",
+			&auth.LoginAttempts{LockedUntil: &datetime.DateTime{Time: now.Add(-time.Minute)}},
+			0, 0,
+		},
+		{
+			"under the delay threshold",
+			&auth.LoginAttempts{Failures: 2, LastFailureAt: &datetime.DateTime{Time: now}},
+			0, 0,
+		},
+		{
+			"first delay",
+			&auth.LoginAttempts{Failures: 3, LastFailureAt: &datetime.DateTime{Time: now}},
+			500 * time.Millisecond, time.Second,
+		},
+		{
+			"progressive delay",
+			&auth.LoginAttempts{Failures: 5, LastFailureAt: &datetime.DateTime{Time: now}},
+			3 * time.Second, 4 * time.Second,
+		},
+		{
+			"capped delay",
+			&auth.LoginAttempts{Failures: 9, LastFailureAt: &datetime.DateTime{Time: now}},
+			29 * time.Second, 30 * time.Second,
+		},
+		{
+			"last attempt being verified",
+			&auth.LoginAttempts{Failures: 10, LastFailureAt: &datetime.DateTime{Time: now.Add(-time.Minute)}},
+			0, time.Second,
+		},
+		{
+			"delay already waited",
+			&auth.LoginAttempts{Failures: 3, LastFailureAt: &datetime.DateTime{Time: now.Add(-2 * time.Second)}},
+			0, 0,
+		},
+		{
+			"failures out of the window",
+			&auth.LoginAttempts{Failures: 10, LastFailureAt: &datetime.DateTime{Time: now.Add(-time.Hour)}},
+			0, 0,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+			mockDB.EXPECT().GetID(&auth.LoginAttempts{}, "account:user@domain.tld", func(la *auth.LoginAttempts, stmt, key string) {
+				*la = *tc.attempts
+				la.Key = key
+			})
+			if tc.maxWait == 0 {
+				mockDB.EXPECT().Exec(gomock.Any(), "account:user@domain.tld", gomock.Any(), gomock.Any(), tc.attempts.Failures, gomock.Any()).Return(int64(1), nil)
+				expectReservation(mockDB, "ip:10.0.0.1")
+			}
+
+			rep := &eventsReporter{}
+			l := auth.NewLockout(nil)
+			l.Reporter = rep
+			err := l.Reserve(mockDB, " User@domain.tld", "10.0.0.1")
+			if tc.maxWait == 0 {
+				require.NoError(t, err, "Reserve() should have succeed")
+				assert.Empty(t, rep.events)
+				return
+			}
+
+			require.True(t, apperror.IsLocked(err), "expected a Locked error")
+			retryAfter := apperror.Convert(err).RetryAfter()
+			assert.True(t, retryAfter > tc.minWait && retryAfter <= tc.maxWait, "unexpected retry after: %s", retryAfter)
+			require.Len(t, rep.events, 1)
+			assert.Equal(t, auth.LockoutEventBlockedAttempt, rep.events[0].Type)
+		})
+	}
+
+	t.Run("concurrent attempt", func(t *testing.T) {
+		t.Parallel()
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		key := "account:user@domain.tld"
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetID(&auth.LoginAttempts{}, key, func(la *auth.LoginAttempts, stmt, key string) {
+			*la = auth.LoginAttempts{Key: key, Failures: 2, LastFailureAt: &datetime.DateTime{Time: now}}
+		})
+		// Another request reserved the third attempt in the meantime
+		mockDB.EXPECT().Exec(gomock.Any(), key, 3, gomock.Any(), 2, gomock.Any()).Return(int64(0), nil)
+		mockDB.EXPECT().GetID(&auth.LoginAttempts{}, key, func(la *auth.LoginAttempts, stmt, key string) {
+			*la = auth.LoginAttempts{Key: key, Failures: 3, LastFailureAt: &datetime.DateTime{Time: time.Now()}}
+		})
+
+		err := auth.NewLockout(nil).Reserve(mockDB, "user@domain.tld", "")
+		require.True(t, apperror.IsLocked(err), "expected a Locked error")
+	})
+
+	t.Run("locked ip", func(t *testing.T) {
+		t.Parallel()
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		// The attempts of the account should not be counted
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetID(&auth.LoginAttempts{}, "account:user@domain.tld", func(la *auth.LoginAttempts, stmt, key string) {
+			*la = auth.LoginAttempts{Key: key, Failures: 1, LastFailureAt: &datetime.DateTime{Time: now}}
+		})
+		mockDB.EXPECT().GetID(&auth.LoginAttempts{}, "ip:10.0.0.1", func(la *auth.LoginAttempts, stmt, key string) {
+			*la = auth.LoginAttempts{Key: key, LockedUntil: &datetime.DateTime{Time: now.Add(time.Minute)}}
+		})
+
+		err := auth.NewLockout(nil).Reserve(mockDB, "user@domain.tld", "10.0.0.1")
+		require.True(t, apperror.IsLocked(err), "expected a Locked error")
+	})
+}
+
+func TestLockoutRecordSuccess(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+	// The attempts of the account are removed, and the attempt of the
+	// IP address is given back
+	mockDB.EXPECT().Exec(gomock.Any(), "account:user@domain.tld").Return(int64(1), nil)
+	mockDB.EXPECT().Exec(gomock.Any(), "ip:10.0.0.1").Return(int64(1), nil)
+
+	err := auth.NewLockout(nil).RecordSuccess(mockDB, "user@domain.tld", "10.0.0.1")
+	require.NoError(t, err, "RecordSuccess() should have succeed")
+}
+
+func TestLockoutRecordFailure(t *testing.T) {
+	t.Run("under the threshold", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		expectFailure(mockDB, "account:user@domain.tld", &auth.LoginAttempts{Failures: 9})
+		expectFailure(mockDB, "ip:10.0.0.1", &auth.LoginAttempts{Failures: 10})
+
+		err := auth.NewLockout(nil).RecordFailure(mockDB, "user@domain.tld", "10.0.0.1")
+		require.NoError(t, err, "RecordFailure() should have succeed")
+	})
+
+	testCases := []struct {
+		description      string
+		key              string
+		lockouts         int
+		expectedDuration time.Duration
+		expectedEvent    string
+	}{
+		{"first account lockout", "account:user@domain.tld", 0, 15 * time.Minute, auth.LockoutEventAccountLocked},
+		{"third account lockout", "account:user@domain.tld", 2, time.Hour, auth.LockoutEventAccountLocked},
+		{"capped account lockout", "account:user@domain.tld", 10, 24 * time.Hour, auth.LockoutEventAccountLocked},
+		{"ip lockout", "ip:10.0.0.1", 0, 15 * time.Minute, auth.LockoutEventIPLocked},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			policy := auth.DefaultLockoutPolicy()
+			mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+			accountFailures, ipFailures := 1, 1
+			if tc.expectedEvent == auth.LockoutEventAccountLocked {
+				accountFailures = policy.MaxAccountFailures
+			} else {
+				ipFailures = policy.MaxIPFailures
+			}
+			expectFailure(mockDB, "account:user@domain.tld", &auth.LoginAttempts{Failures: accountFailures, Lockouts: tc.lockouts})
+			expectFailure(mockDB, "ip:10.0.0.1", &auth.LoginAttempts{Failures: ipFailures, Lockouts: tc.lockouts})
+			mockDB.EXPECT().Exec(gomock.Any(), tc.key, gomock.Any(), gomock.Any()).Do(func(stmt string, key string, lockedUntil time.Time, max int) {
+				assert.WithinDuration(t, time.Now().Add(tc.expectedDuration), lockedUntil, time.Minute)
+			}).Return(int64(1), nil)
+
+			rep := &eventsReporter{}
+			l := auth.NewLockout(policy)
+			l.Reporter = rep
+			err := l.RecordFailure(mockDB, "user@domain.tld", "10.0.0.1")
+			require.NoError(t, err, "RecordFailure() should have succeed")
+			require.Len(t, rep.events, 1)
+			assert.Equal(t, tc.expectedEvent, rep.events[0].Type)
+			assert.Equal(t, tc.key, rep.events[0].Key)
+			assert.Equal(t, tc.expectedDuration, rep.events[0].RetryAfter)
+		})
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+	mockDB.EXPECT().Exec(gomock.Any(), "account:user@domain.tld").Return(int64(1), nil)
+	mockDB.EXPECT().Exec(gomock.Any(), "ip:10.0.0.1").Return(int64(1), nil)
+
+	require.NoError(t, auth.UnlockAccount(mockDB, "USER@domain.tld "))
+	require.NoError(t, auth.UnlockIP(mockDB, "10.0.0.1"))
+}
+
+func TestAuthenticateWithLockout(t *testing.T) {
+	user := testauth.NewUser()
+	user.Password = "hashed:password"
+	accountKey := "account:" + strings.ToLower(user.Email)
+
+	t.Run("locked account", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetID(&auth.LoginAttempts{}, accountKey, func(la *auth.LoginAttempts, stmt, key string) {
+			la.LockedUntil = &datetime.DateTime{Time: time.Now().Add(time.Minute)}
+		})
+
+		a := newTestAccounts()
+		a.Lockout = auth.NewLockout(nil)
+		_, _, err := a.AuthenticateFrom(mockDB, user.Email, "password", "10.0.0.1")
+		assert.True(t, apperror.IsLocked(err), "expected a Locked error")
+	})
+
+	t.Run("invalid password", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		expectReservation(mockDB, accountKey)
+		expectReservation(mockDB, "ip:10.0.0.1")
+		mockDB.EXPECT().GetSuccess(&auth.User{}, func(u *auth.User, stmt, email string) {
+			*u = *user
+		})
+		expectFailure(mockDB, accountKey, &auth.LoginAttempts{Failures: 1})
+		expectFailure(mockDB, "ip:10.0.0.1", &auth.LoginAttempts{Failures: 1})
+
+		a := newTestAccounts()
+		a.Lockout = auth.NewLockout(nil)
+		_, _, err := a.AuthenticateFrom(mockDB, user.Email, "not password", "10.0.0.1")
+		assert.True(t, apperror.IsUnauthorized(err), "expected an Unauthorized error")
+	})
+
+	t.Run("valid password", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		expectReservation(mockDB, accountKey)
+		mockDB.EXPECT().GetSuccess(&auth.User{}, func(u *auth.User, stmt, email string) {
+			*u = *user
+		})
+		// The failed attempts of the account should be reset
+		mockDB.EXPECT().Exec(gomock.Any(), accountKey).Return(int64(1), nil)
+		mockDB.EXPECT().GetNotFound(&auth.TOTPDevice{})
+		mockDB.EXPECT().InsertSuccess(&auth.Session{})
+
+		a := newTestAccounts()
+		a.Lockout = auth.NewLockout(nil)
+		_, _, err := a.AuthenticateFrom(mockDB, user.Email, "password", "")
+		require.NoError(t, err, "AuthenticateFrom() should have succeed")
+	})
+}
+
+func TestChangePasswordWithLockout(t *testing.T) {
+	user := testauth.NewUser()
+	user.Password = "hashed:password"
+	accountKey := "account:" + strings.ToLower(user.Email)
+
+	t.Run("locked account", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetID(&auth.LoginAttempts{}, accountKey, func(la *auth.LoginAttempts, stmt, key string) {
+			la.LockedUntil = &datetime.DateTime{Time: time.Now().Add(time.Minute)}
+		})
+
+		a := newTestAccounts()
+		a.Lockout = auth.NewLockout(nil)
+		err := a.ChangePassword(mockDB, user, "session-id", "password", "new-password")
+		assert.True(t, apperror.IsLocked(err), "expected a Locked error")
+	})
+
+	t.Run("invalid current password", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		expectReservation(mockDB, accountKey)
+		expectFailure(mockDB, accountKey, &auth.LoginAttempts{Failures: 1})
+
+		a := newTestAccounts()
+		a.Lockout = auth.NewLockout(nil)
+		err := a.ChangePassword(mockDB, user, "session-id", "not password", "new-password")
+		assert.True(t, apperror.IsBadRequest(err), "expected a BadRequest error")
+	})
+}
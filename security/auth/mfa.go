@@ -0,0 +1,458 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/security/auth/totp"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	db "github.com/Nivl/go-sqldb"
+	"github.com/Nivl/go-types/datetime"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// MFAPending is the MFA status of a session created with a valid
+	// password, but that still needs a second factor to be used
+	MFAPending = "pending"
+
+	// MFAVerified is the MFA status of a session for which a second
+	// factor has been provided
+	MFAVerified = "verified"
+
+	// ErrMsgMFARequired is the message returned when a second factor is
+	// needed to access a resource
+	ErrMsgMFARequired = "second factor required"
+
+	// ErrMsgInvalidMFACode is the message returned when a TOTP code or a
+	// recovery code is invalid
+	ErrMsgInvalidMFACode = "invalid code"
+
+	// ErrMsgMFAAlreadyEnabled is the message returned when enrolling a
+	// user that already uses MFA
+	ErrMsgMFAAlreadyEnabled = "already enabled"
+
+	// ErrMsgTooManyMFAFailures is the message returned when a session got
+	// revoked after too many invalid second factors
+	ErrMsgTooManyMFAFailures = "too many invalid codes, sign in again"
+)
+
+var (
+	// TOTPSkew is the number of time steps before and after the current
+	// one during which a TOTP code is still accepted
+	TOTPSkew = 1
+
+	// RecoveryCodesCount is the number of recovery codes generated for
+	// a user
+	RecoveryCodesCount = 10
+
+	// MaxMFAFailures is the number of invalid second factors after which
+	// a pending session is revoked. 0 means that sessions are never
+	// revoked
+	MaxMFAFailures = 5
+)
+
+// TOTPDevice is a structure representing an authenticator app registered
+// by a user, that can be saved in the database.
+// A device is only used once it has been confirmed with a valid code.
+// The secret is needed to validate the codes, and is therefore stored
+// as it is.
+// The devices are stored in a table named user_totp_devices:
+//
+//	CREATE TABLE user_totp_devices (
+//	  id UUID PRIMARY KEY,
+//	  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  deleted_at TIMESTAMP WITH TIME ZONE,
+//	  user_id UUID NOT NULL,
+//	  secret VARCHAR NOT NULL,
+//	  confirmed_at TIMESTAMP WITH TIME ZONE,
+//	  last_used_step BIGINT NOT NULL
+//	);
+type TOTPDevice struct {
+	ID        string             `db:"id"`
+	CreatedAt *datetime.DateTime `db:"created_at"`
+	UpdatedAt *datetime.DateTime `db:"updated_at"`
+	DeletedAt *datetime.DateTime `db:"deleted_at"`
+
+	UserID       string             `db:"user_id"`
+	Secret       string             `db:"secret"`
+	ConfirmedAt  *datetime.DateTime `db:"confirmed_at"`
+	LastUsedStep int64              `db:"last_used_step"`
+}
+
+// RecoveryCode is a structure representing a single-use code that can
+// be used instead of a TOTP code. Only the hash of the code is stored.
+// The codes are stored in a table named user_recovery_codes:
+//
+//	CREATE TABLE user_recovery_codes (
+//	  id UUID PRIMARY KEY,
+//	  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  user_id UUID NOT NULL,
+//	  hash VARCHAR NOT NULL,
+//	  used_at TIMESTAMP WITH TIME ZONE
+//	);
+type RecoveryCode struct {
+	ID        string             `db:"id"`
+	CreatedAt *datetime.DateTime `db:"created_at"`
+	UserID    string             `db:"user_id"`
+	Hash      string             `db:"hash"`
+	UsedAt    *datetime.DateTime `db:"used_at"`
+}
+
+// GetTOTPDeviceByUserID finds and returns the confirmed TOTP device of
+// a user
+func GetTOTPDeviceByUserID(q db.Queryable, userID string) (*TOTPDevice, error) {
+	d := &TOTPDevice{}
+	stmt := `SELECT * from user_totp_devices
+					WHERE user_id=$1
+						AND confirmed_at IS NOT NULL
+						AND deleted_at IS NULL
+					LIMIT 1`
+	err := q.Get(d, stmt, userID)
+	return d, apperror.NewFromSQL(err)
+}
+
+// getPendingTOTPDevice finds and returns the latest device of a user
+// that has not been confirmed yet
+func getPendingTOTPDevice(q db.Queryable, userID string) (*TOTPDevice, error) {
+	d := &TOTPDevice{}
+	stmt := `SELECT * from user_totp_devices
+					WHERE user_id=$1
+						AND confirmed_at IS NULL
+						AND deleted_at IS NULL
+					ORDER BY created_at DESC
+					LIMIT 1`
+	err := q.Get(d, stmt, userID)
+	return d, apperror.NewFromSQL(err)
+}
+
+// HasMFA checks if a user has a confirmed TOTP device
+func HasMFA(q db.Queryable, userID string) (bool, error) {
+	_, err := GetTOTPDeviceByUserID(q, userID)
+	if err != nil {
+		if apperror.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Create persists a TOTP device in the database
+func (d *TOTPDevice) Create(q db.Queryable) error {
+	if d == nil {
+		return apperror.NewServerError("totp device is nil")
+	}
+
+	if d.ID != "" {
+		return apperror.NewServerError("totp devices cannot be updated")
+	}
+
+	if d.UserID == "" || d.Secret == "" {
+		return apperror.NewServerError("cannot save a totp device with no user id or secret")
+	}
+
+	d.ID = uuid.NewV4().String()
+	d.UpdatedAt = datetime.Now()
+	if d.CreatedAt == nil {
+		d.CreatedAt = datetime.Now()
+	}
+
+	stmt := `INSERT INTO user_totp_devices
+		(id, created_at, updated_at, deleted_at, user_id, secret, confirmed_at, last_used_step)
+		VALUES (:id, :created_at, :updated_at, :deleted_at, :user_id, :secret, :confirmed_at, :last_used_step)`
+	_, err := q.NamedExec(stmt, d)
+	return apperror.NewFromSQL(err)
+}
+
+// use validates a code and marks its time step as used, so the code
+// cannot be used twice. The device is confirmed if it wasn't already
+func (d *TOTPDevice) use(q db.Queryable, code string) (bool, error) {
+	step, ok := totp.Validate(d.Secret, code, time.Now(), TOTPSkew, d.LastUsedStep)
+	if !ok {
+		return false, nil
+	}
+
+	now := datetime.Now()
+	stmt := `UPDATE user_totp_devices
+					SET last_used_step=$1, confirmed_at=COALESCE(confirmed_at, $2), updated_at=$2
+					WHERE id=$3
+						AND last_used_step < $1`
+	affected, err := q.Exec(stmt, step, now, d.ID)
+	if err != nil {
+		return false, apperror.NewFromSQL(err)
+	}
+	if affected == 0 {
+		// the code has been used in the meantime
+		return false, nil
+	}
+
+	d.LastUsedStep = step
+	d.UpdatedAt = now
+	if d.ConfirmedAt == nil {
+		d.ConfirmedAt = now
+	}
+	return true, nil
+}
+
+// setMFAStatus updates the MFA status of the session
+func (s *Session) setMFAStatus(q db.Queryable, status string) error {
+	if s.IsZero() {
+		return apperror.NewServerError("session has not been saved")
+	}
+
+	stmt := `UPDATE user_sessions
+					SET mfa_status = $1
+					WHERE id = $2`
+	if _, err := q.Exec(stmt, status, s.ID); err != nil {
+		return apperror.NewFromSQL(err)
+	}
+	s.MFAStatus = status
+	return nil
+}
+
+// EnrollTOTP starts the enrollment of a TOTP device and returns its
+// secret, as well as the URI to provide to the authenticator app.
+// The enrollment has to be completed with ConfirmTOTP().
+// A Conflict error is returned if the user already has a device
+func (a *Accounts) EnrollTOTP(q db.Queryable, u *User, issuer string) (secret, uri string, err error) {
+	if u.IsZero() {
+		return "", "", apperror.NewServerError("user has not been saved")
+	}
+
+	hasMFA, err := HasMFA(q, u.ID)
+	if err != nil {
+		return "", "", err
+	}
+	if hasMFA {
+		return "", "", apperror.NewConflictR("totp", ErrMsgMFAAlreadyEnabled)
+	}
+
+	secret, err = totp.NewSecret()
+	if err != nil {
+		return "", "", err
+	}
+	d := &TOTPDevice{UserID: u.ID, Secret: secret}
+	if err := d.Create(q); err != nil {
+		return "", "", err
+	}
+	return secret, totp.ProvisioningURI(secret, issuer, u.Email), nil
+}
+
+// ConfirmTOTP completes the enrollment of a TOTP device using a code
+// generated by the authenticator app, and returns the recovery codes of
+// the user. The recovery codes cannot be retrieved afterward.
+// The provided session is flagged as verified
+func (a *Accounts) ConfirmTOTP(q db.Queryable, u *User, s *Session, code string) ([]string, error) {
+	if u.IsZero() {
+		return nil, apperror.NewServerError("user has not been saved")
+	}
+
+	d, err := getPendingTOTPDevice(q, u.ID)
+	if err != nil {
+		if apperror.IsNotFound(err) {
+			return nil, apperror.NewPreconditionFailed("no pending enrollment")
+		}
+		return nil, err
+	}
+	ok, err := d.use(q, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, apperror.NewBadRequest("code", ErrMsgInvalidMFACode)
+	}
+
+	codes, err := newRecoveryCodes(q, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.setMFAStatus(q, MFAVerified); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// VerifyMFA checks the second factor of a session waiting for one.
+// The code can either be a TOTP code or a recovery code.
+// Once verified, the session can be used to access all the endpoints.
+// The access tokens issued for the session before the verification
+// still contain the pending status and should be replaced.
+// The session is revoked after MaxMFAFailures invalid codes, and the
+// invalid codes are also tracked per user by the Lockout, if any. The
+// failures are recorded using q, which should therefore not be a
+// transaction that gets rolled back when the code is invalid
+func (a *Accounts) VerifyMFA(q db.Queryable, s *Session, code string) error {
+	if s.IsZero() {
+		return apperror.NewServerError("session has not been saved")
+	}
+	if s.MFAStatus != MFAPending {
+		return apperror.NewPreconditionFailed("the session is not waiting for a second factor")
+	}
+
+	d, err := GetTOTPDeviceByUserID(q, s.UserID)
+	if err != nil {
+		if apperror.IsNotFound(err) {
+			return apperror.NewPreconditionFailed("the user has no second factor")
+		}
+		return err
+	}
+	// The attempt is reserved once the device is known, so a user without
+	// second factor doesn't leave a reservation that never gets settled
+	if a.Lockout != nil {
+		if err := a.Lockout.ReserveMFA(q, s.UserID); err != nil {
+			return err
+		}
+	}
+
+	ok, err := d.use(q, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		ok, err = useRecoveryCode(q, s.UserID, code)
+		if err != nil {
+			return err
+		}
+	}
+	if !ok {
+		return a.mfaFailed(q, s)
+	}
+	if a.Lockout != nil {
+		if err := a.Lockout.RecordMFASuccess(q, s.UserID); err != nil {
+			return err
+		}
+	}
+	return s.setMFAStatus(q, MFAVerified)
+}
+
+// mfaFailed records an invalid second factor provided for a session and
+// returns the error to send to the client
+func (a *Accounts) mfaFailed(q db.Queryable, s *Session) error {
+	if a.Lockout != nil {
+		if err := a.Lockout.RecordMFAFailure(q, s.UserID); err != nil {
+			return err
+		}
+	}
+
+	stmt := `UPDATE user_sessions
+					SET mfa_failures = mfa_failures + 1
+					WHERE id = $1
+					RETURNING mfa_failures`
+	if err := q.Get(&s.MFAFailures, stmt, s.ID); err != nil {
+		return apperror.NewFromSQL(err)
+	}
+	if MaxMFAFailures > 0 && s.MFAFailures >= MaxMFAFailures {
+		if err := s.Revoke(q); err != nil {
+			return err
+		}
+		return apperror.NewUnauthorizedR(ErrMsgTooManyMFAFailures)
+	}
+	return apperror.NewBadRequest("code", ErrMsgInvalidMFACode)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user and
+// returns the new ones. The codes cannot be retrieved afterward
+func (a *Accounts) RegenerateRecoveryCodes(q db.Queryable, u *User) ([]string, error) {
+	if u.IsZero() {
+		return nil, apperror.NewServerError("user has not been saved")
+	}
+
+	hasMFA, err := HasMFA(q, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasMFA {
+		return nil, apperror.NewPreconditionFailed("the user has no second factor")
+	}
+	return newRecoveryCodes(q, u.ID)
+}
+
+// DisableMFA removes the TOTP devices and the recovery codes of a user
+func (a *Accounts) DisableMFA(q db.Queryable, u *User) error {
+	if u.IsZero() {
+		return apperror.NewServerError("user has not been saved")
+	}
+
+	stmt := `UPDATE user_totp_devices
+					SET deleted_at = $1
+					WHERE user_id = $2
+						AND deleted_at IS NULL`
+	if _, err := q.Exec(stmt, datetime.Now(), u.ID); err != nil {
+		return apperror.NewFromSQL(err)
+	}
+
+	stmt = "DELETE FROM user_recovery_codes WHERE user_id = $1"
+	_, err := q.Exec(stmt, u.ID)
+	return apperror.NewFromSQL(err)
+}
+
+// newRecoveryCodes replaces the recovery codes of a user and returns
+// the new ones
+func newRecoveryCodes(q db.Queryable, userID string) ([]string, error) {
+	stmt := "DELETE FROM user_recovery_codes WHERE user_id = $1"
+	if _, err := q.Exec(stmt, userID); err != nil {
+		return nil, apperror.NewFromSQL(err)
+	}
+
+	stmt = `INSERT INTO user_recovery_codes
+		(id, created_at, user_id, hash, used_at)
+		VALUES (:id, :created_at, :user_id, :hash, :used_at)`
+	codes := make([]string, RecoveryCodesCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		rc := &RecoveryCode{
+			ID:        uuid.NewV4().String(),
+			CreatedAt: datetime.Now(),
+			UserID:    userID,
+			Hash:      hashSecret(normalizeRecoveryCode(code)),
+		}
+		if _, err := q.NamedExec(stmt, rc); err != nil {
+			return nil, apperror.NewFromSQL(err)
+		}
+		codes[i] = code
+	}
+	return codes, nil
+}
+
+// useRecoveryCode marks a recovery code of the user as used.
+// false is returned if the code doesn't exist or has already been used
+func useRecoveryCode(q db.Queryable, userID, code string) (bool, error) {
+	code = normalizeRecoveryCode(code)
+	if code == "" {
+		return false, nil
+	}
+
+	stmt := `UPDATE user_recovery_codes
+					SET used_at = $1
+					WHERE user_id = $2
+						AND hash = $3
+						AND used_at IS NULL`
+	affected, err := q.Exec(stmt, datetime.Now(), userID, hashSecret(code))
+	if err != nil {
+		return false, apperror.NewFromSQL(err)
+	}
+	return affected > 0, nil
+}
+
+// newRecoveryCode returns a random recovery code formatted as xxxxx-xxxxx
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(base32.StdEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeRecoveryCode removes the formatting of a recovery code
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
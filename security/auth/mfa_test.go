@@ -0,0 +1,270 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/security/auth"
+	"github.com/Nivl/go-rest-tools/security/auth/testauth"
+	"github.com/Nivl/go-rest-tools/security/auth/totp"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	"github.com/Nivl/go-sqldb/implementations/mocksqldb"
+	"github.com/Nivl/go-types/datetime"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// currentCode returns the TOTP code of the current time step
+func currentCode(t *testing.T, secret string) (string, int64) {
+	step := totp.Step(time.Now())
+	code, err := totp.Code(secret, step)
+	require.NoError(t, err)
+	return code, step
+}
+
+func TestEnrollTOTP(t *testing.T) {
+	user := testauth.NewUser()
+
+	t.Run("new enrollment", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetNotFound(&auth.TOTPDevice{})
+		mockDB.EXPECT().InsertSuccess(&auth.TOTPDevice{}).Do(func(stmt string, d *auth.TOTPDevice) {
+			assert.Nil(t, d.ConfirmedAt, "the device should not be confirmed")
+		})
+
+		secret, uri, err := newTestAccounts().EnrollTOTP(mockDB, user, "API")
+		require.NoError(t, err, "EnrollTOTP() should have succeed")
+		assert.NotEmpty(t, secret)
+		assert.Contains(t, uri, "secret="+secret)
+	})
+
+	t.Run("already enrolled", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetSuccess(&auth.TOTPDevice{}, nil)
+
+		_, _, err := newTestAccounts().EnrollTOTP(mockDB, user, "API")
+		assert.True(t, apperror.IsConflict(err), "expected a Conflict error")
+	})
+}
+
+func TestConfirmTOTP(t *testing.T) {
+	user, session := testauth.NewAuth()
+	secret, err := totp.NewSecret()
+	require.NoError(t, err)
+	device := &auth.TOTPDevice{ID: "device-id", UserID: user.ID, Secret: secret}
+
+	t.Run("valid code", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		code, step := currentCode(t, secret)
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetSuccess(&auth.TOTPDevice{}, func(d *auth.TOTPDevice, stmt, userID string) {
+			*d = *device
+		})
+		mockDB.EXPECT().Exec(gomock.Any(), step, gomock.Any(), device.ID).Return(int64(1), nil)
+		// the recovery codes should be replaced
+		mockDB.EXPECT().Exec(gomock.Any(), user.ID).Return(int64(0), nil)
+		mockDB.EXPECT().InsertSuccess(&auth.RecoveryCode{}).Times(auth.RecoveryCodesCount)
+		mockDB.EXPECT().Exec(gomock.Any(), auth.MFAVerified, session.ID).Return(int64(1), nil)
+
+		s := *session
+		codes, err := newTestAccounts().ConfirmTOTP(mockDB, user, &s, code)
+		require.NoError(t, err, "ConfirmTOTP() should have succeed")
+		assert.Len(t, codes, auth.RecoveryCodesCount)
+		assert.Regexp(t, "^[a-z2-7]{5}-[a-z2-7]{5}$", codes[0])
+		assert.NotEqual(t, codes[0], codes[1])
+		assert.Equal(t, auth.MFAVerified, s.MFAStatus)
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetSuccess(&auth.TOTPDevice{}, func(d *auth.TOTPDevice, stmt, userID string) {
+			*d = *device
+		})
+
+		_, err := newTestAccounts().ConfirmTOTP(mockDB, user, session, "abcdef")
+		require.True(t, apperror.IsBadRequest(err), "expected a BadRequest error")
+		assert.Equal(t, "code", apperror.Convert(err).Field())
+	})
+
+	t.Run("no pending enrollment", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetNotFound(&auth.TOTPDevice{})
+
+		_, err := newTestAccounts().ConfirmTOTP(mockDB, user, session, "123456")
+		assert.True(t, apperror.IsPreconditionFailed(err), "expected a PreconditionFailed error")
+	})
+}
+
+func TestVerifyMFA(t *testing.T) {
+	user := testauth.NewUser()
+	secret, err := totp.NewSecret()
+	require.NoError(t, err)
+	device := &auth.TOTPDevice{ID: "device-id", UserID: user.ID, Secret: secret}
+	newPendingSession := func() *auth.Session {
+		s := testauth.NewSession(user)
+		s.MFAStatus = auth.MFAPending
+		return s
+	}
+
+	t.Run("valid TOTP code", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		s := newPendingSession()
+		code, step := currentCode(t, secret)
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetSuccess(&auth.TOTPDevice{}, func(d *auth.TOTPDevice, stmt, userID string) {
+			*d = *device
+		})
+		mockDB.EXPECT().Exec(gomock.Any(), step, gomock.Any(), device.ID).Return(int64(1), nil)
+		mockDB.EXPECT().Exec(gomock.Any(), auth.MFAVerified, s.ID).Return(int64(1), nil)
+
+		err := newTestAccounts().VerifyMFA(mockDB, s, code)
+		require.NoError(t, err, "VerifyMFA() should have succeed")
+		assert.Equal(t, auth.MFAVerified, s.MFAStatus)
+	})
+
+	t.Run("replayed TOTP code", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		s := newPendingSession()
+		code, step := currentCode(t, secret)
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetSuccess(&auth.TOTPDevice{}, func(d *auth.TOTPDevice, stmt, userID string) {
+			*d = *device
+			d.LastUsedStep = step
+		})
+		// the code is then tried as a recovery code
+		mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), user.ID, gomock.Any()).Return(int64(0), nil)
+		expectMFAFailure(mockDB, s.ID, 1)
+
+		err := newTestAccounts().VerifyMFA(mockDB, s, code)
+		require.True(t, apperror.IsBadRequest(err), "expected a BadRequest error")
+		assert.Equal(t, auth.MFAPending, s.MFAStatus)
+		assert.Equal(t, 1, s.MFAFailures)
+	})
+
+	t.Run("too many invalid codes", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		s := newPendingSession()
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetSuccess(&auth.TOTPDevice{}, func(d *auth.TOTPDevice, stmt, userID string) {
+			*d = *device
+		})
+		mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), user.ID, gomock.Any()).Return(int64(0), nil)
+		expectMFAFailure(mockDB, s.ID, auth.MaxMFAFailures)
+		// the session should be revoked
+		mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), s.ID).Return(int64(1), nil)
+
+		err := newTestAccounts().VerifyMFA(mockDB, s, "not-a-code")
+		require.True(t, apperror.IsUnauthorized(err), "expected an Unauthorized error")
+		assert.Contains(t, err.Error(), auth.ErrMsgTooManyMFAFailures)
+		assert.NotNil(t, s.DeletedAt, "the session should have been revoked")
+	})
+
+	t.Run("invalid code with lockout", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		s := newPendingSession()
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		expectReservation(mockDB, "mfa:"+user.ID)
+		mockDB.EXPECT().GetSuccess(&auth.TOTPDevice{}, func(d *auth.TOTPDevice, stmt, userID string) {
+			*d = *device
+		})
+		mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), user.ID, gomock.Any()).Return(int64(0), nil)
+		expectFailure(mockDB, "mfa:"+user.ID, &auth.LoginAttempts{Failures: 1})
+		expectMFAFailure(mockDB, s.ID, 1)
+
+		a := newTestAccounts()
+		a.Lockout = auth.NewLockout(nil)
+		err := a.VerifyMFA(mockDB, s, "not-a-code")
+		require.True(t, apperror.IsBadRequest(err), "expected a BadRequest error")
+	})
+
+	t.Run("locked second factor", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetSuccess(&auth.TOTPDevice{}, func(d *auth.TOTPDevice, stmt, userID string) {
+			*d = *device
+		})
+		mockDB.EXPECT().GetID(&auth.LoginAttempts{}, "mfa:"+user.ID, func(la *auth.LoginAttempts, stmt, key string) {
+			la.LockedUntil = &datetime.DateTime{Time: time.Now().Add(time.Minute)}
+		})
+
+		a := newTestAccounts()
+		a.Lockout = auth.NewLockout(nil)
+		err := a.VerifyMFA(mockDB, newPendingSession(), "123456")
+		assert.True(t, apperror.IsLocked(err), "expected a Locked error")
+	})
+
+	t.Run("no device with lockout", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		// No attempt should be reserved
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetNotFound(&auth.TOTPDevice{})
+
+		a := newTestAccounts()
+		a.Lockout = auth.NewLockout(nil)
+		err := a.VerifyMFA(mockDB, newPendingSession(), "123456")
+		assert.True(t, apperror.IsPreconditionFailed(err), "expected a PreconditionFailed error")
+	})
+
+	t.Run("valid recovery code", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		s := newPendingSession()
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetSuccess(&auth.TOTPDevice{}, func(d *auth.TOTPDevice, stmt, userID string) {
+			*d = *device
+		})
+		mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), user.ID, gomock.Any()).Return(int64(1), nil)
+		mockDB.EXPECT().Exec(gomock.Any(), auth.MFAVerified, s.ID).Return(int64(1), nil)
+
+		err := newTestAccounts().VerifyMFA(mockDB, s, "ABCDE-FGHIJ")
+		require.NoError(t, err, "VerifyMFA() should have succeed")
+		assert.Equal(t, auth.MFAVerified, s.MFAStatus)
+	})
+
+	t.Run("session not pending", func(t *testing.T) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		err := newTestAccounts().VerifyMFA(mocksqldb.NewMockQueryable(mockCtrl), testauth.NewSession(user), "123456")
+		assert.True(t, apperror.IsPreconditionFailed(err), "expected a PreconditionFailed error")
+	})
+}
+
+// expectMFAFailure expects an invalid second factor to be recorded for
+// a session. failures is the updated count returned by the database
+func expectMFAFailure(mockDB *mocksqldb.MockQueryable, sessionID string, failures int) *gomock.Call {
+	return mockDB.EXPECT().
+		Get(gomock.Any(), gomock.Any(), sessionID).
+		Do(func(count *int, stmt string, args ...interface{}) {
+			*count = failures
+		}).
+		Return(nil)
+}
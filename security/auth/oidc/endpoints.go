@@ -0,0 +1,309 @@
+package oidc
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/request"
+	"github.com/Nivl/go-rest-tools/router"
+	"github.com/Nivl/go-rest-tools/router/guard"
+	"github.com/Nivl/go-rest-tools/security/auth"
+	"github.com/Nivl/go-rest-tools/security/auth/jwt"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	db "github.com/Nivl/go-sqldb"
+	"github.com/Nivl/go-types/datetime"
+)
+
+// StateCookieName contains the name of the cookie used to bind a login
+// to the browser that started it
+const StateCookieName = "oidc_state"
+
+const (
+	// ErrMsgInvalidState is the message returned when the state sent back
+	// by the provider doesn't match a login started by the client
+	ErrMsgInvalidState = "invalid or expired state"
+
+	// ErrMsgLoginFailed is the message returned when the provider didn't
+	// authenticate the user
+	ErrMsgLoginFailed = "could not sign in with the provider"
+
+	// ErrMsgNoAccount is the message returned when no user can be
+	// found for an identity, and the sign-up is disabled
+	ErrMsgNoAccount = "no account is linked to this identity"
+
+	// ErrMsgMissingEmail is the message returned when the provider didn't
+	// send the email address needed to create an account
+	ErrMsgMissingEmail = "the provider did not share an email address"
+
+	// ErrMsgEmailInUse is the message returned when an account that cannot
+	// be linked automatically already uses the email address of the
+	// identity
+	ErrMsgEmailInUse = "an account already uses this email address"
+)
+
+// Handlers implements the endpoints used to sign users in with a
+// provider. Once the user signed in, a regular auth.Session is created
+type Handlers struct {
+	// Provider contains the configuration of the provider
+	Provider *Provider
+
+	// DB is the connection used to store the logins, the users, and
+	// their sessions
+	DB db.Connection
+
+	// SignUp creates an account for the users that don't have one
+	SignUp bool
+
+	// LinkByEmail links a new identity to the user having the same email
+	// address, when the address has been verified by both the provider
+	// and the user
+	LinkByEmail bool
+}
+
+// LoginResponse represents the data sent back to the client once
+// the user signed in
+type LoginResponse struct {
+	User    *auth.PrivateUser    `json:"user"`
+	Session *auth.PrivateSession `json:"session"`
+}
+
+// callbackParams represents the params sent by the provider to the
+// callback endpoint
+type callbackParams struct {
+	Code        string `from:"query" json:"code"`
+	State       string `from:"query" json:"state" params:"required"`
+	Error       string `from:"query" json:"error"`
+	StateCookie string `from:"cookie" json:"oidc_state"`
+}
+
+// Endpoints returns the endpoints used to sign users in, mounted
+// under the provided path prefix:
+// GET {prefix}/login redirects the user to the provider, and
+// GET {prefix}/callback is the URL the provider redirects the user to.
+// The Provider.RedirectURL must point to the callback endpoint
+func (h *Handlers) Endpoints(prefix string) router.Endpoints {
+	return router.Endpoints{
+		{
+			Verb:    http.MethodGet,
+			Path:    prefix + "/login",
+			Handler: h.Login,
+			Summary: "Sign in with " + h.Provider.Name,
+			Response: &router.ResponseSpec{
+				Status:      http.StatusFound,
+				Description: "Redirects the user to the provider",
+			},
+		},
+		{
+			Verb:    http.MethodGet,
+			Path:    prefix + "/callback",
+			Handler: h.Callback,
+			Guard: &guard.Guard{
+				ParamStruct: &callbackParams{},
+			},
+			Summary: "Complete the sign in with " + h.Provider.Name,
+			Response: &router.ResponseSpec{
+				Description: "The user and their new session",
+				Body:        &LoginResponse{},
+			},
+		},
+	}
+}
+
+// Login starts a new login and redirects the user to the provider
+func (h *Handlers) Login(req request.Request) error {
+	ls, state, err := NewLoginState(h.DB, h.Provider.Name)
+	if err != nil {
+		return err
+	}
+	h.setStateCookie(req, state, LoginStateTTL)
+	req.Response().Redirect(h.Provider.AuthCodeURL(state, ls.Nonce, ls.CodeVerifier))
+	return nil
+}
+
+// Callback completes a login using the authorization code sent by the
+// provider, and creates a new session for the user.
+// The identity is linked to a user the first time it is used
+func (h *Handlers) Callback(req request.Request) error {
+	params := req.Params().(*callbackParams)
+
+	// The state can only be used once, whatever the result
+	h.setStateCookie(req, "", -1)
+	if params.StateCookie == "" || subtle.ConstantTimeCompare([]byte(params.StateCookie), []byte(params.State)) != 1 {
+		return apperror.NewBadRequest("state", ErrMsgInvalidState)
+	}
+	ls, err := ConsumeLoginState(h.DB, h.Provider.Name, params.State)
+	if err != nil {
+		if apperror.IsNotFound(err) {
+			return apperror.NewBadRequest("state", ErrMsgInvalidState)
+		}
+		return err
+	}
+
+	// The user denied the access, or the provider failed to
+	// authenticate them
+	if params.Error != "" || params.Code == "" {
+		return apperror.NewUnauthorizedR(ErrMsgLoginFailed)
+	}
+
+	idToken, err := h.Provider.Exchange(params.Code, ls.CodeVerifier)
+	if err != nil {
+		if err == ErrExchangeFailed {
+			return apperror.NewUnauthorizedR(ErrMsgLoginFailed)
+		}
+		return apperror.Wrap(err, apperror.Internal, "", "could not exchange the authorization code")
+	}
+	claims, err := h.Provider.VerifyIDToken(idToken, ls.Nonce)
+	if err != nil {
+		if isInvalidToken(err) {
+			return apperror.NewUnauthorizedR(ErrMsgLoginFailed)
+		}
+		return apperror.Wrap(err, apperror.Internal, "", "could not verify the id token")
+	}
+
+	u, s, err := h.signIn(claims)
+	if err != nil {
+		return err
+	}
+	return req.Response().Ok(&LoginResponse{
+		User:    u.ExportPrivate(),
+		Session: s.ExportPrivate(),
+	})
+}
+
+// signIn returns the user matching the claims of an ID token with a
+// new session
+func (h *Handlers) signIn(claims *IDTokenClaims) (u *auth.User, s *auth.Session, err error) {
+	tx, err := h.DB.Beginx()
+	if err != nil {
+		return nil, nil, apperror.NewFromSQL(err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	u, err = h.findUser(tx, claims)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err = auth.StartSession(tx, u)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, nil, apperror.NewFromSQL(err)
+	}
+	return u, s, nil
+}
+
+// findUser returns the user linked to the identity of an ID token.
+// The identity is linked to a user if it's the first time it's used
+func (h *Handlers) findUser(q db.Queryable, claims *IDTokenClaims) (*auth.User, error) {
+	ei, err := auth.GetExternalIdentity(q, h.Provider.Name, claims.Subject)
+	if err == nil {
+		u, err := auth.GetUserByID(q, ei.UserID)
+		if apperror.IsNotFound(err) {
+			return nil, apperror.NewUnauthorizedR(ErrMsgNoAccount)
+		}
+		return u, err
+	}
+	if !apperror.IsNotFound(err) {
+		return nil, err
+	}
+
+	u, err := h.newIdentityUser(q, claims)
+	if err != nil {
+		return nil, err
+	}
+	ei = &auth.ExternalIdentity{
+		UserID:   u.ID,
+		Provider: h.Provider.Name,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+	}
+	return u, ei.Create(q)
+}
+
+// newIdentityUser returns the user a new identity should be linked to.
+// The user is created if needed
+func (h *Handlers) newIdentityUser(q db.Queryable, claims *IDTokenClaims) (*auth.User, error) {
+	if claims.Email == "" {
+		return nil, apperror.NewUnauthorizedR(ErrMsgMissingEmail)
+	}
+
+	if h.LinkByEmail && claims.EmailVerified {
+		u, err := auth.GetUserByEmail(q, claims.Email)
+		if err == nil {
+			// Anybody can create an account with an email they don't own,
+			// so we only trust the accounts that have been verified
+			if !u.IsEmailVerified() {
+				return nil, apperror.NewConflictR("email", ErrMsgEmailInUse)
+			}
+			return u, nil
+		}
+		if !apperror.IsNotFound(err) {
+			return nil, err
+		}
+	}
+
+	if !h.SignUp {
+		return nil, apperror.NewUnauthorizedR(ErrMsgNoAccount)
+	}
+	u := &auth.User{
+		Name:  claims.Name,
+		Email: claims.Email,
+	}
+	if claims.EmailVerified {
+		u.EmailVerifiedAt = datetime.Now()
+	}
+	return u, u.Create(q)
+}
+
+// setStateCookie sets the cookie binding a login to the browser of
+// the user. A negative ttl removes the cookie
+func (h *Handlers) setStateCookie(req request.Request, state string, ttl time.Duration) {
+	path := "/"
+	secure := false
+	if u, err := url.Parse(h.Provider.RedirectURL); err == nil {
+		if u.Path != "" {
+			path = u.Path
+		}
+		secure = u.Scheme == "https"
+	}
+
+	maxAge := int(ttl.Seconds())
+	if ttl < 0 {
+		maxAge = -1
+	}
+	cookie := &http.Cookie{
+		Name:     StateCookieName,
+		Value:    state,
+		Path:     path,
+		MaxAge:   maxAge,
+		Secure:   secure,
+		HttpOnly: true,
+		// The cookie has to be sent when the provider redirects the user
+		// to the callback
+		SameSite: http.SameSiteLaxMode,
+	}
+	req.Response().Header().Add("Set-Cookie", cookie.String())
+}
+
+// isInvalidToken checks if an error returned by VerifyIDToken() is caused
+// by the token itself
+func isInvalidToken(err error) bool {
+	switch err {
+	case ErrInvalidIDToken,
+		jwt.ErrMalformed,
+		jwt.ErrInvalidSignature,
+		jwt.ErrAlgorithmMismatch,
+		jwt.ErrExpired,
+		jwt.ErrNotValidYet,
+		jwt.ErrUnknownKey:
+		return true
+	}
+	return false
+}
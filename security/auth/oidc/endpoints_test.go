@@ -0,0 +1,404 @@
+package oidc_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	logger "github.com/Nivl/go-logger"
+	reporter "github.com/Nivl/go-reporter"
+	"github.com/Nivl/go-rest-tools/router"
+	"github.com/Nivl/go-rest-tools/security/auth"
+	"github.com/Nivl/go-rest-tools/security/auth/jwt"
+	"github.com/Nivl/go-rest-tools/security/auth/oidc"
+	"github.com/Nivl/go-rest-tools/security/auth/testauth"
+	db "github.com/Nivl/go-sqldb"
+	"github.com/Nivl/go-sqldb/implementations/mocksqldb"
+	"github.com/Nivl/go-types/datetime"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// noopReporter is a reporter that does nothing
+type noopReporter struct{}
+
+func (r *noopReporter) SetUser(u *reporter.User)       {}
+func (r *noopReporter) AddTag(key, value string)       {}
+func (r *noopReporter) AddTags(tags map[string]string) {}
+func (r *noopReporter) ReportError(err error)          {}
+func (r *noopReporter) ReportErrorAndWait(err error)   {}
+
+// testDeps is an implementation of router.Dependencies that does not
+// need any external services
+type testDeps struct{}
+
+func (d *testDeps) NewLogger() (logger.Logger, error)       { return nil, nil }
+func (d *testDeps) NewReporter() (reporter.Reporter, error) { return &noopReporter{}, nil }
+func (d *testDeps) DB() db.Connection                       { return nil }
+
+// stubProvider is a local OpenID Connect provider exposing a token
+// endpoint and a JWKS endpoint
+type stubProvider struct {
+	*httptest.Server
+	key *jwt.EdDSA
+
+	// challenge and nonce contain the values sent to the authorization
+	// endpoint
+	challenge string
+	nonce     string
+
+	// claims contains the claims of the ID tokens returned by the
+	// token endpoint
+	claims *oidc.IDTokenClaims
+}
+
+const validCode = "valid-code"
+
+func newStubProvider(t *testing.T) *stubProvider {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	p := &stubProvider{key: &jwt.EdDSA{PrivateKey: priv}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		jwk, err := jwt.NewJWK(p.key, "key-1")
+		require.NoError(t, err)
+		json.NewEncoder(w).Encode(&jwt.JWKSet{Keys: []*jwt.JWK{jwk}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		if r.PostForm.Get("code") != validCode ||
+			r.PostForm.Get("client_id") != "client-id" ||
+			oidc.CodeChallenge(r.PostForm.Get("code_verifier")) != p.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		token, err := jwt.Encode(p.claims, p.key, "key-1")
+		require.NoError(t, err)
+		json.NewEncoder(w).Encode(map[string]string{"id_token": token})
+	})
+	p.Server = httptest.NewServer(mux)
+
+	p.claims = &oidc.IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    p.URL,
+			Subject:   "subject",
+			Audience:  jwt.Audience{"client-id"},
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+		Email:         "user@domain.tld",
+		EmailVerified: true,
+		Name:          "user",
+	}
+	return p
+}
+
+// newHandlers returns Handlers configured to use the stub provider
+func (p *stubProvider) newHandlers(con db.Connection) *oidc.Handlers {
+	return &oidc.Handlers{
+		DB: con,
+		Provider: &oidc.Provider{
+			Name:        "stub",
+			Issuer:      p.URL,
+			ClientID:    "client-id",
+			AuthURL:     p.URL + "/authorize",
+			TokenURL:    p.URL + "/token",
+			JWKSURL:     p.URL + "/jwks",
+			RedirectURL: "https://api.domain.tld/auth/stub/callback",
+		},
+	}
+}
+
+// login starts a login and returns the state sent to the provider, the
+// state cookie, and the login saved in the database
+func (p *stubProvider) login(t *testing.T, h *oidc.Handlers) (string, *http.Cookie, *oidc.LoginState) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	saved := &oidc.LoginState{}
+	mockDB := mocksqldb.NewMockConnection(mockCtrl)
+	mockDB.QEXPECT().InsertSuccess(&oidc.LoginState{}).Do(func(stmt string, ls *oidc.LoginState) {
+		*saved = *ls
+	})
+	h.DB = mockDB
+
+	rec := httptest.NewRecorder()
+	e := h.Endpoints("/auth/stub")[0]
+	router.Handler(e, &testDeps{}).ServeHTTP(rec, httptest.NewRequest("GET", "/auth/stub/login", nil))
+	require.Equal(t, http.StatusFound, rec.Code)
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	require.NoError(t, err)
+	query := location.Query()
+	assert.Equal(t, "/authorize", location.Path)
+	assert.Equal(t, "code", query.Get("response_type"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.Equal(t, saved.Nonce, query.Get("nonce"))
+	p.challenge = query.Get("code_challenge")
+	p.nonce = query.Get("nonce")
+
+	cookies := rec.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, oidc.StateCookieName, cookies[0].Name)
+	assert.Equal(t, query.Get("state"), cookies[0].Value)
+	assert.True(t, cookies[0].HttpOnly)
+	assert.True(t, cookies[0].Secure)
+	assert.Equal(t, "/auth/stub/callback", cookies[0].Path)
+	return query.Get("state"), cookies[0], saved
+}
+
+// callback calls the callback endpoint as the provider would
+func callback(h *oidc.Handlers, query url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", "/auth/stub/callback?"+query.Encode(), nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	router.Handler(h.Endpoints("/auth/stub")[1], &testDeps{}).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCallback(t *testing.T) {
+	p := newStubProvider(t)
+	defer p.Close()
+
+	user := testauth.NewUser()
+	user.EmailVerifiedAt = datetime.Now()
+
+	testCases := []struct {
+		description string
+		signUp      bool
+		linkByEmail bool
+		expectedID  string
+		setup       func(tx *mocksqldb.MockTx)
+	}{
+		{
+			"linked identity", false, false, user.ID,
+			func(tx *mocksqldb.MockTx) {
+				tx.QEXPECT().GetSuccess(&auth.ExternalIdentity{}, func(ei *auth.ExternalIdentity, stmt, provider, subject string) {
+					assert.Equal(t, "stub", provider)
+					assert.Equal(t, "subject", subject)
+					ei.UserID = user.ID
+				})
+				tx.QEXPECT().GetID(&auth.User{}, user.ID, func(u *auth.User, stmt, id string) {
+					*u = *user
+				})
+			},
+		},
+		{
+			"link by email", false, true, user.ID,
+			func(tx *mocksqldb.MockTx) {
+				tx.QEXPECT().GetNotFound(&auth.ExternalIdentity{})
+				tx.QEXPECT().GetSuccess(&auth.User{}, func(u *auth.User, stmt, email string) {
+					*u = *user
+				})
+				tx.QEXPECT().InsertSuccess(&auth.ExternalIdentity{}).Do(func(stmt string, ei *auth.ExternalIdentity) {
+					assert.Equal(t, user.ID, ei.UserID)
+				})
+			},
+		},
+		{
+			"sign up", true, false, "",
+			func(tx *mocksqldb.MockTx) {
+				tx.QEXPECT().GetNotFound(&auth.ExternalIdentity{})
+				tx.QEXPECT().InsertSuccess(&auth.User{}).Do(func(stmt string, u *auth.User) {
+					assert.Equal(t, "user@domain.tld", u.Email)
+					assert.True(t, u.IsEmailVerified(), "the email should be verified")
+				})
+				tx.QEXPECT().InsertSuccess(&auth.ExternalIdentity{})
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			h := p.newHandlers(nil)
+			h.SignUp = tc.signUp
+			h.LinkByEmail = tc.linkByEmail
+			state, cookie, saved := p.login(t, h)
+			p.claims.Nonce = p.nonce
+
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			mockDB := mocksqldb.NewMockConnection(mockCtrl)
+			mockDB.QEXPECT().GetSuccess(&oidc.LoginState{}, func(ls *oidc.LoginState, stmt, id, provider string) {
+				assert.Equal(t, saved.ID, id)
+				*ls = *saved
+			})
+			tx, _ := mockDB.EXPECT().TransactionSuccess(mockCtrl)
+			tc.setup(tx)
+			tx.QEXPECT().GetNotFound(&auth.TOTPDevice{})
+			tx.QEXPECT().InsertSuccess(&auth.Session{})
+			tx.EXPECT().CommitSuccess()
+			h.DB = mockDB
+
+			rec := callback(h, url.Values{"code": {validCode}, "state": {state}}, cookie)
+			require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+
+			var body oidc.LoginResponse
+			require.NoError(t, json.NewDecoder(rec.Body).Decode(&body))
+			assert.NotEmpty(t, body.Session.ID)
+			assert.Equal(t, body.User.ID, body.Session.UserID)
+			if tc.expectedID != "" {
+				assert.Equal(t, tc.expectedID, body.User.ID)
+			}
+
+			// The state cookie should be removed
+			cookies := rec.Result().Cookies()
+			require.Len(t, cookies, 1)
+			assert.Equal(t, oidc.StateCookieName, cookies[0].Name)
+			assert.True(t, cookies[0].MaxAge < 0)
+		})
+	}
+}
+
+func TestCallbackFailures(t *testing.T) {
+	p := newStubProvider(t)
+	defer p.Close()
+
+	unverifiedUser := testauth.NewUser()
+
+	testCases := []struct {
+		description  string
+		query        func(state string) url.Values
+		noCookie     bool
+		update       func(c *oidc.IDTokenClaims)
+		setup        func(tx *mocksqldb.MockTx)
+		expectedCode int
+	}{
+		{
+			description:  "missing cookie",
+			noCookie:     true,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description: "state of another login",
+			query: func(state string) url.Values {
+				return url.Values{"code": {validCode}, "state": {"other-state"}}
+			},
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			description: "access denied",
+			query: func(state string) url.Values {
+				return url.Values{"error": {"access_denied"}, "state": {state}}
+			},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			description: "invalid code",
+			query: func(state string) url.Values {
+				return url.Values{"code": {"invalid"}, "state": {state}}
+			},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			description:  "wrong nonce",
+			update:       func(c *oidc.IDTokenClaims) { c.Nonce = "other-nonce" },
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			description:  "wrong audience",
+			update:       func(c *oidc.IDTokenClaims) { c.Audience = jwt.Audience{"other-client"} },
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			description:  "expired token",
+			update:       func(c *oidc.IDTokenClaims) { c.ExpiresAt = time.Now().Add(-time.Hour).Unix() },
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			description: "unknown identity",
+			setup: func(tx *mocksqldb.MockTx) {
+				tx.QEXPECT().GetNotFound(&auth.ExternalIdentity{})
+				tx.QEXPECT().GetNotFound(&auth.User{})
+				tx.EXPECT().RollbackSuccess()
+			},
+			expectedCode: http.StatusUnauthorized,
+		},
+		{
+			description: "unverified account with the same email",
+			setup: func(tx *mocksqldb.MockTx) {
+				tx.QEXPECT().GetNotFound(&auth.ExternalIdentity{})
+				tx.QEXPECT().GetSuccess(&auth.User{}, func(u *auth.User, stmt, email string) {
+					*u = *unverifiedUser
+				})
+				tx.EXPECT().RollbackSuccess()
+			},
+			expectedCode: http.StatusConflict,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			h := p.newHandlers(nil)
+			h.LinkByEmail = true
+			state, cookie, saved := p.login(t, h)
+			p.claims.Nonce = p.nonce
+			p.claims.Audience = jwt.Audience{"client-id"}
+			p.claims.ExpiresAt = time.Now().Add(time.Hour).Unix()
+			if tc.update != nil {
+				tc.update(p.claims)
+			}
+
+			mockCtrl := gomock.NewController(t)
+			defer mockCtrl.Finish()
+
+			query := url.Values{"code": {validCode}, "state": {state}}
+			if tc.query != nil {
+				query = tc.query(state)
+			}
+			if tc.noCookie {
+				cookie = nil
+			}
+
+			mockDB := mocksqldb.NewMockConnection(mockCtrl)
+			// The login should only be consumed if the state is bound to
+			// the client
+			if !tc.noCookie && query.Get("state") == state {
+				mockDB.QEXPECT().GetSuccess(&oidc.LoginState{}, func(ls *oidc.LoginState, stmt, id, provider string) {
+					*ls = *saved
+				})
+			}
+			if tc.setup != nil {
+				tx, _ := mockDB.EXPECT().TransactionSuccess(mockCtrl)
+				tc.setup(tx)
+			}
+			h.DB = mockDB
+
+			rec := callback(h, query, cookie)
+			assert.Equal(t, tc.expectedCode, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestCallbackExpiredState(t *testing.T) {
+	p := newStubProvider(t)
+	defer p.Close()
+
+	h := p.newHandlers(nil)
+	state, cookie, saved := p.login(t, h)
+
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDB := mocksqldb.NewMockConnection(mockCtrl)
+	mockDB.QEXPECT().GetSuccess(&oidc.LoginState{}, func(ls *oidc.LoginState, stmt, id, provider string) {
+		*ls = *saved
+		ls.ExpiresAt = &datetime.DateTime{Time: time.Now().Add(-time.Minute)}
+	})
+	h.DB = mockDB
+
+	rec := callback(h, url.Values{"code": {validCode}, "state": {state}}, cookie)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,120 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	db "github.com/Nivl/go-sqldb"
+	"github.com/Nivl/go-types/datetime"
+)
+
+// LoginStateTTL is the amount of time a user has to sign in with the
+// provider once a login has been started
+var LoginStateTTL = 10 * time.Minute
+
+// LoginState is a structure representing a login started with a provider,
+// that can be saved in the database until the provider redirects the
+// user back. The ID is the hash of the "state" sent to the provider.
+// A state can only be used once.
+// The logins are stored in a table named oidc_login_states:
+//
+//	CREATE TABLE oidc_login_states (
+//	  id VARCHAR PRIMARY KEY,
+//	  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  provider VARCHAR NOT NULL,
+//	  nonce VARCHAR NOT NULL,
+//	  code_verifier VARCHAR NOT NULL
+//	);
+type LoginState struct {
+	ID        string             `db:"id"`
+	CreatedAt *datetime.DateTime `db:"created_at"`
+	ExpiresAt *datetime.DateTime `db:"expires_at"`
+
+	Provider     string `db:"provider"`
+	Nonce        string `db:"nonce"`
+	CodeVerifier string `db:"code_verifier"`
+}
+
+// NewLoginState creates and persists a new login, and returns it with
+// the state to send to the provider
+func NewLoginState(q db.Queryable, provider string) (*LoginState, string, error) {
+	state, err := randomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	nonce, err := randomString(32)
+	if err != nil {
+		return nil, "", err
+	}
+	// RFC 7636 requires between 43 and 128 chars
+	verifier, err := randomString(48)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ls := &LoginState{
+		ID:           hashState(state),
+		CreatedAt:    datetime.Now(),
+		ExpiresAt:    &datetime.DateTime{Time: time.Now().Add(LoginStateTTL).UTC()},
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+	}
+	stmt := `INSERT INTO oidc_login_states
+		(id, created_at, expires_at, provider, nonce, code_verifier)
+		VALUES (:id, :created_at, :expires_at, :provider, :nonce, :code_verifier)`
+	if _, err := q.NamedExec(stmt, ls); err != nil {
+		return nil, "", apperror.NewFromSQL(err)
+	}
+	return ls, state, nil
+}
+
+// ConsumeLoginState finds, deletes, and returns the login matching
+// a state. A NotFound error is returned if the state doesn't exist,
+// has already been used, or has expired
+func ConsumeLoginState(q db.Queryable, provider, state string) (*LoginState, error) {
+	ls := &LoginState{}
+	stmt := `DELETE FROM oidc_login_states
+					WHERE id=$1 AND provider=$2
+					RETURNING *`
+	if err := q.Get(ls, stmt, hashState(state), provider); err != nil {
+		return nil, apperror.NewFromSQL(err)
+	}
+	if ls.IsExpired() {
+		return nil, apperror.NewNotFound()
+	}
+	return ls, nil
+}
+
+// DeleteExpiredLoginStates removes the logins that have expired
+func DeleteExpiredLoginStates(q db.Queryable) error {
+	stmt := "DELETE FROM oidc_login_states WHERE expires_at <= $1"
+	_, err := q.Exec(stmt, datetime.Now())
+	return apperror.NewFromSQL(err)
+}
+
+// IsExpired checks if the login has expired
+func (ls *LoginState) IsExpired() bool {
+	return ls.ExpiresAt == nil || !ls.ExpiresAt.After(time.Now())
+}
+
+// hashState returns the hash of a state, ready to be stored in
+// the database
+func hashState(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomString returns a random URL-safe string generated from size bytes
+func randomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,191 @@
+// Package oidc contains the endpoints used to sign users in through
+// an external OpenID Connect provider, using the authorization code flow
+// with PKCE
+package oidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/Nivl/go-rest-tools/security/auth/jwt"
+)
+
+var (
+	// ErrInvalidIDToken is returned when an ID token has not been issued
+	// by the provider for the client, or for the current login
+	ErrInvalidIDToken = errors.New("invalid id token")
+
+	// ErrExchangeFailed is returned when the provider rejected an
+	// authorization code
+	ErrExchangeFailed = errors.New("the provider rejected the authorization code")
+)
+
+// DefaultScopes contains the scopes requested when a provider doesn't
+// specify any
+var DefaultScopes = []string{"openid", "email", "profile"}
+
+// defaultClient is the client used by the providers that have no
+// HTTPClient
+var defaultClient = &http.Client{Timeout: jwt.DefaultFetchTimeout}
+
+// Provider represents the configuration of an OpenID Connect provider
+type Provider struct {
+	// Name identifies the provider (ex. "google"). It is stored with the
+	// identities linked to the users and should never change
+	Name string
+
+	// Issuer contains the expected value of the "iss" claim of the
+	// ID tokens
+	Issuer string
+
+	// ClientID and ClientSecret contain the credentials of the client
+	// registered with the provider
+	ClientID     string
+	ClientSecret string
+
+	// AuthURL, TokenURL, and JWKSURL contain the URLs of the
+	// authorization endpoint, the token endpoint, and the JWKS endpoint
+	// of the provider
+	AuthURL  string
+	TokenURL string
+	JWKSURL  string
+
+	// RedirectURL contains the URL of the callback endpoint, as
+	// registered with the provider
+	RedirectURL string
+
+	// Scopes contains the scopes to request. Default to DefaultScopes
+	Scopes []string
+
+	// HTTPClient is the client used to call the provider.
+	// Default to a client timing out after jwt.DefaultFetchTimeout
+	HTTPClient *http.Client
+
+	keysOnce sync.Once
+	keys     *jwt.RemoteKeySet
+}
+
+// IDTokenClaims represents the claims of an ID token we care about
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+}
+
+// AuthCodeURL returns the URL of the authorization endpoint the user
+// should be redirected to
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	scopes := p.Scopes
+	if len(scopes) == 0 {
+		scopes = DefaultScopes
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.ClientID)
+	params.Set("redirect_uri", p.RedirectURL)
+	params.Set("scope", strings.Join(scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", CodeChallenge(codeVerifier))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.AuthURL, "?") {
+		separator = "&"
+	}
+	return p.AuthURL + separator + params.Encode()
+}
+
+// Exchange sends an authorization code to the token endpoint and returns
+// the ID token sent back by the provider.
+// ErrExchangeFailed is returned if the provider rejected the code
+func (p *Provider) Exchange(code, codeVerifier string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("client_secret", p.ClientSecret)
+	form.Set("code_verifier", codeVerifier)
+
+	res, err := p.httpClient().PostForm(p.TokenURL, form)
+	if err != nil {
+		return "", fmt.Errorf("could not reach the token endpoint: %w", err)
+	}
+	defer res.Body.Close()
+
+	// The provider returns a 400 when the code is invalid, expired, or
+	// has already been used
+	if res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusUnauthorized {
+		return "", ErrExchangeFailed
+	}
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status from the token endpoint: %d", res.StatusCode)
+	}
+
+	body := struct {
+		IDToken string `json:"id_token"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("could not decode the response of the token endpoint: %w", err)
+	}
+	if body.IDToken == "" {
+		return "", ErrExchangeFailed
+	}
+	return body.IDToken, nil
+}
+
+// VerifyIDToken verifies the signature of an ID token using the keys
+// of the provider, and checks that it has been issued for the client
+// and the login identified by nonce
+func (p *Provider) VerifyIDToken(token, nonce string) (*IDTokenClaims, error) {
+	claims := &IDTokenClaims{}
+	if _, err := jwt.Decode(token, p.keySet().KeyFunc, claims); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case claims.Issuer != p.Issuer,
+		!claims.Audience.Contains(p.ClientID),
+		claims.ExpiresAt == 0,
+		claims.Subject == "",
+		nonce == "" || claims.Nonce != nonce:
+		return nil, ErrInvalidIDToken
+	}
+	return claims, nil
+}
+
+// keySet returns the keys used by the provider to sign its ID tokens
+func (p *Provider) keySet() *jwt.RemoteKeySet {
+	p.keysOnce.Do(func() {
+		p.keys = jwt.NewRemoteKeySet(p.JWKSURL)
+		p.keys.Client = p.HTTPClient
+	})
+	return p.keys
+}
+
+// httpClient returns the client used to call the provider
+func (p *Provider) httpClient() *http.Client {
+	if p.HTTPClient != nil {
+		return p.HTTPClient
+	}
+	return defaultClient
+}
+
+// CodeChallenge returns the S256 PKCE challenge of a code verifier
+// (RFC 7636)
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	db "github.com/Nivl/go-sqldb"
+	"github.com/Nivl/go-types/datetime"
+	uuid "github.com/satori/go.uuid"
+)
+
+// RefreshToken is a structure representing a refresh token that can be saved
+// in the database. Only the hash of the secret part of the token is stored.
+// All the refresh tokens of a session belong to the same family: once a
+// token has been used, it is replaced by a new one of the same family.
+// The tokens are stored in a table named user_refresh_tokens:
+//
+//	CREATE TABLE user_refresh_tokens (
+//	  id UUID PRIMARY KEY,
+//	  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  deleted_at TIMESTAMP WITH TIME ZONE,
+//	  user_id UUID NOT NULL,
+//	  session_id UUID NOT NULL,
+//	  hash VARCHAR NOT NULL,
+//	  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  used_at TIMESTAMP WITH TIME ZONE
+//	);
+type RefreshToken struct {
+	ID        string             `db:"id"`
+	CreatedAt *datetime.DateTime `db:"created_at"`
+	UpdatedAt *datetime.DateTime `db:"updated_at"`
+	DeletedAt *datetime.DateTime `db:"deleted_at"`
+
+	UserID    string             `db:"user_id"`
+	SessionID string             `db:"session_id"`
+	Hash      string             `db:"hash"`
+	ExpiresAt *datetime.DateTime `db:"expires_at"`
+	UsedAt    *datetime.DateTime `db:"used_at"`
+}
+
+// GetAnyRefreshTokenByID finds and returns a refresh token by ID.
+// Deleted tokens are returned
+func GetAnyRefreshTokenByID(q db.Queryable, id string) (*RefreshToken, error) {
+	rt := &RefreshToken{}
+	if !isValidID(id) {
+		return rt, apperror.NewNotFound()
+	}
+	stmt := "SELECT * from user_refresh_tokens WHERE id=$1 LIMIT 1"
+	err := q.Get(rt, stmt, id)
+	return rt, apperror.NewFromSQL(err)
+}
+
+// Create persists a refresh token in the database and returns the token
+// to send to the client. The token cannot be retrieved afterward
+func (rt *RefreshToken) Create(q db.Queryable) (string, error) {
+	if rt == nil {
+		return "", apperror.NewServerError("refresh token is nil")
+	}
+
+	if rt.ID != "" {
+		return "", apperror.NewServerError("refresh tokens cannot be updated")
+	}
+
+	if rt.UserID == "" || rt.SessionID == "" {
+		return "", apperror.NewServerError("cannot save a refresh token with no user id or session id")
+	}
+
+	secret, err := newSecret(32)
+	if err != nil {
+		return "", err
+	}
+
+	rt.ID = uuid.NewV4().String()
+	rt.Hash = hashSecret(secret)
+	rt.UpdatedAt = datetime.Now()
+	if rt.CreatedAt == nil {
+		rt.CreatedAt = datetime.Now()
+	}
+
+	stmt := `INSERT INTO user_refresh_tokens
+		(id, created_at, updated_at, deleted_at, user_id, session_id, hash, expires_at, used_at)
+		VALUES (:id, :created_at, :updated_at, :deleted_at, :user_id, :session_id, :hash, :expires_at, :used_at)`
+	if _, err := q.NamedExec(stmt, rt); err != nil {
+		return "", apperror.NewFromSQL(err)
+	}
+	return rt.ID + "." + secret, nil
+}
+
+// IsExpired checks if the token has expired
+func (rt *RefreshToken) IsExpired() bool {
+	return rt.ExpiresAt != nil && !rt.ExpiresAt.After(time.Now())
+}
+
+// markUsed flags the token as used. false is returned if the token
+// has already been used
+func (rt *RefreshToken) markUsed(q db.Queryable) (bool, error) {
+	rt.UsedAt = datetime.Now()
+	rt.UpdatedAt = rt.UsedAt
+
+	stmt := `UPDATE user_refresh_tokens
+					SET used_at=$1, updated_at=$1
+					WHERE id=$2
+						AND used_at IS NULL`
+	affected, err := q.Exec(stmt, rt.UsedAt, rt.ID)
+	if err != nil {
+		return false, apperror.NewFromSQL(err)
+	}
+	return affected > 0, nil
+}
+
+// reused revokes the whole family of the token, as well as the session
+// it belongs to, and returns the error to send to the client
+func (rt *RefreshToken) reused(q db.Queryable) error {
+	now := datetime.Now()
+
+	stmt := `UPDATE user_refresh_tokens
+					SET deleted_at=$1
+					WHERE session_id=$2
+						AND deleted_at IS NULL`
+	if _, err := q.Exec(stmt, now, rt.SessionID); err != nil {
+		return apperror.NewFromSQL(err)
+	}
+
+	session := &Session{ID: rt.SessionID}
+	if err := session.Revoke(q); err != nil {
+		return err
+	}
+
+	return apperror.NewUnauthorizedR(ErrMsgTokenReused)
+}
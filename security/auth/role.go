@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	db "github.com/Nivl/go-sqldb"
+	"github.com/Nivl/go-types/datetime"
+)
+
+// PermissionWildcard is used to grant all the permissions of a scope.
+// Ex. "articles:*" grants "articles:write" and "articles:read",
+// "*" grants everything.
+const PermissionWildcard = "*"
+
+// GetUserRoles returns the roles attached to a user.
+// The roles of the users are stored in a table named user_roles:
+//
+//	CREATE TABLE user_roles (
+//	  user_id UUID NOT NULL,
+//	  role VARCHAR NOT NULL,
+//	  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  PRIMARY KEY (user_id, role)
+//	);
+func GetUserRoles(q db.Queryable, userID string) ([]string, error) {
+	roles := []string{}
+	stmt := `SELECT role
+					FROM user_roles
+					WHERE user_id = $1
+					ORDER BY role`
+	err := q.Select(&roles, stmt, userID)
+	return roles, apperror.NewFromSQL(err)
+}
+
+// GetUserPermissions returns all the permissions granted to a user
+// through their roles.
+// The permissions of the roles are stored in a table named
+// role_permissions:
+//
+//	CREATE TABLE role_permissions (
+//	  role VARCHAR NOT NULL,
+//	  permission VARCHAR NOT NULL,
+//	  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  PRIMARY KEY (role, permission)
+//	);
+func GetUserPermissions(q db.Queryable, userID string) ([]string, error) {
+	perms := []string{}
+	stmt := `SELECT DISTINCT rp.permission
+					FROM role_permissions rp
+					JOIN user_roles ur
+						ON ur.role = rp.role
+					WHERE ur.user_id = $1
+					ORDER BY rp.permission`
+	err := q.Select(&perms, stmt, userID)
+	return perms, apperror.NewFromSQL(err)
+}
+
+// AddUserRole attaches a role to a user. Nothing happens if the user
+// already has the role
+func AddUserRole(q db.Queryable, userID, role string) error {
+	stmt := `INSERT INTO user_roles (user_id, role, created_at)
+					VALUES ($1, $2, $3)
+					ON CONFLICT DO NOTHING`
+	_, err := q.Exec(stmt, userID, role, datetime.Now())
+	return apperror.NewFromSQL(err)
+}
+
+// RemoveUserRole removes a role from a user
+func RemoveUserRole(q db.Queryable, userID, role string) error {
+	stmt := "DELETE FROM user_roles WHERE user_id=$1 AND role=$2"
+	_, err := q.Exec(stmt, userID, role)
+	return apperror.NewFromSQL(err)
+}
+
+// AddRolePermission grants a permission to a role. Nothing happens if
+// the role already has the permission
+func AddRolePermission(q db.Queryable, role, permission string) error {
+	stmt := `INSERT INTO role_permissions (role, permission, created_at)
+					VALUES ($1, $2, $3)
+					ON CONFLICT DO NOTHING`
+	_, err := q.Exec(stmt, role, permission, datetime.Now())
+	return apperror.NewFromSQL(err)
+}
+
+// RemoveRolePermission removes a permission from a role
+func RemoveRolePermission(q db.Queryable, role, permission string) error {
+	stmt := "DELETE FROM role_permissions WHERE role=$1 AND permission=$2"
+	_, err := q.Exec(stmt, role, permission)
+	return apperror.NewFromSQL(err)
+}
+
+// LoadPermissions retrieves the roles and permissions of the user and
+// attaches them to the object
+func (u *User) LoadPermissions(q db.Queryable) error {
+	if u.IsZero() {
+		return apperror.NewServerError("user has not been saved")
+	}
+
+	roles, err := GetUserRoles(q, u.ID)
+	if err != nil {
+		return err
+	}
+	perms, err := GetUserPermissions(q, u.ID)
+	if err != nil {
+		return err
+	}
+
+	u.Roles = roles
+	u.Permissions = perms
+	return nil
+}
+
+// HasRole checks if the user has the given role
+// Works on nil object
+func (u *User) HasRole(role string) bool {
+	if !u.IsLogged() {
+		return false
+	}
+	for _, r := range u.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasPermission checks if the user has been granted the given permission.
+// Admins have all the permissions
+// Works on nil object
+func (u *User) HasPermission(permission string) bool {
+	if !u.IsLogged() {
+		return false
+	}
+	if u.IsAdmin {
+		return true
+	}
+	for _, p := range u.Permissions {
+		if permissionMatches(p, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// permissionMatches checks if a granted permission matches a wanted
+// permission, taking wildcards into account
+func permissionMatches(granted, wanted string) bool {
+	if granted == wanted || granted == PermissionWildcard {
+		return true
+	}
+	if strings.HasSuffix(granted, ":"+PermissionWildcard) {
+		scope := strings.TrimSuffix(granted, PermissionWildcard)
+		return strings.HasPrefix(wanted, scope)
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/Nivl/go-rest-tools/security/auth"
+	"github.com/Nivl/go-sqldb/implementations/mocksqldb"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserHasPermission(t *testing.T) {
+	testCases := []struct {
+		description string
+		user        *auth.User
+		permission  string
+		expected    bool
+	}{
+		{"nil user", nil, "articles:write", false},
+		{"no permissions", &auth.User{}, "articles:write", false},
+		{"exact match", &auth.User{Permissions: []string{"articles:write"}}, "articles:write", true},
+		{"other permission", &auth.User{Permissions: []string{"articles:read"}}, "articles:write", false},
+		{"scope wildcard", &auth.User{Permissions: []string{"articles:*"}}, "articles:write", true},
+		{"other scope wildcard", &auth.User{Permissions: []string{"users:*"}}, "articles:write", false},
+		{"global wildcard", &auth.User{Permissions: []string{"*"}}, "articles:write", true},
+		{"admin", &auth.User{IsAdmin: true}, "articles:write", true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, tc.user.HasPermission(tc.permission))
+		})
+	}
+}
+
+func TestUserHasRole(t *testing.T) {
+	var u *auth.User
+	assert.False(t, u.HasRole("editor"), "HasRole() should have returned false")
+
+	u = &auth.User{Roles: []string{"editor"}}
+	assert.True(t, u.HasRole("editor"), "HasRole() should have returned true")
+	assert.False(t, u.HasRole("admin"), "HasRole() should have returned false")
+}
+
+func TestUserLoadPermissions(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	u := &auth.User{ID: "user-id"}
+	mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+	mockDB.EXPECT().Select(gomock.Any(), gomock.Any(), u.ID).
+		Do(func(roles *[]string, stmt string, args ...interface{}) {
+			*roles = []string{"editor"}
+		}).
+		Return(nil)
+	mockDB.EXPECT().Select(gomock.Any(), gomock.Any(), u.ID).
+		Do(func(perms *[]string, stmt string, args ...interface{}) {
+			*perms = []string{"articles:write"}
+		}).
+		Return(nil)
+
+	err := u.LoadPermissions(mockDB)
+	require.NoError(t, err, "LoadPermissions() should not have failed")
+	assert.Equal(t, []string{"editor"}, u.Roles)
+	assert.Equal(t, []string{"articles:write"}, u.Permissions)
+}
+
+func TestUserRolesPersistence(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+	mockDB.EXPECT().Exec(gomock.Any(), "user-id", "editor", gomock.Any()).Return(int64(1), nil)
+	mockDB.EXPECT().Exec(gomock.Any(), "user-id", "editor").Return(int64(1), nil)
+	mockDB.EXPECT().Exec(gomock.Any(), "editor", "articles:write", gomock.Any()).Return(int64(1), nil)
+	mockDB.EXPECT().Exec(gomock.Any(), "editor", "articles:write").Return(int64(1), nil)
+
+	assert.NoError(t, auth.AddUserRole(mockDB, "user-id", "editor"))
+	assert.NoError(t, auth.RemoveUserRole(mockDB, "user-id", "editor"))
+	assert.NoError(t, auth.AddRolePermission(mockDB, "editor", "articles:write"))
+	assert.NoError(t, auth.RemoveRolePermission(mockDB, "editor", "articles:write"))
+}
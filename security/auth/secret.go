@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+// newSecret returns a random URL-safe string generated from size bytes
+func newSecret(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashSecret returns the hash of a secret, ready to be stored in
+// the database
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// secretMatches checks in constant time if a secret matches a hash
+func secretMatches(hash, secret string) bool {
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(hashSecret(secret))) == 1
+}
+
+// isValidID checks if an ID sent by a client is a UUID. Postgres
+// rejects the malformed UUIDs instead of not finding them, so the IDs
+// should be checked before being used in a query
+func isValidID(id string) bool {
+	if len(id) != 36 {
+		return false
+	}
+	_, err := uuid.FromString(id)
+	return err == nil
+}
@@ -2,24 +2,103 @@ package auth
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/Nivl/go-rest-tools/types/apperror"
 	db "github.com/Nivl/go-sqldb"
 	"github.com/Nivl/go-types/datetime"
 )
 
+var (
+	// SessionAbsoluteTTL is the maximum lifetime of a session, regardless of
+	// its activity. 0 means that sessions never expire
+	SessionAbsoluteTTL = 30 * 24 * time.Hour
+
+	// SessionIdleTTL is the maximum amount of time a session can stay
+	// unused. 0 means that sessions never expire
+	SessionIdleTTL = 7 * 24 * time.Hour
+
+	// SessionTouchInterval is the minimum amount of time between two
+	// updates of the activity of a session. It prevents writing in the
+	// database at every request
+	SessionTouchInterval = time.Minute
+)
+
 // Session is a structure representing a session that can be saved in the database
+// The ID of a session is used as a credential and should only be sent to
+// the owner of the session, see Export()
+// The second factor of the sessions is tracked using two columns of
+// the user_sessions table:
+//
+//	ALTER TABLE user_sessions
+//	  ADD COLUMN mfa_status VARCHAR NOT NULL DEFAULT '',
+//	  ADD COLUMN mfa_failures INTEGER NOT NULL DEFAULT 0;
+//
 //go:generate api-cli generate model Session -t user_sessions -e Save,Create,Update,doUpdate,JoinSQL,Get,GetAny,Exists --single=false
 type Session struct {
-	ID        string             `db:"id"`
-	CreatedAt *datetime.DateTime `db:"created_at"`
-	UpdatedAt *datetime.DateTime `db:"updated_at"`
-	DeletedAt *datetime.DateTime `db:"deleted_at"`
+	ID        string             `db:"id" json:"-"`
+	CreatedAt *datetime.DateTime `db:"created_at" json:"created_at"`
+	UpdatedAt *datetime.DateTime `db:"updated_at" json:"updated_at"`
+	DeletedAt *datetime.DateTime `db:"deleted_at" json:"-"`
 
-	UserID string `db:"user_id"`
+	UserID string `db:"user_id" json:"user_id"`
+
+	// MFAStatus contains the state of the second factor of the session.
+	// See MFAPending and MFAVerified
+	MFAStatus string `db:"mfa_status" json:"mfa_status,omitempty"`
+
+	// MFAFailures contains the number of invalid second factors provided
+	// for the session. See MaxMFAFailures
+	MFAFailures int `db:"mfa_failures" json:"-"`
 }
 
-// Exists check if a session exists in the database
+// PublicSession represents the data of a session that the admins can see.
+// It doesn't contain the ID since it's a credential
+type PublicSession struct {
+	CreatedAt *datetime.DateTime `json:"created_at"`
+	UpdatedAt *datetime.DateTime `json:"updated_at"`
+	UserID    string             `json:"user_id"`
+	MFAStatus string             `json:"mfa_status,omitempty"`
+}
+
+// PrivateSession represents the data of a session that only its owner
+// can see
+type PrivateSession struct {
+	PublicSession
+
+	ID string `json:"id"`
+}
+
+// ExportPublic returns the public data of the session
+func (s *Session) ExportPublic() *PublicSession {
+	return &PublicSession{
+		CreatedAt: s.CreatedAt,
+		UpdatedAt: s.UpdatedAt,
+		UserID:    s.UserID,
+		MFAStatus: s.MFAStatus,
+	}
+}
+
+// ExportPrivate returns the private data of the session
+func (s *Session) ExportPrivate() *PrivateSession {
+	return &PrivateSession{
+		PublicSession: *s.ExportPublic(),
+		ID:            s.ID,
+	}
+}
+
+// Export returns the data of the session that the requester is allowed
+// to see: a *PrivateSession for the owner of the session, a
+// *PublicSession for everybody else, admins included.
+// Works with a nil requester
+func (s *Session) Export(requester *User) interface{} {
+	if requester.IsLogged() && requester.ID == s.UserID {
+		return s.ExportPrivate()
+	}
+	return s.ExportPublic()
+}
+
+// Exists check if a session exists in the database and has not expired
 func (s *Session) Exists(q db.Queryable) (bool, error) {
 	if s == nil {
 		return false, apperror.NewServerError("session is nil")
@@ -34,19 +113,133 @@ func (s *Session) Exists(q db.Queryable) (bool, error) {
 		return false, nil
 	}
 
+	createdAfter, updatedAfter := sessionValidityBounds(time.Now())
+
 	var count int
 	stmt := `SELECT count(1)
 					FROM user_sessions
 					WHERE deleted_at IS NULL
 						AND id = $1
-						AND user_id = $2`
-	err := q.Get(&count, stmt, s.ID, s.UserID)
+						AND user_id = $2
+						AND created_at > $3
+						AND updated_at > $4`
+	err := q.Get(&count, stmt, s.ID, s.UserID, createdAfter, updatedAfter)
 	return (count > 0), err
 }
 
+// IsExpired checks if the session reached one of its timeouts
+func (s *Session) IsExpired() bool {
+	createdAfter, updatedAfter := sessionValidityBounds(time.Now())
+	if s.CreatedAt != nil && !s.CreatedAt.After(createdAfter) {
+		return true
+	}
+	if s.UpdatedAt != nil && !s.UpdatedAt.After(updatedAfter) {
+		return true
+	}
+	return false
+}
+
+// IsMFAPending checks if the session is still waiting for a second factor
+// Works on nil object
+func (s *Session) IsMFAPending() bool {
+	return s != nil && s.MFAStatus == MFAPending
+}
+
+// sessionValidityBounds returns the dates after which the creation date
+// and the last activity of a session need to be for the session to be valid
+func sessionValidityBounds(now time.Time) (createdAfter, updatedAfter time.Time) {
+	// the zero value of time.Time is before any valid date
+	if SessionAbsoluteTTL > 0 {
+		createdAfter = now.Add(-SessionAbsoluteTTL)
+	}
+	if SessionIdleTTL > 0 {
+		updatedAfter = now.Add(-SessionIdleTTL)
+	}
+	return createdAfter.UTC(), updatedAfter.UTC()
+}
+
+// Touch marks the session as active by updating UpdatedAt, which slides
+// the idle timeout. The database is not updated if the session has been
+// touched less than SessionTouchInterval ago, or if it has been revoked.
+// UpdatedAt is left untouched if the database has not been updated
+func (s *Session) Touch(q db.Queryable) error {
+	if s.IsZero() {
+		return apperror.NewServerError("session has not been saved")
+	}
+
+	now := datetime.Now()
+	stmt := `UPDATE user_sessions
+					SET updated_at = $1
+					WHERE id = $2
+						AND deleted_at IS NULL
+						AND updated_at < $3`
+	affected, err := q.Exec(stmt, now, s.ID, now.Add(-SessionTouchInterval))
+	if err != nil {
+		return apperror.NewFromSQL(err)
+	}
+	if affected > 0 {
+		s.UpdatedAt = now
+	}
+	return nil
+}
+
+// Revoke soft-deletes the session, making it unusable.
+// Unlike Delete(), the session is kept in the database
+func (s *Session) Revoke(q db.Queryable) error {
+	if s.IsZero() {
+		return apperror.NewServerError("session has not been saved")
+	}
+
+	now := datetime.Now()
+	stmt := `UPDATE user_sessions
+					SET deleted_at = $1
+					WHERE id = $2
+						AND deleted_at IS NULL`
+	if _, err := q.Exec(stmt, now, s.ID); err != nil {
+		return apperror.NewFromSQL(err)
+	}
+	s.DeletedAt = now
+	return nil
+}
+
+// RevokeUserSessions revokes all the sessions of a user.
+// Useful to log a user out everywhere
+func RevokeUserSessions(q db.Queryable, userID string) error {
+	stmt := `UPDATE user_sessions
+					SET deleted_at = $1
+					WHERE user_id = $2
+						AND deleted_at IS NULL`
+	_, err := q.Exec(stmt, datetime.Now(), userID)
+	return apperror.NewFromSQL(err)
+}
+
+// RevokeOtherUserSessions revokes all the sessions of a user except
+// the current one. Useful after a password change
+func RevokeOtherUserSessions(q db.Queryable, userID, currentSessionID string) error {
+	stmt := `UPDATE user_sessions
+					SET deleted_at = $1
+					WHERE user_id = $2
+						AND id != $3
+						AND deleted_at IS NULL`
+	_, err := q.Exec(stmt, datetime.Now(), userID, currentSessionID)
+	return apperror.NewFromSQL(err)
+}
+
+// GetSessionByID finds and returns an active session by ID
+// Deleted sessions are not returned
+func GetSessionByID(q db.Queryable, id string) (*Session, error) {
+	s := &Session{}
+	if !isValidID(id) {
+		return s, apperror.NewNotFound()
+	}
+	stmt := "SELECT * from user_sessions WHERE id=$1 and deleted_at IS NULL LIMIT 1"
+	err := q.Get(s, stmt, id)
+	return s, apperror.NewFromSQL(err)
+}
+
 // SessionJoinSQL returns a string ready to be embed in a JOIN query
 func SessionJoinSQL(prefix string) string {
-	fields := []string{"id", "created_at", "deleted_at", "user_id"}
+	fields := []string{"id", "created_at", "updated_at", "deleted_at", "user_id", "mfa_status", "mfa_failures"}
 	output := ""
 
 	for i, field := range fields {
@@ -31,7 +31,7 @@ func (s *Session) doCreate(q sqldb.Queryable) error {
 		s.CreatedAt = datetime.Now()
 	}
 
-	stmt := "INSERT INTO user_sessions (id, created_at, updated_at, deleted_at, user_id) VALUES (:id, :created_at, :updated_at, :deleted_at, :user_id)"
+	stmt := "INSERT INTO user_sessions (id, created_at, updated_at, deleted_at, user_id, mfa_status, mfa_failures) VALUES (:id, :created_at, :updated_at, :deleted_at, :user_id, :mfa_status, :mfa_failures)"
 	_, err := q.NamedExec(stmt, s)
 
   return apperror.NewFromSQL(err)
@@ -0,0 +1,184 @@
+package auth_test
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/security/auth"
+	"github.com/Nivl/go-sqldb/implementations/mocksqldb"
+	"github.com/Nivl/go-types/datetime"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionExists(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	s := &auth.Session{ID: "session-id", UserID: "user-id"}
+	mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+	mockDB.EXPECT().Get(gomock.Any(), gomock.Any(), s.ID, s.UserID, gomock.Any(), gomock.Any()).
+		Do(func(count *int, stmt string, args ...interface{}) {
+			createdAfter := args[2].(time.Time)
+			updatedAfter := args[3].(time.Time)
+			assert.WithinDuration(t, time.Now().Add(-auth.SessionAbsoluteTTL), createdAfter, time.Minute)
+			assert.WithinDuration(t, time.Now().Add(-auth.SessionIdleTTL), updatedAfter, time.Minute)
+			*count = 1
+		}).
+		Return(nil)
+
+	exists, err := s.Exists(mockDB)
+	assert.NoError(t, err, "Exists() should not have failed")
+	assert.True(t, exists, "the session should exist")
+}
+
+func TestSessionExistsDeleted(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	s := &auth.Session{ID: "session-id", UserID: "user-id", DeletedAt: datetime.Now()}
+	exists, err := s.Exists(mocksqldb.NewMockQueryable(mockCtrl))
+	assert.NoError(t, err, "Exists() should not have failed")
+	assert.False(t, exists, "the session should not exist")
+}
+
+func TestSessionIsExpired(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) *datetime.DateTime {
+		return &datetime.DateTime{Time: now.Add(-d)}
+	}
+
+	testCases := []struct {
+		description string
+		session     *auth.Session
+		expired     bool
+	}{
+		{"new session", &auth.Session{CreatedAt: ago(0), UpdatedAt: ago(0)}, false},
+		{"idle session", &auth.Session{CreatedAt: ago(auth.SessionIdleTTL * 2), UpdatedAt: ago(auth.SessionIdleTTL * 2)}, true},
+		{"old but active session", &auth.Session{CreatedAt: ago(auth.SessionIdleTTL * 2), UpdatedAt: ago(time.Hour)}, false},
+		{"too old session", &auth.Session{CreatedAt: ago(auth.SessionAbsoluteTTL + time.Hour), UpdatedAt: ago(time.Hour)}, true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expired, tc.session.IsExpired())
+		})
+	}
+}
+
+func TestSessionIsMFAPending(t *testing.T) {
+	var s *auth.Session
+	assert.False(t, s.IsMFAPending(), "IsMFAPending() should have returned false")
+
+	s = &auth.Session{}
+	assert.False(t, s.IsMFAPending(), "IsMFAPending() should have returned false")
+
+	s = &auth.Session{MFAStatus: auth.MFAVerified}
+	assert.False(t, s.IsMFAPending(), "IsMFAPending() should have returned false")
+
+	s = &auth.Session{MFAStatus: auth.MFAPending}
+	assert.True(t, s.IsMFAPending(), "IsMFAPending() should have returned true")
+}
+
+func TestSessionTouch(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	s := &auth.Session{ID: "session-id"}
+	mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+	mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), s.ID, gomock.Any()).Return(int64(1), nil)
+
+	assert.NoError(t, s.Touch(mockDB), "Touch() should not have failed")
+	assert.NotNil(t, s.UpdatedAt, "UpdatedAt should have been set")
+
+	// No rows are updated when the session has been touched recently
+	// or has been revoked
+	updatedAt := datetime.Now().AddDate(0, 0, -1)
+	s = &auth.Session{ID: "session-id", UpdatedAt: updatedAt}
+	mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), s.ID, gomock.Any()).Return(int64(0), nil)
+
+	assert.NoError(t, s.Touch(mockDB), "Touch() should not have failed")
+	assert.Equal(t, updatedAt, s.UpdatedAt, "UpdatedAt should not have changed")
+}
+
+func TestSessionRevoke(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	s := &auth.Session{ID: "session-id"}
+	mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+	mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), s.ID).Return(int64(1), nil)
+
+	assert.NoError(t, s.Revoke(mockDB), "Revoke() should not have failed")
+	assert.NotNil(t, s.DeletedAt, "DeletedAt should have been set")
+
+	assert.Error(t, (&auth.Session{}).Revoke(mockDB), "Revoke() should fail on unsaved sessions")
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+	mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), "user-id").Return(int64(3), nil)
+	mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), "user-id", "session-id").Return(int64(0), errors.New("sql error"))
+
+	assert.NoError(t, auth.RevokeUserSessions(mockDB, "user-id"))
+	assert.Error(t, auth.RevokeOtherUserSessions(mockDB, "user-id", "session-id"))
+}
+
+func TestSessionExport(t *testing.T) {
+	t.Parallel()
+
+	s := &auth.Session{ID: "session-id", UserID: "user-id"}
+
+	testCases := []struct {
+		description     string
+		requester       *auth.User
+		expectedPrivate bool
+	}{
+		{"anonymous", nil, false},
+		{"other user", &auth.User{ID: "other-id"}, false},
+		{"admin", &auth.User{ID: "admin-id", IsAdmin: true}, false},
+		{"owner", &auth.User{ID: "user-id"}, true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			data, err := json.Marshal(s.Export(tc.requester))
+			require.NoError(t, err, "json.Marshal() should not have failed")
+			assert.Contains(t, string(data), `"user_id":"user-id"`)
+			assert.Equal(t, tc.expectedPrivate, containsKey(t, data, "id"), "only the owner should get the ID")
+		})
+	}
+}
+
+func TestSessionJSON(t *testing.T) {
+	t.Parallel()
+
+	s := &auth.Session{ID: "session-id", UserID: "user-id"}
+	data, err := json.Marshal(s)
+	require.NoError(t, err, "json.Marshal() should not have failed")
+	assert.NotContains(t, string(data), "session-id", "the ID should not be serialized")
+	assert.False(t, containsKey(t, data, "id"))
+}
+
+func TestSessionJoinSQL(t *testing.T) {
+	t.Parallel()
+
+	output := auth.SessionJoinSQL("s")
+	typ := reflect.TypeOf(auth.Session{})
+	for i := 0; i < typ.NumField(); i++ {
+		column := "s." + typ.Field(i).Tag.Get("db")
+		assert.Contains(t, output, column+` "`+column+`"`, "%s should be joined", column)
+	}
+}
@@ -0,0 +1,232 @@
+package auth
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/security/auth/jwt"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	db "github.com/Nivl/go-sqldb"
+	"github.com/Nivl/go-types/datetime"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// DefaultAccessTokenTTL is the default lifetime of an access token
+	DefaultAccessTokenTTL = 15 * time.Minute
+
+	// DefaultRefreshTokenTTL is the default lifetime of a refresh token
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+	// AccessTokenType is the value of the "typ" claim of the access
+	// tokens. It prevents the other tokens signed with the same key from
+	// being used as access tokens
+	AccessTokenType = "access"
+
+	// ErrMsgInvalidToken is the message returned when a token cannot be used
+	ErrMsgInvalidToken = "invalid token"
+
+	// ErrMsgTokenReused is the message returned when a refresh token that
+	// has already been used is provided
+	ErrMsgTokenReused = "refresh token already used"
+)
+
+// AccessTokenClaims represents the claims contained in an access token.
+// They contain enough data to rebuild the user without querying the
+// database
+type AccessTokenClaims struct {
+	jwt.RegisteredClaims
+
+	// Type is always AccessTokenType
+	Type string `json:"typ"`
+
+	SessionID string `json:"sid,omitempty"`
+	MFAStatus string `json:"mfa,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Email     string `json:"email,omitempty"`
+	IsAdmin   bool   `json:"adm,omitempty"`
+
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"perms,omitempty"`
+}
+
+// User returns the user described by the claims
+func (c *AccessTokenClaims) User() *User {
+	return &User{
+		ID:          c.Subject,
+		Name:        c.Name,
+		Email:       c.Email,
+		IsAdmin:     c.IsAdmin,
+		Roles:       c.Roles,
+		Permissions: c.Permissions,
+	}
+}
+
+// Session returns the session used to create the token
+func (c *AccessTokenClaims) Session() *Session {
+	return &Session{
+		ID:        c.SessionID,
+		UserID:    c.Subject,
+		MFAStatus: c.MFAStatus,
+	}
+}
+
+// TokenPair represents the tokens returned to a client
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+}
+
+// TokenIssuer issues and validates access and refresh tokens
+type TokenIssuer struct {
+	// Key is used to sign and verify the access tokens
+	Key jwt.Key
+
+	// KeyID is the optional ID of the key, set in the "kid" header
+	KeyID string
+
+	// Issuer is the value of the "iss" claim
+	Issuer string
+
+	// AccessTokenTTL is the lifetime of an access token
+	AccessTokenTTL time.Duration
+
+	// RefreshTokenTTL is the lifetime of a refresh token
+	RefreshTokenTTL time.Duration
+}
+
+// NewTokenIssuer returns a TokenIssuer using the default lifetimes
+func NewTokenIssuer(key jwt.Key, issuer string) *TokenIssuer {
+	return &TokenIssuer{
+		Key:             key,
+		Issuer:          issuer,
+		AccessTokenTTL:  DefaultAccessTokenTTL,
+		RefreshTokenTTL: DefaultRefreshTokenTTL,
+	}
+}
+
+// NewAccessToken returns a signed access token for the given user
+// and session. The roles and permissions of the user are embedded in the
+// token, see User.LoadPermissions()
+func (ti *TokenIssuer) NewAccessToken(u *User, s *Session) (string, error) {
+	if u.IsZero() || s.IsZero() {
+		return "", apperror.NewServerError("cannot create a token without a user and a session")
+	}
+
+	now := time.Now()
+	claims := &AccessTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewV4().String(),
+			Issuer:    ti.Issuer,
+			Subject:   u.ID,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(ti.AccessTokenTTL).Unix(),
+		},
+		Type:      AccessTokenType,
+		SessionID: s.ID,
+		MFAStatus: s.MFAStatus,
+		Name:      u.Name,
+		Email:     u.Email,
+		IsAdmin:   u.IsAdmin,
+
+		Roles:       u.Roles,
+		Permissions: u.Permissions,
+	}
+	return jwt.Encode(claims, ti.Key, ti.KeyID)
+}
+
+// ParseAccessToken validates an access token and returns its claims
+func (ti *TokenIssuer) ParseAccessToken(token string) (*AccessTokenClaims, error) {
+	claims := &AccessTokenClaims{}
+	if _, err := jwt.Decode(token, jwt.StaticKey(ti.Key), claims); err != nil {
+		return nil, apperror.NewUnauthorizedR(ErrMsgInvalidToken)
+	}
+	if claims.Type != AccessTokenType || claims.Issuer != ti.Issuer || claims.Subject == "" {
+		return nil, apperror.NewUnauthorizedR(ErrMsgInvalidToken)
+	}
+	return claims, nil
+}
+
+// Issue returns a new access token and a new refresh token for the
+// given user and session
+func (ti *TokenIssuer) Issue(q db.Queryable, u *User, s *Session) (*TokenPair, error) {
+	accessToken, err := ti.NewAccessToken(u, s)
+	if err != nil {
+		return nil, err
+	}
+
+	rt := &RefreshToken{
+		UserID:    u.ID,
+		SessionID: s.ID,
+		ExpiresAt: &datetime.DateTime{Time: time.Now().Add(ti.RefreshTokenTTL).UTC()},
+	}
+	refreshToken, err := rt.Create(q)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(ti.AccessTokenTTL.Seconds()),
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// Refresh exchanges a refresh token against a new pair of tokens.
+// A refresh token can only be used once, using it a second time will
+// revoke the session it belongs to, as well as all its refresh tokens
+func (ti *TokenIssuer) Refresh(q db.Queryable, refreshToken string) (*TokenPair, error) {
+	parts := strings.SplitN(refreshToken, ".", 2)
+	if len(parts) != 2 {
+		return nil, apperror.NewUnauthorizedR(ErrMsgInvalidToken)
+	}
+
+	rt, err := GetAnyRefreshTokenByID(q, parts[0])
+	if err != nil {
+		if apperror.IsNotFound(err) {
+			return nil, apperror.NewUnauthorizedR(ErrMsgInvalidToken)
+		}
+		return nil, err
+	}
+	if !secretMatches(rt.Hash, parts[1]) || rt.DeletedAt != nil || rt.IsExpired() {
+		return nil, apperror.NewUnauthorizedR(ErrMsgInvalidToken)
+	}
+
+	// A token being reused means it has been leaked
+	if rt.UsedAt != nil {
+		return nil, rt.reused(q)
+	}
+	used, err := rt.markUsed(q)
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		// someone used the token in the meantime
+		return nil, rt.reused(q)
+	}
+
+	session, err := GetSessionByID(q, rt.SessionID)
+	if err != nil {
+		if apperror.IsNotFound(err) {
+			return nil, apperror.NewUnauthorizedR(ErrMsgInvalidToken)
+		}
+		return nil, err
+	}
+	if session.IsExpired() {
+		return nil, apperror.NewUnauthorizedR(ErrMsgInvalidToken)
+	}
+	user, err := GetUserByID(q, rt.UserID)
+	if err != nil {
+		if apperror.IsNotFound(err) {
+			return nil, apperror.NewUnauthorizedR(ErrMsgInvalidToken)
+		}
+		return nil, err
+	}
+	if err := user.LoadPermissions(q); err != nil {
+		return nil, err
+	}
+	return ti.Issue(q, user, session)
+}
@@ -0,0 +1,176 @@
+package auth_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/security/auth"
+	"github.com/Nivl/go-rest-tools/security/auth/jwt"
+	"github.com/Nivl/go-rest-tools/security/auth/testauth"
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	"github.com/Nivl/go-sqldb/implementations/mocksqldb"
+	gomock "github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestIssuer() *auth.TokenIssuer {
+	return auth.NewTokenIssuer(&jwt.HS256{Secret: []byte("secret")}, "tests")
+}
+
+func TestAccessToken(t *testing.T) {
+	ti := newTestIssuer()
+	user, session := testauth.NewAdminAuth()
+	session.MFAStatus = auth.MFAVerified
+
+	token, err := ti.NewAccessToken(user, session)
+	require.NoError(t, err, "NewAccessToken() should have succeed")
+
+	claims, err := ti.ParseAccessToken(token)
+	require.NoError(t, err, "ParseAccessToken() should have succeed")
+	assert.Equal(t, user.ID, claims.User().ID)
+	assert.Equal(t, user.Email, claims.User().Email)
+	assert.True(t, claims.User().IsAdmin)
+	assert.Equal(t, session.ID, claims.Session().ID)
+	assert.Equal(t, user.ID, claims.Session().UserID)
+	assert.Equal(t, auth.MFAVerified, claims.Session().MFAStatus)
+	assert.Equal(t, auth.AccessTokenType, claims.Type)
+}
+
+func TestParseAccessTokenInvalid(t *testing.T) {
+	user, session := testauth.NewAuth()
+
+	otherIssuer := newTestIssuer()
+	otherIssuer.Issuer = "other"
+	wrongIssuer, err := otherIssuer.NewAccessToken(user, session)
+	require.NoError(t, err)
+
+	expiredIssuer := newTestIssuer()
+	expiredIssuer.AccessTokenTTL = -time.Hour
+	expired, err := expiredIssuer.NewAccessToken(user, session)
+	require.NoError(t, err)
+
+	// A token signed with the same key, but that is not an access token
+	otherType, err := jwt.Encode(&jwt.RegisteredClaims{
+		Issuer:    "tests",
+		Subject:   user.ID,
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	}, newTestIssuer().Key, "")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		description string
+		token       string
+	}{
+		{"garbage", "not a token"},
+		{"wrong issuer", wrongIssuer},
+		{"expired", expired},
+		{"not an access token", otherType},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+			_, err := newTestIssuer().ParseAccessToken(tc.token)
+			assert.True(t, apperror.IsUnauthorized(err), "expected an Unauthorized error")
+		})
+	}
+}
+
+func TestIssue(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+
+	mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+	mockDB.EXPECT().InsertSuccess(&auth.RefreshToken{})
+
+	user, session := testauth.NewAuth()
+	pair, err := newTestIssuer().Issue(mockDB, user, session)
+	require.NoError(t, err, "Issue() should have succeed")
+	assert.NotEmpty(t, pair.AccessToken)
+	assert.Equal(t, "Bearer", pair.TokenType)
+	assert.Equal(t, int64(auth.DefaultAccessTokenTTL.Seconds()), pair.ExpiresIn)
+	assert.Len(t, strings.Split(pair.RefreshToken, "."), 2, "invalid refresh token format")
+}
+
+func TestRefresh(t *testing.T) {
+	user, session := testauth.NewAuth()
+
+	// newRefreshToken creates a refresh token and returns it with its
+	// DB representation
+	newRefreshToken := func(t *testing.T) (string, *auth.RefreshToken) {
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		var saved *auth.RefreshToken
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().InsertSuccess(&auth.RefreshToken{}).Do(func(stmt string, rt *auth.RefreshToken) {
+			saved = &auth.RefreshToken{}
+			*saved = *rt
+		})
+		token, err := (&auth.RefreshToken{UserID: user.ID, SessionID: session.ID}).Create(mockDB)
+		require.NoError(t, err)
+		return token, saved
+	}
+
+	t.Run("valid token", func(t *testing.T) {
+		token, saved := newRefreshToken(t)
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetID(&auth.RefreshToken{}, saved.ID, func(rt *auth.RefreshToken, stmt, id string) {
+			*rt = *saved
+		})
+		mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), saved.ID).Return(int64(1), nil)
+		mockDB.EXPECT().GetID(&auth.Session{}, session.ID, func(s *auth.Session, stmt, id string) {
+			*s = *session
+		})
+		mockDB.EXPECT().GetID(&auth.User{}, user.ID, func(u *auth.User, stmt, id string) {
+			*u = *user
+		})
+		mockDB.EXPECT().Select(gomock.Any(), gomock.Any(), user.ID).Return(nil).Times(2)
+		mockDB.EXPECT().InsertSuccess(&auth.RefreshToken{})
+
+		pair, err := newTestIssuer().Refresh(mockDB, token)
+		require.NoError(t, err, "Refresh() should have succeed")
+		assert.NotEqual(t, token, pair.RefreshToken, "the refresh token should have been rotated")
+	})
+
+	t.Run("invalid secret", func(t *testing.T) {
+		_, saved := newRefreshToken(t)
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetID(&auth.RefreshToken{}, saved.ID, func(rt *auth.RefreshToken, stmt, id string) {
+			*rt = *saved
+		})
+
+		_, err := newTestIssuer().Refresh(mockDB, saved.ID+".wrong-secret")
+		assert.True(t, apperror.IsUnauthorized(err), "expected an Unauthorized error")
+	})
+
+	t.Run("reused token", func(t *testing.T) {
+		token, saved := newRefreshToken(t)
+		saved.UsedAt = saved.CreatedAt
+
+		mockCtrl := gomock.NewController(t)
+		defer mockCtrl.Finish()
+
+		mockDB := mocksqldb.NewMockQueryable(mockCtrl)
+		mockDB.EXPECT().GetID(&auth.RefreshToken{}, saved.ID, func(rt *auth.RefreshToken, stmt, id string) {
+			*rt = *saved
+		})
+		// the family and the session should be revoked
+		mockDB.EXPECT().Exec(gomock.Any(), gomock.Any(), session.ID).Return(int64(1), nil).Times(2)
+
+		_, err := newTestIssuer().Refresh(mockDB, token)
+		require.True(t, apperror.IsUnauthorized(err), "expected an Unauthorized error")
+		assert.Equal(t, auth.ErrMsgTokenReused, err.Error())
+	})
+}
@@ -0,0 +1,113 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/security/auth/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the secret used by the test vectors of RFC 6238
+var rfcSecret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	t.Parallel()
+
+	// Test vectors of RFC 6238, truncated to 6 digits
+	testCases := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tc := range testCases {
+		code, err := totp.Code(rfcSecret, totp.Step(time.Unix(tc.unix, 0)))
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, code, "invalid code for %d", tc.unix)
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	t.Parallel()
+
+	_, err := totp.Code("not base32!", 1)
+	assert.Equal(t, totp.ErrInvalidSecret, err)
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(1111111111, 0)
+	step := totp.Step(now)
+	codeAt := func(offset int64) string {
+		code, err := totp.Code(rfcSecret, step+offset)
+		require.NoError(t, err)
+		return code
+	}
+
+	testCases := []struct {
+		description  string
+		code         string
+		skew         int
+		lastUsedStep int64
+		expectedStep int64
+		expectedOK   bool
+	}{
+		{"current step", codeAt(0), 1, 0, step, true},
+		{"with spaces", codeAt(0)[:3] + " " + codeAt(0)[3:], 1, 0, step, true},
+		{"previous step", codeAt(-1), 1, 0, step - 1, true},
+		{"next step", codeAt(1), 1, 0, step + 1, true},
+		{"out of window", codeAt(-2), 1, 0, 0, false},
+		{"no skew", codeAt(-1), 0, 0, 0, false},
+		{"replayed", codeAt(0), 1, step, 0, false},
+		{"older than last used", codeAt(-1), 1, step, 0, false},
+		{"wrong code", "000000", 1, 0, 0, false},
+		{"wrong length", "12345", 1, 0, 0, false},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			s, ok := totp.Validate(rfcSecret, tc.code, now, tc.skew, tc.lastUsedStep)
+			assert.Equal(t, tc.expectedOK, ok)
+			assert.Equal(t, tc.expectedStep, s)
+		})
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	t.Parallel()
+
+	secret, err := totp.NewSecret()
+	require.NoError(t, err)
+	_, err = totp.Code(secret, 1)
+	assert.NoError(t, err, "the secret should be usable")
+
+	other, err := totp.NewSecret()
+	require.NoError(t, err)
+	assert.NotEqual(t, secret, other)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	t.Parallel()
+
+	uri, err := url.Parse(totp.ProvisioningURI("SECRET", "My App", "user@domain.tld"))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/My App:user@domain.tld", uri.Path)
+	assert.Equal(t, "SECRET", uri.Query().Get("secret"))
+	assert.Equal(t, "My App", uri.Query().Get("issuer"))
+	assert.Equal(t, "6", uri.Query().Get("digits"))
+}
@@ -1,21 +1,113 @@
 package auth
 
 import (
+	"strings"
+
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	db "github.com/Nivl/go-sqldb"
 	"github.com/Nivl/go-types/datetime"
 )
 
 // User is a structure representing a user that can be saved in the database
+// The password is never serialized, but the object should not be sent
+// as it is to the clients, see Export()
+// The verification of the email addresses is tracked using a column of
+// the users table:
+//
+//	ALTER TABLE users
+//	  ADD COLUMN email_verified_at TIMESTAMP WITH TIME ZONE;
+//
 //go:generate api-cli generate model User -t users --single=false
 type User struct {
-	ID        string             `db:"id"`
-	CreatedAt *datetime.DateTime `db:"created_at"`
-	UpdatedAt *datetime.DateTime `db:"updated_at"`
-	DeletedAt *datetime.DateTime `db:"deleted_at"`
-
-	Name     string `db:"name"`
-	Email    string `db:"email"`
-	Password string `db:"password"`
-	IsAdmin  bool   `db:"is_admin"`
+	ID        string             `db:"id" json:"id"`
+	CreatedAt *datetime.DateTime `db:"created_at" json:"created_at"`
+	UpdatedAt *datetime.DateTime `db:"updated_at" json:"updated_at"`
+	DeletedAt *datetime.DateTime `db:"deleted_at" json:"-"`
+
+	Name     string `db:"name" json:"name"`
+	Email    string `db:"email" json:"email"`
+	Password string `db:"password" json:"-"`
+	IsAdmin  bool   `db:"is_admin" json:"is_admin"`
+
+	// EmailVerifiedAt contains the date at which the user proved owning
+	// their email address, see Accounts.VerifyEmail()
+	EmailVerifiedAt *datetime.DateTime `db:"email_verified_at" json:"email_verified_at"`
+
+	// Roles and Permissions are not loaded by default, see LoadPermissions()
+	Roles       []string `db:"-" json:"roles,omitempty"`
+	Permissions []string `db:"-" json:"permissions,omitempty"`
+}
+
+// PublicUser represents the data of a user that anyone can see
+type PublicUser struct {
+	ID        string             `json:"id"`
+	CreatedAt *datetime.DateTime `json:"created_at"`
+	Name      string             `json:"name"`
+}
+
+// PrivateUser represents the data of a user that only the user and the
+// admins can see
+type PrivateUser struct {
+	PublicUser
+
+	UpdatedAt       *datetime.DateTime `json:"updated_at"`
+	Email           string             `json:"email"`
+	IsAdmin         bool               `json:"is_admin"`
+	EmailVerifiedAt *datetime.DateTime `json:"email_verified_at"`
+	Roles           []string           `json:"roles,omitempty"`
+	Permissions     []string           `json:"permissions,omitempty"`
+}
+
+// IsEmailVerified checks if the user proved owning their email address
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
+
+// GetUserByEmail finds and returns an active user by email.
+// The comparison is case insensitive
+func GetUserByEmail(q db.Queryable, email string) (*User, error) {
+	u := &User{}
+	stmt := "SELECT * from users WHERE LOWER(email)=LOWER($1) and deleted_at IS NULL LIMIT 1"
+	err := q.Get(u, stmt, strings.TrimSpace(email))
+	return u, apperror.NewFromSQL(err)
+}
+
+// ExportPublic returns the public data of the user
+func (u *User) ExportPublic() *PublicUser {
+	return &PublicUser{
+		ID:        u.ID,
+		CreatedAt: u.CreatedAt,
+		Name:      u.Name,
+	}
+}
+
+// ExportPrivate returns the private data of the user
+func (u *User) ExportPrivate() *PrivateUser {
+	return &PrivateUser{
+		PublicUser:      *u.ExportPublic(),
+		UpdatedAt:       u.UpdatedAt,
+		Email:           u.Email,
+		IsAdmin:         u.IsAdmin,
+		EmailVerifiedAt: u.EmailVerifiedAt,
+		Roles:           u.Roles,
+		Permissions:     u.Permissions,
+	}
+}
+
+// CanSeePrivateData checks if the requester is allowed to see the private
+// data of the user. Works with a nil requester
+func (u *User) CanSeePrivateData(requester *User) bool {
+	return requester.IsAdm() || (requester.IsLogged() && requester.ID == u.ID)
+}
+
+// Export returns the data of the user that the requester is allowed to
+// see: a *PrivateUser for the user themselves and the admins, a
+// *PublicUser for everybody else
+func (u *User) Export(requester *User) interface{} {
+	if u.CanSeePrivateData(requester) {
+		return u.ExportPrivate()
+	}
+	return u.ExportPublic()
 }
 
 // IsLogged checks if the user object belong to a logged in user
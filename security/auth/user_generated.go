@@ -17,7 +17,7 @@ import (
 
 // JoinUserSQL returns a string ready to be embed in a JOIN query
 func JoinUserSQL(prefix string) string {
-	fields := []string{ "id", "created_at", "updated_at", "deleted_at", "name", "email", "password", "is_admin" }
+	fields := []string{ "id", "created_at", "updated_at", "deleted_at", "name", "email", "password", "is_admin", "email_verified_at" }
 	output := ""
 
 	for _, field := range fields {
@@ -74,7 +74,7 @@ func (u *User) doCreate(q sqldb.Queryable) error {
 		u.CreatedAt = datetime.Now()
 	}
 
-	stmt := "INSERT INTO users (id, created_at, updated_at, deleted_at, name, email, password, is_admin) VALUES (:id, :created_at, :updated_at, :deleted_at, :name, :email, :password, :is_admin)"
+	stmt := "INSERT INTO users (id, created_at, updated_at, deleted_at, name, email, password, is_admin, email_verified_at) VALUES (:id, :created_at, :updated_at, :deleted_at, :name, :email, :password, :is_admin, :email_verified_at)"
 	_, err := q.NamedExec(stmt, u)
 
   return apperror.NewFromSQL(err)
@@ -98,7 +98,7 @@ func (u *User) doUpdate(q sqldb.Queryable) error {
 
 	u.UpdatedAt = datetime.Now()
 
-	stmt := "UPDATE users SET id=:id, created_at=:created_at, updated_at=:updated_at, deleted_at=:deleted_at, name=:name, email=:email, password=:password, is_admin=:is_admin WHERE id=:id"
+	stmt := "UPDATE users SET id=:id, created_at=:created_at, updated_at=:updated_at, deleted_at=:deleted_at, name=:name, email=:email, password=:password, is_admin=:is_admin, email_verified_at=:email_verified_at WHERE id=:id"
 	_, err := q.NamedExec(stmt, u)
 
 	return apperror.NewFromSQL(err)
@@ -20,7 +20,7 @@ import (
 )
 
 func TestJoinUserSQL(t *testing.T) {
-	fields := []string{ "id", "created_at", "updated_at", "deleted_at", "name", "email", "password", "is_admin" }
+	fields := []string{ "id", "created_at", "updated_at", "deleted_at", "name", "email", "password", "is_admin", "email_verified_at" }
 	totalFields := len(fields)
 	output := JoinUserSQL("tofind")
 
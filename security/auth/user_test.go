@@ -1,9 +1,11 @@
 package auth_test
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/Nivl/go-rest-tools/security/auth"
 )
@@ -26,3 +28,57 @@ func TestUserIsAdm(t *testing.T) {
 	u = &auth.User{IsAdmin: true}
 	assert.True(t, u.IsAdm(), "IsLogged() should have returned true")
 }
+
+func TestUserExport(t *testing.T) {
+	t.Parallel()
+
+	u := &auth.User{ID: "user-id", Name: "name", Email: "email@domain.tld", Password: "hash"}
+
+	testCases := []struct {
+		description     string
+		requester       *auth.User
+		expectedPrivate bool
+	}{
+		{"anonymous", nil, false},
+		{"other user", &auth.User{ID: "other-id"}, false},
+		{"self", &auth.User{ID: "user-id"}, true},
+		{"admin", &auth.User{ID: "admin-id", IsAdmin: true}, true},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			payload := u.Export(tc.requester)
+			if tc.expectedPrivate {
+				assert.Equal(t, u.ExportPrivate(), payload)
+			} else {
+				assert.Equal(t, u.ExportPublic(), payload)
+			}
+
+			data, err := json.Marshal(payload)
+			require.NoError(t, err, "json.Marshal() should not have failed")
+			assert.NotContains(t, string(data), "hash", "the password should not be serialized")
+			assert.Equal(t, tc.expectedPrivate, containsKey(t, data, "email"))
+		})
+	}
+}
+
+func TestUserJSON(t *testing.T) {
+	t.Parallel()
+
+	u := &auth.User{ID: "user-id", Password: "hash"}
+	data, err := json.Marshal(u)
+	require.NoError(t, err, "json.Marshal() should not have failed")
+	assert.NotContains(t, string(data), "hash", "the password should not be serialized")
+	assert.False(t, containsKey(t, data, "password"))
+}
+
+// containsKey checks if the provided JSON object contains the given key
+func containsKey(t *testing.T, data []byte, key string) bool {
+	obj := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(data, &obj), "json.Unmarshal() should not have failed")
+	_, found := obj[key]
+	return found
+}
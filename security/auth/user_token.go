@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	db "github.com/Nivl/go-sqldb"
+	"github.com/Nivl/go-types/datetime"
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// UserTokenPasswordReset is the type of the tokens used to reset
+	// a password
+	UserTokenPasswordReset = "password_reset"
+
+	// UserTokenEmailVerification is the type of the tokens used to verify
+	// an email address
+	UserTokenEmailVerification = "email_verification"
+)
+
+// UserToken is a structure representing a single-use token sent to a user
+// by email, that can be saved in the database. Only the hash of the
+// secret part of the token is stored.
+// A token is only valid for the email address it has been sent to.
+// The tokens are stored in a table named user_tokens:
+//
+//	CREATE TABLE user_tokens (
+//	  id UUID PRIMARY KEY,
+//	  created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  deleted_at TIMESTAMP WITH TIME ZONE,
+//	  user_id UUID NOT NULL,
+//	  type VARCHAR NOT NULL,
+//	  email VARCHAR NOT NULL,
+//	  hash VARCHAR NOT NULL,
+//	  expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+//	  used_at TIMESTAMP WITH TIME ZONE
+//	);
+type UserToken struct {
+	ID        string             `db:"id"`
+	CreatedAt *datetime.DateTime `db:"created_at"`
+	UpdatedAt *datetime.DateTime `db:"updated_at"`
+	DeletedAt *datetime.DateTime `db:"deleted_at"`
+
+	UserID    string             `db:"user_id"`
+	Type      string             `db:"type"`
+	Email     string             `db:"email"`
+	Hash      string             `db:"hash"`
+	ExpiresAt *datetime.DateTime `db:"expires_at"`
+	UsedAt    *datetime.DateTime `db:"used_at"`
+}
+
+// GetAnyUserTokenByID finds and returns a user token by ID.
+// Deleted tokens are returned
+func GetAnyUserTokenByID(q db.Queryable, id string) (*UserToken, error) {
+	ut := &UserToken{}
+	if !isValidID(id) {
+		return ut, apperror.NewNotFound()
+	}
+	stmt := "SELECT * from user_tokens WHERE id=$1 LIMIT 1"
+	err := q.Get(ut, stmt, id)
+	return ut, apperror.NewFromSQL(err)
+}
+
+// Create persists a user token in the database and returns the token
+// to send to the user. The token cannot be retrieved afterward
+func (ut *UserToken) Create(q db.Queryable) (string, error) {
+	if ut == nil {
+		return "", apperror.NewServerError("user token is nil")
+	}
+
+	if ut.ID != "" {
+		return "", apperror.NewServerError("user tokens cannot be updated")
+	}
+
+	if ut.UserID == "" || ut.Type == "" || ut.Email == "" {
+		return "", apperror.NewServerError("cannot save a user token with no user id, type, or email")
+	}
+
+	secret, err := newSecret(32)
+	if err != nil {
+		return "", err
+	}
+
+	ut.ID = uuid.NewV4().String()
+	ut.Hash = hashSecret(secret)
+	ut.UpdatedAt = datetime.Now()
+	if ut.CreatedAt == nil {
+		ut.CreatedAt = datetime.Now()
+	}
+
+	stmt := `INSERT INTO user_tokens
+		(id, created_at, updated_at, deleted_at, user_id, type, email, hash, expires_at, used_at)
+		VALUES (:id, :created_at, :updated_at, :deleted_at, :user_id, :type, :email, :hash, :expires_at, :used_at)`
+	if _, err := q.NamedExec(stmt, ut); err != nil {
+		return "", apperror.NewFromSQL(err)
+	}
+	return ut.ID + "." + secret, nil
+}
+
+// IsExpired checks if the token has expired
+func (ut *UserToken) IsExpired() bool {
+	return ut.ExpiresAt != nil && !ut.ExpiresAt.After(time.Now())
+}
+
+// markUsed flags the token as used. false is returned if the token
+// has already been used
+func (ut *UserToken) markUsed(q db.Queryable) (bool, error) {
+	ut.UsedAt = datetime.Now()
+	ut.UpdatedAt = ut.UsedAt
+
+	stmt := `UPDATE user_tokens
+					SET used_at=$1, updated_at=$1
+					WHERE id=$2
+						AND used_at IS NULL
+						AND deleted_at IS NULL`
+	affected, err := q.Exec(stmt, ut.UsedAt, ut.ID)
+	if err != nil {
+		return false, apperror.NewFromSQL(err)
+	}
+	return affected > 0, nil
+}
+
+// newUserToken revokes the pending tokens of the given type and returns
+// a new token valid for ttl
+func newUserToken(q db.Queryable, u *User, typ string, ttl time.Duration) (string, error) {
+	if err := RevokeUserTokens(q, u.ID, typ); err != nil {
+		return "", err
+	}
+
+	ut := &UserToken{
+		UserID:    u.ID,
+		Type:      typ,
+		Email:     u.Email,
+		ExpiresAt: &datetime.DateTime{Time: time.Now().Add(ttl).UTC()},
+	}
+	return ut.Create(q)
+}
+
+// useUserToken checks that a token of the given type is valid for
+// the provided user and marks it as used. An InvalidArgument error is
+// returned if the token cannot be used
+func useUserToken(q db.Queryable, typ, token string) (*UserToken, *User, error) {
+	invalid := apperror.NewBadRequest("token", ErrMsgInvalidToken)
+
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return nil, nil, invalid
+	}
+
+	ut, err := GetAnyUserTokenByID(q, parts[0])
+	if err != nil {
+		if apperror.IsNotFound(err) {
+			return nil, nil, invalid
+		}
+		return nil, nil, err
+	}
+	if !secretMatches(ut.Hash, parts[1]) || ut.Type != typ ||
+		ut.DeletedAt != nil || ut.UsedAt != nil || ut.IsExpired() {
+		return nil, nil, invalid
+	}
+
+	u, err := GetUserByID(q, ut.UserID)
+	if err != nil {
+		if apperror.IsNotFound(err) {
+			return nil, nil, invalid
+		}
+		return nil, nil, err
+	}
+	// The token has been sent to an address that is not the one of
+	// the user anymore
+	if !strings.EqualFold(u.Email, ut.Email) {
+		return nil, nil, invalid
+	}
+
+	used, err := ut.markUsed(q)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !used {
+		// someone used the token in the meantime
+		return nil, nil, invalid
+	}
+	return ut, u, nil
+}
+
+// RevokeUserTokens revokes all the pending tokens of the given type
+// of a user
+func RevokeUserTokens(q db.Queryable, userID, typ string) error {
+	stmt := `UPDATE user_tokens
+					SET deleted_at = $1
+					WHERE user_id = $2
+						AND type = $3
+						AND used_at IS NULL
+						AND deleted_at IS NULL`
+	_, err := q.Exec(stmt, datetime.Now(), userID, typ)
+	return apperror.NewFromSQL(err)
+}
@@ -32,17 +32,81 @@ const (
 	// permissions to execute the request
 	PermissionDenied Code = 104
 
+	// ResourceExhausted indicates some resource has been exhausted, like a
+	// rate limit or a quota
+	ResourceExhausted Code = 105
+
+	// FailedPrecondition indicates the request has been rejected because the
+	// system is not in a state required for its execution
+	FailedPrecondition Code = 106
+
+	// Aborted indicates the operation was aborted, typically due to a
+	// concurrency issue like a transaction abort
+	Aborted Code = 107
+
+	// OutOfRange indicates the operation was attempted past the valid range
+	OutOfRange Code = 108
+
+	// Unimplemented indicates the operation is not implemented or not
+	// supported
+	Unimplemented Code = 109
+
+	// Unavailable indicates the service is currently unavailable
+	Unavailable Code = 110
+
+	// DeadlineExceeded indicates the operation expired before completion
+	DeadlineExceeded Code = 111
+
+	// Canceled indicates the operation was canceled, typically by the caller
+	Canceled Code = 112
+
+	// DataLoss indicates unrecoverable data loss or corruption
+	DataLoss Code = 113
+
+	// NotAcceptable indicates the server cannot produce a response in any
+	// of the formats accepted by the client
+	NotAcceptable Code = 114
+
+	// UnsupportedMediaType indicates the server cannot read the format of
+	// the data sent by the client
+	UnsupportedMediaType Code = 115
+
+	// PayloadTooLarge indicates the data sent by the client are bigger than
+	// what the server accepts
+	PayloadTooLarge Code = 116
+
+	// Locked indicates the requested resource has been temporarily locked,
+	// like an account after too many failed login attempts
+	Locked Code = 117
+
 	// Internal indicates something the service is internally broken
 	Internal Code = 1000
 )
 
+// StatusClientClosedRequest is the non-standard HTTP code used when the
+// client canceled the request
+const StatusClientClosedRequest = 499
+
 var statusText = map[Code]string{
-	InvalidArgument:  "Bad Request",
-	Unauthenticated:  "Unauthorized",
-	PermissionDenied: "Forbidden",
-	NotFound:         "Not Found",
-	AlreadyExists:    "Conflict",
-	Internal:         "Internal Error",
+	InvalidArgument:      "Bad Request",
+	Unauthenticated:      "Unauthorized",
+	PermissionDenied:     "Forbidden",
+	NotFound:             "Not Found",
+	AlreadyExists:        "Conflict",
+	ResourceExhausted:    "Too Many Requests",
+	FailedPrecondition:   "Precondition Failed",
+	Aborted:              "Aborted",
+	OutOfRange:           "Out Of Range",
+	Unimplemented:        "Not Implemented",
+	Unavailable:          "Service Unavailable",
+	DeadlineExceeded:     "Gateway Timeout",
+	Canceled:             "Client Closed Request",
+	DataLoss:             "Data Loss",
+	NotAcceptable:        "Not Acceptable",
+	UnsupportedMediaType: "Unsupported Media Type",
+	PayloadTooLarge:      "Payload Too Large",
+	Locked:               "Locked",
+	Internal:             "Internal Error",
 }
 
 // StatusText returns
@@ -51,12 +115,25 @@ func StatusText(errCode Code) string {
 }
 
 var httpCodes = map[Code]int{
-	InvalidArgument:  http.StatusBadRequest,
-	Unauthenticated:  http.StatusUnauthorized,
-	PermissionDenied: http.StatusForbidden,
-	NotFound:         http.StatusNotFound,
-	AlreadyExists:    http.StatusConflict,
-	Internal:         http.StatusInternalServerError,
+	InvalidArgument:      http.StatusBadRequest,
+	Unauthenticated:      http.StatusUnauthorized,
+	PermissionDenied:     http.StatusForbidden,
+	NotFound:             http.StatusNotFound,
+	AlreadyExists:        http.StatusConflict,
+	ResourceExhausted:    http.StatusTooManyRequests,
+	FailedPrecondition:   http.StatusPreconditionFailed,
+	Aborted:              http.StatusConflict,
+	OutOfRange:           http.StatusBadRequest,
+	Unimplemented:        http.StatusNotImplemented,
+	Unavailable:          http.StatusServiceUnavailable,
+	DeadlineExceeded:     http.StatusGatewayTimeout,
+	Canceled:             StatusClientClosedRequest,
+	DataLoss:             http.StatusInternalServerError,
+	NotAcceptable:        http.StatusNotAcceptable,
+	UnsupportedMediaType: http.StatusUnsupportedMediaType,
+	PayloadTooLarge:      http.StatusRequestEntityTooLarge,
+	Locked:               http.StatusLocked,
+	Internal:             http.StatusInternalServerError,
 }
 
 // HTTPStatusCode returns the HTTP Code corresponding to the
@@ -66,12 +143,25 @@ func HTTPStatusCode(code Code) int {
 }
 
 var grpcCodes = map[Code]codes.Code{
-	InvalidArgument:  codes.InvalidArgument,
-	Unauthenticated:  codes.Unauthenticated,
-	PermissionDenied: codes.PermissionDenied,
-	NotFound:         codes.NotFound,
-	AlreadyExists:    codes.AlreadyExists,
-	Internal:         codes.Internal,
+	InvalidArgument:      codes.InvalidArgument,
+	Unauthenticated:      codes.Unauthenticated,
+	PermissionDenied:     codes.PermissionDenied,
+	NotFound:             codes.NotFound,
+	AlreadyExists:        codes.AlreadyExists,
+	ResourceExhausted:    codes.ResourceExhausted,
+	FailedPrecondition:   codes.FailedPrecondition,
+	Aborted:              codes.Aborted,
+	OutOfRange:           codes.OutOfRange,
+	Unimplemented:        codes.Unimplemented,
+	Unavailable:          codes.Unavailable,
+	DeadlineExceeded:     codes.DeadlineExceeded,
+	Canceled:             codes.Canceled,
+	DataLoss:             codes.DataLoss,
+	NotAcceptable:        codes.InvalidArgument,
+	UnsupportedMediaType: codes.InvalidArgument,
+	PayloadTooLarge:      codes.ResourceExhausted,
+	Locked:               codes.ResourceExhausted,
+	Internal:             codes.Internal,
 }
 
 // GRPCStatusCode returns the GRPC Code corresponding to the
@@ -1,14 +1,26 @@
 package apperror
 
-// Convert takes an error an turns it into an AppError
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Convert takes an error an turns it into an AppError.
+// If e wraps an AppError, the wrapped AppError is returned
 func Convert(e error) *AppError {
-	err, casted := e.(*AppError)
-	if !casted {
-		err = NewServerError(e.Error())
-		err.origin = e
+	var err *AppError
+	if errors.As(e, &err) {
+		return err
 	}
 
-	return err
+	switch {
+	case errors.Is(e, context.Canceled):
+		return Wrap(e, Canceled, "", "request canceled")
+	case errors.Is(e, context.DeadlineExceeded):
+		return Wrap(e, DeadlineExceeded, "", "deadline exceeded")
+	}
+	return Wrap(e, Internal, "", "%s", e.Error())
 }
 
 // Error represents an error with a code attached.
@@ -23,14 +35,19 @@ type Error interface {
 
 	// Origin returns the original error if there's one
 	Origin() error
+
+	// FieldErrors returns the list of all the fields that failed
+	FieldErrors() []*FieldError
 }
 
 // AppError represents an error with a status code and an optional field
 type AppError struct {
 	error
-	status Code
-	field  string
-	origin error
+	status      Code
+	field       string
+	origin      error
+	fieldErrors []*FieldError
+	retryAfter  time.Duration
 }
 
 // StatusCode returns the HTTP code associated to the error
@@ -56,3 +73,30 @@ func (err *AppError) Origin() error {
 	}
 	return err.origin
 }
+
+// Unwrap returns the original error if there's one.
+// It allows errors.Is() and errors.As() to inspect the origin chain
+func (err *AppError) Unwrap() error {
+	return err.Origin()
+}
+
+// FieldErrors returns the list of all the fields that failed.
+// The list is empty if the error is not attached to any field
+func (err *AppError) FieldErrors() []*FieldError {
+	if err == nil {
+		return nil
+	}
+	if len(err.fieldErrors) == 0 && err.field != "" {
+		return []*FieldError{NewFieldError(err.field, "", err.Error())}
+	}
+	return err.fieldErrors
+}
+
+// RetryAfter returns the amount of time the client should wait before
+// retrying the request. 0 means the client doesn't have to wait
+func (err *AppError) RetryAfter() time.Duration {
+	if err == nil {
+		return 0
+	}
+	return err.retryAfter
+}
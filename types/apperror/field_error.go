@@ -0,0 +1,84 @@
+package apperror
+
+import (
+	params "github.com/Nivl/go-params"
+)
+
+// Machine-readable codes attached to the field errors
+const (
+	FieldCodeInvalid      = "invalid"
+	FieldCodeMissing      = "missing"
+	FieldCodeEmpty        = "empty"
+	FieldCodeInvalidUUID  = "invalid_uuid"
+	FieldCodeInvalidSlug  = "invalid_slug"
+	FieldCodeInvalidURL   = "invalid_url"
+	FieldCodeInvalidEmail = "invalid_email"
+	FieldCodeInvalidImage = "invalid_image"
+	FieldCodeTooLong      = "too_long"
+	FieldCodeNotInEnum    = "not_in_enum"
+	FieldCodeInvalidBool  = "invalid_boolean"
+	FieldCodeInvalidInt   = "invalid_integer"
+	FieldCodeTooHigh      = "too_high"
+	FieldCodeTooLow       = "too_low"
+	FieldCodeEmptyFile    = "empty_file"
+	FieldCodeCorrupted    = "corrupted_file"
+	FieldCodeTooManyItems = "too_many_items"
+	FieldCodeTooFewItems  = "too_few_items"
+	FieldCodeEmptyItem    = "empty_item"
+	FieldCodeConflict     = "already_exists"
+)
+
+// FieldError represents an error attached to a specific field
+type FieldError struct {
+	// Field is the name of the invalid field
+	Field string `json:"field" xml:"field"`
+
+	// Code is a machine-readable code describing the error
+	Code string `json:"code" xml:"code"`
+
+	// Message is a human-readable message describing the error
+	Message string `json:"message" xml:"message"`
+}
+
+// NewFieldError returns a new FieldError. The code is guessed from the
+// message if empty
+func NewFieldError(field, code, message string) *FieldError {
+	if code == "" {
+		code = FieldCode(message)
+	}
+	return &FieldError{
+		Field:   field,
+		Code:    code,
+		Message: message,
+	}
+}
+
+var fieldCodes = map[string]string{
+	params.ErrMsgMissingParameter: FieldCodeMissing,
+	params.ErrMsgEmptyParameter:   FieldCodeEmpty,
+	params.ErrMsgInvalidUUID:      FieldCodeInvalidUUID,
+	params.ErrMsgInvalidSlug:      FieldCodeInvalidSlug,
+	params.ErrMsgInvalidURL:       FieldCodeInvalidURL,
+	params.ErrMsgInvalidEmail:     FieldCodeInvalidEmail,
+	params.ErrMsgInvalidImage:     FieldCodeInvalidImage,
+	params.ErrMsgMaxLen:           FieldCodeTooLong,
+	params.ErrMsgEnum:             FieldCodeNotInEnum,
+	params.ErrMsgInvalidBoolean:   FieldCodeInvalidBool,
+	params.ErrMsgInvalidInteger:   FieldCodeInvalidInt,
+	params.ErrMsgIntegerTooBig:    FieldCodeTooHigh,
+	params.ErrMsgIntegerTooSmall:  FieldCodeTooLow,
+	params.ErrMsgEmptyFile:        FieldCodeEmptyFile,
+	params.ErrMsgCorruptedFile:    FieldCodeCorrupted,
+	params.ErrMsgArrayTooBig:      FieldCodeTooManyItems,
+	params.ErrMsgArrayTooSmall:    FieldCodeTooFewItems,
+	params.ErrMsgEmptyItem:        FieldCodeEmptyItem,
+}
+
+// FieldCode returns the machine-readable code matching a validation
+// error message. FieldCodeInvalid is returned for unknown messages
+func FieldCode(message string) string {
+	if code, found := fieldCodes[message]; found {
+		return code
+	}
+	return FieldCodeInvalid
+}
@@ -1,57 +1,101 @@
 package apperror
 
-// IsNotFound checks if an error is the NotFound type
-func IsNotFound(e error) bool {
-	err, casted := e.(*AppError)
-	if !casted {
+// HasCode checks if an error, or one of the errors it wraps, has
+// the given code once converted to an AppError
+func HasCode(e error, code Code) bool {
+	if e == nil {
 		return false
 	}
-	return err.StatusCode() == NotFound
+	return Convert(e).StatusCode() == code
+}
+
+// IsNotFound checks if an error is the NotFound type
+func IsNotFound(e error) bool {
+	return HasCode(e, NotFound)
 }
 
 // IsConflict checks if an error is caused by a conflict
 func IsConflict(e error) bool {
-	err, casted := e.(*AppError)
-	if !casted {
-		return false
-	}
-	return err.StatusCode() == AlreadyExists
+	return HasCode(e, AlreadyExists)
 }
 
 // IsInternalServerError checks if an error is caused by an internal error
 func IsInternalServerError(e error) bool {
-	err := Convert(e)
-	return err.StatusCode() == Internal
+	return HasCode(e, Internal)
 }
 
 // IsBadRequest checks if an error is caused by a bad request
 func IsBadRequest(e error) bool {
-	err, casted := e.(*AppError)
-	if !casted {
-		return false
-	}
-	return err.StatusCode() == InvalidArgument
+	return HasCode(e, InvalidArgument)
 }
 
 // IsForbidden checks if an error is caused by a forbidden access
 func IsForbidden(e error) bool {
-	err, casted := e.(*AppError)
-	if !casted {
-		return false
-	}
-	return err.StatusCode() == PermissionDenied
+	return HasCode(e, PermissionDenied)
 }
 
 // IsUnauthorized checks if an error is caused by an Unauthorized access
 func IsUnauthorized(e error) bool {
-	err, casted := e.(*AppError)
-	if !casted {
-		return false
-	}
-	return err.StatusCode() == Unauthenticated
+	return HasCode(e, Unauthenticated)
 }
 
 // IsInvalidParam checks if an error is caused by an invalid param
 func IsInvalidParam(e error) bool {
 	return IsBadRequest(e)
 }
+
+// IsTooManyRequests checks if an error is caused by an exhausted resource
+func IsTooManyRequests(e error) bool {
+	return HasCode(e, ResourceExhausted)
+}
+
+// IsPreconditionFailed checks if an error is caused by a failed precondition
+func IsPreconditionFailed(e error) bool {
+	return HasCode(e, FailedPrecondition)
+}
+
+// IsAborted checks if an error is caused by an aborted operation
+func IsAborted(e error) bool {
+	return HasCode(e, Aborted)
+}
+
+// IsNotImplemented checks if an error is caused by an unimplemented feature
+func IsNotImplemented(e error) bool {
+	return HasCode(e, Unimplemented)
+}
+
+// IsUnavailable checks if an error is caused by an unavailable service
+func IsUnavailable(e error) bool {
+	return HasCode(e, Unavailable)
+}
+
+// IsDeadlineExceeded checks if an error is caused by an expired deadline
+func IsDeadlineExceeded(e error) bool {
+	return HasCode(e, DeadlineExceeded)
+}
+
+// IsCanceled checks if an error is caused by a canceled operation
+func IsCanceled(e error) bool {
+	return HasCode(e, Canceled)
+}
+
+// IsNotAcceptable checks if an error is caused by a format not supported
+func IsNotAcceptable(e error) bool {
+	return HasCode(e, NotAcceptable)
+}
+
+// IsUnsupportedMediaType checks if an error is caused by a body sent
+// using an unsupported format
+func IsUnsupportedMediaType(e error) bool {
+	return HasCode(e, UnsupportedMediaType)
+}
+
+// IsPayloadTooLarge checks if an error is caused by a body too large
+func IsPayloadTooLarge(e error) bool {
+	return HasCode(e, PayloadTooLarge)
+}
+
+// IsLocked checks if an error is caused by a locked resource
+func IsLocked(e error) bool {
+	return HasCode(e, Locked)
+}
@@ -0,0 +1,136 @@
+package apperror_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+)
+
+// wrap wraps err into a standard error
+func wrap(err error) error {
+	return fmt.Errorf("wrapped: %w", err)
+}
+
+func TestIsWrapped(t *testing.T) {
+	testCases := []struct {
+		description string
+		err         error
+		is          func(error) bool
+	}{
+		{"not found", apperror.NewNotFound(), apperror.IsNotFound},
+		{"wrapped not found", wrap(apperror.NewNotFound()), apperror.IsNotFound},
+		{"wrapped conflict", wrap(apperror.NewConflict("email")), apperror.IsConflict},
+		{"wrapped bad request", wrap(apperror.NewBadRequest("f", "nope")), apperror.IsBadRequest},
+		{"wrapped forbidden", wrap(apperror.NewForbidden()), apperror.IsForbidden},
+		{"wrapped unauthorized", wrap(apperror.NewUnauthorized()), apperror.IsUnauthorized},
+		{"too many requests", apperror.NewTooManyRequests(), apperror.IsTooManyRequests},
+		{"precondition failed", apperror.NewPreconditionFailed("etag"), apperror.IsPreconditionFailed},
+		{"aborted", apperror.NewAborted("retry"), apperror.IsAborted},
+		{"not implemented", apperror.NewNotImplemented(), apperror.IsNotImplemented},
+		{"unavailable", apperror.NewUnavailable(), apperror.IsUnavailable},
+		{"wrapped locked", wrap(apperror.NewLocked("locked", time.Minute)), apperror.IsLocked},
+		{"canceled context", context.Canceled, apperror.IsCanceled},
+		{"deadline exceeded", wrap(context.DeadlineExceeded), apperror.IsDeadlineExceeded},
+		{"plain error", errors.New("boom"), apperror.IsInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+			assert.True(t, tc.is(tc.err))
+		})
+	}
+}
+
+func TestDefaultMessages(t *testing.T) {
+	testCases := []struct {
+		description string
+		err         *apperror.AppError
+		expected    string
+	}{
+		{"too many requests", apperror.NewTooManyRequests(), "Too Many Requests"},
+		{"not implemented", apperror.NewNotImplemented(), "Not Implemented"},
+		{"unavailable", apperror.NewUnavailable(), "Service Unavailable"},
+		{"not acceptable", apperror.NewNotAcceptable(), "Not Acceptable"},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, tc.err.Error())
+		})
+	}
+}
+
+func TestIsNotMatching(t *testing.T) {
+	t.Parallel()
+
+	err := wrap(apperror.NewNotFound())
+	assert.False(t, apperror.IsConflict(err))
+	assert.False(t, apperror.IsInternalServerError(err))
+	assert.False(t, apperror.IsNotFound(errors.New("not found")))
+}
+
+func TestUnwrap(t *testing.T) {
+	t.Parallel()
+
+	err := apperror.NewFromSQL(sql.ErrNoRows)
+	assert.True(t, apperror.IsNotFound(err))
+	assert.True(t, errors.Is(err, sql.ErrNoRows), "the origin should be reachable")
+
+	origin := errors.New("connection refused")
+	wrapped := apperror.Wrap(origin, apperror.Unavailable, "", "db unavailable")
+	assert.True(t, errors.Is(wrapped, origin))
+	assert.Equal(t, origin, errors.Unwrap(wrapped))
+
+	converted := apperror.Convert(origin)
+	assert.True(t, errors.Is(converted, origin))
+	assert.Equal(t, apperror.Internal, converted.StatusCode())
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	err := wrap(apperror.NewLocked("account locked", time.Minute))
+	assert.Equal(t, time.Minute, apperror.Convert(err).RetryAfter())
+	assert.Equal(t, "account locked", apperror.Convert(err).Error())
+	assert.Zero(t, apperror.NewNotFound().RetryAfter())
+}
+
+func TestCodesMapping(t *testing.T) {
+	testCases := []struct {
+		code     apperror.Code
+		httpCode int
+		grpcCode codes.Code
+	}{
+		{apperror.ResourceExhausted, http.StatusTooManyRequests, codes.ResourceExhausted},
+		{apperror.FailedPrecondition, http.StatusPreconditionFailed, codes.FailedPrecondition},
+		{apperror.Aborted, http.StatusConflict, codes.Aborted},
+		{apperror.OutOfRange, http.StatusBadRequest, codes.OutOfRange},
+		{apperror.Unimplemented, http.StatusNotImplemented, codes.Unimplemented},
+		{apperror.Unavailable, http.StatusServiceUnavailable, codes.Unavailable},
+		{apperror.DeadlineExceeded, http.StatusGatewayTimeout, codes.DeadlineExceeded},
+		{apperror.Canceled, apperror.StatusClientClosedRequest, codes.Canceled},
+		{apperror.DataLoss, http.StatusInternalServerError, codes.DataLoss},
+		{apperror.Locked, http.StatusLocked, codes.ResourceExhausted},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(apperror.StatusText(tc.code), func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.httpCode, apperror.HTTPStatusCode(tc.code))
+			assert.Equal(t, tc.grpcCode, apperror.GRPCStatusCode(tc.code))
+		})
+	}
+}
@@ -1,49 +1,13 @@
 package apperror
 
 import (
-	"database/sql"
 	"errors"
 	"fmt"
-	"regexp"
+	"time"
 
 	"github.com/Nivl/go-params/perror"
-
-	"github.com/lib/pq"
-)
-
-const (
-	// ErrDup contains the errcode of a unique constraint violation
-	ErrDup = "23505"
 )
 
-// NewFromSQL returns an error based on a pq.Error
-// the provided error will be returned if it's not a pq.Error instance,
-// or if the error cannot be matched to
-func NewFromSQL(err error) error {
-	if err != nil && err == sql.ErrNoRows {
-		return NewNotFound()
-	}
-
-	if pqErr, ok := err.(*pq.Error); ok {
-		switch pqErr.Code {
-		case ErrDup:
-			// because it's a constraint issue, the column name won't be stored in
-			// pqErr.Column. Fortunately we can find it in detail.
-			// Example of detail: "Key (name)=(Google) already exists."
-			r := regexp.MustCompile(`^Key \(([a-z_]+)\).*\.$`)
-			matches := r.FindStringSubmatch(pqErr.Detail)
-			fieldName := "unknown"
-			if len(matches) > 1 {
-				fieldName = matches[1]
-			}
-			return NewConflict(fieldName)
-		default:
-			return err
-		}
-	}
-	return err
-}
-
 // NewFromError returns an api error based on an error
 // the provided error will be returned if it doesn't match any known error
 func NewFromError(err error) error {
@@ -51,7 +15,7 @@ func NewFromError(err error) error {
 
 	switch e := err.(type) {
 	case perror.Error:
-		return NewBadRequest(e.Field(), e.Error())
+		return NewValidationError(NewFieldError(e.Field(), "", e.Error()))
 	}
 	return err
 }
@@ -59,7 +23,31 @@ func NewFromError(err error) error {
 // NewError returns an error with an associated code
 func NewError(code Code, field string, message string, args ...interface{}) *AppError {
 	fullMessage := fmt.Sprintf(message, args...)
-	return &AppError{errors.New(fullMessage), code, field, nil}
+	return &AppError{
+		error:  errors.New(fullMessage),
+		status: code,
+		field:  field,
+	}
+}
+
+// Wrap returns an error with an associated code, that has origin as
+// original error
+func Wrap(origin error, code Code, field string, message string, args ...interface{}) *AppError {
+	err := NewError(code, field, message, args...)
+	err.origin = origin
+	return err
+}
+
+// NewValidationError returns a bad request containing all the fields
+// that failed. The message and the field of the error are the ones of
+// the first FieldError
+func NewValidationError(fieldErrors ...*FieldError) *AppError {
+	if len(fieldErrors) == 0 {
+		return NewBadRequest("", "invalid params")
+	}
+	err := NewBadRequest(fieldErrors[0].Field, "%s", fieldErrors[0].Message)
+	err.fieldErrors = fieldErrors
+	return err
 }
 
 // NewServerError returns an Internal Error.
@@ -98,7 +86,7 @@ func NewUnauthorized() *AppError {
 // NewUnauthorizedR returns an error caused by a anonymous user trying to access
 // a protected resource. A reason is sent back to the user.
 func NewUnauthorizedR(reason string) *AppError {
-	return NewError(Unauthenticated, "", reason)
+	return NewError(Unauthenticated, "", "%s", reason)
 }
 
 // NewForbidden returns an error caused by a user trying to access
@@ -110,7 +98,7 @@ func NewForbidden() *AppError {
 // NewForbiddenR returns an error caused by a user trying to access
 // a protected resource. A reason is sent back to the user.
 func NewForbiddenR(reason string) *AppError {
-	return NewError(PermissionDenied, "", reason)
+	return NewError(PermissionDenied, "", "%s", reason)
 }
 
 // NewNotFound returns an error caused by a user trying to access
@@ -122,11 +110,69 @@ func NewNotFound() *AppError {
 // NewNotFoundR returns an error caused by a user trying to access
 // a resource that does not exists. A reason is sent back to the user.
 func NewNotFoundR(reason string) *AppError {
-	return NewError(NotFound, "", reason)
+	return NewError(NotFound, "", "%s", reason)
 }
 
 // NewNotFoundField returns an error caused by a user trying to access
 // a resource that does not exists. A reason is sent back to the user.
 func NewNotFoundField(field string, reason string) *AppError {
-	return NewError(NotFound, field, reason)
+	return NewError(NotFound, field, "%s", reason)
+}
+
+// NewTooManyRequests returns an error caused by a user exceeding a rate
+// limit or a quota
+func NewTooManyRequests() *AppError {
+	return NewError(ResourceExhausted, "", "%s", StatusText(ResourceExhausted))
+}
+
+// NewPreconditionFailed returns an error caused by a request that cannot
+// be executed in the current state of the system. A reason is sent back
+// to the user.
+func NewPreconditionFailed(reason string) *AppError {
+	return NewError(FailedPrecondition, "", "%s", reason)
+}
+
+// NewAborted returns an error caused by an operation that has been
+// aborted, typically due to a concurrency issue.
+func NewAborted(reason string) *AppError {
+	return NewError(Aborted, "", "%s", reason)
+}
+
+// NewNotImplemented returns an error caused by a user trying to use
+// a feature that is not supported.
+func NewNotImplemented() *AppError {
+	return NewError(Unimplemented, "", "%s", StatusText(Unimplemented))
+}
+
+// NewUnavailable returns an error caused by the service, or one of its
+// dependencies, being temporarily unavailable.
+func NewUnavailable() *AppError {
+	return NewError(Unavailable, "", "%s", StatusText(Unavailable))
+}
+
+// NewNotAcceptable returns an error caused by a client accepting none of
+// the formats supported by the server
+func NewNotAcceptable() *AppError {
+	return NewError(NotAcceptable, "", "%s", StatusText(NotAcceptable))
+}
+
+// NewUnsupportedMediaType returns an error caused by a client sending
+// data using a format not supported by the server
+func NewUnsupportedMediaType(mediaType string) *AppError {
+	return NewError(UnsupportedMediaType, "", "unsupported media type %q", mediaType)
+}
+
+// NewPayloadTooLarge returns an error caused by a client sending a body
+// bigger than maxSize bytes
+func NewPayloadTooLarge(maxSize int64) *AppError {
+	return NewError(PayloadTooLarge, "", "payload cannot be larger than %d bytes", maxSize)
+}
+
+// NewLocked returns an error caused by a user trying to use a resource
+// that has been temporarily locked. retryAfter contains the amount of
+// time before the resource is unlocked
+func NewLocked(reason string, retryAfter time.Duration) *AppError {
+	err := NewError(Locked, "", "%s", reason)
+	err.retryAfter = retryAfter
+	return err
 }
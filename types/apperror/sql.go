@@ -0,0 +1,190 @@
+package apperror
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+
+	params "github.com/Nivl/go-params"
+	"github.com/lib/pq"
+)
+
+const (
+	// ErrDup contains the errcode of a unique constraint violation
+	ErrDup = "23505"
+
+	// ErrForeignKey contains the errcode of a foreign key violation
+	ErrForeignKey = "23503"
+
+	// ErrNotNull contains the errcode of a not null violation
+	ErrNotNull = "23502"
+
+	// ErrCheck contains the errcode of a check constraint violation
+	ErrCheck = "23514"
+
+	// ErrStringTooLong contains the errcode of a value too long for its
+	// column
+	ErrStringTooLong = "22001"
+
+	// ErrInvalidTextRepresentation contains the errcode of a value that
+	// cannot be casted to the type of its column (ex. an invalid uuid)
+	ErrInvalidTextRepresentation = "22P02"
+
+	// ErrSerializationFailure contains the errcode of a transaction that
+	// could not be serialized
+	ErrSerializationFailure = "40001"
+
+	// ErrDeadlock contains the errcode of a detected deadlock
+	ErrDeadlock = "40P01"
+
+	// ErrQueryCanceled contains the errcode of a query canceled by a
+	// statement timeout or a user request
+	ErrQueryCanceled = "57014"
+)
+
+// ErrMsgInvalidValue is the message returned when the database rejected
+// a value without telling which rule it breaks, or which column
+// it belongs to
+const ErrMsgInvalidValue = "invalid value"
+
+// keyDetailRegexp matches the detail of the key related errors.
+// Example: "Key (user_id, name)=(xxx, Google) already exists."
+var keyDetailRegexp = regexp.MustCompile(`^Key \((.+?)\)=\(`)
+
+// identifierRegexp matches an SQL identifier
+var identifierRegexp = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`)
+
+// NewFromSQL returns an error based on a pq.Error
+// the provided error will be returned if it's not a pq.Error instance,
+// or if the error cannot be matched to.
+// The wrapped errors are matched as well
+func NewFromSQL(err error) error {
+	if err != nil && errors.Is(err, sql.ErrNoRows) {
+		return Wrap(err, NotFound, "", "%s", StatusText(NotFound))
+	}
+
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	switch pqErr.Code {
+	case ErrDup:
+		// because it's a constraint issue, the column name won't be stored in
+		// pqErr.Column. Fortunately we can find it in detail.
+		fields := keyColumns(pqErr.Detail)
+		if len(fields) == 0 {
+			fields = []string{"unknown"}
+		}
+		e := Wrap(err, AlreadyExists, fields[0], "already exists")
+		for _, f := range fields {
+			e.fieldErrors = append(e.fieldErrors, NewFieldError(f, FieldCodeConflict, "already exists"))
+		}
+		return e
+	case ErrForeignKey:
+		// Example of details:
+		// Key (user_id)=(xxx) is not present in table "users".
+		// Key (id)=(xxx) is still referenced from table "sessions".
+		field := firstField(keyColumns(pqErr.Detail))
+		if strings.Contains(pqErr.Detail, "is still referenced") {
+			return Wrap(err, FailedPrecondition, field, "still referenced")
+		}
+		return Wrap(err, NotFound, field, "does not exist")
+	case ErrNotNull:
+		e := Wrap(err, InvalidArgument, pqErr.Column, "%s", params.ErrMsgMissingParameter)
+		e.fieldErrors = []*FieldError{NewFieldError(pqErr.Column, FieldCodeMissing, params.ErrMsgMissingParameter)}
+		return e
+	case ErrCheck:
+		field := pqErr.Column
+		if field == "" {
+			field = checkConstraintColumn(pqErr.Table, pqErr.Constraint)
+		}
+		// the constraint can be any expression, so we don't know what
+		// rule the value breaks
+		e := Wrap(err, InvalidArgument, field, "%s", ErrMsgInvalidValue)
+		if field != "" {
+			e.fieldErrors = []*FieldError{NewFieldError(field, FieldCodeInvalid, ErrMsgInvalidValue)}
+		}
+		return e
+	case ErrStringTooLong:
+		// Postgres doesn't tell which column the value was for
+		return Wrap(err, InvalidArgument, "", "%s", params.ErrMsgMaxLen)
+	case ErrInvalidTextRepresentation:
+		// Postgres doesn't tell which column the value was for, and its
+		// message contains the raw value
+		return Wrap(err, InvalidArgument, "", "%s", ErrMsgInvalidValue)
+	case ErrSerializationFailure, ErrDeadlock:
+		return Wrap(err, Aborted, "", "concurrent update, please retry")
+	case ErrQueryCanceled:
+		return Wrap(err, DeadlineExceeded, "", "%s", StatusText(DeadlineExceeded))
+	}
+	return err
+}
+
+// keyColumns returns the columns listed in the detail of a key related
+// error. Expressions are reduced to the first column they use.
+// Example: "Key (lower(email::text))=(...)" returns "email"
+func keyColumns(detail string) []string {
+	matches := keyDetailRegexp.FindStringSubmatch(detail)
+	if len(matches) < 2 {
+		return nil
+	}
+
+	columns := []string{}
+	for _, part := range splitColumns(matches[1]) {
+		// in the case of an expression we remove the function names
+		// and the casts
+		part = strings.Split(part, "::")[0]
+		if i := strings.LastIndex(part, "("); i >= 0 {
+			part = part[i+1:]
+		}
+		if name := identifierRegexp.FindString(strings.Trim(part, `" `)); name != "" {
+			columns = append(columns, name)
+		}
+	}
+	return columns
+}
+
+// splitColumns splits a list of columns on the commas that are not
+// inside parentheses
+func splitColumns(list string) []string {
+	parts := []string{}
+	depth := 0
+	start := 0
+	for i, c := range list {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(list[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, strings.TrimSpace(list[start:]))
+}
+
+// checkConstraintColumn guesses the column of a check constraint using the
+// Postgres naming convention: {table}_{column}_check
+func checkConstraintColumn(table, constraint string) string {
+	if !strings.HasSuffix(constraint, "_check") {
+		return ""
+	}
+	column := strings.TrimSuffix(constraint, "_check")
+	if table != "" {
+		column = strings.TrimPrefix(column, table+"_")
+	}
+	return column
+}
+
+// firstField returns the first field of the list, or "unknown"
+func firstField(fields []string) string {
+	if len(fields) == 0 {
+		return "unknown"
+	}
+	return fields[0]
+}
@@ -0,0 +1,134 @@
+package apperror_test
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Nivl/go-rest-tools/types/apperror"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewFromSQL(t *testing.T) {
+	testCases := []struct {
+		description string
+		err         error
+		code        apperror.Code
+		field       string
+		fields      []string
+	}{
+		{"no rows", sql.ErrNoRows, apperror.NotFound, "", nil},
+		{
+			"unique",
+			&pq.Error{Code: apperror.ErrDup, Detail: "Key (email)=(a@b.c) already exists."},
+			apperror.AlreadyExists, "email", []string{"email"},
+		},
+		{
+			"composite unique",
+			&pq.Error{Code: apperror.ErrDup, Detail: "Key (user_id, name)=(xxx, Google) already exists."},
+			apperror.AlreadyExists, "user_id", []string{"user_id", "name"},
+		},
+		{
+			"unique on expression",
+			&pq.Error{Code: apperror.ErrDup, Detail: "Key (lower(email::text))=(a@b.c) already exists."},
+			apperror.AlreadyExists, "email", []string{"email"},
+		},
+		{
+			"missing foreign key",
+			&pq.Error{Code: apperror.ErrForeignKey, Detail: `Key (user_id)=(xxx) is not present in table "users".`},
+			apperror.NotFound, "user_id", []string{"user_id"},
+		},
+		{
+			"still referenced",
+			&pq.Error{Code: apperror.ErrForeignKey, Detail: `Key (id)=(xxx) is still referenced from table "sessions".`},
+			apperror.FailedPrecondition, "id", []string{"id"},
+		},
+		{
+			"not null",
+			&pq.Error{Code: apperror.ErrNotNull, Column: "name"},
+			apperror.InvalidArgument, "name", []string{"name"},
+		},
+		{
+			"check",
+			&pq.Error{Code: apperror.ErrCheck, Table: "users", Constraint: "users_age_check"},
+			apperror.InvalidArgument, "age", []string{"age"},
+		},
+		{
+			"too long",
+			&pq.Error{Code: apperror.ErrStringTooLong, Message: "value too long for type character varying(10)"},
+			apperror.InvalidArgument, "", nil,
+		},
+		{
+			"invalid uuid",
+			&pq.Error{Code: apperror.ErrInvalidTextRepresentation, Message: `invalid input syntax for type uuid: "nope"`},
+			apperror.InvalidArgument, "", nil,
+		},
+		{"serialization", &pq.Error{Code: apperror.ErrSerializationFailure}, apperror.Aborted, "", nil},
+		{"deadlock", &pq.Error{Code: apperror.ErrDeadlock}, apperror.Aborted, "", nil},
+		{"timeout", &pq.Error{Code: apperror.ErrQueryCanceled}, apperror.DeadlineExceeded, "", nil},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.description, func(t *testing.T) {
+			t.Parallel()
+
+			err := apperror.NewFromSQL(tc.err)
+			if pqErr, ok := tc.err.(*pq.Error); ok && pqErr.Message != "" {
+				assert.NotContains(t, err.Error(), pqErr.Message, "the message of the database should not be sent to the clients")
+			}
+			e, ok := err.(*apperror.AppError)
+			require.True(t, ok, "expected an AppError")
+			assert.Equal(t, tc.code, e.StatusCode())
+			assert.Equal(t, tc.field, e.Field())
+			assert.True(t, errors.Is(err, tc.err), "the origin should be kept")
+
+			fields := []string{}
+			for _, f := range e.FieldErrors() {
+				fields = append(fields, f.Field)
+			}
+			if tc.fields == nil {
+				assert.Empty(t, fields)
+			} else {
+				assert.Equal(t, tc.fields, fields)
+			}
+		})
+	}
+}
+
+func TestNewFromSQLUnknown(t *testing.T) {
+	t.Parallel()
+
+	err := &pq.Error{Code: "XX000"}
+	assert.Equal(t, err, apperror.NewFromSQL(err), "unknown errors should be returned as is")
+
+	plain := errors.New("nope")
+	assert.Equal(t, plain, apperror.NewFromSQL(plain))
+	assert.Nil(t, apperror.NewFromSQL(nil))
+}
+
+func TestNewFromSQLCheck(t *testing.T) {
+	t.Parallel()
+
+	err := apperror.NewFromSQL(&pq.Error{Code: apperror.ErrCheck, Table: "items", Constraint: "items_price_check"})
+	e := apperror.Convert(err)
+	assert.Equal(t, apperror.ErrMsgInvalidValue, e.Error())
+	require.Len(t, e.FieldErrors(), 1)
+	assert.Equal(t, "price", e.FieldErrors()[0].Field)
+	assert.Equal(t, apperror.FieldCodeInvalid, e.FieldErrors()[0].Code)
+}
+
+func TestNewFromSQLWrapped(t *testing.T) {
+	t.Parallel()
+
+	err := apperror.NewFromSQL(fmt.Errorf("could not get the user: %w", sql.ErrNoRows))
+	assert.True(t, apperror.IsNotFound(err), "expected a NotFound error")
+
+	// the driver returns a *pq.Error
+	var pqErr error = &pq.Error{Code: apperror.ErrDup, Detail: "Key (email)=(a@b.c) already exists."}
+	err = apperror.NewFromSQL(fmt.Errorf("could not create the user: %w", pqErr))
+	assert.True(t, apperror.IsConflict(err), "expected a Conflict error")
+}